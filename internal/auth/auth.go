@@ -232,11 +232,12 @@ func (h *Handler) RequireAuth(next http.Handler) http.Handler {
 		if err != nil || user == nil {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized", "code": "unauthorized"})
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), UserContextKey, user)
+		ctx = db.WithActor(ctx, user.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,432 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Activity operations
+
+const activityColumns = `ac.id, ac.event_id, ac.title, ac.description, ac.location, ac.leader_attendee_id, a.name,
+	ac.start_time, ac.end_time, ac.capacity, ac.version, ac.created_at, ac.updated_at`
+
+const activityJoins = ` FROM activities ac LEFT JOIN attendees a ON ac.leader_attendee_id = a.id`
+
+func scanActivity(row pgx.Row, ac *models.Activity) error {
+	return row.Scan(&ac.ID, &ac.EventID, &ac.Title, &ac.Description, &ac.Location, &ac.LeaderAttendeeID,
+		&ac.LeaderName, &ac.StartTime, &ac.EndTime, &ac.Capacity, &ac.Version, &ac.CreatedAt, &ac.UpdatedAt)
+}
+
+const activitySignupColumns = `s.id, s.activity_id, s.attendee_id, a.name, s.people, s.created_at`
+
+func scanActivitySignup(row pgx.Row, s *models.ActivitySignup) error {
+	return row.Scan(&s.ID, &s.ActivityID, &s.AttendeeID, &s.AttendeeName, &s.People, &s.CreatedAt)
+}
+
+func getActivity(ctx context.Context, q querier, id string) (*models.Activity, error) {
+	var activity models.Activity
+	err := scanActivity(q.QueryRow(ctx, `SELECT `+activityColumns+activityJoins+` WHERE ac.id = $1`, id), &activity)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &activity, nil
+}
+
+func (db *DB) GetActivity(ctx context.Context, id string) (*models.Activity, error) {
+	return getActivity(ctx, db.pool, id)
+}
+
+func getActivitySignups(ctx context.Context, q querier, activityID string) ([]models.ActivitySignup, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+activitySignupColumns+` FROM activity_signups s JOIN attendees a ON s.attendee_id = a.id
+		 WHERE s.activity_id = $1 ORDER BY s.created_at ASC`, activityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	signups := []models.ActivitySignup{}
+	for rows.Next() {
+		var s models.ActivitySignup
+		if err := scanActivitySignup(rows, &s); err != nil {
+			return nil, err
+		}
+		signups = append(signups, s)
+	}
+	return signups, rows.Err()
+}
+
+func getActivitySignup(ctx context.Context, q querier, id string) (*models.ActivitySignup, error) {
+	var signup models.ActivitySignup
+	err := scanActivitySignup(q.QueryRow(ctx,
+		`SELECT `+activitySignupColumns+` FROM activity_signups s JOIN attendees a ON s.attendee_id = a.id
+		 WHERE s.id = $1`, id,
+	), &signup)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &signup, nil
+}
+
+func signedUp(signups []models.ActivitySignup) int {
+	people := 0
+	for _, s := range signups {
+		people += s.People
+	}
+	return people
+}
+
+// mealOverlaps returns the dated meals served while the activity is going
+// on. Meals without a serving window ("other") aren't counted.
+func mealOverlaps(activity models.Activity, meals []models.Meal, loc *time.Location) []models.MealOverlap {
+	overlaps := []models.MealOverlap{}
+	for _, m := range meals {
+		if m.MealDate == nil {
+			continue
+		}
+		if _, ok := mealWindows[m.MealType]; !ok {
+			continue
+		}
+		day, err := time.ParseInLocation(dateLayout, *m.MealDate, loc)
+		if err != nil {
+			continue
+		}
+		start, end := mealWindow(day, m.MealType)
+		if start.Before(activity.EndTime) && end.After(activity.StartTime) {
+			overlaps = append(overlaps, models.MealOverlap{
+				MealID: m.ID, MealName: m.Name, MealType: m.MealType, Start: start, End: end,
+			})
+		}
+	}
+	return overlaps
+}
+
+func withActivitySignups(activity models.Activity, signups []models.ActivitySignup, meals []models.Meal, loc *time.Location) models.ActivityWithSignups {
+	result := models.ActivityWithSignups{
+		Activity:     activity,
+		Signups:      signups,
+		SignedUp:     signedUp(signups),
+		MealOverlaps: mealOverlaps(activity, meals, loc),
+	}
+	if activity.Capacity != nil {
+		left := max(*activity.Capacity-result.SignedUp, 0)
+		result.SpotsLeft = &left
+	}
+	return result
+}
+
+// GetActivityWithSignups returns an activity with its signups and the meals
+// it overlaps
+func (db *DB) GetActivityWithSignups(ctx context.Context, id string) (*models.ActivityWithSignups, error) {
+	activity, err := db.GetActivity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return db.activityWithSignups(ctx, *activity)
+}
+
+func (db *DB) activityWithSignups(ctx context.Context, activity models.Activity) (*models.ActivityWithSignups, error) {
+	event, err := db.GetEvent(ctx, activity.EventID)
+	if err != nil {
+		return nil, err
+	}
+	meals, err := db.GetMealsByEvent(ctx, activity.EventID)
+	if err != nil {
+		return nil, err
+	}
+	signups, err := getActivitySignups(ctx, db.pool, activity.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := withActivitySignups(activity, signups, meals, EventLocation(event))
+	return &result, nil
+}
+
+// GetActivitiesByEvent returns an event's activities in the order they start
+func (db *DB) GetActivitiesByEvent(ctx context.Context, eventID string) ([]models.ActivityWithSignups, error) {
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	meals, err := db.GetMealsByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+activityColumns+activityJoins+` WHERE ac.event_id = $1 ORDER BY ac.start_time ASC, ac.title ASC`,
+		eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []models.Activity
+	for rows.Next() {
+		var ac models.Activity
+		if err := scanActivity(rows, &ac); err != nil {
+			return nil, err
+		}
+		activities = append(activities, ac)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]models.ActivityWithSignups, len(activities))
+	for i, activity := range activities {
+		signups, err := getActivitySignups(ctx, db.pool, activity.ID)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = withActivitySignups(activity, signups, meals, EventLocation(event))
+	}
+	return result, nil
+}
+
+func (db *DB) CreateActivity(ctx context.Context, eventID string, req models.CreateActivityRequest) (*models.ActivityWithSignups, error) {
+	activity := &models.Activity{
+		ID:               uuid.New().String(),
+		EventID:          eventID,
+		Title:            req.Title,
+		Description:      req.Description,
+		Location:         req.Location,
+		LeaderAttendeeID: req.LeaderAttendeeID,
+		StartTime:        req.StartTime,
+		EndTime:          req.EndTime,
+		Capacity:         req.Capacity,
+		Version:          1,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if activity.LeaderAttendeeID != nil {
+			if err := checkAttendeeInEvent(ctx, tx, *activity.LeaderAttendeeID, eventID); err != nil {
+				return err
+			}
+			activity.LeaderName = attendeeName(ctx, tx, activity.LeaderAttendeeID)
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO activities (id, event_id, title, description, location, leader_attendee_id, start_time, end_time,
+			 capacity, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			activity.ID, activity.EventID, activity.Title, activity.Description, activity.Location,
+			activity.LeaderAttendeeID, activity.StartTime, activity.EndTime, activity.Capacity,
+			activity.CreatedAt, activity.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "activity", EntityID: activity.ID, EventID: &eventID, After: activity,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.activityWithSignups(ctx, *activity)
+}
+
+// UpdateActivity changes an activity. It returns ErrOverCapacity if the new
+// capacity is below the number of people already signed up.
+func (db *DB) UpdateActivity(ctx context.Context, id string, req models.UpdateActivityRequest, expectedVersion *int) (*models.ActivityWithSignups, error) {
+	var activity *models.Activity
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockActivity(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		activity = &updated
+		if req.Title != nil {
+			activity.Title = *req.Title
+		}
+		if req.Description != nil {
+			activity.Description = *req.Description
+		}
+		if req.Location != nil {
+			activity.Location = *req.Location
+		}
+		if req.LeaderAttendeeID != nil {
+			if *req.LeaderAttendeeID == "" {
+				activity.LeaderAttendeeID = nil
+				activity.LeaderName = nil
+			} else {
+				if err := checkAttendeeInEvent(ctx, tx, *req.LeaderAttendeeID, activity.EventID); err != nil {
+					return err
+				}
+				activity.LeaderAttendeeID = req.LeaderAttendeeID
+				activity.LeaderName = attendeeName(ctx, tx, req.LeaderAttendeeID)
+			}
+		}
+		if req.StartTime != nil {
+			activity.StartTime = *req.StartTime
+		}
+		if req.EndTime != nil {
+			activity.EndTime = *req.EndTime
+		}
+		if req.Capacity != nil {
+			if *req.Capacity == 0 {
+				activity.Capacity = nil
+			} else {
+				signups, err := getActivitySignups(ctx, tx, id)
+				if err != nil {
+					return err
+				}
+				if *req.Capacity < signedUp(signups) {
+					return ErrOverCapacity
+				}
+				activity.Capacity = req.Capacity
+			}
+		}
+		activity.UpdatedAt = time.Now()
+		activity.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE activities SET title=$1, description=$2, location=$3, leader_attendee_id=$4, start_time=$5,
+			 end_time=$6, capacity=$7, updated_at=$8, version=$9
+			 WHERE id=$10 AND version=$11`,
+			activity.Title, activity.Description, activity.Location, activity.LeaderAttendeeID, activity.StartTime,
+			activity.EndTime, activity.Capacity, activity.UpdatedAt, activity.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "activity", EntityID: id, EventID: &activity.EventID,
+			Before: before, After: activity,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.activityWithSignups(ctx, *activity)
+}
+
+// DeleteActivity removes an activity and its signups. It returns
+// ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteActivity(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getActivity(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM activities WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "activity", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
+
+// lockActivity locks an activity against concurrent signups and returns it
+func lockActivity(ctx context.Context, tx pgx.Tx, id string) (*models.Activity, error) {
+	if _, err := tx.Exec(ctx, `SELECT id FROM activities WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return nil, err
+	}
+	return getActivity(ctx, tx, id)
+}
+
+// SignUpForActivity adds an attendee and some of their party to an
+// activity. It returns ErrOverCapacity when there isn't room and
+// ErrConflict when the attendee is already signed up.
+func (db *DB) SignUpForActivity(ctx context.Context, activityID string, req models.ActivitySignupRequest) (*models.ActivitySignup, error) {
+	var signup *models.ActivitySignup
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		activity, err := lockActivity(ctx, tx, activityID)
+		if err != nil {
+			return err
+		}
+		attendee, err := getAttendee(ctx, tx, req.AttendeeID)
+		if errors.Is(err, ErrNotFound) || (err == nil && attendee.EventID != activity.EventID) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+
+		signup = &models.ActivitySignup{
+			ID:           uuid.New().String(),
+			ActivityID:   activityID,
+			AttendeeID:   attendee.ID,
+			AttendeeName: attendee.Name,
+			People:       max(partySize(*attendee), 1),
+			CreatedAt:    time.Now(),
+		}
+		if req.People != nil {
+			signup.People = *req.People
+		}
+
+		if activity.Capacity != nil {
+			signups, err := getActivitySignups(ctx, tx, activityID)
+			if err != nil {
+				return err
+			}
+			if signedUp(signups)+signup.People > *activity.Capacity {
+				return ErrOverCapacity
+			}
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO activity_signups (id, activity_id, attendee_id, people, created_at)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			signup.ID, signup.ActivityID, signup.AttendeeID, signup.People, signup.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "activity_signup", EntityID: signup.ID, EventID: &activity.EventID,
+			After: signup,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return signup, nil
+}
+
+// DeleteActivitySignup takes an attendee off an activity. It returns
+// ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteActivitySignup(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getActivitySignup(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		activity, err := getActivity(ctx, tx, before.ActivityID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM activity_signups WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "activity_signup", EntityID: id, EventID: &activity.EventID,
+			Before: before,
+		})
+	})
+}
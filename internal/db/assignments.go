@@ -0,0 +1,660 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Chore assignment. The engine hands each unassigned todo and uncovered
+// meal item to an attending attendee who is there when it's needed and
+// hasn't ruled it out, favoring whoever has done the least here and on
+// earlier trips. Proposals are computed fresh each time; only applied
+// assignments are stored, in the assignment log.
+
+// Chore kinds
+const (
+	ChoreTodo     = "todo"
+	ChoreMealItem = "meal_item"
+)
+
+// attendeeChores counts the chores attendee a took on at a.event_id: todos
+// and meal items assigned to them, and items their user signed up for
+const attendeeChores = `(
+	(SELECT COUNT(*) FROM todos t WHERE t.assigned_attendee_id = a.id AND t.deleted_at IS NULL)
+	+ (SELECT COUNT(*) FROM meal_items mi WHERE mi.assigned_attendee_id = a.id AND mi.deleted_at IS NULL)
+	+ (SELECT COUNT(*) FROM meal_signups s
+		JOIN users u ON s.user_id = u.id
+		JOIN meal_items mi ON s.meal_item_id = mi.id
+		JOIN meals m ON mi.meal_id = m.id
+		WHERE m.event_id = a.event_id AND a.email <> '' AND LOWER(u.email) = LOWER(a.email) AND mi.deleted_at IS NULL)
+)`
+
+// Chore preference operations
+
+func getChorePreferences(ctx context.Context, q querier, attendeeID string) (*models.ChorePreferences, error) {
+	prefs := &models.ChorePreferences{AttendeeID: attendeeID, Prefers: []string{}, Avoids: []string{}}
+	err := q.QueryRow(ctx,
+		`SELECT prefers, avoids, exempt FROM chore_preferences WHERE attendee_id = $1`, attendeeID,
+	).Scan(&prefs.Prefers, &prefs.Avoids, &prefs.Exempt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// GetChorePreferences returns an attendee's chore preferences, empty if
+// they haven't stated any
+func (db *DB) GetChorePreferences(ctx context.Context, attendeeID string) (*models.ChorePreferences, error) {
+	if _, err := getAttendee(ctx, db.pool, attendeeID); err != nil {
+		return nil, err
+	}
+	return getChorePreferences(ctx, db.pool, attendeeID)
+}
+
+// SetChorePreferences replaces an attendee's chore preferences
+func (db *DB) SetChorePreferences(ctx context.Context, attendeeID string, req models.UpdateChorePreferencesRequest) (*models.ChorePreferences, error) {
+	prefs := &models.ChorePreferences{
+		AttendeeID: attendeeID,
+		Prefers:    normalizeTags(req.Prefers),
+		Avoids:     normalizeTags(req.Avoids),
+		Exempt:     req.Exempt,
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		attendee, err := getAttendee(ctx, tx, attendeeID)
+		if err != nil {
+			return err
+		}
+		before, err := getChorePreferences(ctx, tx, attendeeID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO chore_preferences (attendee_id, prefers, avoids, exempt, updated_at)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (attendee_id) DO UPDATE SET
+			   prefers = EXCLUDED.prefers,
+			   avoids = EXCLUDED.avoids,
+			   exempt = EXCLUDED.exempt,
+			   updated_at = EXCLUDED.updated_at`,
+			attendeeID, prefs.Prefers, prefs.Avoids, prefs.Exempt, time.Now(),
+		); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "chore_preferences", EntityID: attendeeID, EventID: &attendee.EventID,
+			Before: before, After: prefs,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// chore is a todo or meal item waiting for someone
+type chore struct {
+	kind    string
+	id      string
+	title   string
+	texts   []string        // Lowercased text preferences are matched against
+	present map[string]bool // Attendees there when it's needed; nil for anyone
+	when    string          // Why being present matters, for the explanation
+}
+
+// matchChore returns the first keyword that appears in any of the chore's texts
+func matchChore(c chore, keywords []string) (string, bool) {
+	for _, kw := range keywords {
+		kw = strings.ToLower(strings.TrimSpace(kw))
+		if kw == "" {
+			continue
+		}
+		for _, text := range c.texts {
+			if strings.Contains(text, kw) {
+				return kw, true
+			}
+		}
+	}
+	return "", false
+}
+
+// choreCandidate is an attendee the engine can give chores to
+type choreCandidate struct {
+	attendee   models.Attendee
+	prefs      models.ChorePreferences
+	pastEvents int
+	pastChores int
+	current    int
+	proposed   int
+}
+
+func (c *choreCandidate) pastAverage() float64 {
+	if c.pastEvents == 0 {
+		return 0
+	}
+	return float64(c.pastChores) / float64(c.pastEvents)
+}
+
+// load is how much the candidate has on: chores here, plus what they
+// usually did on earlier trips
+func (c *choreCandidate) load() float64 {
+	return float64(c.current+c.proposed) + c.pastAverage()
+}
+
+// openChores returns an event's unassigned, incomplete todos followed by
+// its meal items that nobody is bringing or signed up for, with who is on
+// site for each
+func openChores(ctx context.Context, q querier, eventID string, hc *headcounter) ([]chore, error) {
+	open := false
+	todos, err := listTodos(ctx, q, eventID, models.TodoFilter{Completed: &open, AssigneeID: "none", Sort: "due"})
+	if err != nil {
+		return nil, err
+	}
+
+	chores := []chore{}
+	for _, t := range todos {
+		c := chore{
+			kind:  ChoreTodo,
+			id:    t.ID,
+			title: t.Title,
+			texts: []string{strings.ToLower(t.Title), t.Category, strings.ReplaceAll(t.Category, "_", " "), t.Checklist},
+		}
+		// Chores for before arrival can be done from anywhere
+		if t.DueAt != nil && t.Category != "before_arrival" {
+			c.present = map[string]bool{}
+			for _, a := range hc.attendees {
+				if !a.ArrivalTime.After(*t.DueAt) && !a.DepartureTime.Before(*t.DueAt) {
+					c.present[a.ID] = true
+				}
+			}
+			c.when = "on site at " + t.DueAt.In(hc.loc).Format("Mon 3:04 PM")
+		}
+		chores = append(chores, c)
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT mi.id, mi.name, m.id, m.name, m.meal_type, CASE WHEN m.meal_date IS NOT NULL THEN m.meal_date::text END
+		 FROM meal_items mi
+		 JOIN meals m ON mi.meal_id = m.id
+		 WHERE m.event_id = $1 AND m.deleted_at IS NULL AND mi.deleted_at IS NULL
+		   AND mi.assigned_attendee_id IS NULL AND NOT mi.host_buys
+		   AND NOT EXISTS (SELECT 1 FROM meal_signups s WHERE s.meal_item_id = mi.id)
+		 ORDER BY m.meal_date ASC NULLS LAST, m.created_at ASC, mi.sort_order ASC, mi.name ASC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c chore
+		var m models.Meal
+		if err := rows.Scan(&c.id, &c.title, &m.ID, &m.Name, &m.MealType, &m.MealDate); err != nil {
+			return nil, err
+		}
+		c.kind = ChoreMealItem
+		c.texts = []string{strings.ToLower(c.title), strings.ToLower(m.Name), m.MealType}
+		c.present = map[string]bool{}
+		for _, a := range hc.diners(m) {
+			c.present[a.ID] = true
+		}
+		c.when = "eating at " + m.Name
+		chores = append(chores, c)
+	}
+	return chores, rows.Err()
+}
+
+// choreCandidates returns the event's attending attendees with their
+// preferences and workload. Earlier events are matched by email.
+func choreCandidates(ctx context.Context, q querier, event *models.Event, hc *headcounter) ([]*choreCandidate, error) {
+	candidates := []*choreCandidate{}
+	byID := map[string]*choreCandidate{}
+	ids := []string{}
+	emails := []string{}
+	for _, a := range hc.attendees {
+		c := &choreCandidate{
+			attendee: a,
+			prefs:    models.ChorePreferences{AttendeeID: a.ID, Prefers: []string{}, Avoids: []string{}},
+		}
+		candidates = append(candidates, c)
+		byID[a.ID] = c
+		ids = append(ids, a.ID)
+		if a.Email != "" {
+			emails = append(emails, strings.ToLower(a.Email))
+		}
+	}
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT attendee_id, prefers, avoids, exempt FROM chore_preferences WHERE attendee_id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p models.ChorePreferences
+		if err := rows.Scan(&p.AttendeeID, &p.Prefers, &p.Avoids, &p.Exempt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byID[p.AttendeeID].prefs = p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(ctx,
+		`SELECT a.id, `+attendeeChores+` FROM attendees a WHERE a.id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byID[id].current = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(emails) == 0 {
+		return candidates, nil
+	}
+	rows, err = q.Query(ctx,
+		`SELECT LOWER(a.email), COUNT(*), COALESCE(SUM(`+attendeeChores+`), 0)::int
+		 FROM attendees a JOIN events e ON a.event_id = e.id
+		 WHERE LOWER(a.email) = ANY($1) AND a.status = 'attending'
+		   AND e.deleted_at IS NULL AND e.id <> $2 AND e.start_time < $3
+		 GROUP BY LOWER(a.email)`, emails, event.ID, event.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	past := map[string][2]int{}
+	for rows.Next() {
+		var email string
+		var events, chores int
+		if err := rows.Scan(&email, &events, &chores); err != nil {
+			return nil, err
+		}
+		past[email] = [2]int{events, chores}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		if p, ok := past[strings.ToLower(c.attendee.Email)]; ok && c.attendee.Email != "" {
+			c.pastEvents, c.pastChores = p[0], p[1]
+		}
+	}
+	return candidates, nil
+}
+
+// proposeAssignments suggests who should take each unassigned todo and
+// uncovered meal item of an event. The most constrained chores are handed
+// out first; each goes to the available attendee with the lightest load,
+// with a stated preference counting as one chore less.
+func proposeAssignments(ctx context.Context, q querier, eventID string) (*models.AssignmentProposal, error) {
+	event, err := getEvent(ctx, q, eventID)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := newHeadcounter(ctx, q, eventID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := choreCandidates(ctx, q, event, hc)
+	if err != nil {
+		return nil, err
+	}
+	chores, err := openChores(ctx, q, eventID, hc)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := &models.AssignmentProposal{
+		EventID:     eventID,
+		Assignments: []models.ProposedAssignment{},
+		Unassigned:  []models.UnassignedChore{},
+		Workload:    []models.AttendeeWorkload{},
+	}
+
+	// Work out who could take each chore, and why nobody can
+	eligible := make([][]*choreCandidate, len(chores))
+	reasons := make([]string, len(chores))
+	for i, c := range chores {
+		willing, present := 0, 0
+		for _, cand := range candidates {
+			if cand.prefs.Exempt {
+				continue
+			}
+			willing++
+			if c.present != nil && !c.present[cand.attendee.ID] {
+				continue
+			}
+			present++
+			if _, avoids := matchChore(c, cand.prefs.Avoids); avoids {
+				continue
+			}
+			eligible[i] = append(eligible[i], cand)
+		}
+		switch {
+		case willing == 0:
+			reasons[i] = "Nobody attending is taking chores"
+		case present == 0:
+			reasons[i] = "Nobody attending is there when it's needed"
+		default:
+			reasons[i] = "Everyone there has asked not to do it"
+		}
+	}
+
+	order := make([]int, len(chores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(x, y int) bool {
+		return len(eligible[order[x]]) < len(eligible[order[y]])
+	})
+
+	for _, i := range order {
+		c := chores[i]
+		if len(eligible[i]) == 0 {
+			proposal.Unassigned = append(proposal.Unassigned, models.UnassignedChore{
+				Kind: c.kind, ID: c.id, Title: c.title, Reason: reasons[i],
+			})
+			continue
+		}
+
+		var best *choreCandidate
+		var bestScore float64
+		var bestLiked string
+		lightest := eligible[i][0].load()
+		for _, cand := range eligible[i] {
+			lightest = min(lightest, cand.load())
+			score := cand.load()
+			liked, ok := matchChore(c, cand.prefs.Prefers)
+			if ok {
+				score--
+			}
+			if best == nil || score < bestScore ||
+				(score == bestScore && strings.ToLower(cand.attendee.Name) < strings.ToLower(best.attendee.Name)) {
+				best, bestScore, bestLiked = cand, score, liked
+			}
+		}
+
+		proposal.Assignments = append(proposal.Assignments, models.ProposedAssignment{
+			Kind:         c.kind,
+			ID:           c.id,
+			Title:        c.title,
+			AttendeeID:   best.attendee.ID,
+			AttendeeName: best.attendee.Name,
+			Reason:       explainAssignment(c, best, bestLiked, best.load() == lightest, len(eligible[i])),
+		})
+		best.proposed++
+	}
+
+	for _, cand := range candidates {
+		proposal.Workload = append(proposal.Workload, models.AttendeeWorkload{
+			AttendeeID:   cand.attendee.ID,
+			AttendeeName: cand.attendee.Name,
+			PastEvents:   cand.pastEvents,
+			PastAverage:  cand.pastAverage(),
+			Current:      cand.current,
+			Proposed:     cand.proposed,
+		})
+	}
+	return proposal, nil
+}
+
+func (db *DB) ProposeAssignments(ctx context.Context, eventID string) (*models.AssignmentProposal, error) {
+	return proposeAssignments(ctx, db.pool, eventID)
+}
+
+// explainAssignment says in a sentence why a chore went to cand
+func explainAssignment(c chore, cand *choreCandidate, liked string, lightest bool, available int) string {
+	done := cand.current + cand.proposed
+	noun := "chores"
+	if done == 1 {
+		noun = "chore"
+	}
+	reason := fmt.Sprintf("Has %d %s here and averaged %.1f per earlier trip", done, noun, cand.pastAverage())
+	switch {
+	case available == 1:
+		reason += ", and is the only one available"
+	case lightest:
+		reason += fmt.Sprintf(", the lightest load of the %d available", available)
+	default:
+		reason += fmt.Sprintf(", close to the lightest load of the %d available", available)
+	}
+	if liked != "" {
+		reason += fmt.Sprintf("; likes %q", liked)
+	}
+	if c.when != "" {
+		reason += "; " + c.when
+	}
+	return reason
+}
+
+// Assignment log operations
+
+const assignmentLogColumns = `l.id, l.event_id, l.kind, l.entity_id, l.title, l.attendee_id, l.attendee_name, l.reason,
+	l.applied_by, u.name, l.created_at`
+
+const assignmentLogJoins = ` FROM assignment_log l LEFT JOIN users u ON l.applied_by = u.id`
+
+func scanAssignmentLogEntry(row pgx.Row, e *models.AssignmentLogEntry) error {
+	return row.Scan(&e.ID, &e.EventID, &e.Kind, &e.EntityID, &e.Title, &e.AttendeeID, &e.AttendeeName, &e.Reason,
+		&e.AppliedBy, &e.AppliedByName, &e.CreatedAt)
+}
+
+// GetAssignmentLog returns the assignments applied for an event, newest first
+func (db *DB) GetAssignmentLog(ctx context.Context, eventID string) ([]models.AssignmentLogEntry, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+assignmentLogColumns+assignmentLogJoins+` WHERE l.event_id = $1 ORDER BY l.created_at DESC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AssignmentLogEntry{}
+	for rows.Next() {
+		var e models.AssignmentLogEntry
+		if err := scanAssignmentLogEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ApplyAssignments hands out the chosen chores of a proposal and logs the
+// engine's reason for each. The proposal is worked out again first, and a
+// choice is skipped unless the engine still gives that chore to that
+// attendee, so chores taken, finished or removed in the meantime are left
+// alone and the log only ever holds the engine's own explanations.
+func (db *DB) ApplyAssignments(ctx context.Context, eventID string, req models.ApplyAssignmentsRequest) (*models.AssignmentResult, error) {
+	result := &models.AssignmentResult{Applied: []models.AssignmentLogEntry{}, Skipped: []models.ProposedAssignment{}}
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		// One apply at a time per event, so the proposal can't go stale
+		// while it's being applied
+		if _, err := tx.Exec(ctx,
+			`SELECT pg_advisory_xact_lock(hashtext('assignments:' || $1))`, eventID,
+		); err != nil {
+			return err
+		}
+		fresh, err := proposeAssignments(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		proposed := make(map[string]models.ProposedAssignment, len(fresh.Assignments))
+		for _, p := range fresh.Assignments {
+			proposed[p.Kind+":"+p.ID] = p
+		}
+
+		for _, a := range req.Assignments {
+			p, ok := proposed[a.Kind+":"+a.ID]
+			if !ok || p.AttendeeID != a.AttendeeID {
+				result.Skipped = append(result.Skipped, a)
+				continue
+			}
+
+			attendee, err := getAttendee(ctx, tx, p.AttendeeID)
+			if errors.Is(err, ErrNotFound) {
+				result.Skipped = append(result.Skipped, a)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if attendee.EventID != eventID || attendee.Status != "attending" {
+				result.Skipped = append(result.Skipped, a)
+				continue
+			}
+
+			var title string
+			var applied bool
+			switch a.Kind {
+			case ChoreTodo:
+				title, applied, err = db.assignTodo(ctx, tx, eventID, a.ID, attendee)
+			case ChoreMealItem:
+				title, applied, err = db.assignMealItem(ctx, tx, eventID, a.ID, attendee)
+			}
+			if err != nil {
+				return err
+			}
+			if !applied {
+				result.Skipped = append(result.Skipped, a)
+				continue
+			}
+
+			entry := models.AssignmentLogEntry{
+				ID:           uuid.New().String(),
+				EventID:      eventID,
+				Kind:         a.Kind,
+				EntityID:     a.ID,
+				Title:        title,
+				AttendeeID:   &attendee.ID,
+				AttendeeName: attendee.Name,
+				Reason:       p.Reason,
+				AppliedBy:    actorFromContext(ctx),
+				CreatedAt:    time.Now(),
+			}
+			entry.AppliedByName = userName(ctx, tx, entry.AppliedBy)
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO assignment_log (id, event_id, kind, entity_id, title, attendee_id, attendee_name, reason,
+				 applied_by, created_at)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+				entry.ID, entry.EventID, entry.Kind, entry.EntityID, entry.Title, entry.AttendeeID, entry.AttendeeName,
+				entry.Reason, entry.AppliedBy, entry.CreatedAt,
+			); err != nil {
+				return err
+			}
+			result.Applied = append(result.Applied, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// assignTodo gives an open, unassigned todo of the event to attendee,
+// reporting false if it's no longer up for grabs
+func (db *DB) assignTodo(ctx context.Context, tx pgx.Tx, eventID, todoID string, attendee *models.Attendee) (string, bool, error) {
+	// Lock the todo so a concurrent edit can't fail the whole batch
+	if _, err := tx.Exec(ctx, `SELECT id FROM todos WHERE id = $1 FOR UPDATE`, todoID); err != nil {
+		return "", false, err
+	}
+	before, err := getTodo(ctx, tx, todoID)
+	if errors.Is(err, ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if before.EventID != eventID || before.Completed || before.AssignedAttendeeID != nil {
+		return "", false, nil
+	}
+
+	todo := *before
+	todo.AssignedAttendeeID = &attendee.ID
+	todo.AssignedAttendeeName = &attendee.Name
+	todo.UpdatedAt = time.Now()
+	todo.Version = before.Version + 1
+	if err := casResult(tx.Exec(ctx,
+		`UPDATE todos SET assigned_attendee_id=$1, updated_at=$2, version=$3 WHERE id=$4 AND version=$5`,
+		todo.AssignedAttendeeID, todo.UpdatedAt, todo.Version, todoID, before.Version,
+	)); err != nil {
+		return "", false, err
+	}
+
+	err = db.recordAudit(ctx, tx, auditRecord{
+		Action: AuditUpdate, EntityType: "todo", EntityID: todoID, EventID: &eventID, Before: before, After: &todo,
+	})
+	return todo.Title, err == nil, err
+}
+
+// assignMealItem gives an uncovered meal item of the event to attendee,
+// reporting false if it's no longer up for grabs
+func (db *DB) assignMealItem(ctx context.Context, tx pgx.Tx, eventID, itemID string, attendee *models.Attendee) (string, bool, error) {
+	// Lock the item against concurrent edits and signups
+	if _, err := tx.Exec(ctx, `SELECT id FROM meal_items WHERE id = $1 FOR UPDATE`, itemID); err != nil {
+		return "", false, err
+	}
+	before, err := getMealItem(ctx, tx, itemID)
+	if errors.Is(err, ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	itemEventID, err := eventIDForMealItem(ctx, tx, itemID)
+	if err != nil {
+		return "", false, err
+	}
+	var signups int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM meal_signups WHERE meal_item_id = $1`, itemID).Scan(&signups); err != nil {
+		return "", false, err
+	}
+	if *itemEventID != eventID || before.AssignedAttendeeID != nil || before.HostBuys || signups > 0 {
+		return "", false, nil
+	}
+
+	item := *before
+	item.AssignedAttendeeID = &attendee.ID
+	item.AssignedAttendeeName = &attendee.Name
+	item.UpdatedAt = time.Now()
+	item.Version = before.Version + 1
+	if err := casResult(tx.Exec(ctx,
+		`UPDATE meal_items SET assigned_attendee_id=$1, updated_at=$2, version=$3 WHERE id=$4 AND version=$5`,
+		item.AssignedAttendeeID, item.UpdatedAt, item.Version, itemID, before.Version,
+	)); err != nil {
+		return "", false, err
+	}
+
+	err = db.recordAudit(ctx, tx, auditRecord{
+		Action: AuditUpdate, EntityType: "meal_item", EntityID: itemID, EventID: &eventID, Before: before, After: &item,
+	})
+	return item.Name, err == nil, err
+}
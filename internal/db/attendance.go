@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Meal attendance answers
+const (
+	AttendanceIn      = "in"
+	AttendanceOut     = "out"
+	AttendanceUnknown = "unknown"
+)
+
+// GetAttendeeByEmail finds the attendee record for an email within an
+// event, ignoring case
+func (db *DB) GetAttendeeByEmail(ctx context.Context, eventID, email string) (*models.Attendee, error) {
+	var attendee models.Attendee
+	err := scanAttendee(db.pool.QueryRow(ctx,
+		`SELECT `+attendeeColumns+` FROM attendees WHERE event_id = $1 AND LOWER(email) = LOWER($2)
+		 ORDER BY created_at ASC LIMIT 1`, eventID, email,
+	), &attendee)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &attendee, nil
+}
+
+// SetMealAttendance records the same answer for each attendee. The meal
+// and attendees must all belong to eventID.
+func (db *DB) SetMealAttendance(ctx context.Context, eventID, mealID string, attendeeIDs []string, status string) ([]models.MealAttendance, error) {
+	var result []models.MealAttendance
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		meal, err := getMeal(ctx, tx, mealID)
+		if err != nil {
+			return err
+		}
+		if meal.EventID != eventID {
+			return ErrNotFound
+		}
+
+		for _, attendeeID := range attendeeIDs {
+			attendee, err := getAttendee(ctx, tx, attendeeID)
+			if err != nil {
+				return err
+			}
+			if attendee.EventID != meal.EventID {
+				return ErrNotFound
+			}
+
+			var before *models.MealAttendance
+			var existing models.MealAttendance
+			err = tx.QueryRow(ctx,
+				`SELECT id, meal_id, attendee_id, status, updated_at
+				 FROM meal_attendance WHERE meal_id = $1 AND attendee_id = $2`, mealID, attendeeID,
+			).Scan(&existing.ID, &existing.MealID, &existing.AttendeeID, &existing.Status, &existing.UpdatedAt)
+			if err == nil {
+				existing.AttendeeName = attendee.Name
+				before = &existing
+			} else if !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+
+			after := models.MealAttendance{
+				ID:           uuid.New().String(),
+				MealID:       mealID,
+				AttendeeID:   attendeeID,
+				AttendeeName: attendee.Name,
+				Status:       status,
+				UpdatedAt:    time.Now(),
+			}
+			err = tx.QueryRow(ctx,
+				`INSERT INTO meal_attendance (id, meal_id, attendee_id, status, updated_at)
+				 VALUES ($1, $2, $3, $4, $5)
+				 ON CONFLICT (meal_id, attendee_id) DO UPDATE SET status = EXCLUDED.status, updated_at = EXCLUDED.updated_at
+				 RETURNING id`,
+				after.ID, after.MealID, after.AttendeeID, after.Status, after.UpdatedAt,
+			).Scan(&after.ID)
+			if err != nil {
+				return err
+			}
+
+			rec := auditRecord{
+				Action: AuditCreate, EntityType: "meal_attendance", EntityID: after.ID, EventID: &meal.EventID, After: &after,
+			}
+			if before != nil {
+				rec.Action = AuditUpdate
+				rec.Before = before
+			}
+			if err := db.recordAudit(ctx, tx, rec); err != nil {
+				return err
+			}
+			result = append(result, after)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// getEventAttendance loads every attendance answer for an event's meals,
+// keyed by meal ID then attendee ID
+func getEventAttendance(ctx context.Context, q querier, eventID string) (map[string]map[string]string, error) {
+	rows, err := q.Query(ctx,
+		`SELECT ma.meal_id, ma.attendee_id, ma.status
+		 FROM meal_attendance ma
+		 JOIN meals m ON ma.meal_id = m.id
+		 WHERE m.event_id = $1`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendance := map[string]map[string]string{}
+	for rows.Next() {
+		var mealID, attendeeID, status string
+		if err := rows.Scan(&mealID, &attendeeID, &status); err != nil {
+			return nil, err
+		}
+		if attendance[mealID] == nil {
+			attendance[mealID] = map[string]string{}
+		}
+		attendance[mealID][attendeeID] = status
+	}
+
+	return attendance, rows.Err()
+}
+
+// GetMealAttendance lists every attendee's answer for a meal along with the
+// ones expected on site who haven't answered yet
+func (db *DB) GetMealAttendance(ctx context.Context, mealID string) (*models.MealAttendanceSummary, error) {
+	meal, err := db.GetMeal(ctx, mealID)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := newHeadcounter(ctx, db.pool, meal.EventID)
+	if err != nil {
+		return nil, err
+	}
+	attendees, err := db.GetAttendeesByEvent(ctx, meal.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.MealAttendanceSummary{
+		MealID:            mealID,
+		ExpectedHeadcount: hc.meal(*meal),
+		Counts:            hc.attendanceCounts(*meal),
+		Attendees:         []models.MealAttendance{},
+		Unanswered:        []models.Attendee{},
+	}
+
+	answers := hc.attendance[mealID]
+	for _, a := range attendees {
+		status, answered := answers[a.ID]
+		if !answered || status == AttendanceUnknown {
+			status = AttendanceUnknown
+		}
+		summary.Attendees = append(summary.Attendees, models.MealAttendance{
+			MealID:       mealID,
+			AttendeeID:   a.ID,
+			AttendeeName: a.Name,
+			Status:       status,
+		})
+	}
+	for _, a := range hc.expected(*meal) {
+		if status := answers[a.ID]; status != AttendanceIn && status != AttendanceOut {
+			summary.Unanswered = append(summary.Unanswered, a)
+		}
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"farm-time/internal/models"
+)
+
+// querier is satisfied by both the pool and a transaction, so reads can run
+// inside the same transaction as the write they support.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// withTx runs fn inside a transaction, committing if it returns nil.
+// Errors are translated by mapError.
+func (db *DB) withTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return mapError(err)
+	}
+	return mapError(tx.Commit(ctx))
+}
+
+type actorContextKey struct{}
+
+// WithActor records the user performing mutations made with the returned context
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, userID)
+}
+
+func actorFromContext(ctx context.Context) *string {
+	userID, ok := ctx.Value(actorContextKey{}).(string)
+	if !ok || userID == "" {
+		return nil
+	}
+	return &userID
+}
+
+// Audit actions
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// auditRecord describes a single mutation to be written to the audit log
+type auditRecord struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	EventID    *string
+	Before     any
+	After      any
+}
+
+// recordAudit appends an entry to the audit log using the caller's transaction
+func (db *DB) recordAudit(ctx context.Context, q querier, rec auditRecord) error {
+	before, err := marshalAuditState(rec.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalAuditState(rec.After)
+	if err != nil {
+		return err
+	}
+	changes, err := diffAuditState(before, after)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(ctx,
+		`INSERT INTO audit_log (id, actor_user_id, action, entity_type, entity_id, event_id, before, after, changes, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8::jsonb, $9::jsonb, $10)`,
+		uuid.New().String(), actorFromContext(ctx), rec.Action, rec.EntityType, rec.EntityID,
+		rec.EventID, before, after, changes, time.Now(),
+	)
+	return err
+}
+
+func marshalAuditState(v any) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	s := string(b)
+	return &s, nil
+}
+
+// diffAuditState returns the top-level fields that differ between before and
+// after as {"field": {"before": ..., "after": ...}}
+func diffAuditState(before, after *string) (*string, error) {
+	var b, a map[string]json.RawMessage
+	if before != nil {
+		if err := json.Unmarshal([]byte(*before), &b); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal([]byte(*after), &a); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string]models.AuditFieldChange{}
+	for key, bv := range b {
+		av, ok := a[key]
+		if !ok || !bytes.Equal(bv, av) {
+			changes[key] = models.AuditFieldChange{Before: bv, After: av}
+		}
+	}
+	for key, av := range a {
+		if _, ok := b[key]; !ok {
+			changes[key] = models.AuditFieldChange{After: av}
+		}
+	}
+
+	return marshalAuditState(changes)
+}
+
+// eventIDForMeal looks up the event owning a meal
+func eventIDForMeal(ctx context.Context, q querier, mealID string) (*string, error) {
+	var eventID string
+	if err := q.QueryRow(ctx, `SELECT event_id FROM meals WHERE id = $1`, mealID).Scan(&eventID); err != nil {
+		return nil, err
+	}
+	return &eventID, nil
+}
+
+// eventIDForMealItem looks up the event owning a meal item
+func eventIDForMealItem(ctx context.Context, q querier, itemID string) (*string, error) {
+	var eventID string
+	err := q.QueryRow(ctx,
+		`SELECT m.event_id FROM meal_items mi JOIN meals m ON mi.meal_id = m.id WHERE mi.id = $1`, itemID,
+	).Scan(&eventID)
+	if err != nil {
+		return nil, err
+	}
+	return &eventID, nil
+}
+
+// Audit queries
+
+func (db *DB) ListAuditLog(ctx context.Context, filter models.AuditLogFilter) (*models.AuditLogPage, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.EventID != "" {
+		add("l.event_id = $%d", filter.EventID)
+	}
+	if filter.ActorUserID != "" {
+		add("l.actor_user_id = $%d", filter.ActorUserID)
+	}
+	if filter.EntityType != "" {
+		add("l.entity_type = $%d", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		add("l.entity_id = $%d", filter.EntityID)
+	}
+	if filter.Action != "" {
+		add("l.action = $%d", filter.Action)
+	}
+	if filter.Since != nil {
+		add("l.created_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		add("l.created_at < $%d", *filter.Until)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	page := &models.AuditLogPage{
+		Entries: []models.AuditEntry{},
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	}
+
+	if err := db.pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM audit_log l `+where, args...,
+	).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	rows, err := db.pool.Query(ctx,
+		`SELECT l.id, l.actor_user_id, u.name, l.action, l.entity_type, l.entity_id, l.event_id,
+		 l.before::text, l.after::text, l.changes::text, l.created_at
+		 FROM audit_log l
+		 LEFT JOIN users u ON l.actor_user_id = u.id
+		 `+where+fmt.Sprintf(` ORDER BY l.created_at DESC, l.id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEntry
+		var before, after, changes []byte
+		if err := rows.Scan(&e.ID, &e.ActorUserID, &e.ActorName, &e.Action, &e.EntityType, &e.EntityID,
+			&e.EventID, &before, &after, &changes, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before = json.RawMessage(before)
+		e.After = json.RawMessage(after)
+		e.Changes = json.RawMessage(changes)
+		page.Entries = append(page.Entries, e)
+	}
+
+	return page, rows.Err()
+}
+
+// ChangeCursor is a position in a change feed: the transaction that wrote
+// an audit entry and the entry's order within it
+type ChangeCursor struct {
+	TxID int64
+	Seq  int64
+}
+
+func (c ChangeCursor) String() string {
+	return strconv.FormatInt(c.TxID, 10) + "." + strconv.FormatInt(c.Seq, 10)
+}
+
+// ParseChangeCursor reads a cursor written by ChangeCursor.String. The
+// empty string is the start of the feed.
+func ParseChangeCursor(s string) (ChangeCursor, error) {
+	if s == "" {
+		return ChangeCursor{}, nil
+	}
+	tx, seq, ok := strings.Cut(s, ".")
+	if !ok {
+		return ChangeCursor{}, fmt.Errorf("invalid change cursor %q", s)
+	}
+	var c ChangeCursor
+	var err error
+	if c.TxID, err = strconv.ParseInt(tx, 10, 64); err != nil || c.TxID < 0 {
+		return ChangeCursor{}, fmt.Errorf("invalid change cursor %q", s)
+	}
+	if c.Seq, err = strconv.ParseInt(seq, 10, 64); err != nil || c.Seq < 0 {
+		return ChangeCursor{}, fmt.Errorf("invalid change cursor %q", s)
+	}
+	return c, nil
+}
+
+// ListChanges returns an event's change feed: up to limit audit entries
+// recorded against it after the cursor, in the order they were written.
+//
+// Timestamps and sequence numbers are handed out before commit, so a slow
+// transaction can become visible after a reader has moved past its
+// position. To never skip one, the feed only goes as far as the oldest
+// transaction still running: entries from it and anything newer wait for
+// the next poll, and positions are ordered by transaction first.
+//
+// Entries carry no states or actor, since the full history is only for the
+// event's owner.
+func (db *DB) ListChanges(ctx context.Context, eventID string, after ChangeCursor, limit int) (*models.ChangeFeed, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT l.id, l.action, l.entity_type, l.entity_id, l.created_at, l.txid::text::bigint, l.seq
+		 FROM audit_log l
+		 WHERE l.event_id = $1
+		   AND l.txid < pg_snapshot_xmin(pg_current_snapshot())
+		   AND (l.txid, l.seq) > ($2::bigint::text::xid8, $3::bigint)
+		 ORDER BY l.txid ASC, l.seq ASC
+		 LIMIT $4`, eventID, after.TxID, after.Seq, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feed := &models.ChangeFeed{Changes: []models.Change{}, Cursor: after.String()}
+	for rows.Next() {
+		if len(feed.Changes) == limit {
+			feed.More = true
+			break
+		}
+		var c models.Change
+		var pos ChangeCursor
+		if err := rows.Scan(&c.ID, &c.Action, &c.EntityType, &c.EntityID, &c.CreatedAt, &pos.TxID, &pos.Seq); err != nil {
+			return nil, err
+		}
+		feed.Changes = append(feed.Changes, c)
+		feed.Cursor = pos.String()
+	}
+	return feed, rows.Err()
+}
@@ -0,0 +1,304 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Farm availability. An exclusive event claims the whole property, so no
+// other event may overlap it; ordinary events may overlap each other.
+
+// Booking request statuses
+const (
+	BookingPending  = "pending"
+	BookingApproved = "approved"
+	BookingDenied   = "denied"
+)
+
+// eventCalendarLock is the advisory lock key that serializes date checks,
+// so two overlapping exclusive events can't be saved at the same time
+const eventCalendarLock = 0x6661726d
+
+// eventConflicts returns the live events, other than skipID, that overlap
+// [start, end) where either side is exclusive
+func eventConflicts(ctx context.Context, q querier, start, end time.Time, exclusive bool, skipID string) ([]models.Event, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+eventColumns+` FROM events
+		 WHERE deleted_at IS NULL AND id <> $1 AND start_time < $3 AND end_time > $2 AND (exclusive OR $4)
+		 ORDER BY start_time ASC`,
+		skipID, start, end, exclusive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		var e models.Event
+		if err := scanEvent(rows, &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// EventConflicts lists the events that keep an event from having
+// [start, end), for explaining ErrDatesTaken
+func (db *DB) EventConflicts(ctx context.Context, start, end time.Time, exclusive bool, skipID string) ([]models.Event, error) {
+	return eventConflicts(ctx, db.pool, start, end, exclusive, skipID)
+}
+
+// checkEventDates returns ErrDatesTaken if the event would collide with an
+// exclusive event, or is exclusive and would collide with any event
+func checkEventDates(ctx context.Context, tx pgx.Tx, event *models.Event) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, eventCalendarLock); err != nil {
+		return err
+	}
+	conflicts, err := eventConflicts(ctx, tx, event.StartTime, event.EndTime, event.Exclusive, event.ID)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return ErrDatesTaken
+	}
+	return nil
+}
+
+// markOverlaps fills in each event's Overlaps. events must be sorted by
+// start time.
+func markOverlaps(events []models.Event) {
+	for i := range events {
+		for j := i + 1; j < len(events) && events[j].StartTime.Before(events[i].EndTime); j++ {
+			if events[j].EndTime.After(events[i].StartTime) {
+				events[i].Overlaps = append(events[i].Overlaps, events[j].ID)
+				events[j].Overlaps = append(events[j].Overlaps, events[i].ID)
+			}
+		}
+	}
+}
+
+// GetAvailability returns the events and pending booking requests that
+// overlap [from, until). A nil from or until leaves that end open.
+func (db *DB) GetAvailability(ctx context.Context, from, until *time.Time) (*models.Availability, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+eventColumns+` FROM events
+		 WHERE deleted_at IS NULL
+		   AND ($1::timestamptz IS NULL OR end_time > $1) AND ($2::timestamptz IS NULL OR start_time < $2)
+		 ORDER BY start_time ASC`, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	availability := &models.Availability{Events: []models.Event{}}
+	for rows.Next() {
+		var e models.Event
+		if err := scanEvent(rows, &e); err != nil {
+			return nil, err
+		}
+		availability.Events = append(availability.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	markOverlaps(availability.Events)
+
+	availability.BookingRequests, err = queryBookingRequests(ctx, db.pool,
+		`b.status = 'pending'
+		 AND ($1::timestamptz IS NULL OR b.end_time > $1) AND ($2::timestamptz IS NULL OR b.start_time < $2)`,
+		from, until)
+	if err != nil {
+		return nil, err
+	}
+	return availability, nil
+}
+
+// Booking request operations. Requests aren't tied to an event until
+// approved, so their audit entries have one only from then on.
+
+const bookingRequestColumns = `b.id, b.requested_by, u.name, b.title, b.description, b.start_time, b.end_time,
+	b.exclusive, b.status, b.event_id, b.review_note, b.reviewed_by, b.reviewed_at, b.created_at, b.updated_at`
+
+const bookingRequestJoins = ` FROM booking_requests b JOIN users u ON b.requested_by = u.id`
+
+func scanBookingRequest(row pgx.Row, b *models.BookingRequest) error {
+	return row.Scan(&b.ID, &b.RequestedBy, &b.RequesterName, &b.Title, &b.Description, &b.StartTime, &b.EndTime,
+		&b.Exclusive, &b.Status, &b.EventID, &b.ReviewNote, &b.ReviewedBy, &b.ReviewedAt, &b.CreatedAt, &b.UpdatedAt)
+}
+
+func getBookingRequest(ctx context.Context, q querier, id string) (*models.BookingRequest, error) {
+	var request models.BookingRequest
+	err := scanBookingRequest(q.QueryRow(ctx,
+		`SELECT `+bookingRequestColumns+bookingRequestJoins+` WHERE b.id = $1`, id,
+	), &request)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &request, nil
+}
+
+func (db *DB) GetBookingRequest(ctx context.Context, id string) (*models.BookingRequest, error) {
+	return getBookingRequest(ctx, db.pool, id)
+}
+
+func queryBookingRequests(ctx context.Context, q querier, where string, args ...any) ([]models.BookingRequest, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+bookingRequestColumns+bookingRequestJoins+` WHERE `+where+` ORDER BY b.start_time ASC, b.created_at ASC`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.BookingRequest{}
+	for rows.Next() {
+		var b models.BookingRequest
+		if err := scanBookingRequest(rows, &b); err != nil {
+			return nil, err
+		}
+		requests = append(requests, b)
+	}
+	return requests, rows.Err()
+}
+
+// ListBookingRequests returns booking requests by start date. An empty
+// userID or status matches every user or status.
+func (db *DB) ListBookingRequests(ctx context.Context, userID, status string) ([]models.BookingRequest, error) {
+	return queryBookingRequests(ctx, db.pool,
+		`($1 = '' OR b.requested_by = $1) AND ($2 = '' OR b.status = $2)`, userID, status)
+}
+
+// CreateBookingRequest files a request for the farm on behalf of the
+// current user. It returns ErrDatesTaken if the dates already clash with
+// an exclusive event.
+func (db *DB) CreateBookingRequest(ctx context.Context, req models.CreateBookingRequestRequest) (*models.BookingRequest, error) {
+	id := uuid.New().String()
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		conflicts, err := eventConflicts(ctx, tx, req.StartTime, req.EndTime, req.Exclusive, "")
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			return ErrDatesTaken
+		}
+
+		now := time.Now()
+		_, err = tx.Exec(ctx,
+			`INSERT INTO booking_requests (id, requested_by, title, description, start_time, end_time, exclusive,
+			 created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			id, actorFromContext(ctx), req.Title, req.Description, req.StartTime, req.EndTime, req.Exclusive, now, now,
+		)
+		if err != nil {
+			return err
+		}
+
+		request, err := getBookingRequest(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "booking_request", EntityID: id, After: request,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetBookingRequest(ctx, id)
+}
+
+// ReviewBookingRequest approves or denies a pending request. Approving it
+// creates the event, owned by the requester, and fails with ErrDatesTaken
+// if the dates have been claimed since. Requests that were already
+// reviewed return ErrConflict.
+func (db *DB) ReviewBookingRequest(ctx context.Context, id string, req models.ReviewBookingRequestRequest) (*models.BookingRequest, *models.Event, error) {
+	var request *models.BookingRequest
+	var event *models.Event
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT id FROM booking_requests WHERE id = $1 FOR UPDATE`, id); err != nil {
+			return err
+		}
+		before, err := getBookingRequest(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if before.Status != BookingPending {
+			return ErrConflict
+		}
+
+		updated := *before
+		request = &updated
+		now := time.Now()
+		request.Status = req.Status
+		request.ReviewNote = req.Note
+		request.ReviewedBy = actorFromContext(ctx)
+		request.ReviewedAt = &now
+		request.UpdatedAt = now
+
+		if req.Status == BookingApproved {
+			event = &models.Event{
+				ID:          uuid.New().String(),
+				Title:       request.Title,
+				Description: request.Description,
+				StartTime:   request.StartTime,
+				EndTime:     request.EndTime,
+				TimeZone:    DefaultTimeZone,
+				Exclusive:   request.Exclusive,
+				CreatedBy:   &request.RequestedBy,
+				Version:     1,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if err := db.insertEvent(ctx, tx, event); err != nil {
+				return err
+			}
+			request.EventID = &event.ID
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE booking_requests SET status = $1, event_id = $2, review_note = $3, reviewed_by = $4, reviewed_at = $5,
+			 updated_at = $6
+			 WHERE id = $7`,
+			request.Status, request.EventID, request.ReviewNote, request.ReviewedBy, request.ReviewedAt,
+			request.UpdatedAt, id,
+		); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "booking_request", EntityID: id, EventID: request.EventID,
+			Before: before, After: request,
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return request, event, nil
+}
+
+// DeleteBookingRequest withdraws a request. It returns ErrNotFound if there
+// was nothing to delete.
+func (db *DB) DeleteBookingRequest(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getBookingRequest(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM booking_requests WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "booking_request", EntityID: id, EventID: before.EventID, Before: before,
+		})
+	})
+}
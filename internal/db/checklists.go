@@ -0,0 +1,468 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Standing checklists. The farm keeps one opening and one closing routine;
+// each new event gets every item as a todo, and the todos keep a link to
+// their item so later edits can be pushed to upcoming events. Like rooms,
+// checklist items belong to the property, so their audit entries have no
+// event.
+
+// Checklist phases
+const (
+	ChecklistArrival   = "arrival"
+	ChecklistDeparture = "departure"
+)
+
+const checklistItemColumns = `id, phase, title, description, priority, position, version, created_at, updated_at`
+
+func scanChecklistItem(row pgx.Row, c *models.ChecklistItem) error {
+	return row.Scan(&c.ID, &c.Phase, &c.Title, &c.Description, &c.Priority, &c.Position, &c.Version, &c.CreatedAt,
+		&c.UpdatedAt)
+}
+
+func getChecklistItem(ctx context.Context, q querier, id string) (*models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	err := scanChecklistItem(q.QueryRow(ctx,
+		`SELECT `+checklistItemColumns+` FROM checklist_items WHERE id = $1`, id,
+	), &item)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &item, nil
+}
+
+func (db *DB) GetChecklistItem(ctx context.Context, id string) (*models.ChecklistItem, error) {
+	return getChecklistItem(ctx, db.pool, id)
+}
+
+func listChecklistItems(ctx context.Context, q querier) ([]models.ChecklistItem, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+checklistItemColumns+` FROM checklist_items ORDER BY phase ASC, position ASC, created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.ChecklistItem{}
+	for rows.Next() {
+		var c models.ChecklistItem
+		if err := scanChecklistItem(rows, &c); err != nil {
+			return nil, err
+		}
+		items = append(items, c)
+	}
+	return items, rows.Err()
+}
+
+// ListChecklistItems returns the arrival items, then the departure items,
+// each in order
+func (db *DB) ListChecklistItems(ctx context.Context) ([]models.ChecklistItem, error) {
+	return listChecklistItems(ctx, db.pool)
+}
+
+func (db *DB) CreateChecklistItem(ctx context.Context, req models.CreateChecklistItemRequest) (*models.ChecklistItem, error) {
+	item := &models.ChecklistItem{
+		ID:          uuid.New().String(),
+		Phase:       req.Phase,
+		Title:       req.Title,
+		Description: req.Description,
+		Priority:    req.Priority,
+		Version:     1,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if item.Priority == "" {
+		item.Priority = TodoPriorityNormal
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if req.Position != nil {
+			item.Position = *req.Position
+		} else if err := tx.QueryRow(ctx,
+			`SELECT COALESCE(MAX(position) + 1, 0) FROM checklist_items WHERE phase = $1`, item.Phase,
+		).Scan(&item.Position); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO checklist_items (id, phase, title, description, priority, position, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			item.ID, item.Phase, item.Title, item.Description, item.Priority, item.Position, item.CreatedAt,
+			item.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "checklist_item", EntityID: item.ID, After: item,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// UpdateChecklistItem changes a standing item. Events already planned keep
+// their todos as they were until PropagateChecklists is run.
+func (db *DB) UpdateChecklistItem(ctx context.Context, id string, req models.UpdateChecklistItemRequest, expectedVersion *int) (*models.ChecklistItem, error) {
+	var item *models.ChecklistItem
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getChecklistItem(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		item = &updated
+		if req.Phase != nil {
+			item.Phase = *req.Phase
+		}
+		if req.Title != nil {
+			item.Title = *req.Title
+		}
+		if req.Description != nil {
+			item.Description = *req.Description
+		}
+		if req.Priority != nil {
+			item.Priority = *req.Priority
+		}
+		if req.Position != nil {
+			item.Position = *req.Position
+		}
+		item.UpdatedAt = time.Now()
+		item.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE checklist_items SET phase=$1, title=$2, description=$3, priority=$4, position=$5, updated_at=$6,
+			 version=$7
+			 WHERE id=$8 AND version=$9`,
+			item.Phase, item.Title, item.Description, item.Priority, item.Position, item.UpdatedAt, item.Version,
+			id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "checklist_item", EntityID: id, Before: before, After: item,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// DeleteChecklistItem removes a standing item. Todos made from it stay
+// with their events, unlinked, until PropagateChecklists clears the open
+// ones from upcoming events. It returns ErrNotFound if there was nothing
+// to delete.
+func (db *DB) DeleteChecklistItem(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getChecklistItem(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM checklist_items WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "checklist_item", EntityID: id, Before: before,
+		})
+	})
+}
+
+// checklistTodo builds the todo an event gets for a checklist item.
+// Arrival chores are due when the event starts and follow its start;
+// departure chores are due when it ends.
+func checklistTodo(item models.ChecklistItem, event *models.Event) *models.Todo {
+	now := time.Now()
+	todo := &models.Todo{
+		ID:              uuid.New().String(),
+		EventID:         event.ID,
+		Title:           item.Title,
+		Description:     item.Description,
+		Priority:        item.Priority,
+		Subtasks:        []models.TodoSubtask{},
+		DependsOn:       []string{},
+		ChecklistItemID: &item.ID,
+		Checklist:       item.Phase,
+		Version:         1,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if item.Phase == ChecklistArrival {
+		offset := 0
+		todo.Category = "on_site"
+		todo.DueOffsetMinutes = &offset
+		todo.DueAt = relativeDue(event, offset)
+	} else {
+		end := event.EndTime
+		todo.Category = "closing_up"
+		todo.DueAt = &end
+	}
+	return todo
+}
+
+// attachChecklists gives a new event a todo for every checklist item
+func (db *DB) attachChecklists(ctx context.Context, tx pgx.Tx, event *models.Event) error {
+	items, err := listChecklistItems(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		todo := checklistTodo(item, event)
+		if err := insertTodo(ctx, tx, todo); err != nil {
+			return err
+		}
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "todo", EntityID: todo.ID, EventID: &event.ID, After: todo,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PropagateChecklists brings the checklist todos of events that haven't
+// started yet in line with the standing checklists: new items are added,
+// open todos take their item's current wording, and open todos whose item
+// was deleted go to the trash. Completed todos are left alone, as are todos
+// someone put in the trash and todos changed while this runs.
+func (db *DB) PropagateChecklists(ctx context.Context) (*models.ChecklistPropagation, error) {
+	result := &models.ChecklistPropagation{}
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		items, err := listChecklistItems(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx,
+			`SELECT `+eventColumns+` FROM events WHERE deleted_at IS NULL AND start_time > $1 ORDER BY start_time ASC`,
+			time.Now())
+		if err != nil {
+			return err
+		}
+		events := []models.Event{}
+		for rows.Next() {
+			var e models.Event
+			if err := scanEvent(rows, &e); err != nil {
+				rows.Close()
+				return err
+			}
+			events = append(events, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range events {
+			if err := db.propagateChecklists(ctx, tx, &events[i], items, result); err != nil {
+				return err
+			}
+			result.Events++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (db *DB) propagateChecklists(ctx context.Context, tx pgx.Tx, event *models.Event, items []models.ChecklistItem, result *models.ChecklistPropagation) error {
+	rows, err := tx.Query(ctx,
+		`SELECT `+todoColumns+todoJoins+` WHERE t.event_id = $1 AND t.checklist <> ''`, event.ID)
+	if err != nil {
+		return err
+	}
+	byItem := map[string]models.Todo{}
+	trashed := map[string]bool{} // Items whose todo someone deleted, which shouldn't come back
+	orphans := []models.Todo{}
+	for rows.Next() {
+		var t models.Todo
+		if err := scanTodo(rows, &t); err != nil {
+			rows.Close()
+			return err
+		}
+		if t.DeletedAt != nil {
+			if t.ChecklistItemID != nil {
+				trashed[*t.ChecklistItemID] = true
+			}
+		} else if t.ChecklistItemID != nil {
+			byItem[*t.ChecklistItemID] = t
+		} else if !t.Completed {
+			orphans = append(orphans, t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		existing, ok := byItem[item.ID]
+		if !ok && trashed[item.ID] {
+			continue
+		}
+		if !ok {
+			todo := checklistTodo(item, event)
+			if err := insertTodo(ctx, tx, todo); err != nil {
+				return err
+			}
+			if err := db.recordAudit(ctx, tx, auditRecord{
+				Action: AuditCreate, EntityType: "todo", EntityID: todo.ID, EventID: &event.ID, After: todo,
+			}); err != nil {
+				return err
+			}
+			result.Added++
+			continue
+		}
+		if existing.Completed {
+			continue
+		}
+
+		fresh := checklistTodo(item, event)
+		todo := existing
+		todo.Title = fresh.Title
+		todo.Description = fresh.Description
+		todo.Priority = fresh.Priority
+		if todo.Checklist != fresh.Checklist {
+			todo.Checklist = fresh.Checklist
+			todo.Category = fresh.Category
+			todo.DueAt = fresh.DueAt
+			todo.DueOffsetMinutes = fresh.DueOffsetMinutes
+		}
+		if todo.Title == existing.Title && todo.Description == existing.Description &&
+			todo.Priority == existing.Priority && todo.Checklist == existing.Checklist {
+			continue
+		}
+		todo.UpdatedAt = time.Now()
+		todo.Version = existing.Version + 1
+
+		tag, err := tx.Exec(ctx,
+			`UPDATE todos SET title=$1, description=$2, priority=$3, checklist=$4, category=$5, due_at=$6,
+			 due_offset_minutes=$7, updated_at=$8, version=$9
+			 WHERE id=$10 AND version=$11 AND deleted_at IS NULL`,
+			todo.Title, todo.Description, todo.Priority, todo.Checklist, todo.Category, todo.DueAt,
+			todo.DueOffsetMinutes, todo.UpdatedAt, todo.Version, todo.ID, existing.Version,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			result.Skipped++
+			continue
+		}
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "todo", EntityID: todo.ID, EventID: &event.ID, Before: existing, After: todo,
+		}); err != nil {
+			return err
+		}
+		result.Updated++
+	}
+
+	for _, orphan := range orphans {
+		tag, err := tx.Exec(ctx,
+			`UPDATE todos SET deleted_at = $1 WHERE id = $2 AND version = $3 AND deleted_at IS NULL`,
+			time.Now(), orphan.ID, orphan.Version)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			result.Skipped++
+			continue
+		}
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "todo", EntityID: orphan.ID, EventID: &event.ID, Before: orphan,
+		}); err != nil {
+			return err
+		}
+		result.Removed++
+	}
+	return nil
+}
+
+// GetChecklistHistory returns how the most recent events that have started
+// did with their standing checklists, newest first. phase limits it to
+// "arrival" or "departure"; empty means both.
+func (db *DB) GetChecklistHistory(ctx context.Context, phase string, limit int) ([]models.ChecklistRun, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT e.id, e.title, e.start_time, e.end_time
+		 FROM events e
+		 WHERE e.deleted_at IS NULL AND e.start_time <= $1
+		   AND EXISTS (
+			SELECT 1 FROM todos t
+			WHERE t.event_id = e.id AND t.deleted_at IS NULL AND t.checklist <> '' AND ($2 = '' OR t.checklist = $2)
+		   )
+		 ORDER BY e.start_time DESC
+		 LIMIT $3`, time.Now(), phase, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.ChecklistRun{}
+	index := map[string]int{}
+	eventIDs := []string{}
+	for rows.Next() {
+		var run models.ChecklistRun
+		if err := rows.Scan(&run.EventID, &run.EventTitle, &run.StartTime, &run.EndTime); err != nil {
+			return nil, err
+		}
+		run.Todos = []models.Todo{}
+		index[run.EventID] = len(runs)
+		eventIDs = append(eventIDs, run.EventID)
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return runs, nil
+	}
+
+	todoRows, err := db.pool.Query(ctx,
+		`SELECT `+todoColumns+todoJoins+`
+		 LEFT JOIN checklist_items ci ON t.checklist_item_id = ci.id
+		 WHERE t.event_id = ANY($1) AND t.deleted_at IS NULL AND t.checklist <> '' AND ($2 = '' OR t.checklist = $2)
+		 ORDER BY t.checklist ASC, ci.position ASC NULLS LAST, t.created_at ASC`, eventIDs, phase)
+	if err != nil {
+		return nil, err
+	}
+	defer todoRows.Close()
+
+	for todoRows.Next() {
+		var t models.Todo
+		if err := scanTodo(todoRows, &t); err != nil {
+			return nil, err
+		}
+		run := &runs[index[t.EventID]]
+		run.Todos = append(run.Todos, t)
+		run.Total++
+		if t.Completed {
+			run.Completed++
+		}
+	}
+	return runs, todoRows.Err()
+}
@@ -0,0 +1,535 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Comment threads. A thread hangs off an event, meal, meal item or todo and
+// its comments are recorded against the event, so they show up in the
+// event's change feed. Mentions are worked out from the body whenever it is
+// saved, and each user's read position is kept per thread.
+
+// Things a comment can be attached to
+const (
+	CommentOnEvent    = "event"
+	CommentOnMeal     = "meal"
+	CommentOnMealItem = "meal_item"
+	CommentOnTodo     = "todo"
+)
+
+const commentColumns = `c.id, c.event_id, c.entity_type, c.entity_id, c.parent_id, c.author_id, u.name, c.body,
+	c.version, c.created_at, c.updated_at, c.edited_at, c.deleted_at`
+
+const commentJoins = `LEFT JOIN users u ON c.author_id = u.id`
+
+// scanComment reads commentColumns, then any extra columns into extra
+func scanComment(row pgx.Row, c *models.Comment, extra ...any) error {
+	dest := []any{&c.ID, &c.EventID, &c.EntityType, &c.EntityID, &c.ParentID, &c.AuthorID, &c.AuthorName, &c.Body,
+		&c.Version, &c.CreatedAt, &c.UpdatedAt, &c.EditedAt, &c.DeletedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func getComment(ctx context.Context, q querier, id string) (*models.Comment, error) {
+	var comment models.Comment
+	err := scanComment(q.QueryRow(ctx,
+		`SELECT `+commentColumns+` FROM comments c `+commentJoins+` WHERE c.id = $1`, id,
+	), &comment)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	comments := []models.Comment{comment}
+	if err := withCommentMentions(ctx, q, comments); err != nil {
+		return nil, err
+	}
+	return &comments[0], nil
+}
+
+func (db *DB) GetComment(ctx context.Context, id string) (*models.Comment, error) {
+	return getComment(ctx, db.pool, id)
+}
+
+// withCommentMentions fills in who each comment mentions
+func withCommentMentions(ctx context.Context, q querier, comments []models.Comment) error {
+	ids := make([]string, len(comments))
+	index := make(map[string]int, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].ID
+		index[comments[i].ID] = i
+		comments[i].Mentions = []models.CommentMention{}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT cm.comment_id, a.id, a.name FROM comment_mentions cm
+		 JOIN attendees a ON cm.attendee_id = a.id
+		 WHERE cm.comment_id = ANY($1)
+		 ORDER BY a.name ASC`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID string
+		var m models.CommentMention
+		if err := rows.Scan(&commentID, &m.AttendeeID, &m.Name); err != nil {
+			return err
+		}
+		if i, ok := index[commentID]; ok {
+			comments[i].Mentions = append(comments[i].Mentions, m)
+		}
+	}
+	return rows.Err()
+}
+
+// commentTarget returns the event the thing a comment is attached to
+// belongs to, or ErrNotFound if it doesn't exist or is in the trash
+func commentTarget(ctx context.Context, q querier, entityType, entityID string) (string, error) {
+	var query string
+	switch entityType {
+	case CommentOnEvent:
+		query = `SELECT id FROM events WHERE id = $1 AND deleted_at IS NULL`
+	case CommentOnMeal:
+		query = `SELECT event_id FROM meals WHERE id = $1 AND deleted_at IS NULL`
+	case CommentOnMealItem:
+		query = `SELECT m.event_id FROM meal_items mi JOIN meals m ON mi.meal_id = m.id
+			WHERE mi.id = $1 AND mi.deleted_at IS NULL AND m.deleted_at IS NULL`
+	case CommentOnTodo:
+		query = `SELECT event_id FROM todos WHERE id = $1 AND deleted_at IS NULL`
+	default:
+		return "", ErrNotFound
+	}
+
+	var eventID string
+	if err := q.QueryRow(ctx, query, entityID).Scan(&eventID); err != nil {
+		return "", mapError(err)
+	}
+	return eventID, nil
+}
+
+// threadInEvent checks that a thread belongs to eventID, defaulting to the
+// event's own thread when entityType is empty
+func threadInEvent(ctx context.Context, q querier, eventID, entityType, entityID string) (string, string, error) {
+	if entityType == "" {
+		entityType, entityID = CommentOnEvent, eventID
+	}
+	target, err := commentTarget(ctx, q, entityType, entityID)
+	if err != nil {
+		return "", "", err
+	}
+	if target != eventID {
+		return "", "", ErrNotFound
+	}
+	return entityType, entityID, nil
+}
+
+// findMentions returns the candidates named after an @ in body, ignoring
+// case. A name only counts when it isn't followed by more of a word, and
+// longer names are matched first so "@Mary Ann" doesn't also mention Mary.
+func findMentions(body string, candidates []models.CommentMention) []models.CommentMention {
+	sorted := append([]models.CommentMention(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Name) > len(sorted[j].Name) })
+
+	text := strings.ToLower(body)
+	taken := map[int]bool{}
+	found := map[string]int{}
+	for _, c := range sorted {
+		name := strings.ToLower(strings.TrimSpace(c.Name))
+		if name == "" {
+			continue
+		}
+		tag := "@" + name
+		for from := 0; ; {
+			i := strings.Index(text[from:], tag)
+			if i < 0 {
+				break
+			}
+			start, end := from+i, from+i+len(tag)
+			from = start + 1
+			if taken[start] {
+				continue
+			}
+			if next, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) &&
+				(unicode.IsLetter(next) || unicode.IsDigit(next)) {
+				continue
+			}
+			taken[start] = true
+			if _, ok := found[c.AttendeeID]; !ok {
+				found[c.AttendeeID] = start
+			}
+		}
+	}
+
+	mentions := []models.CommentMention{}
+	for _, c := range candidates {
+		if _, ok := found[c.AttendeeID]; ok {
+			mentions = append(mentions, c)
+		}
+	}
+	sort.SliceStable(mentions, func(i, j int) bool {
+		return found[mentions[i].AttendeeID] < found[mentions[j].AttendeeID]
+	})
+	return mentions
+}
+
+// saveCommentMentions works out who a comment mentions among the event's
+// attendees and replaces its mention rows
+func saveCommentMentions(ctx context.Context, tx pgx.Tx, comment *models.Comment) error {
+	rows, err := tx.Query(ctx, `SELECT id, name FROM attendees WHERE event_id = $1`, comment.EventID)
+	if err != nil {
+		return err
+	}
+	var candidates []models.CommentMention
+	for rows.Next() {
+		var m models.CommentMention
+		if err := rows.Scan(&m.AttendeeID, &m.Name); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates = append(candidates, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	comment.Mentions = findMentions(comment.Body, candidates)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM comment_mentions WHERE comment_id = $1`, comment.ID); err != nil {
+		return err
+	}
+	for _, m := range comment.Mentions {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO comment_mentions (comment_id, attendee_id) VALUES ($1, $2)`, comment.ID, m.AttendeeID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveMealComments moves the threads on a meal and its items, those in the
+// trash included, to the meal's event. Mentions are worked out again among
+// that event's attendees.
+func (db *DB) moveMealComments(ctx context.Context, tx pgx.Tx, meal *models.Meal) error {
+	rows, err := tx.Query(ctx,
+		`SELECT `+commentColumns+` FROM comments c `+commentJoins+`
+		 WHERE c.event_id <> $2
+		   AND ((c.entity_type = $3 AND c.entity_id = $1)
+		        OR (c.entity_type = $4 AND c.entity_id IN (SELECT id FROM meal_items WHERE meal_id = $1)))
+		 FOR UPDATE OF c`, meal.ID, meal.EventID, CommentOnMeal, CommentOnMealItem)
+	if err != nil {
+		return err
+	}
+	var comments []models.Comment
+	for rows.Next() {
+		var c models.Comment
+		if err := scanComment(rows, &c); err != nil {
+			rows.Close()
+			return err
+		}
+		comments = append(comments, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := withCommentMentions(ctx, tx, comments); err != nil {
+		return err
+	}
+
+	for _, before := range comments {
+		comment := before
+		comment.EventID = meal.EventID
+		comment.UpdatedAt = meal.UpdatedAt
+		if err := tx.QueryRow(ctx,
+			`UPDATE comments SET event_id = $1, updated_at = $2, version = version + 1 WHERE id = $3 RETURNING version`,
+			comment.EventID, comment.UpdatedAt, comment.ID,
+		).Scan(&comment.Version); err != nil {
+			return err
+		}
+		if err := saveCommentMentions(ctx, tx, &comment); err != nil {
+			return err
+		}
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "comment", EntityID: comment.ID, EventID: &comment.EventID,
+			Before: before, After: comment,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateComment adds a comment to a thread in the event, as the current
+// user. A reply must be to a live comment in the same thread.
+func (db *DB) CreateComment(ctx context.Context, eventID string, req models.CreateCommentRequest) (*models.Comment, error) {
+	now := time.Now()
+	comment := &models.Comment{
+		ID:        uuid.New().String(),
+		EventID:   eventID,
+		ParentID:  req.ParentID,
+		AuthorID:  actorFromContext(ctx),
+		Body:      strings.TrimSpace(req.Body),
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		comment.EntityType, comment.EntityID, err = threadInEvent(ctx, tx, eventID, req.EntityType, req.EntityID)
+		if errors.Is(err, ErrNotFound) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+
+		if comment.ParentID != nil {
+			parent, err := getComment(ctx, tx, *comment.ParentID)
+			if errors.Is(err, ErrNotFound) {
+				return ErrForeignKey
+			}
+			if err != nil {
+				return err
+			}
+			if parent.EntityType != comment.EntityType || parent.EntityID != comment.EntityID || parent.DeletedAt != nil {
+				return ErrForeignKey
+			}
+		}
+		comment.AuthorName = userName(ctx, tx, comment.AuthorID)
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO comments (id, event_id, entity_type, entity_id, parent_id, author_id, body, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			comment.ID, comment.EventID, comment.EntityType, comment.EntityID, comment.ParentID, comment.AuthorID,
+			comment.Body, comment.CreatedAt, comment.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := saveCommentMentions(ctx, tx, comment); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "comment", EntityID: comment.ID, EventID: &comment.EventID, After: comment,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// UpdateComment rewrites a comment's body and works out its mentions again
+func (db *DB) UpdateComment(ctx context.Context, id string, req models.UpdateCommentRequest, expectedVersion *int) (*models.Comment, error) {
+	var comment *models.Comment
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getComment(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		comment = &updated
+		now := time.Now()
+		comment.Body = strings.TrimSpace(req.Body)
+		comment.EditedAt = &now
+		comment.UpdatedAt = now
+		comment.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE comments SET body=$1, edited_at=$2, updated_at=$3, version=$4 WHERE id=$5 AND version=$6`,
+			comment.Body, comment.EditedAt, comment.UpdatedAt, comment.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+		if err := saveCommentMentions(ctx, tx, comment); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "comment", EntityID: id, EventID: &comment.EventID,
+			Before: before, After: comment,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// DeleteComment removes a comment's body and mentions. The row stays so
+// its replies keep their place; threads leave it out once nothing is
+// under it.
+func (db *DB) DeleteComment(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getComment(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if before.DeletedAt != nil {
+			return ErrNotFound
+		}
+
+		now := time.Now()
+		err = casResult(tx.Exec(ctx,
+			`UPDATE comments SET body = '', deleted_at = $1, updated_at = $1, version = version + 1
+			 WHERE id = $2 AND deleted_at IS NULL`, now, id,
+		))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM comment_mentions WHERE comment_id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "comment", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
+
+// commentTree nests replies under their parents, oldest first, and drops
+// deleted comments with nothing left under them
+func commentTree(comments []models.Comment) []models.Comment {
+	children := map[string][]models.Comment{}
+	for _, c := range comments {
+		parent := ""
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	var build func(parent string) []models.Comment
+	build = func(parent string) []models.Comment {
+		tree := []models.Comment{}
+		for _, c := range children[parent] {
+			c.Replies = build(c.ID)
+			if c.DeletedAt != nil && len(c.Replies) == 0 {
+				continue
+			}
+			tree = append(tree, c)
+		}
+		return tree
+	}
+	return build("")
+}
+
+// GetCommentThread returns a thread in the event, defaulting to the
+// event's own, with the comments userID hasn't read yet flagged
+func (db *DB) GetCommentThread(ctx context.Context, eventID, entityType, entityID, userID string) (*models.CommentThread, error) {
+	entityType, entityID, err := threadInEvent(ctx, db.pool, eventID, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+commentColumns+`,
+			c.deleted_at IS NULL AND c.author_id IS DISTINCT FROM $3
+			AND (r.last_read_at IS NULL OR c.created_at > r.last_read_at)
+		 FROM comments c `+commentJoins+`
+		 LEFT JOIN comment_reads r ON r.user_id = $3 AND r.entity_type = c.entity_type AND r.entity_id = c.entity_id
+		 WHERE c.entity_type = $1 AND c.entity_id = $2
+		 ORDER BY c.created_at ASC, c.id ASC`, entityType, entityID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	thread := &models.CommentThread{EntityType: entityType, EntityID: entityID}
+	var comments []models.Comment
+	for rows.Next() {
+		var c models.Comment
+		if err := scanComment(rows, &c, &c.Unread); err != nil {
+			return nil, err
+		}
+		if c.Unread {
+			thread.Unread++
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := withCommentMentions(ctx, db.pool, comments); err != nil {
+		return nil, err
+	}
+	thread.Comments = commentTree(comments)
+	return thread, nil
+}
+
+// MarkCommentsRead records that userID has read a thread up to now. Read
+// positions are private to each user, so they aren't audited.
+func (db *DB) MarkCommentsRead(ctx context.Context, eventID, entityType, entityID, userID string) error {
+	entityType, entityID, err := threadInEvent(ctx, db.pool, eventID, entityType, entityID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.pool.Exec(ctx,
+		`INSERT INTO comment_reads (user_id, entity_type, entity_id, last_read_at) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id, entity_type, entity_id) DO UPDATE SET last_read_at = EXCLUDED.last_read_at`,
+		userID, entityType, entityID, time.Now())
+	return mapError(err)
+}
+
+// GetUnreadComments lists the event's threads with comments userID hasn't
+// read, most recently active first. Mentions count the unread comments
+// naming an attendee entry with the user's email.
+func (db *DB) GetUnreadComments(ctx context.Context, eventID, userID string) ([]models.UnreadComments, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT c.entity_type, c.entity_id, COUNT(*),
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM comment_mentions cm
+				JOIN attendees a ON cm.attendee_id = a.id
+				JOIN users me ON LOWER(a.email) = LOWER(me.email)
+				WHERE cm.comment_id = c.id AND me.id = $2)),
+			MAX(c.created_at)
+		 FROM comments c
+		 LEFT JOIN comment_reads r ON r.user_id = $2 AND r.entity_type = c.entity_type AND r.entity_id = c.entity_id
+		 WHERE c.event_id = $1 AND c.deleted_at IS NULL AND c.author_id IS DISTINCT FROM $2
+		   AND (r.last_read_at IS NULL OR c.created_at > r.last_read_at)
+		 GROUP BY c.entity_type, c.entity_id
+		 ORDER BY MAX(c.created_at) DESC`, eventID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unread := []models.UnreadComments{}
+	for rows.Next() {
+		var u models.UnreadComments
+		if err := rows.Scan(&u.EntityType, &u.EntityID, &u.Unread, &u.Mentions, &u.LatestAt); err != nil {
+			return nil, err
+		}
+		unread = append(unread, u)
+	}
+	return unread, rows.Err()
+}
@@ -2,11 +2,13 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"farm-time/internal/models"
@@ -138,6 +140,453 @@ func (db *DB) Migrate(ctx context.Context) error {
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_todos_event_id ON todos(event_id);
+
+	ALTER TABLE events ADD COLUMN IF NOT EXISTS created_by TEXT REFERENCES users(id) ON DELETE SET NULL;
+
+	-- Append-only log of every mutation. No foreign keys so history
+	-- outlives the rows it describes.
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id TEXT PRIMARY KEY,
+		actor_user_id TEXT,
+		action TEXT NOT NULL,
+		entity_type TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		event_id TEXT,
+		before JSONB,
+		after JSONB,
+		changes JSONB,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_event_id ON audit_log(event_id, created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_user_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at DESC);
+
+	-- Soft delete: rows stay in the trash until restored or purged
+	ALTER TABLE events ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	ALTER TABLE meals ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+	CREATE INDEX IF NOT EXISTS idx_events_deleted_at ON events(deleted_at) WHERE deleted_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_meals_deleted_at ON meals(deleted_at) WHERE deleted_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_meal_items_deleted_at ON meal_items(deleted_at) WHERE deleted_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_todos_deleted_at ON todos(deleted_at) WHERE deleted_at IS NOT NULL;
+
+	-- Row versions for optimistic concurrency; bumped on every update
+	ALTER TABLE events ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE meals ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+	-- When each attendee is on site; defaults to the event's start and end
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS arrival_time TIMESTAMPTZ;
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS departure_time TIMESTAMPTZ;
+	UPDATE attendees a SET arrival_time = e.start_time FROM events e
+		WHERE a.event_id = e.id AND a.arrival_time IS NULL;
+	UPDATE attendees a SET departure_time = e.end_time FROM events e
+		WHERE a.event_id = e.id AND a.departure_time IS NULL;
+	ALTER TABLE attendees ALTER COLUMN arrival_time SET NOT NULL;
+	ALTER TABLE attendees ALTER COLUMN departure_time SET NOT NULL;
+
+	-- Each event's IANA time zone, which decides the calendar day its times
+	-- fall on
+	ALTER TABLE events ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC';
+
+	CREATE TABLE IF NOT EXISTS meal_attendance (
+		id TEXT PRIMARY KEY,
+		meal_id TEXT NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+		attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		status TEXT NOT NULL CHECK (status IN ('in', 'out', 'unknown')),
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		UNIQUE(meal_id, attendee_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_meal_attendance_attendee ON meal_attendance(attendee_id);
+
+	-- Dietary restrictions and allergens
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS dietary_restrictions TEXT[] NOT NULL DEFAULT '{}';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS allergies TEXT[] NOT NULL DEFAULT '{}';
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS dietary_notes TEXT;
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS dietary_restrictions TEXT[] NOT NULL DEFAULT '{}';
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS allergies TEXT[] NOT NULL DEFAULT '{}';
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS dietary_notes TEXT;
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS allergens TEXT[] NOT NULL DEFAULT '{}';
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS diet_tags TEXT[] NOT NULL DEFAULT '{}';
+
+	-- Households and party sizes
+	CREATE TABLE IF NOT EXISTS households (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		primary_attendee_id TEXT REFERENCES attendees(id) ON DELETE SET NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_households_event_id ON households(event_id);
+
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS household_id TEXT REFERENCES households(id) ON DELETE SET NULL;
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS adults INTEGER NOT NULL DEFAULT 1 CHECK (adults >= 0);
+	ALTER TABLE attendees ADD COLUMN IF NOT EXISTS children INTEGER NOT NULL DEFAULT 0 CHECK (children >= 0);
+	CREATE INDEX IF NOT EXISTS idx_attendees_household_id ON attendees(household_id);
+
+	-- Quantities on meal items and signups
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS quantity DOUBLE PRECISION CHECK (quantity > 0);
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS unit TEXT NOT NULL DEFAULT '';
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS assigned_quantity DOUBLE PRECISION CHECK (assigned_quantity > 0);
+	ALTER TABLE meal_signups ADD COLUMN IF NOT EXISTS quantity DOUBLE PRECISION CHECK (quantity > 0);
+
+	-- Shopping list
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS host_buys BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+
+	CREATE TABLE IF NOT EXISTS shopping_list_purchases (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		item_key TEXT NOT NULL,
+		purchased_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		purchased_at TIMESTAMPTZ DEFAULT NOW(),
+		UNIQUE(event_id, item_key)
+	);
+
+	-- Recipe library
+	CREATE TABLE IF NOT EXISTS recipes (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		servings INTEGER NOT NULL CHECK (servings > 0),
+		steps TEXT[] NOT NULL DEFAULT '{}',
+		tags TEXT[] NOT NULL DEFAULT '{}',
+		source_url TEXT NOT NULL DEFAULT '',
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS recipe_ingredients (
+		id TEXT PRIMARY KEY,
+		recipe_id TEXT NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		quantity DOUBLE PRECISION CHECK (quantity > 0),
+		unit TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		category TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_recipe_ingredients_recipe_id ON recipe_ingredients(recipe_id, position);
+	CREATE INDEX IF NOT EXISTS idx_recipes_tags ON recipes USING GIN(tags);
+
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS recipe_id TEXT REFERENCES recipes(id) ON DELETE SET NULL;
+
+	-- Explicit item order within a meal; existing items all start at 0 and
+	-- so keep sorting by name until someone reorders them
+	ALTER TABLE meal_items ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0;
+
+	-- Expenses and settling up. Amounts are stored in cents so splits add
+	-- up exactly; attendees who paid or were paid can't be deleted.
+	CREATE TABLE IF NOT EXISTS expenses (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		payer_attendee_id TEXT NOT NULL REFERENCES attendees(id),
+		amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+		currency TEXT NOT NULL DEFAULT 'USD',
+		description TEXT NOT NULL DEFAULT '',
+		meal_item_id TEXT REFERENCES meal_items(id) ON DELETE SET NULL,
+		todo_id TEXT REFERENCES todos(id) ON DELETE SET NULL,
+		split_rule TEXT NOT NULL DEFAULT 'equal' CHECK (split_rule IN ('equal', 'household', 'nights', 'custom')),
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS expense_shares (
+		expense_id TEXT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+		attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		shares DOUBLE PRECISION NOT NULL CHECK (shares > 0),
+		PRIMARY KEY (expense_id, attendee_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS settlements (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		from_attendee_id TEXT NOT NULL REFERENCES attendees(id),
+		to_attendee_id TEXT NOT NULL REFERENCES attendees(id),
+		amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+		currency TEXT NOT NULL DEFAULT 'USD',
+		note TEXT NOT NULL DEFAULT '',
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		paid_at TIMESTAMPTZ DEFAULT NOW(),
+		CHECK (from_attendee_id <> to_attendee_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_expenses_event_id ON expenses(event_id);
+	CREATE INDEX IF NOT EXISTS idx_settlements_event_id ON settlements(event_id);
+
+	-- Lodging: the property's rooms and beds, and who sleeps where each night
+	CREATE TABLE IF NOT EXISTS rooms (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS room_beds (
+		room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		bed_type TEXT NOT NULL,
+		capacity INTEGER NOT NULL CHECK (capacity > 0),
+		label TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (room_id, position)
+	);
+
+	CREATE TABLE IF NOT EXISTS sleeping_assignments (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		room_id TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+		night DATE NOT NULL,
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		UNIQUE(attendee_id, night)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sleeping_assignments_event ON sleeping_assignments(event_id, night);
+	CREATE INDEX IF NOT EXISTS idx_sleeping_assignments_room ON sleeping_assignments(room_id, night);
+
+	-- Carpools
+	CREATE TABLE IF NOT EXISTS rides (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		driver_attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		direction TEXT NOT NULL CHECK (direction IN ('to_farm', 'home')),
+		origin TEXT NOT NULL DEFAULT '',
+		departure_time TIMESTAMPTZ NOT NULL,
+		seats INTEGER NOT NULL CHECK (seats >= 0),
+		notes TEXT NOT NULL DEFAULT '',
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS ride_passengers (
+		id TEXT PRIMARY KEY,
+		ride_id TEXT NOT NULL REFERENCES rides(id) ON DELETE CASCADE,
+		attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		seats INTEGER NOT NULL CHECK (seats > 0),
+		status TEXT NOT NULL CHECK (status IN ('requested', 'confirmed')),
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		UNIQUE(ride_id, attendee_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_rides_event_id ON rides(event_id);
+	CREATE INDEX IF NOT EXISTS idx_ride_passengers_attendee ON ride_passengers(attendee_id);
+
+	-- Activities and the itinerary
+	CREATE TABLE IF NOT EXISTS activities (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		location TEXT NOT NULL DEFAULT '',
+		leader_attendee_id TEXT REFERENCES attendees(id) ON DELETE SET NULL,
+		start_time TIMESTAMPTZ NOT NULL,
+		end_time TIMESTAMPTZ NOT NULL,
+		capacity INTEGER CHECK (capacity > 0),
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		CHECK (end_time > start_time)
+	);
+
+	CREATE TABLE IF NOT EXISTS activity_signups (
+		id TEXT PRIMARY KEY,
+		activity_id TEXT NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+		attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		people INTEGER NOT NULL CHECK (people > 0),
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		UNIQUE(activity_id, attendee_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_activities_event_id ON activities(event_id);
+	CREATE INDEX IF NOT EXISTS idx_activity_signups_attendee ON activity_signups(attendee_id);
+
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+
+	-- Shared equipment and reservations
+	CREATE TABLE IF NOT EXISTS resources (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+		requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS resource_reservations (
+		id TEXT PRIMARY KEY,
+		resource_id TEXT NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		start_time TIMESTAMPTZ NOT NULL,
+		end_time TIMESTAMPTZ NOT NULL,
+		quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+		status TEXT NOT NULL CHECK (status IN ('pending', 'approved', 'denied')),
+		notes TEXT NOT NULL DEFAULT '',
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		reviewed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		reviewed_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		CHECK (end_time > start_time)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_reservations_resource_time ON resource_reservations(resource_id, start_time);
+	CREATE INDEX IF NOT EXISTS idx_reservations_event_id ON resource_reservations(event_id);
+
+	-- Farm availability: exclusive events and booking requests
+	ALTER TABLE events ADD COLUMN IF NOT EXISTS exclusive BOOLEAN NOT NULL DEFAULT FALSE;
+
+	CREATE TABLE IF NOT EXISTS booking_requests (
+		id TEXT PRIMARY KEY,
+		requested_by TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		start_time TIMESTAMPTZ NOT NULL,
+		end_time TIMESTAMPTZ NOT NULL,
+		exclusive BOOLEAN NOT NULL DEFAULT FALSE,
+		status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied')),
+		event_id TEXT REFERENCES events(id) ON DELETE SET NULL,
+		review_note TEXT NOT NULL DEFAULT '',
+		reviewed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		reviewed_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		CHECK (end_time > start_time)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_booking_requests_status ON booking_requests(status, start_time);
+	CREATE INDEX IF NOT EXISTS idx_booking_requests_requested_by ON booking_requests(requested_by);
+
+	-- Todo details: relative due dates, priority, category, checklists
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS due_offset_minutes INTEGER;
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal'
+		CHECK (priority IN ('low', 'normal', 'high', 'urgent'));
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS completed_by TEXT REFERENCES users(id) ON DELETE SET NULL;
+
+	CREATE TABLE IF NOT EXISTS todo_subtasks (
+		todo_id TEXT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		done BOOLEAN NOT NULL DEFAULT FALSE,
+		PRIMARY KEY (todo_id, position)
+	);
+
+	-- Todo dependencies
+	CREATE TABLE IF NOT EXISTS todo_dependencies (
+		todo_id TEXT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		depends_on_id TEXT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		PRIMARY KEY (todo_id, depends_on_id),
+		CHECK (todo_id <> depends_on_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_todo_dependencies_depends_on ON todo_dependencies(depends_on_id);
+
+	-- Standing opening and closing checklists
+	CREATE TABLE IF NOT EXISTS checklist_items (
+		id TEXT PRIMARY KEY,
+		phase TEXT NOT NULL CHECK (phase IN ('arrival', 'departure')),
+		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		priority TEXT NOT NULL DEFAULT 'normal' CHECK (priority IN ('low', 'normal', 'high', 'urgent')),
+		position INTEGER NOT NULL DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS checklist_item_id TEXT REFERENCES checklist_items(id) ON DELETE SET NULL;
+	ALTER TABLE todos ADD COLUMN IF NOT EXISTS checklist TEXT NOT NULL DEFAULT '';
+
+	CREATE INDEX IF NOT EXISTS idx_todos_checklist_item ON todos(checklist_item_id);
+
+	-- Chore assignment: preferences and the log of applied assignments
+	CREATE TABLE IF NOT EXISTS chore_preferences (
+		attendee_id TEXT PRIMARY KEY REFERENCES attendees(id) ON DELETE CASCADE,
+		prefers TEXT[] NOT NULL DEFAULT '{}',
+		avoids TEXT[] NOT NULL DEFAULT '{}',
+		exempt BOOLEAN NOT NULL DEFAULT FALSE,
+		updated_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS assignment_log (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		kind TEXT NOT NULL CHECK (kind IN ('todo', 'meal_item')),
+		entity_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		attendee_id TEXT REFERENCES attendees(id) ON DELETE SET NULL,
+		attendee_name TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		applied_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_assignment_log_event_id ON assignment_log(event_id, created_at);
+
+	-- Stats: attendee entries are matched to users by email
+	CREATE INDEX IF NOT EXISTS idx_attendees_email ON attendees(LOWER(email));
+
+	-- Comment threads on events, meals, meal items and todos
+	CREATE TABLE IF NOT EXISTS comments (
+		id TEXT PRIMARY KEY,
+		event_id TEXT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+		entity_type TEXT NOT NULL CHECK (entity_type IN ('event', 'meal', 'meal_item', 'todo')),
+		entity_id TEXT NOT NULL,
+		parent_id TEXT REFERENCES comments(id) ON DELETE CASCADE,
+		author_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+		body TEXT NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		created_at TIMESTAMPTZ DEFAULT NOW(),
+		updated_at TIMESTAMPTZ DEFAULT NOW(),
+		edited_at TIMESTAMPTZ,
+		deleted_at TIMESTAMPTZ
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_comments_entity ON comments(entity_type, entity_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_comments_event_id ON comments(event_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS comment_mentions (
+		comment_id TEXT NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+		attendee_id TEXT NOT NULL REFERENCES attendees(id) ON DELETE CASCADE,
+		PRIMARY KEY (comment_id, attendee_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS comment_reads (
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		entity_type TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		last_read_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (user_id, entity_type, entity_id)
+	);
+
+	-- Change feed position of each audit entry: the writing transaction,
+	-- then the order within it
+	ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS txid XID8 NOT NULL DEFAULT pg_current_xact_id();
+	ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS seq BIGSERIAL;
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_event_feed ON audit_log(event_id, txid, seq);
 	`
 
 	_, err := db.pool.Exec(ctx, schema)
@@ -146,6 +595,27 @@ func (db *DB) Migrate(ctx context.Context) error {
 
 // Event operations
 
+// DefaultTimeZone is used for events created without one
+const DefaultTimeZone = "UTC"
+
+const eventColumns = `id, title, description, location, start_time, end_time, time_zone, exclusive, created_by, version,
+	created_at, updated_at, deleted_at`
+
+func scanEvent(row pgx.Row, e *models.Event) error {
+	return row.Scan(&e.ID, &e.Title, &e.Description, &e.Location, &e.StartTime, &e.EndTime, &e.TimeZone,
+		&e.Exclusive, &e.CreatedBy, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.DeletedAt)
+}
+
+// EventLocation loads the event's time zone. Zones are validated on the
+// way in, so one that no longer loads falls back to UTC.
+func EventLocation(e *models.Event) *time.Location {
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 func (db *DB) CreateEvent(ctx context.Context, req models.CreateEventRequest) (*models.Event, error) {
 	event := &models.Event{
 		ID:          uuid.New().String(),
@@ -154,16 +624,20 @@ func (db *DB) CreateEvent(ctx context.Context, req models.CreateEventRequest) (*
 		Location:    req.Location,
 		StartTime:   req.StartTime,
 		EndTime:     req.EndTime,
+		TimeZone:    req.TimeZone,
+		Exclusive:   req.Exclusive,
+		CreatedBy:   actorFromContext(ctx),
+		Version:     1,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	if event.TimeZone == "" {
+		event.TimeZone = DefaultTimeZone
+	}
 
-	_, err := db.pool.Exec(ctx,
-		`INSERT INTO events (id, title, description, location, start_time, end_time, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		event.ID, event.Title, event.Description, event.Location,
-		event.StartTime, event.EndTime, event.CreatedAt, event.UpdatedAt,
-	)
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		return db.insertEvent(ctx, tx, event)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -171,24 +645,53 @@ func (db *DB) CreateEvent(ctx context.Context, req models.CreateEventRequest) (*
 	return event, nil
 }
 
-func (db *DB) GetEvent(ctx context.Context, id string) (*models.Event, error) {
-	var event models.Event
-	err := db.pool.QueryRow(ctx,
-		`SELECT id, title, description, location, start_time, end_time, created_at, updated_at
-		 FROM events WHERE id = $1`, id,
-	).Scan(&event.ID, &event.Title, &event.Description, &event.Location,
-		&event.StartTime, &event.EndTime, &event.CreatedAt, &event.UpdatedAt)
+// insertEvent stores a new event once its dates are clear of exclusive
+// events, audits it and gives it the standing checklists
+func (db *DB) insertEvent(ctx context.Context, tx pgx.Tx, event *models.Event) error {
+	if err := checkEventDates(ctx, tx, event); err != nil {
+		return err
+	}
 
+	_, err := tx.Exec(ctx,
+		`INSERT INTO events (id, title, description, location, start_time, end_time, time_zone, exclusive, created_by,
+		 created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		event.ID, event.Title, event.Description, event.Location, event.StartTime, event.EndTime, event.TimeZone,
+		event.Exclusive, event.CreatedBy, event.CreatedAt, event.UpdatedAt,
+	)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if err := db.recordAudit(ctx, tx, auditRecord{
+		Action: AuditCreate, EntityType: "event", EntityID: event.ID, EventID: &event.ID, After: event,
+	}); err != nil {
+		return err
+	}
+
+	return db.attachChecklists(ctx, tx, event)
+}
+
+func getEvent(ctx context.Context, q querier, id string) (*models.Event, error) {
+	var event models.Event
+	err := scanEvent(q.QueryRow(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE id = $1 AND deleted_at IS NULL`, id,
+	), &event)
+	if err != nil {
+		return nil, mapError(err)
 	}
 	return &event, nil
 }
 
+func (db *DB) GetEvent(ctx context.Context, id string) (*models.Event, error) {
+	return getEvent(ctx, db.pool, id)
+}
+
+// ListEvents returns every live event by start time, each with the IDs of
+// the other events it overlaps
 func (db *DB) ListEvents(ctx context.Context) ([]models.Event, error) {
 	rows, err := db.pool.Query(ctx,
-		`SELECT id, title, description, location, start_time, end_time, created_at, updated_at
-		 FROM events ORDER BY start_time ASC`)
+		`SELECT `+eventColumns+` FROM events WHERE deleted_at IS NULL ORDER BY start_time ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -197,58 +700,230 @@ func (db *DB) ListEvents(ctx context.Context) ([]models.Event, error) {
 	var events []models.Event
 	for rows.Next() {
 		var e models.Event
-		if err := rows.Scan(&e.ID, &e.Title, &e.Description, &e.Location,
-			&e.StartTime, &e.EndTime, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		if err := scanEvent(rows, &e); err != nil {
 			return nil, err
 		}
 		events = append(events, e)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	markOverlaps(events)
 	return events, nil
 }
 
-func (db *DB) UpdateEvent(ctx context.Context, id string, req models.UpdateEventRequest) (*models.Event, error) {
-	event, err := db.GetEvent(ctx, id)
+// UpdateEvent applies req as a compare-and-swap against the stored version.
+// If expectedVersion is set it must match the stored version as well. New
+// dates must still cover every meal's day, or ErrMealsOutsideDates is
+// returned.
+func (db *DB) UpdateEvent(ctx context.Context, id string, req models.UpdateEventRequest, expectedVersion *int) (*models.Event, error) {
+	var event *models.Event
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getEvent(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		event = &updated
+		if req.Title != nil {
+			event.Title = *req.Title
+		}
+		if req.Description != nil {
+			event.Description = *req.Description
+		}
+		if req.Location != nil {
+			event.Location = *req.Location
+		}
+		if req.StartTime != nil {
+			event.StartTime = *req.StartTime
+		}
+		if req.EndTime != nil {
+			event.EndTime = *req.EndTime
+		}
+		if req.TimeZone != nil {
+			event.TimeZone = *req.TimeZone
+		}
+		if req.Exclusive != nil {
+			event.Exclusive = *req.Exclusive
+		}
+		event.UpdatedAt = time.Now()
+		event.Version = before.Version + 1
+
+		if !event.StartTime.Equal(before.StartTime) || !event.EndTime.Equal(before.EndTime) || event.Exclusive != before.Exclusive {
+			if err := checkEventDates(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+		if !event.StartTime.Equal(before.StartTime) || !event.EndTime.Equal(before.EndTime) ||
+			event.TimeZone != before.TimeZone {
+			// Lock the meals so none can be moved outside the new dates meanwhile
+			if _, err := tx.Exec(ctx,
+				`SELECT id FROM meals WHERE event_id = $1 AND deleted_at IS NULL FOR UPDATE`, id,
+			); err != nil {
+				return err
+			}
+			outside, err := mealsOutsideDates(ctx, tx, event)
+			if err != nil {
+				return err
+			}
+			if len(outside) > 0 {
+				return ErrMealsOutsideDates
+			}
+		}
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE events SET title=$1, description=$2, location=$3, start_time=$4, end_time=$5, time_zone=$6,
+			 exclusive=$7, updated_at=$8, version=$9
+			 WHERE id=$10 AND version=$11 AND deleted_at IS NULL`,
+			event.Title, event.Description, event.Location, event.StartTime, event.EndTime, event.TimeZone,
+			event.Exclusive, event.UpdatedAt, event.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		if !event.StartTime.Equal(before.StartTime) || !event.EndTime.Equal(before.EndTime) {
+			if err := db.followEventTimes(ctx, tx, before, event); err != nil {
+				return err
+			}
+			if err := db.followEventDueDates(ctx, tx, before, event); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "event", EntityID: id, EventID: &id, Before: before, After: event,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if req.Title != nil {
-		event.Title = *req.Title
-	}
-	if req.Description != nil {
-		event.Description = *req.Description
+	return event, nil
+}
+
+// followEventTimes moves the attendees still on the event's default
+// schedule, arriving at its old start or leaving at its old end, to its new
+// times, auditing each one it changes
+func (db *DB) followEventTimes(ctx context.Context, tx pgx.Tx, before, event *models.Event) error {
+	rows, err := tx.Query(ctx,
+		`SELECT `+attendeeColumns+` FROM attendees
+		 WHERE event_id = $1 AND (arrival_time = $2 OR departure_time = $3)
+		 FOR UPDATE`, event.ID, before.StartTime, before.EndTime)
+	if err != nil {
+		return err
 	}
-	if req.Location != nil {
-		event.Location = *req.Location
+	var attendees []models.Attendee
+	for rows.Next() {
+		var a models.Attendee
+		if err := scanAttendee(rows, &a); err != nil {
+			rows.Close()
+			return err
+		}
+		attendees = append(attendees, a)
 	}
-	if req.StartTime != nil {
-		event.StartTime = *req.StartTime
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
-	if req.EndTime != nil {
-		event.EndTime = *req.EndTime
+
+	for _, prev := range attendees {
+		attendee := prev
+		if attendee.ArrivalTime.Equal(before.StartTime) {
+			attendee.ArrivalTime = event.StartTime
+		}
+		if attendee.DepartureTime.Equal(before.EndTime) {
+			attendee.DepartureTime = event.EndTime
+		}
+		if attendee.ArrivalTime.Equal(prev.ArrivalTime) && attendee.DepartureTime.Equal(prev.DepartureTime) {
+			continue
+		}
+
+		if err := tx.QueryRow(ctx,
+			`UPDATE attendees SET arrival_time = $1, departure_time = $2, updated_at = $3, version = version + 1
+			 WHERE id = $4
+			 RETURNING version`,
+			attendee.ArrivalTime, attendee.DepartureTime, event.UpdatedAt, attendee.ID,
+		).Scan(&attendee.Version); err != nil {
+			return err
+		}
+		attendee.UpdatedAt = event.UpdatedAt
+
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "attendee", EntityID: attendee.ID, EventID: &attendee.EventID,
+			Before: &prev, After: &attendee,
+		}); err != nil {
+			return err
+		}
 	}
-	event.UpdatedAt = time.Now()
+	return nil
+}
 
-	_, err = db.pool.Exec(ctx,
-		`UPDATE events SET title=$1, description=$2, location=$3, start_time=$4, end_time=$5, updated_at=$6
-		 WHERE id=$7`,
-		event.Title, event.Description, event.Location, event.StartTime, event.EndTime, event.UpdatedAt, id,
-	)
+// DeleteEvent moves the event and all of its meals, items and todos to the
+// trash. It returns ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteEvent(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getEvent(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if _, err := tx.Exec(ctx, `UPDATE events SET deleted_at = $1 WHERE id = $2`, now, id); err != nil {
+			return err
+		}
+		if err := softDeleteEventChildren(ctx, tx, id, now); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "event", EntityID: id, EventID: &id, Before: before,
+		})
+	})
+}
+
+// Attendee operations
+
+const attendeeColumns = `id, event_id, name, email, status, arrival_time, departure_time,
+	household_id, adults, children,
+	dietary_restrictions, allergies, COALESCE(dietary_notes, ''), version, created_at, updated_at`
+
+func scanAttendee(row pgx.Row, a *models.Attendee) error {
+	return row.Scan(&a.ID, &a.EventID, &a.Name, &a.Email, &a.Status, &a.ArrivalTime, &a.DepartureTime,
+		&a.HouseholdID, &a.Adults, &a.Children,
+		&a.DietaryRestrictions, &a.Allergies, &a.DietaryNotes, &a.Version, &a.CreatedAt, &a.UpdatedAt)
+}
+
+func getAttendee(ctx context.Context, q querier, id string) (*models.Attendee, error) {
+	var attendee models.Attendee
+	err := scanAttendee(q.QueryRow(ctx,
+		`SELECT `+attendeeColumns+` FROM attendees WHERE id = $1`, id,
+	), &attendee)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
+	return &attendee, nil
+}
 
-	return event, nil
+func (db *DB) GetAttendee(ctx context.Context, id string) (*models.Attendee, error) {
+	return getAttendee(ctx, db.pool, id)
 }
 
-func (db *DB) DeleteEvent(ctx context.Context, id string) error {
-	_, err := db.pool.Exec(ctx, `DELETE FROM events WHERE id = $1`, id)
+// checkAttendeeInEvent returns ErrForeignKey unless the attendee exists and
+// belongs to the event
+func checkAttendeeInEvent(ctx context.Context, q querier, attendeeID, eventID string) error {
+	attendee, err := getAttendee(ctx, q, attendeeID)
+	if errors.Is(err, ErrNotFound) || (err == nil && attendee.EventID != eventID) {
+		return ErrForeignKey
+	}
 	return err
 }
 
-// Attendee operations
-
 func (db *DB) CreateAttendee(ctx context.Context, eventID string, req models.CreateAttendeeRequest) (*models.Attendee, error) {
 	attendee := &models.Attendee{
 		ID:        uuid.New().String(),
@@ -256,20 +931,66 @@ func (db *DB) CreateAttendee(ctx context.Context, eventID string, req models.Cre
 		Name:      req.Name,
 		Email:     req.Email,
 		Status:    req.Status,
+		Adults:    1,
+		Version:   1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+
+		HouseholdID:         req.HouseholdID,
+		DietaryRestrictions: normalizeTags(req.DietaryRestrictions),
+		Allergies:           normalizeTags(req.Allergies),
+		DietaryNotes:        req.DietaryNotes,
 	}
 
 	if attendee.Status == "" {
 		attendee.Status = "attending"
 	}
+	if req.Adults != nil {
+		attendee.Adults = *req.Adults
+	}
+	if req.Children != nil {
+		attendee.Children = *req.Children
+	}
 
-	_, err := db.pool.Exec(ctx,
-		`INSERT INTO attendees (id, event_id, name, email, status, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		attendee.ID, attendee.EventID, attendee.Name, attendee.Email,
-		attendee.Status, attendee.CreatedAt, attendee.UpdatedAt,
-	)
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		event, err := getEvent(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+
+		if attendee.HouseholdID != nil {
+			if err := checkHouseholdInEvent(ctx, tx, *attendee.HouseholdID, eventID); err != nil {
+				return err
+			}
+		}
+
+		// Default to being on site for the whole event
+		attendee.ArrivalTime = event.StartTime
+		if req.ArrivalTime != nil {
+			attendee.ArrivalTime = *req.ArrivalTime
+		}
+		attendee.DepartureTime = event.EndTime
+		if req.DepartureTime != nil {
+			attendee.DepartureTime = *req.DepartureTime
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO attendees (id, event_id, name, email, status, arrival_time, departure_time,
+			 household_id, adults, children, dietary_restrictions, allergies, dietary_notes, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+			attendee.ID, attendee.EventID, attendee.Name, attendee.Email,
+			attendee.Status, attendee.ArrivalTime, attendee.DepartureTime,
+			attendee.HouseholdID, attendee.Adults, attendee.Children,
+			attendee.DietaryRestrictions, attendee.Allergies, attendee.DietaryNotes, attendee.CreatedAt, attendee.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "attendee", EntityID: attendee.ID, EventID: &eventID, After: attendee,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -277,10 +998,9 @@ func (db *DB) CreateAttendee(ctx context.Context, eventID string, req models.Cre
 	return attendee, nil
 }
 
-func (db *DB) GetAttendeesByEvent(ctx context.Context, eventID string) ([]models.Attendee, error) {
-	rows, err := db.pool.Query(ctx,
-		`SELECT id, event_id, name, email, status, created_at, updated_at
-		 FROM attendees WHERE event_id = $1 ORDER BY name ASC`, eventID)
+func getAttendeesByEvent(ctx context.Context, q querier, eventID string) ([]models.Attendee, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+attendeeColumns+` FROM attendees WHERE event_id = $1 ORDER BY name ASC`, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -289,52 +1009,122 @@ func (db *DB) GetAttendeesByEvent(ctx context.Context, eventID string) ([]models
 	var attendees []models.Attendee
 	for rows.Next() {
 		var a models.Attendee
-		if err := rows.Scan(&a.ID, &a.EventID, &a.Name, &a.Email,
-			&a.Status, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		if err := scanAttendee(rows, &a); err != nil {
 			return nil, err
 		}
 		attendees = append(attendees, a)
 	}
 
-	return attendees, nil
+	return attendees, rows.Err()
 }
 
-func (db *DB) UpdateAttendee(ctx context.Context, id string, req models.UpdateAttendeeRequest) (*models.Attendee, error) {
-	var attendee models.Attendee
-	err := db.pool.QueryRow(ctx,
-		`SELECT id, event_id, name, email, status, created_at, updated_at
-		 FROM attendees WHERE id = $1`, id,
-	).Scan(&attendee.ID, &attendee.EventID, &attendee.Name, &attendee.Email,
-		&attendee.Status, &attendee.CreatedAt, &attendee.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
+func (db *DB) GetAttendeesByEvent(ctx context.Context, eventID string) ([]models.Attendee, error) {
+	return getAttendeesByEvent(ctx, db.pool, eventID)
+}
 
-	if req.Name != nil {
-		attendee.Name = *req.Name
-	}
-	if req.Email != nil {
-		attendee.Email = *req.Email
-	}
-	if req.Status != nil {
-		attendee.Status = *req.Status
-	}
-	attendee.UpdatedAt = time.Now()
+func (db *DB) UpdateAttendee(ctx context.Context, id string, req models.UpdateAttendeeRequest, expectedVersion *int) (*models.Attendee, error) {
+	var attendee *models.Attendee
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getAttendee(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
 
-	_, err = db.pool.Exec(ctx,
-		`UPDATE attendees SET name=$1, email=$2, status=$3, updated_at=$4 WHERE id=$5`,
-		attendee.Name, attendee.Email, attendee.Status, attendee.UpdatedAt, id,
-	)
+		updated := *before
+		attendee = &updated
+		if req.Name != nil {
+			attendee.Name = *req.Name
+		}
+		if req.Email != nil {
+			attendee.Email = *req.Email
+		}
+		if req.Status != nil {
+			attendee.Status = *req.Status
+		}
+		if req.ArrivalTime != nil {
+			attendee.ArrivalTime = *req.ArrivalTime
+		}
+		if req.DepartureTime != nil {
+			attendee.DepartureTime = *req.DepartureTime
+		}
+		if req.HouseholdID != nil {
+			if *req.HouseholdID == "" {
+				attendee.HouseholdID = nil
+			} else {
+				if err := checkHouseholdInEvent(ctx, tx, *req.HouseholdID, attendee.EventID); err != nil {
+					return err
+				}
+				attendee.HouseholdID = req.HouseholdID
+			}
+		}
+		if req.Adults != nil {
+			attendee.Adults = *req.Adults
+		}
+		if req.Children != nil {
+			attendee.Children = *req.Children
+		}
+		if req.DietaryRestrictions != nil {
+			attendee.DietaryRestrictions = normalizeTags(*req.DietaryRestrictions)
+		}
+		if req.Allergies != nil {
+			attendee.Allergies = normalizeTags(*req.Allergies)
+		}
+		if req.DietaryNotes != nil {
+			attendee.DietaryNotes = *req.DietaryNotes
+		}
+		attendee.UpdatedAt = time.Now()
+		attendee.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE attendees SET name=$1, email=$2, status=$3, arrival_time=$4, departure_time=$5,
+			 household_id=$6, adults=$7, children=$8,
+			 dietary_restrictions=$9, allergies=$10, dietary_notes=$11, updated_at=$12, version=$13
+			 WHERE id=$14 AND version=$15`,
+			attendee.Name, attendee.Email, attendee.Status, attendee.ArrivalTime, attendee.DepartureTime,
+			attendee.HouseholdID, attendee.Adults, attendee.Children,
+			attendee.DietaryRestrictions, attendee.Allergies, attendee.DietaryNotes,
+			attendee.UpdatedAt, attendee.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+		if !sameID(before.HouseholdID, attendee.HouseholdID) {
+			if err := clearHouseholdPrimary(ctx, tx, id, attendee.HouseholdID); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "attendee", EntityID: id, EventID: &attendee.EventID,
+			Before: before, After: attendee,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &attendee, nil
+	return attendee, nil
 }
 
+// DeleteAttendee returns ErrNotFound if there was nothing to delete
 func (db *DB) DeleteAttendee(ctx context.Context, id string) error {
-	_, err := db.pool.Exec(ctx, `DELETE FROM attendees WHERE id = $1`, id)
-	return err
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getAttendee(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM attendees WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "attendee", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
 }
 
 func (db *DB) GetEventWithAttendees(ctx context.Context, id string) (*models.EventWithAttendees, error) {
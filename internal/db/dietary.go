@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"farm-time/internal/models"
+)
+
+// normalizeTags lowercases, trims and de-duplicates dietary tags, keeping
+// their order. The result is never nil so it is stored as '{}' not NULL.
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// mergeTags returns the union of two normalized tag lists
+func mergeTags(a, b []string) []string {
+	return normalizeTags(append(append([]string{}, a...), b...))
+}
+
+// withUserDietaryProfiles folds the dietary profile of each attendee's user
+// account, matched by email, into the attendee's own profile
+func withUserDietaryProfiles(ctx context.Context, q querier, attendees []models.Attendee) ([]models.Attendee, error) {
+	var emails []string
+	for _, a := range attendees {
+		if a.Email != "" {
+			emails = append(emails, strings.ToLower(a.Email))
+		}
+	}
+	if len(emails) == 0 {
+		return attendees, nil
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT LOWER(email), dietary_restrictions, allergies, COALESCE(dietary_notes, '')
+		 FROM users WHERE LOWER(email) = ANY($1)`, emails)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := map[string]models.DietaryProfile{}
+	for rows.Next() {
+		var email string
+		var p models.DietaryProfile
+		if err := rows.Scan(&email, &p.Restrictions, &p.Allergies, &p.Notes); err != nil {
+			return nil, err
+		}
+		profiles[email] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	merged := make([]models.Attendee, len(attendees))
+	for i, a := range attendees {
+		if p, ok := profiles[strings.ToLower(a.Email)]; ok {
+			a.DietaryRestrictions = mergeTags(a.DietaryRestrictions, p.Restrictions)
+			a.Allergies = mergeTags(a.Allergies, p.Allergies)
+			if a.DietaryNotes == "" {
+				a.DietaryNotes = p.Notes
+			} else if p.Notes != "" && p.Notes != a.DietaryNotes {
+				a.DietaryNotes += "\n" + p.Notes
+			}
+		}
+		merged[i] = a
+	}
+	return merged, nil
+}
+
+// dietaryWarnings flags each item of the meal that contains something one of
+// its diners is allergic to
+func (hc *headcounter) dietaryWarnings(m models.Meal, items []models.MealItem) []models.DietaryWarning {
+	warnings := []models.DietaryWarning{}
+	diners := hc.diners(m)
+	for _, item := range items {
+		for _, allergen := range item.Allergens {
+			for _, a := range diners {
+				for _, allergy := range a.Allergies {
+					if allergy == allergen {
+						warnings = append(warnings, models.DietaryWarning{
+							AttendeeID:   a.ID,
+							AttendeeName: a.Name,
+							MealItemID:   item.ID,
+							MealItemName: item.Name,
+							Allergen:     allergen,
+						})
+					}
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// GetEventDietarySummary groups the attending attendees of an event by diet
+// and allergy and collects the allergy conflicts across its meals
+func (db *DB) GetEventDietarySummary(ctx context.Context, eventID string) (*models.DietarySummary, error) {
+	hc, err := newHeadcounter(ctx, db.pool, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.DietarySummary{
+		Restrictions: map[string][]string{},
+		Allergies:    map[string][]string{},
+		Notes:        []models.DietaryNote{},
+		Warnings:     []models.DietaryWarning{},
+	}
+	for _, a := range hc.attendees {
+		for _, r := range a.DietaryRestrictions {
+			summary.Restrictions[r] = append(summary.Restrictions[r], a.Name)
+		}
+		for _, allergy := range a.Allergies {
+			summary.Allergies[allergy] = append(summary.Allergies[allergy], a.Name)
+		}
+		if a.DietaryNotes != "" {
+			summary.Notes = append(summary.Notes, models.DietaryNote{
+				AttendeeID: a.ID, AttendeeName: a.Name, Notes: a.DietaryNotes,
+			})
+		}
+	}
+	for _, names := range summary.Restrictions {
+		sort.Strings(names)
+	}
+	for _, names := range summary.Allergies {
+		sort.Strings(names)
+	}
+
+	meals, err := db.GetMealsByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range meals {
+		items, err := db.GetMealItemsByMeal(ctx, m.ID)
+		if err != nil {
+			return nil, err
+		}
+		summary.Warnings = append(summary.Warnings, hc.dietaryWarnings(m, items)...)
+	}
+
+	return summary, nil
+}
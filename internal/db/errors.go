@@ -0,0 +1,110 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Errors returned by DB methods. Callers should match them with errors.Is;
+// the underlying driver error stays wrapped for logging.
+var (
+	// ErrNotFound is returned when the requested row doesn't exist, or when
+	// an update or delete matched nothing
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when a write would violate a unique constraint
+	ErrConflict = errors.New("conflict with existing row")
+
+	// ErrForeignKey is returned when a write references a row that doesn't exist
+	ErrForeignKey = errors.New("referenced row does not exist")
+
+	// ErrCheckViolation is returned when a write violates a check or not-null constraint
+	ErrCheckViolation = errors.New("check constraint violated")
+
+	// ErrVersionConflict is returned when an update's expected version no longer
+	// matches the stored row, meaning someone else changed it first
+	ErrVersionConflict = errors.New("version conflict")
+
+	// ErrParentDeleted is returned when creating or restoring a row whose parent is in the trash
+	ErrParentDeleted = errors.New("parent is in the trash")
+
+	// ErrOverCommitted is returned when a signup would bring more of an item
+	// than is still needed, or an item's quantity is cut below what is
+	// already being brought
+	ErrOverCommitted = errors.New("more than the remaining quantity")
+
+	// ErrOverCapacity is returned when a booking would put more people in a
+	// room, vehicle or activity than it holds
+	ErrOverCapacity = errors.New("over capacity")
+
+	// ErrDatesTaken is returned when an event would overlap another event
+	// and one of them claims the whole property
+	ErrDatesTaken = errors.New("dates overlap an exclusive event")
+
+	// ErrMealsOutsideDates is returned when an event's new dates would leave
+	// some of its meals on days it no longer covers
+	ErrMealsOutsideDates = errors.New("meals outside the event's dates")
+
+	// ErrDependencyCycle is returned when a todo would end up depending on
+	// itself, directly or through other todos
+	ErrDependencyCycle = errors.New("dependency cycle")
+
+	// ErrBlocked is returned when completing a todo whose prerequisites
+	// are still incomplete
+	ErrBlocked = errors.New("blocked by incomplete prerequisites")
+)
+
+// Postgres SQLSTATE codes for integrity constraint violations
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+	pgNotNullViolation    = "23502"
+)
+
+// mapError translates driver errors into the sentinel errors above
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case pgForeignKeyViolation:
+			return fmt.Errorf("%w: %w", ErrForeignKey, err)
+		case pgCheckViolation, pgNotNullViolation:
+			return fmt.Errorf("%w: %w", ErrCheckViolation, err)
+		}
+	}
+	return err
+}
+
+// checkVersion fails with ErrVersionConflict if the caller expected a
+// different version than the one currently stored
+func checkVersion(expected *int, current int) error {
+	if expected != nil && *expected != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// casResult turns a compare-and-swap UPDATE that matched no rows into
+// ErrVersionConflict
+func casResult(tag pgconn.CommandTag, err error) error {
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
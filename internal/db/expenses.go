@@ -0,0 +1,506 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Expense operations
+
+// Split rules for expenses
+const (
+	SplitEqual     = "equal"     // By party size among attending attendees
+	SplitHousehold = "household" // One share per household; attendees outside one count as their own
+	SplitNights    = "nights"    // By party size times nights stayed
+	SplitCustom    = "custom"    // By the expense's own shares
+)
+
+const defaultCurrency = "USD"
+
+const expenseColumns = `x.id, x.event_id, x.payer_attendee_id, a.name, x.amount_cents, x.currency, x.description,
+	x.meal_item_id, x.todo_id, x.split_rule, x.created_by, x.version, x.created_at, x.updated_at`
+
+func scanExpense(row pgx.Row, e *models.Expense) error {
+	var cents int64
+	err := row.Scan(&e.ID, &e.EventID, &e.PayerAttendeeID, &e.PayerName, &cents, &e.Currency, &e.Description,
+		&e.MealItemID, &e.TodoID, &e.SplitRule, &e.CreatedBy, &e.Version, &e.CreatedAt, &e.UpdatedAt)
+	e.Amount = fromCents(cents)
+	return err
+}
+
+// toCents and fromCents convert between API amounts and the whole cents
+// money is stored and split in
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+func normalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return defaultCurrency
+	}
+	return currency
+}
+
+func getExpenseShares(ctx context.Context, q querier, expenseID string) ([]models.ExpenseShare, error) {
+	rows, err := q.Query(ctx,
+		`SELECT s.attendee_id, a.name, s.shares
+		 FROM expense_shares s JOIN attendees a ON s.attendee_id = a.id
+		 WHERE s.expense_id = $1 ORDER BY a.name ASC`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.ExpenseShare{}
+	for rows.Next() {
+		var s models.ExpenseShare
+		if err := rows.Scan(&s.AttendeeID, &s.AttendeeName, &s.Shares); err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+// replaceExpenseShares swaps an expense's custom shares for new ones, all of
+// which must be attendees of the event
+func replaceExpenseShares(ctx context.Context, q querier, expenseID, eventID string, shares []models.ExpenseShare) error {
+	if _, err := q.Exec(ctx, `DELETE FROM expense_shares WHERE expense_id = $1`, expenseID); err != nil {
+		return err
+	}
+	for _, s := range shares {
+		if err := checkAttendeeInEvent(ctx, q, s.AttendeeID, eventID); err != nil {
+			return err
+		}
+		if _, err := q.Exec(ctx,
+			`INSERT INTO expense_shares (expense_id, attendee_id, shares) VALUES ($1, $2, $3)`,
+			expenseID, s.AttendeeID, s.Shares,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkExpenseLinks returns ErrForeignKey unless the meal item and todo an
+// expense points at, if any, belong to its event
+func checkExpenseLinks(ctx context.Context, q querier, e *models.Expense) error {
+	if e.MealItemID != nil {
+		eventID, err := eventIDForMealItem(ctx, q, *e.MealItemID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && *eventID != e.EventID) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if e.TodoID != nil {
+		todo, err := getTodo(ctx, q, *e.TodoID)
+		if errors.Is(err, ErrNotFound) || (err == nil && todo.EventID != e.EventID) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getExpense(ctx context.Context, q querier, id string) (*models.Expense, error) {
+	var expense models.Expense
+	err := scanExpense(q.QueryRow(ctx,
+		`SELECT `+expenseColumns+` FROM expenses x JOIN attendees a ON x.payer_attendee_id = a.id WHERE x.id = $1`, id,
+	), &expense)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	expense.Shares, err = getExpenseShares(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	return &expense, nil
+}
+
+// GetExpense returns an expense with what each attendee owes of it
+func (db *DB) GetExpense(ctx context.Context, id string) (*models.Expense, error) {
+	expense, err := getExpense(ctx, db.pool, id)
+	if err != nil {
+		return nil, err
+	}
+	s, err := db.newExpenseSplitter(ctx, expense.EventID)
+	if err != nil {
+		return nil, err
+	}
+	expense.Split = s.split(*expense)
+	return expense, nil
+}
+
+// GetExpensesByEvent returns an event's expenses, oldest first, each with
+// what each attendee owes of it
+func (db *DB) GetExpensesByEvent(ctx context.Context, eventID string) ([]models.Expense, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+expenseColumns+` FROM expenses x JOIN attendees a ON x.payer_attendee_id = a.id
+		 WHERE x.event_id = $1 ORDER BY x.created_at ASC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expenses := []models.Expense{}
+	for rows.Next() {
+		var e models.Expense
+		if err := scanExpense(rows, &e); err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s, err := db.newExpenseSplitter(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range expenses {
+		if expenses[i].Shares, err = getExpenseShares(ctx, db.pool, expenses[i].ID); err != nil {
+			return nil, err
+		}
+		expenses[i].Split = s.split(expenses[i])
+	}
+	return expenses, nil
+}
+
+func (db *DB) CreateExpense(ctx context.Context, eventID string, req models.CreateExpenseRequest) (*models.Expense, error) {
+	expense := &models.Expense{
+		ID:              uuid.New().String(),
+		EventID:         eventID,
+		PayerAttendeeID: req.PayerAttendeeID,
+		Amount:          fromCents(toCents(req.Amount)),
+		Currency:        normalizeCurrency(req.Currency),
+		Description:     req.Description,
+		MealItemID:      req.MealItemID,
+		TodoID:          req.TodoID,
+		SplitRule:       req.SplitRule,
+		Shares:          []models.ExpenseShare{},
+		CreatedBy:       actorFromContext(ctx),
+		Version:         1,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	if expense.SplitRule == "" {
+		expense.SplitRule = SplitEqual
+	}
+	if expense.SplitRule == SplitCustom {
+		expense.Shares = req.Shares
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if err := checkAttendeeInEvent(ctx, tx, expense.PayerAttendeeID, eventID); err != nil {
+			return err
+		}
+		if name := attendeeName(ctx, tx, &expense.PayerAttendeeID); name != nil {
+			expense.PayerName = *name
+		}
+		if err := checkExpenseLinks(ctx, tx, expense); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO expenses (id, event_id, payer_attendee_id, amount_cents, currency, description, meal_item_id,
+			 todo_id, split_rule, created_by, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			expense.ID, expense.EventID, expense.PayerAttendeeID, toCents(expense.Amount), expense.Currency,
+			expense.Description, expense.MealItemID, expense.TodoID, expense.SplitRule, expense.CreatedBy,
+			expense.CreatedAt, expense.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := replaceExpenseShares(ctx, tx, expense.ID, eventID, expense.Shares); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "expense", EntityID: expense.ID, EventID: &eventID, After: expense,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetExpense(ctx, expense.ID)
+}
+
+func (db *DB) UpdateExpense(ctx context.Context, id string, req models.UpdateExpenseRequest, expectedVersion *int) (*models.Expense, error) {
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getExpense(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		expense := &updated
+		if req.PayerAttendeeID != nil {
+			if err := checkAttendeeInEvent(ctx, tx, *req.PayerAttendeeID, expense.EventID); err != nil {
+				return err
+			}
+			expense.PayerAttendeeID = *req.PayerAttendeeID
+			if name := attendeeName(ctx, tx, req.PayerAttendeeID); name != nil {
+				expense.PayerName = *name
+			}
+		}
+		if req.Amount != nil {
+			expense.Amount = fromCents(toCents(*req.Amount))
+		}
+		if req.Currency != nil {
+			expense.Currency = normalizeCurrency(*req.Currency)
+		}
+		if req.Description != nil {
+			expense.Description = *req.Description
+		}
+		if req.MealItemID != nil {
+			expense.MealItemID = req.MealItemID
+			if *req.MealItemID == "" {
+				expense.MealItemID = nil
+			}
+		}
+		if req.TodoID != nil {
+			expense.TodoID = req.TodoID
+			if *req.TodoID == "" {
+				expense.TodoID = nil
+			}
+		}
+		if req.SplitRule != nil {
+			expense.SplitRule = *req.SplitRule
+		}
+		if req.Shares != nil {
+			expense.Shares = *req.Shares
+		}
+		if expense.SplitRule != SplitCustom {
+			expense.Shares = []models.ExpenseShare{}
+		}
+		if err := checkExpenseLinks(ctx, tx, expense); err != nil {
+			return err
+		}
+		expense.UpdatedAt = time.Now()
+		expense.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE expenses SET payer_attendee_id=$1, amount_cents=$2, currency=$3, description=$4, meal_item_id=$5,
+			 todo_id=$6, split_rule=$7, updated_at=$8, version=$9
+			 WHERE id=$10 AND version=$11`,
+			expense.PayerAttendeeID, toCents(expense.Amount), expense.Currency, expense.Description, expense.MealItemID,
+			expense.TodoID, expense.SplitRule, expense.UpdatedAt, expense.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+		if err := replaceExpenseShares(ctx, tx, id, expense.EventID, expense.Shares); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "expense", EntityID: id, EventID: &expense.EventID, Before: before, After: expense,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetExpense(ctx, id)
+}
+
+// DeleteExpense returns ErrNotFound if there was nothing to delete
+func (db *DB) DeleteExpense(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getExpense(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM expenses WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "expense", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
+
+// expenseSplitter works out who owes what of an event's expenses. Nights
+// are counted in the event's time zone.
+type expenseSplitter struct {
+	loc        *time.Location
+	attending  []models.Attendee
+	byID       map[string]models.Attendee
+	households map[string]models.HouseholdWithMembers
+}
+
+func (db *DB) newExpenseSplitter(ctx context.Context, eventID string) (*expenseSplitter, error) {
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	attendees, err := db.GetAttendeesByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	households, err := db.GetHouseholdsByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &expenseSplitter{
+		loc:        EventLocation(event),
+		byID:       make(map[string]models.Attendee, len(attendees)),
+		households: make(map[string]models.HouseholdWithMembers, len(households)),
+	}
+	for _, a := range attendees {
+		s.byID[a.ID] = a
+		if a.Status == "attending" {
+			s.attending = append(s.attending, a)
+		}
+	}
+	for _, h := range households {
+		s.households[h.ID] = h
+	}
+	return s, nil
+}
+
+// nights counts the nights an attendee stays, by calendar days between
+// arrival and departure
+func (s *expenseSplitter) nights(a models.Attendee) int {
+	arrival := a.ArrivalTime.In(s.loc)
+	departure := a.DepartureTime.In(s.loc)
+	first := time.Date(arrival.Year(), arrival.Month(), arrival.Day(), 0, 0, 0, 0, s.loc)
+	last := time.Date(departure.Year(), departure.Month(), departure.Day(), 0, 0, 0, 0, s.loc)
+	return max(int(math.Round(last.Sub(first).Hours()/24)), 0)
+}
+
+type splitWeight struct {
+	attendee models.Attendee
+	weight   float64
+}
+
+// weights lists who shares an expense and in what proportion
+func (s *expenseSplitter) weights(e models.Expense) []splitWeight {
+	var weights []splitWeight
+	switch e.SplitRule {
+	case SplitCustom:
+		for _, share := range e.Shares {
+			if a, ok := s.byID[share.AttendeeID]; ok {
+				weights = append(weights, splitWeight{a, share.Shares})
+			}
+		}
+
+	case SplitHousehold:
+		// Each household pays through its primary contact if they're
+		// coming, otherwise through its first attending member
+		seen := map[string]bool{}
+		for _, a := range s.attending {
+			if a.HouseholdID == nil {
+				weights = append(weights, splitWeight{a, 1})
+				continue
+			}
+			if seen[*a.HouseholdID] {
+				continue
+			}
+			seen[*a.HouseholdID] = true
+			payer := a
+			if h, ok := s.households[*a.HouseholdID]; ok && h.PrimaryAttendeeID != nil {
+				if primary, ok := s.byID[*h.PrimaryAttendeeID]; ok && primary.Status == "attending" {
+					payer = primary
+				}
+			}
+			weights = append(weights, splitWeight{payer, 1})
+		}
+
+	case SplitNights:
+		for _, a := range s.attending {
+			weights = append(weights, splitWeight{a, float64(s.nights(a) * partySize(a))})
+		}
+		if totalWeight(weights) > 0 {
+			break
+		}
+		// A day trip: nobody stays the night, so split it equally
+		fallthrough
+
+	default:
+		weights = nil
+		for _, a := range s.attending {
+			weights = append(weights, splitWeight{a, float64(partySize(a))})
+		}
+	}
+	return weights
+}
+
+func totalWeight(weights []splitWeight) float64 {
+	total := 0.0
+	for _, w := range weights {
+		total += w.weight
+	}
+	return total
+}
+
+// split divides an expense by its rule. Cents that don't divide evenly go
+// to the largest remainders, so the parts always add up to the amount. An
+// expense nobody shares is left with the payer.
+func (s *expenseSplitter) split(e models.Expense) []models.ExpenseSplit {
+	weights := s.weights(e)
+	total := totalWeight(weights)
+	if total <= 0 {
+		return []models.ExpenseSplit{{AttendeeID: e.PayerAttendeeID, AttendeeName: e.PayerName, Amount: e.Amount}}
+	}
+
+	cents := toCents(e.Amount)
+	parts := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	allocated := int64(0)
+	for i, w := range weights {
+		exact := float64(cents) * w.weight / total
+		parts[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(parts[i])
+		allocated += parts[i]
+	}
+	for ; allocated < cents; allocated++ {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		parts[best]++
+		remainders[best] = -1
+	}
+
+	split := []models.ExpenseSplit{}
+	for i, w := range weights {
+		if parts[i] == 0 {
+			continue
+		}
+		split = append(split, models.ExpenseSplit{
+			AttendeeID:   w.attendee.ID,
+			AttendeeName: w.attendee.Name,
+			Amount:       fromCents(parts[i]),
+		})
+	}
+	return split
+}
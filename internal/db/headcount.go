@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"farm-time/internal/models"
+)
+
+const dateLayout = "2006-01-02"
+
+// mealWindows gives the local hours [start, end) during which each meal type
+// is served. Types not listed here ("other") span the whole day.
+var mealWindows = map[string][2]int{
+	"breakfast": {7, 10},
+	"lunch":     {11, 14},
+	"snacks":    {14, 17},
+	"dinner":    {17, 21},
+}
+
+// mealWindow returns when a meal of the given type is served on day
+func mealWindow(day time.Time, mealType string) (time.Time, time.Time) {
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	if w, ok := mealWindows[mealType]; ok {
+		return midnight.Add(time.Duration(w[0]) * time.Hour), midnight.Add(time.Duration(w[1]) * time.Hour)
+	}
+	return midnight, midnight.AddDate(0, 0, 1)
+}
+
+// onSite reports whether the attendee is at the event at some point in [start, end)
+func onSite(a models.Attendee, start, end time.Time) bool {
+	return a.ArrivalTime.Before(end) && a.DepartureTime.After(start)
+}
+
+// headcounter computes expected meal headcounts for one event. Meal dates
+// are interpreted in the event's time zone.
+type headcounter struct {
+	loc        *time.Location
+	attendees  []models.Attendee
+	byID       map[string]models.Attendee   // Every attendee, whatever their status
+	attendance map[string]map[string]string // meal ID -> attendee ID -> answer
+}
+
+func newHeadcounter(ctx context.Context, q querier, eventID string) (*headcounter, error) {
+	event, err := getEvent(ctx, q, eventID)
+	if err != nil {
+		return nil, err
+	}
+	attendees, err := getAttendeesByEvent(ctx, q, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	attendees, err = withUserDietaryProfiles(ctx, q, attendees)
+	if err != nil {
+		return nil, err
+	}
+
+	var attending []models.Attendee
+	byID := make(map[string]models.Attendee, len(attendees))
+	for _, a := range attendees {
+		byID[a.ID] = a
+		if a.Status == "attending" {
+			attending = append(attending, a)
+		}
+	}
+
+	attendance, err := getEventAttendance(ctx, q, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &headcounter{loc: EventLocation(event), attendees: attending, byID: byID, attendance: attendance}, nil
+}
+
+// expected returns the attending attendees on site while the meal is
+// served, before anyone opts in or out. Undated meals expect everyone.
+func (hc *headcounter) expected(m models.Meal) []models.Attendee {
+	if m.MealDate == nil {
+		return hc.attendees
+	}
+	day, err := time.ParseInLocation(dateLayout, *m.MealDate, hc.loc)
+	if err != nil {
+		return hc.attendees
+	}
+
+	start, end := mealWindow(day, m.MealType)
+	var present []models.Attendee
+	for _, a := range hc.attendees {
+		if onSite(a, start, end) {
+			present = append(present, a)
+		}
+	}
+	return present
+}
+
+// diners returns who will eat the meal: those expected on site who haven't
+// opted out, plus anyone who explicitly opted in
+func (hc *headcounter) diners(m models.Meal) []models.Attendee {
+	answers := hc.attendance[m.ID]
+	var diners []models.Attendee
+	expected := map[string]bool{}
+	for _, a := range hc.expected(m) {
+		expected[a.ID] = true
+		if answers[a.ID] != AttendanceOut {
+			diners = append(diners, a)
+		}
+	}
+	for attendeeID, status := range answers {
+		if status != AttendanceIn || expected[attendeeID] {
+			continue
+		}
+		if a, ok := hc.byID[attendeeID]; ok {
+			diners = append(diners, a)
+		}
+	}
+	return diners
+}
+
+// meal returns how many people will eat the meal, counting each diner's
+// whole party
+func (hc *headcounter) meal(m models.Meal) int {
+	count := 0
+	for _, a := range hc.diners(m) {
+		count += partySize(a)
+	}
+	return count
+}
+
+// attendanceCounts tallies answers for a meal. Unknown counts attendees
+// expected on site who haven't said in or out.
+func (hc *headcounter) attendanceCounts(m models.Meal) models.MealAttendanceCounts {
+	answers := hc.attendance[m.ID]
+	var counts models.MealAttendanceCounts
+	for _, status := range answers {
+		switch status {
+		case AttendanceIn:
+			counts.In++
+		case AttendanceOut:
+			counts.Out++
+		}
+	}
+	for _, a := range hc.expected(m) {
+		if status := answers[a.ID]; status != AttendanceIn && status != AttendanceOut {
+			counts.Unknown++
+		}
+	}
+	return counts
+}
+
+// GetEventOccupancy summarizes who is on site, arriving and leaving on each
+// day of the event, with the expected headcount of that day's meals
+func (db *DB) GetEventOccupancy(ctx context.Context, eventID string) ([]models.DayOccupancy, error) {
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	hc, err := newHeadcounter(ctx, db.pool, eventID)
+	if err != nil {
+		return nil, err
+	}
+	meals, err := db.GetMealsByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := event.StartTime.In(hc.loc)
+	end := event.EndTime.In(hc.loc)
+	firstDay := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, hc.loc)
+	lastDay := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, hc.loc)
+
+	days := []models.DayOccupancy{}
+	for d := firstDay; !d.After(lastDay); d = d.AddDate(0, 0, 1) {
+		next := d.AddDate(0, 0, 1)
+		date := d.Format(dateLayout)
+		day := models.DayOccupancy{
+			Date:      date,
+			Arriving:  []string{},
+			Departing: []string{},
+			Meals:     []models.MealHeadcount{},
+		}
+
+		for _, a := range hc.attendees {
+			if onSite(a, d, next) {
+				day.OnSite += partySize(a)
+			}
+			if !a.ArrivalTime.After(next) && a.DepartureTime.After(next) {
+				day.Overnight += partySize(a)
+			}
+			if a.ArrivalTime.In(hc.loc).Format(dateLayout) == date {
+				day.Arriving = append(day.Arriving, a.Name)
+			}
+			if a.DepartureTime.In(hc.loc).Format(dateLayout) == date {
+				day.Departing = append(day.Departing, a.Name)
+			}
+		}
+
+		for _, m := range meals {
+			if m.MealDate != nil && *m.MealDate == date {
+				day.Meals = append(day.Meals, models.MealHeadcount{
+					MealID:            m.ID,
+					Name:              m.Name,
+					MealType:          m.MealType,
+					ExpectedHeadcount: hc.meal(m),
+				})
+			}
+		}
+
+		days = append(days, day)
+	}
+
+	return days, nil
+}
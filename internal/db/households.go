@@ -0,0 +1,334 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Household operations
+
+const householdColumns = `id, event_id, name, primary_attendee_id, version, created_at, updated_at`
+
+func scanHousehold(row pgx.Row, h *models.Household) error {
+	return row.Scan(&h.ID, &h.EventID, &h.Name, &h.PrimaryAttendeeID, &h.Version, &h.CreatedAt, &h.UpdatedAt)
+}
+
+// partySize is the number of people an attendee row stands for
+func partySize(a models.Attendee) int {
+	return a.Adults + a.Children
+}
+
+func sameID(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func getHousehold(ctx context.Context, q querier, id string) (*models.Household, error) {
+	var household models.Household
+	err := scanHousehold(q.QueryRow(ctx,
+		`SELECT `+householdColumns+` FROM households WHERE id = $1`, id,
+	), &household)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &household, nil
+}
+
+func (db *DB) GetHousehold(ctx context.Context, id string) (*models.Household, error) {
+	return getHousehold(ctx, db.pool, id)
+}
+
+// checkHouseholdInEvent returns ErrForeignKey unless the household exists
+// and belongs to the event
+func checkHouseholdInEvent(ctx context.Context, q querier, householdID, eventID string) error {
+	household, err := getHousehold(ctx, q, householdID)
+	if errors.Is(err, ErrNotFound) || (err == nil && household.EventID != eventID) {
+		return ErrForeignKey
+	}
+	return err
+}
+
+// clearHouseholdPrimary stops an attendee from being the primary contact of
+// any household other than keep, for when they move out of it
+func clearHouseholdPrimary(ctx context.Context, q querier, attendeeID string, keep *string) error {
+	_, err := q.Exec(ctx,
+		`UPDATE households SET primary_attendee_id = NULL, version = version + 1, updated_at = $1
+		 WHERE primary_attendee_id = $2 AND id IS DISTINCT FROM $3`, time.Now(), attendeeID, keep,
+	)
+	return err
+}
+
+// joinHousehold moves an attendee of the household's event into it
+func (db *DB) joinHousehold(ctx context.Context, tx pgx.Tx, attendeeID string, household *models.Household) error {
+	before, err := getAttendee(ctx, tx, attendeeID)
+	if errors.Is(err, ErrNotFound) || (err == nil && before.EventID != household.EventID) {
+		return ErrForeignKey
+	}
+	if err != nil {
+		return err
+	}
+	if sameID(before.HouseholdID, &household.ID) {
+		return nil
+	}
+
+	updated := *before
+	attendee := &updated
+	attendee.HouseholdID = &household.ID
+	attendee.UpdatedAt = time.Now()
+	attendee.Version = before.Version + 1
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE attendees SET household_id=$1, updated_at=$2, version=$3 WHERE id=$4`,
+		attendee.HouseholdID, attendee.UpdatedAt, attendee.Version, attendeeID,
+	); err != nil {
+		return err
+	}
+	if err := clearHouseholdPrimary(ctx, tx, attendeeID, &household.ID); err != nil {
+		return err
+	}
+
+	return db.recordAudit(ctx, tx, auditRecord{
+		Action: AuditUpdate, EntityType: "attendee", EntityID: attendeeID, EventID: &attendee.EventID,
+		Before: before, After: attendee,
+	})
+}
+
+// CreateHousehold adds a household to an event. A primary contact is moved
+// into the new household.
+func (db *DB) CreateHousehold(ctx context.Context, eventID string, req models.CreateHouseholdRequest) (*models.Household, error) {
+	household := &models.Household{
+		ID:                uuid.New().String(),
+		EventID:           eventID,
+		Name:              req.Name,
+		PrimaryAttendeeID: req.PrimaryAttendeeID,
+		Version:           1,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO households (id, event_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+			household.ID, household.EventID, household.Name, household.CreatedAt, household.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if household.PrimaryAttendeeID != nil {
+			if err := db.joinHousehold(ctx, tx, *household.PrimaryAttendeeID, household); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx,
+				`UPDATE households SET primary_attendee_id = $1 WHERE id = $2`, household.PrimaryAttendeeID, household.ID,
+			); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "household", EntityID: household.ID, EventID: &eventID, After: household,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return household, nil
+}
+
+func (db *DB) UpdateHousehold(ctx context.Context, id string, req models.UpdateHouseholdRequest, expectedVersion *int) (*models.Household, error) {
+	var household *models.Household
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getHousehold(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		household = &updated
+		if req.Name != nil {
+			household.Name = *req.Name
+		}
+		if req.PrimaryAttendeeID != nil {
+			if *req.PrimaryAttendeeID == "" {
+				household.PrimaryAttendeeID = nil
+			} else {
+				if err := db.joinHousehold(ctx, tx, *req.PrimaryAttendeeID, household); err != nil {
+					return err
+				}
+				household.PrimaryAttendeeID = req.PrimaryAttendeeID
+			}
+		}
+		household.UpdatedAt = time.Now()
+		household.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE households SET name=$1, primary_attendee_id=$2, updated_at=$3, version=$4
+			 WHERE id=$5 AND version=$6`,
+			household.Name, household.PrimaryAttendeeID, household.UpdatedAt, household.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "household", EntityID: id, EventID: &household.EventID,
+			Before: before, After: household,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return household, nil
+}
+
+// DeleteHousehold removes the grouping but keeps its members as individual
+// attendees. It returns ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteHousehold(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getHousehold(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM households WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "household", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
+
+// withMembers attaches each household's members from the event's attendees
+func withMembers(households []models.Household, attendees []models.Attendee) []models.HouseholdWithMembers {
+	result := make([]models.HouseholdWithMembers, len(households))
+	index := map[string]int{}
+	for i, h := range households {
+		result[i] = models.HouseholdWithMembers{Household: h, Members: []models.Attendee{}}
+		index[h.ID] = i
+	}
+	for _, a := range attendees {
+		if a.HouseholdID == nil {
+			continue
+		}
+		if i, ok := index[*a.HouseholdID]; ok {
+			result[i].Members = append(result[i].Members, a)
+			result[i].Adults += a.Adults
+			result[i].Children += a.Children
+		}
+	}
+	return result
+}
+
+func (db *DB) GetHouseholdsByEvent(ctx context.Context, eventID string) ([]models.HouseholdWithMembers, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+householdColumns+` FROM households WHERE event_id = $1 ORDER BY name ASC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var households []models.Household
+	for rows.Next() {
+		var h models.Household
+		if err := scanHousehold(rows, &h); err != nil {
+			return nil, err
+		}
+		households = append(households, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	attendees, err := db.GetAttendeesByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return withMembers(households, attendees), nil
+}
+
+func (db *DB) GetHouseholdWithMembers(ctx context.Context, id string) (*models.HouseholdWithMembers, error) {
+	household, err := db.GetHousehold(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	attendees, err := db.GetAttendeesByEvent(ctx, household.EventID)
+	if err != nil {
+		return nil, err
+	}
+	return &withMembers([]models.Household{*household}, attendees)[0], nil
+}
+
+// SetHouseholdStatus applies one RSVP to every member of a household
+func (db *DB) SetHouseholdStatus(ctx context.Context, id, status string) (*models.HouseholdWithMembers, error) {
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := getHousehold(ctx, tx, id); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx,
+			`SELECT `+attendeeColumns+` FROM attendees WHERE household_id = $1 FOR UPDATE`, id)
+		if err != nil {
+			return err
+		}
+		var members []models.Attendee
+		for rows.Next() {
+			var a models.Attendee
+			if err := scanAttendee(rows, &a); err != nil {
+				rows.Close()
+				return err
+			}
+			members = append(members, a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, before := range members {
+			if before.Status == status {
+				continue
+			}
+			attendee := before
+			attendee.Status = status
+			attendee.UpdatedAt = now
+			attendee.Version = before.Version + 1
+
+			if _, err := tx.Exec(ctx,
+				`UPDATE attendees SET status=$1, updated_at=$2, version=$3 WHERE id=$4`,
+				attendee.Status, attendee.UpdatedAt, attendee.Version, attendee.ID,
+			); err != nil {
+				return err
+			}
+			if err := db.recordAudit(ctx, tx, auditRecord{
+				Action: AuditUpdate, EntityType: "attendee", EntityID: attendee.ID, EventID: &attendee.EventID,
+				Before: &before, After: &attendee,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetHouseholdWithMembers(ctx, id)
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"farm-time/internal/models"
+)
+
+// Itinerary kinds, which also break ties between entries at the same time
+const (
+	ItineraryMeal     = "meal"
+	ItineraryActivity = "activity"
+	ItineraryTodo     = "todo"
+)
+
+var itineraryKindOrder = map[string]int{ItineraryMeal: 0, ItineraryActivity: 1, ItineraryTodo: 2}
+
+// GetItinerary merges an event's meals, activities and todos with due times
+// into a day-by-day schedule in the event's time zone. Every day of the
+// event is listed, even when nothing is planned; days outside the event
+// only appear if something is scheduled on them.
+func (db *DB) GetItinerary(ctx context.Context, eventID string) (*models.Itinerary, error) {
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	meals, err := db.GetMealsByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	activities, err := db.GetActivitiesByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	todos, err := db.GetTodosByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := EventLocation(event)
+	itinerary := &models.Itinerary{
+		EventID:     eventID,
+		Days:        []models.ItineraryDay{},
+		Unscheduled: []models.ItineraryEntry{},
+	}
+	byDay := map[string][]models.ItineraryEntry{}
+	add := func(e models.ItineraryEntry) {
+		day := e.Start.In(loc).Format(dateLayout)
+		byDay[day] = append(byDay[day], e)
+	}
+
+	for _, m := range meals {
+		entry := models.ItineraryEntry{Kind: ItineraryMeal, ID: m.ID, Title: m.Name, Detail: m.MealType}
+		var day time.Time
+		if m.MealDate != nil {
+			day, err = time.ParseInLocation(dateLayout, *m.MealDate, loc)
+		}
+		if m.MealDate == nil || err != nil {
+			itinerary.Unscheduled = append(itinerary.Unscheduled, entry)
+			continue
+		}
+		start, end := mealWindow(day, m.MealType)
+		_, timed := mealWindows[m.MealType]
+		entry.Start, entry.End, entry.AllDay = start, &end, !timed
+		add(entry)
+	}
+
+	for _, ac := range activities {
+		end := ac.EndTime
+		entry := models.ItineraryEntry{
+			Kind: ItineraryActivity, ID: ac.ID, Title: ac.Title, Start: ac.StartTime, End: &end, Location: ac.Location,
+		}
+		if ac.LeaderName != nil {
+			entry.Detail = *ac.LeaderName
+		}
+		add(entry)
+	}
+
+	for _, t := range todos {
+		if t.Completed {
+			continue
+		}
+		entry := models.ItineraryEntry{Kind: ItineraryTodo, ID: t.ID, Title: t.Title}
+		if t.AssignedAttendeeName != nil {
+			entry.Detail = *t.AssignedAttendeeName
+		}
+		if t.DueAt == nil {
+			itinerary.Unscheduled = append(itinerary.Unscheduled, entry)
+			continue
+		}
+		entry.Start = *t.DueAt
+		add(entry)
+	}
+
+	first := event.StartTime.In(loc)
+	first = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	for day := first; day.Before(event.EndTime); day = day.AddDate(0, 0, 1) {
+		if key := day.Format(dateLayout); byDay[key] == nil {
+			byDay[key] = []models.ItineraryEntry{}
+		}
+	}
+
+	dates := make([]string, 0, len(byDay))
+	for date := range byDay {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	for _, date := range dates {
+		entries := byDay[date]
+		sort.SliceStable(entries, func(i, j int) bool {
+			a, b := entries[i], entries[j]
+			if a.AllDay != b.AllDay {
+				return a.AllDay
+			}
+			if !a.Start.Equal(b.Start) {
+				return a.Start.Before(b.Start)
+			}
+			return itineraryKindOrder[a.Kind] < itineraryKindOrder[b.Kind]
+		})
+		itinerary.Days = append(itinerary.Days, models.ItineraryDay{Date: date, Entries: entries})
+	}
+
+	return itinerary, nil
+}
@@ -0,0 +1,526 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Room operations. Rooms belong to the property rather than to an event,
+// so their audit entries have no event.
+
+const roomColumns = `id, name, description, version, created_at, updated_at`
+
+func scanRoom(row pgx.Row, r *models.Room) error {
+	return row.Scan(&r.ID, &r.Name, &r.Description, &r.Version, &r.CreatedAt, &r.UpdatedAt)
+}
+
+func getRoomBeds(ctx context.Context, q querier, roomID string) ([]models.Bed, error) {
+	rows, err := q.Query(ctx,
+		`SELECT bed_type, capacity, label FROM room_beds WHERE room_id = $1 ORDER BY position ASC`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	beds := []models.Bed{}
+	for rows.Next() {
+		var b models.Bed
+		if err := rows.Scan(&b.BedType, &b.Capacity, &b.Label); err != nil {
+			return nil, err
+		}
+		beds = append(beds, b)
+	}
+	return beds, rows.Err()
+}
+
+// withBeds loads a room's beds and totals its capacity
+func withBeds(ctx context.Context, q querier, room *models.Room) error {
+	beds, err := getRoomBeds(ctx, q, room.ID)
+	if err != nil {
+		return err
+	}
+	room.Beds = beds
+	room.Capacity = roomCapacity(beds)
+	return nil
+}
+
+func roomCapacity(beds []models.Bed) int {
+	capacity := 0
+	for _, b := range beds {
+		capacity += b.Capacity
+	}
+	return capacity
+}
+
+// replaceRoomBeds swaps a room's beds for a new set
+func replaceRoomBeds(ctx context.Context, q querier, roomID string, beds []models.Bed) error {
+	if _, err := q.Exec(ctx, `DELETE FROM room_beds WHERE room_id = $1`, roomID); err != nil {
+		return err
+	}
+	for i, b := range beds {
+		if _, err := q.Exec(ctx,
+			`INSERT INTO room_beds (room_id, position, bed_type, capacity, label) VALUES ($1, $2, $3, $4, $5)`,
+			roomID, i, b.BedType, b.Capacity, b.Label,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRoom(ctx context.Context, q querier, id string) (*models.Room, error) {
+	var room models.Room
+	if err := scanRoom(q.QueryRow(ctx, `SELECT `+roomColumns+` FROM rooms WHERE id = $1`, id), &room); err != nil {
+		return nil, mapError(err)
+	}
+	if err := withBeds(ctx, q, &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (db *DB) GetRoom(ctx context.Context, id string) (*models.Room, error) {
+	return getRoom(ctx, db.pool, id)
+}
+
+// ListRooms returns every room on the property alphabetically
+func (db *DB) ListRooms(ctx context.Context) ([]models.Room, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+roomColumns+` FROM rooms ORDER BY LOWER(name) ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []models.Room{}
+	for rows.Next() {
+		var r models.Room
+		if err := scanRoom(rows, &r); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range rooms {
+		if err := withBeds(ctx, db.pool, &rooms[i]); err != nil {
+			return nil, err
+		}
+	}
+	return rooms, nil
+}
+
+func (db *DB) CreateRoom(ctx context.Context, req models.CreateRoomRequest) (*models.Room, error) {
+	room := &models.Room{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		Beds:        req.Beds,
+		Capacity:    roomCapacity(req.Beds),
+		Version:     1,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if room.Beds == nil {
+		room.Beds = []models.Bed{}
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO rooms (id, name, description, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+			room.ID, room.Name, room.Description, room.CreatedAt, room.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := replaceRoomBeds(ctx, tx, room.ID, room.Beds); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "room", EntityID: room.ID, After: room,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// UpdateRoom changes a room. Taking beds away doesn't move anyone out; the
+// lodging view flags nights the room is then over capacity.
+func (db *DB) UpdateRoom(ctx context.Context, id string, req models.UpdateRoomRequest, expectedVersion *int) (*models.Room, error) {
+	var room *models.Room
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getRoom(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		room = &updated
+		if req.Name != nil {
+			room.Name = *req.Name
+		}
+		if req.Description != nil {
+			room.Description = *req.Description
+		}
+		room.UpdatedAt = time.Now()
+		room.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE rooms SET name=$1, description=$2, updated_at=$3, version=$4 WHERE id=$5 AND version=$6`,
+			room.Name, room.Description, room.UpdatedAt, room.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+		if req.Beds != nil {
+			room.Beds = *req.Beds
+			if room.Beds == nil {
+				room.Beds = []models.Bed{}
+			}
+			room.Capacity = roomCapacity(room.Beds)
+			if err := replaceRoomBeds(ctx, tx, id, room.Beds); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "room", EntityID: id, Before: before, After: room,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// DeleteRoom removes a room along with everyone's assignments to it. It
+// returns ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteRoom(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getRoom(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM rooms WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "room", EntityID: id, Before: before,
+		})
+	})
+}
+
+// Sleeping assignment operations
+
+const sleepingAssignmentColumns = `s.id, s.event_id, s.attendee_id, a.name, a.adults + a.children, s.room_id, r.name,
+	s.night::text, s.created_by, s.created_at`
+
+const sleepingAssignmentJoins = ` FROM sleeping_assignments s
+	JOIN attendees a ON s.attendee_id = a.id
+	JOIN rooms r ON s.room_id = r.id
+	JOIN events e ON s.event_id = e.id`
+
+func scanSleepingAssignment(row pgx.Row, s *models.SleepingAssignment) error {
+	return row.Scan(&s.ID, &s.EventID, &s.AttendeeID, &s.AttendeeName, &s.PartySize, &s.RoomID, &s.RoomName,
+		&s.Night, &s.CreatedBy, &s.CreatedAt)
+}
+
+func querySleepingAssignments(ctx context.Context, q querier, where string, args ...any) ([]models.SleepingAssignment, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+sleepingAssignmentColumns+sleepingAssignmentJoins+` WHERE `+where+` ORDER BY s.night ASC, a.name ASC`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []models.SleepingAssignment{}
+	for rows.Next() {
+		var s models.SleepingAssignment
+		if err := scanSleepingAssignment(rows, &s); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, s)
+	}
+	return assignments, rows.Err()
+}
+
+func getSleepingAssignment(ctx context.Context, q querier, id string) (*models.SleepingAssignment, error) {
+	var assignment models.SleepingAssignment
+	err := scanSleepingAssignment(q.QueryRow(ctx,
+		`SELECT `+sleepingAssignmentColumns+sleepingAssignmentJoins+` WHERE s.id = $1`, id,
+	), &assignment)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &assignment, nil
+}
+
+// StayNights lists the nights, as YYYY-MM-DD of the evening, an attendee
+// sleeps on site: those they arrive by and leave after the following
+// midnight of. Dates are in loc.
+func StayNights(a models.Attendee, loc *time.Location) []string {
+	arrival := a.ArrivalTime.In(loc)
+	departure := a.DepartureTime.In(loc)
+	nights := []string{}
+	for d := time.Date(arrival.Year(), arrival.Month(), arrival.Day(), 0, 0, 0, 0, loc); d.Before(departure); d = d.AddDate(0, 0, 1) {
+		next := d.AddDate(0, 0, 1)
+		if !a.ArrivalTime.After(next) && a.DepartureTime.After(next) {
+			nights = append(nights, d.Format(dateLayout))
+		}
+	}
+	return nights
+}
+
+// AssignSleeping puts an attendee's party in a room for the given nights,
+// or for their whole stay. It returns ErrOverCapacity if the room, counting
+// every event's guests, can't fit them on one of the nights, and
+// ErrConflict if they already sleep elsewhere that night and req.Replace
+// isn't set.
+func (db *DB) AssignSleeping(ctx context.Context, eventID string, req models.AssignSleepingRequest) ([]models.SleepingAssignment, error) {
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		event, err := getEvent(ctx, tx, eventID)
+		if err != nil {
+			return err
+		}
+		attendee, err := getAttendee(ctx, tx, req.AttendeeID)
+		if errors.Is(err, ErrNotFound) || (err == nil && attendee.EventID != eventID) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+
+		// Lock the room so two people can't take its last bed at once
+		if _, err := tx.Exec(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, req.RoomID); err != nil {
+			return err
+		}
+		room, err := getRoom(ctx, tx, req.RoomID)
+		if errors.Is(err, ErrNotFound) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+
+		nights := req.Nights
+		if len(nights) == 0 {
+			nights = StayNights(*attendee, EventLocation(event))
+		}
+		for _, night := range nights {
+			var occupied int
+			if err := tx.QueryRow(ctx,
+				`SELECT COALESCE(SUM(a.adults + a.children), 0)
+				 FROM sleeping_assignments s
+				 JOIN attendees a ON s.attendee_id = a.id
+				 JOIN events e ON s.event_id = e.id
+				 WHERE s.room_id = $1 AND s.night = $2 AND s.attendee_id <> $3 AND e.deleted_at IS NULL`,
+				room.ID, night, attendee.ID,
+			).Scan(&occupied); err != nil {
+				return err
+			}
+			if occupied+partySize(*attendee) > room.Capacity {
+				return ErrOverCapacity
+			}
+
+			existing, err := querySleepingAssignments(ctx, tx, `s.attendee_id = $1 AND s.night = $2`, attendee.ID, night)
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				if existing[0].RoomID == room.ID {
+					continue
+				}
+				if !req.Replace {
+					return ErrConflict
+				}
+				if _, err := tx.Exec(ctx, `DELETE FROM sleeping_assignments WHERE id = $1`, existing[0].ID); err != nil {
+					return err
+				}
+				if err := db.recordAudit(ctx, tx, auditRecord{
+					Action: AuditDelete, EntityType: "sleeping_assignment", EntityID: existing[0].ID, EventID: &eventID,
+					Before: existing[0],
+				}); err != nil {
+					return err
+				}
+			}
+
+			assignment := &models.SleepingAssignment{
+				ID:           uuid.New().String(),
+				EventID:      eventID,
+				AttendeeID:   attendee.ID,
+				AttendeeName: attendee.Name,
+				PartySize:    partySize(*attendee),
+				RoomID:       room.ID,
+				RoomName:     room.Name,
+				Night:        night,
+				CreatedBy:    actorFromContext(ctx),
+				CreatedAt:    time.Now(),
+			}
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO sleeping_assignments (id, event_id, attendee_id, room_id, night, created_by, created_at)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				assignment.ID, eventID, assignment.AttendeeID, assignment.RoomID, assignment.Night,
+				assignment.CreatedBy, assignment.CreatedAt,
+			); err != nil {
+				return err
+			}
+			if err := db.recordAudit(ctx, tx, auditRecord{
+				Action: AuditCreate, EntityType: "sleeping_assignment", EntityID: assignment.ID, EventID: &eventID,
+				After: assignment,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return querySleepingAssignments(ctx, db.pool, `s.event_id = $1 AND s.attendee_id = $2`, eventID, req.AttendeeID)
+}
+
+func (db *DB) GetSleepingAssignment(ctx context.Context, id string) (*models.SleepingAssignment, error) {
+	return getSleepingAssignment(ctx, db.pool, id)
+}
+
+// DeleteSleepingAssignment returns ErrNotFound if there was nothing to delete
+func (db *DB) DeleteSleepingAssignment(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getSleepingAssignment(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM sleeping_assignments WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "sleeping_assignment", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
+
+// GetEventLodging lays out who sleeps where on each night of an event.
+// Rooms are shared by every event, so guests of overlapping events count
+// toward a room's occupancy too.
+func (db *DB) GetEventLodging(ctx context.Context, eventID string) ([]models.NightLodging, error) {
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	attendees, err := db.GetAttendeesByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := db.ListRooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := EventLocation(event)
+	start := event.StartTime.In(loc)
+	end := event.EndTime.In(loc)
+	firstNight := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	lastMorning := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc)
+
+	assignments, err := querySleepingAssignments(ctx, db.pool,
+		`s.night >= $1::date AND s.night < $2::date AND e.deleted_at IS NULL`, firstNight.Format(dateLayout), lastMorning.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	staying := map[string]map[string]bool{} // night -> attendee ID
+	for _, a := range attendees {
+		if a.Status != "attending" {
+			continue
+		}
+		for _, night := range StayNights(a, loc) {
+			if staying[night] == nil {
+				staying[night] = map[string]bool{}
+			}
+			staying[night][a.ID] = true
+		}
+	}
+
+	nights := []models.NightLodging{}
+	for d := firstNight; d.Before(lastMorning); d = d.AddDate(0, 0, 1) {
+		night := d.Format(dateLayout)
+		lodging := models.NightLodging{
+			Night:      night,
+			Rooms:      []models.RoomOccupancy{},
+			Unassigned: []models.LodgingGuest{},
+			Warnings:   []models.LodgingWarning{},
+		}
+
+		assigned := map[string]bool{}
+		for _, room := range rooms {
+			occupancy := models.RoomOccupancy{
+				RoomID:    room.ID,
+				RoomName:  room.Name,
+				Capacity:  room.Capacity,
+				Occupants: []models.SleepingAssignment{},
+			}
+			for _, s := range assignments {
+				if s.Night != night || s.RoomID != room.ID {
+					continue
+				}
+				occupancy.Occupants = append(occupancy.Occupants, s)
+				occupancy.Occupied += s.PartySize
+				if s.EventID != eventID {
+					continue
+				}
+				assigned[s.AttendeeID] = true
+				if !staying[night][s.AttendeeID] {
+					lodging.Warnings = append(lodging.Warnings, models.LodgingWarning{
+						AttendeeID:   s.AttendeeID,
+						AttendeeName: s.AttendeeName,
+						RoomID:       room.ID,
+						Message:      s.AttendeeName + " has a bed in " + room.Name + " but isn't staying this night",
+					})
+				}
+			}
+			if occupancy.Occupied > occupancy.Capacity {
+				occupancy.OverCapacity = true
+				lodging.Warnings = append(lodging.Warnings, models.LodgingWarning{
+					RoomID:  room.ID,
+					Message: room.Name + " has more people than beds",
+				})
+			}
+			lodging.Rooms = append(lodging.Rooms, occupancy)
+		}
+
+		for _, a := range attendees {
+			if staying[night][a.ID] && !assigned[a.ID] {
+				lodging.Unassigned = append(lodging.Unassigned, models.LodgingGuest{
+					AttendeeID:   a.ID,
+					AttendeeName: a.Name,
+					PartySize:    partySize(a),
+				})
+			}
+		}
+
+		nights = append(nights, lodging)
+	}
+
+	return nights, nil
+}
@@ -0,0 +1,392 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Meal planning: moving, copying and swapping meals between days and
+// events, and ordering the items within a meal
+
+// MoveMeal moves a meal, with its items, signups and comments, to another
+// date and/or event. Attendees belong to one event, so moving to another
+// event drops the item assignments and meal attendance answers, which would
+// otherwise point at people from the old event, and works out comment
+// mentions again among the new event's attendees.
+func (db *DB) MoveMeal(ctx context.Context, id string, req models.MoveMealRequest, expectedVersion *int) (*models.Meal, error) {
+	var meal *models.Meal
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getMeal(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		meal = &updated
+		if req.EventID != nil {
+			if _, err := getEvent(ctx, tx, *req.EventID); err != nil {
+				return err
+			}
+			meal.EventID = *req.EventID
+		}
+		if req.MealDate != nil {
+			meal.MealDate = req.MealDate
+		}
+		meal.UpdatedAt = time.Now()
+		meal.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE meals SET event_id=$1, meal_date=$2, updated_at=$3, version=$4
+			 WHERE id=$5 AND version=$6 AND deleted_at IS NULL`,
+			meal.EventID, meal.MealDate, meal.UpdatedAt, meal.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		if meal.EventID != before.EventID {
+			if err := db.unassignMealItems(ctx, tx, meal); err != nil {
+				return err
+			}
+			if err := db.clearMealAttendance(ctx, tx, meal); err != nil {
+				return err
+			}
+			if err := db.moveMealComments(ctx, tx, meal); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "meal", EntityID: id, EventID: &meal.EventID, Before: before, After: meal,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return meal, nil
+}
+
+// unassignMealItems clears the assignments of a meal's items, those in the
+// trash included, auditing each item against the meal's event
+func (db *DB) unassignMealItems(ctx context.Context, tx pgx.Tx, meal *models.Meal) error {
+	rows, err := tx.Query(ctx,
+		`SELECT `+mealItemColumns+`
+		 FROM meal_items mi
+		 LEFT JOIN attendees a ON mi.assigned_attendee_id = a.id
+		 WHERE mi.meal_id = $1 AND mi.assigned_attendee_id IS NOT NULL
+		 FOR UPDATE OF mi`, meal.ID)
+	if err != nil {
+		return err
+	}
+	var items []models.MealItem
+	for rows.Next() {
+		var item models.MealItem
+		if err := scanMealItem(rows, &item); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, before := range items {
+		item := before
+		item.AssignedAttendeeID = nil
+		item.AssignedAttendeeName = nil
+		item.AssignedQuantity = nil
+		item.UpdatedAt = meal.UpdatedAt
+		if err := tx.QueryRow(ctx,
+			`UPDATE meal_items SET assigned_attendee_id = NULL, assigned_quantity = NULL,
+			 updated_at = $1, version = version + 1
+			 WHERE id = $2
+			 RETURNING version`, item.UpdatedAt, item.ID,
+		).Scan(&item.Version); err != nil {
+			return err
+		}
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "meal_item", EntityID: item.ID, EventID: &meal.EventID,
+			Before: before, After: item,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearMealAttendance deletes a meal's attendance answers, auditing each
+// one against the meal's event
+func (db *DB) clearMealAttendance(ctx context.Context, tx pgx.Tx, meal *models.Meal) error {
+	rows, err := tx.Query(ctx,
+		`DELETE FROM meal_attendance ma USING attendees a
+		 WHERE ma.meal_id = $1 AND ma.attendee_id = a.id
+		 RETURNING ma.id, ma.meal_id, ma.attendee_id, a.name, ma.status, ma.updated_at`, meal.ID)
+	if err != nil {
+		return err
+	}
+	var answers []models.MealAttendance
+	for rows.Next() {
+		var ma models.MealAttendance
+		if err := rows.Scan(&ma.ID, &ma.MealID, &ma.AttendeeID, &ma.AttendeeName, &ma.Status, &ma.UpdatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		answers = append(answers, ma)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, before := range answers {
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "meal_attendance", EntityID: before.ID, EventID: &meal.EventID,
+			Before: before,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyMeal copies a meal and its items, in order, to another date and/or
+// event, optionally with their signups. Item assignments are only kept
+// when copying within the same event.
+func (db *DB) CopyMeal(ctx context.Context, id string, req models.CopyMealRequest) (*models.MealWithItems, error) {
+	var copyID string
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		source, err := getMeal(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		meal := &models.Meal{
+			ID:        uuid.New().String(),
+			EventID:   source.EventID,
+			Name:      source.Name,
+			MealType:  source.MealType,
+			MealDate:  source.MealDate,
+			Notes:     source.Notes,
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if req.EventID != nil {
+			if _, err := getEvent(ctx, tx, *req.EventID); err != nil {
+				return err
+			}
+			meal.EventID = *req.EventID
+		}
+		if req.MealDate != nil {
+			meal.MealDate = req.MealDate
+		}
+		copyID = meal.ID
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO meals (id, event_id, name, meal_type, meal_date, notes, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			meal.ID, meal.EventID, meal.Name, meal.MealType, meal.MealDate, meal.Notes, meal.CreatedAt, meal.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "meal", EntityID: meal.ID, EventID: &meal.EventID, After: meal,
+		}); err != nil {
+			return err
+		}
+
+		items, err := getMealItemsByMeal(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		for _, sourceItem := range items {
+			item := sourceItem
+			item.ID = uuid.New().String()
+			item.MealID = meal.ID
+			item.Version = 1
+			item.CreatedAt = now
+			item.UpdatedAt = now
+			if meal.EventID != source.EventID {
+				item.AssignedAttendeeID = nil
+				item.AssignedAttendeeName = nil
+				item.AssignedQuantity = nil
+			}
+			if err := insertMealItem(ctx, tx, &item); err != nil {
+				return err
+			}
+			if err := db.recordAudit(ctx, tx, auditRecord{
+				Action: AuditCreate, EntityType: "meal_item", EntityID: item.ID, EventID: &meal.EventID, After: item,
+			}); err != nil {
+				return err
+			}
+
+			if !req.IncludeSignups {
+				continue
+			}
+			signups, err := getSignupsByMealItem(ctx, tx, sourceItem.ID)
+			if err != nil {
+				return err
+			}
+			for _, s := range signups {
+				s.ID = uuid.New().String()
+				s.MealItemID = item.ID
+				s.CreatedAt = now
+				if _, err := tx.Exec(ctx,
+					`INSERT INTO meal_signups (id, meal_item_id, user_id, quantity, notes, created_at)
+					 VALUES ($1, $2, $3, $4, $5, $6)`,
+					s.ID, s.MealItemID, s.UserID, s.Quantity, s.Notes, s.CreatedAt,
+				); err != nil {
+					return err
+				}
+				if err := db.recordAudit(ctx, tx, auditRecord{
+					Action: AuditCreate, EntityType: "meal_signup", EntityID: s.ID, EventID: &meal.EventID, After: s,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetMealWithItems(ctx, copyID)
+}
+
+// SwapMeals exchanges the date and meal type of two meals of the same
+// event, e.g. to have Friday's dinner on Saturday and Saturday's on Friday.
+// expectedVersion applies to the first meal.
+func (db *DB) SwapMeals(ctx context.Context, id, otherID string, expectedVersion *int) ([]models.Meal, error) {
+	var meals []models.Meal
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		first, err := getMeal(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, first.Version); err != nil {
+			return err
+		}
+		second, err := getMeal(ctx, tx, otherID)
+		if err != nil {
+			return err
+		}
+		if first.EventID != second.EventID || first.ID == second.ID {
+			return ErrCheckViolation
+		}
+
+		now := time.Now()
+		pairs := []struct{ before, other *models.Meal }{{first, second}, {second, first}}
+		for _, p := range pairs {
+			meal := *p.before
+			meal.MealDate = p.other.MealDate
+			meal.MealType = p.other.MealType
+			meal.UpdatedAt = now
+			meal.Version = p.before.Version + 1
+
+			err = casResult(tx.Exec(ctx,
+				`UPDATE meals SET meal_type=$1, meal_date=$2, updated_at=$3, version=$4
+				 WHERE id=$5 AND version=$6 AND deleted_at IS NULL`,
+				meal.MealType, meal.MealDate, meal.UpdatedAt, meal.Version, meal.ID, p.before.Version,
+			))
+			if err != nil {
+				return err
+			}
+			if err := db.recordAudit(ctx, tx, auditRecord{
+				Action: AuditUpdate, EntityType: "meal", EntityID: meal.ID, EventID: &meal.EventID, Before: p.before, After: meal,
+			}); err != nil {
+				return err
+			}
+			meals = append(meals, meal)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return meals, nil
+}
+
+// ReorderMealItems puts a meal's items in the given order. itemIDs must list
+// every item of the meal exactly once; ErrCheckViolation is returned if it
+// doesn't, e.g. because someone added an item in the meantime. The order is
+// part of the meal, so its version is bumped; if expectedVersion is set it
+// must match the meal's current one.
+func (db *DB) ReorderMealItems(ctx context.Context, mealID string, itemIDs []string, expectedVersion *int) (*models.MealWithItems, error) {
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		meal, err := getMeal(ctx, tx, mealID)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, meal.Version); err != nil {
+			return err
+		}
+		items, err := getMealItemsByMeal(ctx, tx, mealID)
+		if err != nil {
+			return err
+		}
+		if len(items) != len(itemIDs) {
+			return ErrCheckViolation
+		}
+
+		current := make(map[string]models.MealItem, len(items))
+		before := make([]string, len(items))
+		for i, item := range items {
+			current[item.ID] = item
+			before[i] = item.ID
+		}
+
+		now := time.Now()
+		for position, itemID := range itemIDs {
+			item, ok := current[itemID]
+			if !ok {
+				return ErrCheckViolation
+			}
+			delete(current, itemID)
+			if item.SortOrder == position {
+				continue
+			}
+			if _, err := tx.Exec(ctx,
+				`UPDATE meal_items SET sort_order = $1, updated_at = $2, version = version + 1 WHERE id = $3`,
+				position, now, itemID,
+			); err != nil {
+				return err
+			}
+		}
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE meals SET updated_at=$1, version=$2 WHERE id=$3 AND version=$4 AND deleted_at IS NULL`,
+			now, meal.Version+1, mealID, meal.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		type itemOrder struct {
+			ItemIDs []string `json:"item_ids"`
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "meal_item_order", EntityID: mealID, EventID: &meal.EventID,
+			Before: itemOrder{ItemIDs: before}, After: itemOrder{ItemIDs: itemIDs},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetMealWithItems(ctx, mealID)
+}
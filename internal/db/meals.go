@@ -5,12 +5,21 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
 	"farm-time/internal/models"
 )
 
 // Meal operations
 
+const mealColumns = `id, event_id, name, meal_type,
+	CASE WHEN meal_date IS NOT NULL THEN meal_date::text ELSE NULL END as meal_date,
+	COALESCE(notes, ''), version, created_at, updated_at, deleted_at`
+
+func scanMeal(row pgx.Row, m *models.Meal) error {
+	return row.Scan(&m.ID, &m.EventID, &m.Name, &m.MealType, &m.MealDate, &m.Notes, &m.Version, &m.CreatedAt, &m.UpdatedAt, &m.DeletedAt)
+}
+
 func (db *DB) CreateMeal(ctx context.Context, eventID string, req models.CreateMealRequest) (*models.Meal, error) {
 	meal := &models.Meal{
 		ID:        uuid.New().String(),
@@ -19,15 +28,29 @@ func (db *DB) CreateMeal(ctx context.Context, eventID string, req models.CreateM
 		MealType:  req.MealType,
 		MealDate:  req.MealDate,
 		Notes:     req.Notes,
+		Version:   1,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	_, err := db.pool.Exec(ctx,
-		`INSERT INTO meals (id, event_id, name, meal_type, meal_date, notes, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		meal.ID, meal.EventID, meal.Name, meal.MealType, meal.MealDate, meal.Notes, meal.CreatedAt, meal.UpdatedAt,
-	)
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if err := checkLiveEvent(ctx, tx, eventID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO meals (id, event_id, name, meal_type, meal_date, notes, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			meal.ID, meal.EventID, meal.Name, meal.MealType, meal.MealDate, meal.Notes, meal.CreatedAt, meal.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "meal", EntityID: meal.ID, EventID: &eventID, After: meal,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -35,27 +58,25 @@ func (db *DB) CreateMeal(ctx context.Context, eventID string, req models.CreateM
 	return meal, nil
 }
 
-func (db *DB) GetMeal(ctx context.Context, id string) (*models.Meal, error) {
+func getMeal(ctx context.Context, q querier, id string) (*models.Meal, error) {
 	var meal models.Meal
-	err := db.pool.QueryRow(ctx,
-		`SELECT id, event_id, name, meal_type,
-		 CASE WHEN meal_date IS NOT NULL THEN meal_date::text ELSE NULL END as meal_date,
-		 COALESCE(notes, ''), created_at, updated_at
-		 FROM meals WHERE id = $1`, id,
-	).Scan(&meal.ID, &meal.EventID, &meal.Name, &meal.MealType, &meal.MealDate, &meal.Notes, &meal.CreatedAt, &meal.UpdatedAt)
-
+	err := scanMeal(q.QueryRow(ctx,
+		`SELECT `+mealColumns+` FROM meals WHERE id = $1 AND deleted_at IS NULL`, id,
+	), &meal)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &meal, nil
 }
 
+func (db *DB) GetMeal(ctx context.Context, id string) (*models.Meal, error) {
+	return getMeal(ctx, db.pool, id)
+}
+
 func (db *DB) GetMealsByEvent(ctx context.Context, eventID string) ([]models.Meal, error) {
 	rows, err := db.pool.Query(ctx,
-		`SELECT id, event_id, name, meal_type,
-		 CASE WHEN meal_date IS NOT NULL THEN meal_date::text ELSE NULL END as meal_date,
-		 COALESCE(notes, ''), created_at, updated_at
-		 FROM meals WHERE event_id = $1 ORDER BY meal_date ASC NULLS LAST, created_at ASC`, eventID)
+		`SELECT `+mealColumns+`
+		 FROM meals WHERE event_id = $1 AND deleted_at IS NULL ORDER BY meal_date ASC NULLS LAST, created_at ASC`, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +85,7 @@ func (db *DB) GetMealsByEvent(ctx context.Context, eventID string) ([]models.Mea
 	var meals []models.Meal
 	for rows.Next() {
 		var m models.Meal
-		if err := rows.Scan(&m.ID, &m.EventID, &m.Name, &m.MealType, &m.MealDate, &m.Notes, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		if err := scanMeal(rows, &m); err != nil {
 			return nil, err
 		}
 		meals = append(meals, m)
@@ -73,30 +94,78 @@ func (db *DB) GetMealsByEvent(ctx context.Context, eventID string) ([]models.Mea
 	return meals, nil
 }
 
-func (db *DB) UpdateMeal(ctx context.Context, id string, req models.UpdateMealRequest) (*models.Meal, error) {
-	meal, err := db.GetMeal(ctx, id)
+// mealsOutsideDates returns the event's live meals dated on days the event
+// doesn't cover, in its time zone
+func mealsOutsideDates(ctx context.Context, q querier, event *models.Event) ([]models.Meal, error) {
+	loc := EventLocation(event)
+	rows, err := q.Query(ctx,
+		`SELECT `+mealColumns+`
+		 FROM meals WHERE event_id = $1 AND deleted_at IS NULL AND (meal_date < $2::date OR meal_date > $3::date)
+		 ORDER BY meal_date ASC, created_at ASC`,
+		event.ID, event.StartTime.In(loc).Format(dateLayout), event.EndTime.In(loc).Format(dateLayout))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	if req.Name != nil {
-		meal.Name = *req.Name
-	}
-	if req.MealType != nil {
-		meal.MealType = *req.MealType
-	}
-	if req.MealDate != nil {
-		meal.MealDate = req.MealDate
-	}
-	if req.Notes != nil {
-		meal.Notes = *req.Notes
+	meals := []models.Meal{}
+	for rows.Next() {
+		var m models.Meal
+		if err := scanMeal(rows, &m); err != nil {
+			return nil, err
+		}
+		meals = append(meals, m)
 	}
-	meal.UpdatedAt = time.Now()
+	return meals, rows.Err()
+}
 
-	_, err = db.pool.Exec(ctx,
-		`UPDATE meals SET name=$1, meal_type=$2, meal_date=$3, notes=$4, updated_at=$5 WHERE id=$6`,
-		meal.Name, meal.MealType, meal.MealDate, meal.Notes, meal.UpdatedAt, id,
-	)
+// MealsOutsideDates returns the meals that would be left outside the dates
+// of event, which may have changes not saved yet
+func (db *DB) MealsOutsideDates(ctx context.Context, event *models.Event) ([]models.Meal, error) {
+	return mealsOutsideDates(ctx, db.pool, event)
+}
+
+func (db *DB) UpdateMeal(ctx context.Context, id string, req models.UpdateMealRequest, expectedVersion *int) (*models.Meal, error) {
+	var meal *models.Meal
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getMeal(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		meal = &updated
+		if req.Name != nil {
+			meal.Name = *req.Name
+		}
+		if req.MealType != nil {
+			meal.MealType = *req.MealType
+		}
+		if req.MealDate != nil {
+			meal.MealDate = req.MealDate
+		}
+		if req.Notes != nil {
+			meal.Notes = *req.Notes
+		}
+		meal.UpdatedAt = time.Now()
+		meal.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE meals SET name=$1, meal_type=$2, meal_date=$3, notes=$4, updated_at=$5, version=$6
+			 WHERE id=$7 AND version=$8 AND deleted_at IS NULL`,
+			meal.Name, meal.MealType, meal.MealDate, meal.Notes, meal.UpdatedAt, meal.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "meal", EntityID: id, EventID: &meal.EventID, Before: before, After: meal,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -104,13 +173,52 @@ func (db *DB) UpdateMeal(ctx context.Context, id string, req models.UpdateMealRe
 	return meal, nil
 }
 
+// DeleteMeal moves the meal and its items to the trash. It returns
+// ErrNotFound if there was nothing to delete.
 func (db *DB) DeleteMeal(ctx context.Context, id string) error {
-	_, err := db.pool.Exec(ctx, `DELETE FROM meals WHERE id = $1`, id)
-	return err
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getMeal(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if _, err := tx.Exec(ctx, `UPDATE meals SET deleted_at = $1 WHERE id = $2`, now, id); err != nil {
+			return err
+		}
+		if err := softDeleteMealChildren(ctx, tx, id, now); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "meal", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
 }
 
 // MealItem operations
 
+const mealItemColumns = `mi.id, mi.meal_id, mi.name, mi.description, mi.assigned_attendee_id, a.name,
+	mi.quantity, mi.unit, mi.assigned_quantity, mi.host_buys, mi.category, mi.recipe_id,
+	mi.allergens, mi.diet_tags, mi.sort_order, mi.version, mi.created_at, mi.updated_at, mi.deleted_at`
+
+func scanMealItem(row pgx.Row, i *models.MealItem) error {
+	return row.Scan(&i.ID, &i.MealID, &i.Name, &i.Description, &i.AssignedAttendeeID, &i.AssignedAttendeeName,
+		&i.Quantity, &i.Unit, &i.AssignedQuantity, &i.HostBuys, &i.Category, &i.RecipeID, &i.Allergens, &i.DietTags, &i.SortOrder, &i.Version, &i.CreatedAt, &i.UpdatedAt, &i.DeletedAt)
+}
+
+// attendeeName looks up an attendee's display name, returning nil if it can't be found
+func attendeeName(ctx context.Context, q querier, attendeeID *string) *string {
+	if attendeeID == nil {
+		return nil
+	}
+	var name string
+	if err := q.QueryRow(ctx, `SELECT name FROM attendees WHERE id = $1`, *attendeeID).Scan(&name); err != nil {
+		return nil
+	}
+	return &name
+}
+
 func (db *DB) CreateMealItem(ctx context.Context, mealID string, req models.CreateMealItemRequest) (*models.MealItem, error) {
 	item := &models.MealItem{
 		ID:                 uuid.New().String(),
@@ -118,52 +226,94 @@ func (db *DB) CreateMealItem(ctx context.Context, mealID string, req models.Crea
 		Name:               req.Name,
 		Description:        req.Description,
 		AssignedAttendeeID: req.AssignedAttendeeID,
+		Quantity:           req.Quantity,
+		Unit:               req.Unit,
+		AssignedQuantity:   req.AssignedQuantity,
+		HostBuys:           req.HostBuys,
+		Category:           req.Category,
+		RecipeID:           req.RecipeID,
+		Allergens:          normalizeTags(req.Allergens),
+		DietTags:           normalizeTags(req.DietTags),
+		Version:            1,
 		CreatedAt:          time.Now(),
 		UpdatedAt:          time.Now(),
 	}
 
-	_, err := db.pool.Exec(ctx,
-		`INSERT INTO meal_items (id, meal_id, name, description, assigned_attendee_id, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		item.ID, item.MealID, item.Name, item.Description, item.AssignedAttendeeID, item.CreatedAt, item.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if err := checkLiveMeal(ctx, tx, mealID); err != nil {
+			return err
+		}
+		eventID, err := eventIDForMeal(ctx, tx, mealID)
+		if err != nil {
+			return err
+		}
+		if item.AssignedAttendeeID != nil {
+			if err := checkAttendeeInEvent(ctx, tx, *item.AssignedAttendeeID, *eventID); err != nil {
+				return err
+			}
+		}
 
-	// Get attendee name if assigned
-	if item.AssignedAttendeeID != nil {
-		var name string
-		err := db.pool.QueryRow(ctx, `SELECT name FROM attendees WHERE id = $1`, *item.AssignedAttendeeID).Scan(&name)
-		if err == nil {
-			item.AssignedAttendeeName = &name
+		// New items go to the end of the meal
+		if err := tx.QueryRow(ctx,
+			`SELECT COALESCE(MAX(sort_order) + 1, 0) FROM meal_items WHERE meal_id = $1 AND deleted_at IS NULL`, mealID,
+		).Scan(&item.SortOrder); err != nil {
+			return err
+		}
+
+		if err := insertMealItem(ctx, tx, item); err != nil {
+			return err
 		}
+
+		// Get attendee name if assigned
+		item.AssignedAttendeeName = attendeeName(ctx, tx, item.AssignedAttendeeID)
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "meal_item", EntityID: item.ID, EventID: eventID, After: item,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return item, nil
 }
 
-func (db *DB) GetMealItem(ctx context.Context, id string) (*models.MealItem, error) {
+func insertMealItem(ctx context.Context, q querier, item *models.MealItem) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO meal_items (id, meal_id, name, description, assigned_attendee_id, quantity, unit, assigned_quantity,
+		 host_buys, category, recipe_id, allergens, diet_tags, sort_order, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		item.ID, item.MealID, item.Name, item.Description, item.AssignedAttendeeID,
+		item.Quantity, item.Unit, item.AssignedQuantity, item.HostBuys, item.Category, item.RecipeID, item.Allergens, item.DietTags,
+		item.SortOrder, item.CreatedAt, item.UpdatedAt,
+	)
+	return err
+}
+
+func getMealItem(ctx context.Context, q querier, id string) (*models.MealItem, error) {
 	var item models.MealItem
-	err := db.pool.QueryRow(ctx,
-		`SELECT mi.id, mi.meal_id, mi.name, mi.description, mi.assigned_attendee_id, a.name, mi.created_at, mi.updated_at
+	err := scanMealItem(q.QueryRow(ctx,
+		`SELECT `+mealItemColumns+`
 		 FROM meal_items mi
 		 LEFT JOIN attendees a ON mi.assigned_attendee_id = a.id
-		 WHERE mi.id = $1`, id,
-	).Scan(&item.ID, &item.MealID, &item.Name, &item.Description, &item.AssignedAttendeeID, &item.AssignedAttendeeName, &item.CreatedAt, &item.UpdatedAt)
-
+		 WHERE mi.id = $1 AND mi.deleted_at IS NULL`, id,
+	), &item)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &item, nil
 }
 
-func (db *DB) GetMealItemsByMeal(ctx context.Context, mealID string) ([]models.MealItem, error) {
-	rows, err := db.pool.Query(ctx,
-		`SELECT mi.id, mi.meal_id, mi.name, mi.description, mi.assigned_attendee_id, a.name, mi.created_at, mi.updated_at
+func (db *DB) GetMealItem(ctx context.Context, id string) (*models.MealItem, error) {
+	return getMealItem(ctx, db.pool, id)
+}
+
+func getMealItemsByMeal(ctx context.Context, q querier, mealID string) ([]models.MealItem, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+mealItemColumns+`
 		 FROM meal_items mi
 		 LEFT JOIN attendees a ON mi.assigned_attendee_id = a.id
-		 WHERE mi.meal_id = $1 ORDER BY mi.name ASC`, mealID)
+		 WHERE mi.meal_id = $1 AND mi.deleted_at IS NULL ORDER BY mi.sort_order ASC, mi.name ASC`, mealID)
 	if err != nil {
 		return nil, err
 	}
@@ -172,47 +322,127 @@ func (db *DB) GetMealItemsByMeal(ctx context.Context, mealID string) ([]models.M
 	var items []models.MealItem
 	for rows.Next() {
 		var i models.MealItem
-		if err := rows.Scan(&i.ID, &i.MealID, &i.Name, &i.Description, &i.AssignedAttendeeID, &i.AssignedAttendeeName, &i.CreatedAt, &i.UpdatedAt); err != nil {
+		if err := scanMealItem(rows, &i); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
 	}
 
-	return items, nil
+	return items, rows.Err()
 }
 
-func (db *DB) UpdateMealItem(ctx context.Context, id string, req models.UpdateMealItemRequest) (*models.MealItem, error) {
-	item, err := db.GetMealItem(ctx, id)
-	if err != nil {
-		return nil, err
-	}
+// GetMealItemsByMeal returns a meal's items in their sort order
+func (db *DB) GetMealItemsByMeal(ctx context.Context, mealID string) ([]models.MealItem, error) {
+	return getMealItemsByMeal(ctx, db.pool, mealID)
+}
 
-	if req.Name != nil {
-		item.Name = *req.Name
-	}
-	if req.Description != nil {
-		item.Description = *req.Description
-	}
-	if req.AssignedAttendeeID != nil {
-		if *req.AssignedAttendeeID == "" {
-			item.AssignedAttendeeID = nil
-			item.AssignedAttendeeName = nil
-		} else {
-			item.AssignedAttendeeID = req.AssignedAttendeeID
-			// Get attendee name
-			var name string
-			err := db.pool.QueryRow(ctx, `SELECT name FROM attendees WHERE id = $1`, *req.AssignedAttendeeID).Scan(&name)
-			if err == nil {
-				item.AssignedAttendeeName = &name
+// UpdateMealItem applies req as a compare-and-swap against the stored
+// version. The item is locked against new signups while it changes, and
+// ErrOverCommitted is returned if its quantity would end up below what the
+// signups and the assignee's set share already bring.
+func (db *DB) UpdateMealItem(ctx context.Context, id string, req models.UpdateMealItemRequest, expectedVersion *int) (*models.MealItem, error) {
+	var item *models.MealItem
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		coverage, err := lockMealItemCoverage(ctx, tx, id, "")
+		if err != nil {
+			return err
+		}
+		before := &coverage.MealItem
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+		eventID, err := eventIDForMeal(ctx, tx, before.MealID)
+		if err != nil {
+			return err
+		}
+
+		updated := *before
+		item = &updated
+		if req.Name != nil {
+			item.Name = *req.Name
+		}
+		if req.Description != nil {
+			item.Description = *req.Description
+		}
+		if req.AssignedAttendeeID != nil {
+			if *req.AssignedAttendeeID == "" {
+				item.AssignedAttendeeID = nil
+				item.AssignedAttendeeName = nil
+			} else {
+				if err := checkAttendeeInEvent(ctx, tx, *req.AssignedAttendeeID, *eventID); err != nil {
+					return err
+				}
+				item.AssignedAttendeeID = req.AssignedAttendeeID
+				item.AssignedAttendeeName = attendeeName(ctx, tx, req.AssignedAttendeeID)
 			}
 		}
-	}
-	item.UpdatedAt = time.Now()
+		if req.Quantity != nil {
+			item.Quantity = req.Quantity
+			if *req.Quantity == 0 {
+				item.Quantity = nil
+			}
+		}
+		if req.Unit != nil {
+			item.Unit = *req.Unit
+		}
+		if req.AssignedQuantity != nil {
+			item.AssignedQuantity = req.AssignedQuantity
+			if *req.AssignedQuantity == 0 {
+				item.AssignedQuantity = nil
+			}
+		}
+		if req.HostBuys != nil {
+			item.HostBuys = *req.HostBuys
+		}
+		if req.Category != nil {
+			item.Category = *req.Category
+		}
+		if req.RecipeID != nil {
+			item.RecipeID = req.RecipeID
+			if *req.RecipeID == "" {
+				item.RecipeID = nil
+			}
+		}
+		if req.Allergens != nil {
+			item.Allergens = normalizeTags(*req.Allergens)
+		}
+		if req.DietTags != nil {
+			item.DietTags = normalizeTags(*req.DietTags)
+		}
+		if item.Quantity != nil {
+			committed := 0.0
+			if item.AssignedAttendeeID != nil && item.AssignedQuantity != nil {
+				committed += *item.AssignedQuantity
+			}
+			for _, s := range coverage.Signups {
+				if s.Quantity != nil {
+					committed += *s.Quantity
+				}
+			}
+			if committed > *item.Quantity {
+				return ErrOverCommitted
+			}
+		}
+		item.UpdatedAt = time.Now()
+		item.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE meal_items SET name=$1, description=$2, assigned_attendee_id=$3, quantity=$4, unit=$5,
+			 assigned_quantity=$6, host_buys=$7, category=$8, recipe_id=$9, allergens=$10, diet_tags=$11,
+			 updated_at=$12, version=$13
+			 WHERE id=$14 AND version=$15 AND deleted_at IS NULL`,
+			item.Name, item.Description, item.AssignedAttendeeID, item.Quantity, item.Unit,
+			item.AssignedQuantity, item.HostBuys, item.Category, item.RecipeID, item.Allergens, item.DietTags,
+			item.UpdatedAt, item.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
 
-	_, err = db.pool.Exec(ctx,
-		`UPDATE meal_items SET name=$1, description=$2, assigned_attendee_id=$3, updated_at=$4 WHERE id=$5`,
-		item.Name, item.Description, item.AssignedAttendeeID, item.UpdatedAt, id,
-	)
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "meal_item", EntityID: id, EventID: eventID, Before: before, After: item,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -220,19 +450,113 @@ func (db *DB) UpdateMealItem(ctx context.Context, id string, req models.UpdateMe
 	return item, nil
 }
 
+// DeleteMealItem moves the item to the trash. It returns ErrNotFound if
+// there was nothing to delete.
 func (db *DB) DeleteMealItem(ctx context.Context, id string) error {
-	_, err := db.pool.Exec(ctx, `DELETE FROM meal_items WHERE id = $1`, id)
-	return err
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getMealItem(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		eventID, err := eventIDForMeal(ctx, tx, before.MealID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE meal_items SET deleted_at = $1 WHERE id = $2`, time.Now(), id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "meal_item", EntityID: id, EventID: eventID, Before: before,
+		})
+	})
 }
 
 // MealSignup operations
 
+const signupColumns = `s.id, s.meal_item_id, s.user_id, u.name, u.email, s.quantity, COALESCE(s.notes, ''), s.created_at`
+
+func scanSignup(row pgx.Row, s *models.MealSignup) error {
+	return row.Scan(&s.ID, &s.MealItemID, &s.UserID, &s.UserName, &s.UserEmail, &s.Quantity, &s.Notes, &s.CreatedAt)
+}
+
+func getSignupsByMealItem(ctx context.Context, q querier, mealItemID string) ([]models.MealSignup, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+signupColumns+`
+		 FROM meal_signups s
+		 JOIN users u ON s.user_id = u.id
+		 WHERE s.meal_item_id = $1 ORDER BY s.created_at ASC`, mealItemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var signups []models.MealSignup
+	for rows.Next() {
+		var s models.MealSignup
+		if err := scanSignup(rows, &s); err != nil {
+			return nil, err
+		}
+		signups = append(signups, s)
+	}
+
+	return signups, rows.Err()
+}
+
+// lockMealItemCoverage locks a meal item against concurrent signups and
+// returns it with its current coverage, leaving out the signup by skipUserID
+// (so it can be resized)
+func lockMealItemCoverage(ctx context.Context, tx pgx.Tx, itemID, skipUserID string) (*models.MealItemWithSignups, error) {
+	if _, err := tx.Exec(ctx,
+		`SELECT id FROM meal_items WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, itemID,
+	); err != nil {
+		return nil, err
+	}
+	item, err := getMealItem(ctx, tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	signups, err := getSignupsByMealItem(ctx, tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	var others []models.MealSignup
+	for _, s := range signups {
+		if s.UserID != skipUserID {
+			others = append(others, s)
+		}
+	}
+	coverage := withSignups(*item, others)
+	return &coverage, nil
+}
+
+// signupQuantity decides how much a signup brings. Items without a quantity
+// take whatever was asked for; otherwise an unspecified amount is capped at
+// what is still needed, and asking for more than that fails.
+func signupQuantity(item *models.MealItemWithSignups, requested *float64) (*float64, error) {
+	if item.Remaining == nil {
+		return requested, nil
+	}
+	if *item.Remaining <= 0 {
+		return nil, ErrOverCommitted
+	}
+	if requested == nil {
+		return item.Remaining, nil
+	}
+	if *requested > *item.Remaining {
+		return nil, ErrOverCommitted
+	}
+	return requested, nil
+}
+
 func (db *DB) CreateMealSignup(ctx context.Context, mealItemID string, userID string, req models.CreateMealSignupRequest) (*models.MealSignup, error) {
 	// Get user info for the signup record
 	var userName, userEmail string
 	err := db.pool.QueryRow(ctx, `SELECT name, email FROM users WHERE id = $1`, userID).Scan(&userName, &userEmail)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 
 	signup := &models.MealSignup{
@@ -245,11 +569,33 @@ func (db *DB) CreateMealSignup(ctx context.Context, mealItemID string, userID st
 		CreatedAt:  time.Now(),
 	}
 
-	_, err = db.pool.Exec(ctx,
-		`INSERT INTO meal_signups (id, meal_item_id, user_id, notes, created_at)
-		 VALUES ($1, $2, $3, $4, $5)`,
-		signup.ID, signup.MealItemID, signup.UserID, signup.Notes, signup.CreatedAt,
-	)
+	err = db.withTx(ctx, func(tx pgx.Tx) error {
+		item, err := lockMealItemCoverage(ctx, tx, mealItemID, "")
+		if err != nil {
+			return err
+		}
+		signup.Quantity, err = signupQuantity(item, req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO meal_signups (id, meal_item_id, user_id, quantity, notes, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			signup.ID, signup.MealItemID, signup.UserID, signup.Quantity, signup.Notes, signup.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		eventID, err := eventIDForMealItem(ctx, tx, mealItemID)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "meal_signup", EntityID: signup.ID, EventID: eventID, After: signup,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -258,31 +604,123 @@ func (db *DB) CreateMealSignup(ctx context.Context, mealItemID string, userID st
 }
 
 func (db *DB) GetSignupsByMealItem(ctx context.Context, mealItemID string) ([]models.MealSignup, error) {
-	rows, err := db.pool.Query(ctx,
-		`SELECT s.id, s.meal_item_id, s.user_id, u.name, u.email, s.notes, s.created_at
+	return getSignupsByMealItem(ctx, db.pool, mealItemID)
+}
+
+func getMealSignup(ctx context.Context, q querier, mealItemID, userID string) (*models.MealSignup, error) {
+	var signup models.MealSignup
+	err := scanSignup(q.QueryRow(ctx,
+		`SELECT `+signupColumns+`
 		 FROM meal_signups s
 		 JOIN users u ON s.user_id = u.id
-		 WHERE s.meal_item_id = $1 ORDER BY s.created_at ASC`, mealItemID)
+		 WHERE s.meal_item_id = $1 AND s.user_id = $2`, mealItemID, userID,
+	), &signup)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
-	defer rows.Close()
+	return &signup, nil
+}
 
-	var signups []models.MealSignup
-	for rows.Next() {
-		var s models.MealSignup
-		if err := rows.Scan(&s.ID, &s.MealItemID, &s.UserID, &s.UserName, &s.UserEmail, &s.Notes, &s.CreatedAt); err != nil {
-			return nil, err
+// UpdateMealSignup changes how much of an item the user brings. It returns
+// ErrNotFound if the user wasn't signed up.
+func (db *DB) UpdateMealSignup(ctx context.Context, mealItemID string, userID string, req models.UpdateMealSignupRequest) (*models.MealSignup, error) {
+	var signup *models.MealSignup
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		item, err := lockMealItemCoverage(ctx, tx, mealItemID, userID)
+		if err != nil {
+			return err
 		}
-		signups = append(signups, s)
+		before, err := getMealSignup(ctx, tx, mealItemID, userID)
+		if err != nil {
+			return err
+		}
+
+		updated := *before
+		signup = &updated
+		if req.Quantity != nil {
+			signup.Quantity, err = signupQuantity(item, req.Quantity)
+			if err != nil {
+				return err
+			}
+		}
+		if req.Notes != nil {
+			signup.Notes = *req.Notes
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE meal_signups SET quantity = $1, notes = $2 WHERE id = $3`, signup.Quantity, signup.Notes, signup.ID,
+		); err != nil {
+			return err
+		}
+
+		eventID, err := eventIDForMealItem(ctx, tx, mealItemID)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "meal_signup", EntityID: signup.ID, EventID: eventID, Before: before, After: signup,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return signups, nil
+	return signup, nil
 }
 
+// DeleteMealSignup returns ErrNotFound if the user wasn't signed up
 func (db *DB) DeleteMealSignup(ctx context.Context, mealItemID string, userID string) error {
-	_, err := db.pool.Exec(ctx, `DELETE FROM meal_signups WHERE meal_item_id = $1 AND user_id = $2`, mealItemID, userID)
-	return err
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getMealSignup(ctx, tx, mealItemID, userID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM meal_signups WHERE id = $1`, before.ID); err != nil {
+			return err
+		}
+
+		eventID, err := eventIDForMealItem(ctx, tx, mealItemID)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "meal_signup", EntityID: before.ID, EventID: eventID, Before: before,
+		})
+	})
+}
+
+// withSignups works out how much of an item is covered. The assignee brings
+// their assigned quantity, or all of it if none is set; signups without a
+// quantity (made before the item had one) cover nothing.
+func withSignups(item models.MealItem, signups []models.MealSignup) models.MealItemWithSignups {
+	if signups == nil {
+		signups = []models.MealSignup{}
+	}
+	result := models.MealItemWithSignups{MealItem: item, Signups: signups}
+
+	if item.AssignedAttendeeID != nil {
+		switch {
+		case item.AssignedQuantity != nil:
+			result.Covered += *item.AssignedQuantity
+		case item.Quantity != nil:
+			result.Covered += *item.Quantity
+		}
+	}
+	for _, s := range signups {
+		if s.Quantity != nil {
+			result.Covered += *s.Quantity
+		}
+	}
+
+	if item.Quantity == nil {
+		result.FullyCovered = item.AssignedAttendeeID != nil || len(signups) > 0
+		return result
+	}
+	remaining := max(*item.Quantity-result.Covered, 0)
+	result.Remaining = &remaining
+	result.FullyCovered = remaining == 0
+	return result
 }
 
 // Composite queries
@@ -297,14 +735,9 @@ func (db *DB) GetMealItemWithSignups(ctx context.Context, itemID string) (*model
 	if err != nil {
 		return nil, err
 	}
-	if signups == nil {
-		signups = []models.MealSignup{}
-	}
 
-	return &models.MealItemWithSignups{
-		MealItem: *item,
-		Signups:  signups,
-	}, nil
+	result := withSignups(*item, signups)
+	return &result, nil
 }
 
 func (db *DB) GetMealWithItems(ctx context.Context, mealID string) (*models.MealWithItems, error) {
@@ -318,6 +751,11 @@ func (db *DB) GetMealWithItems(ctx context.Context, mealID string) (*models.Meal
 		return nil, err
 	}
 
+	hc, err := newHeadcounter(ctx, db.pool, meal.EventID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get signups for each item
 	itemsWithSignups := make([]models.MealItemWithSignups, len(items))
 	for i, item := range items {
@@ -325,18 +763,15 @@ func (db *DB) GetMealWithItems(ctx context.Context, mealID string) (*models.Meal
 		if err != nil {
 			return nil, err
 		}
-		if signups == nil {
-			signups = []models.MealSignup{}
-		}
-		itemsWithSignups[i] = models.MealItemWithSignups{
-			MealItem: item,
-			Signups:  signups,
-		}
+		itemsWithSignups[i] = withSignups(item, signups)
 	}
 
 	return &models.MealWithItems{
-		Meal:  *meal,
-		Items: itemsWithSignups,
+		Meal:              *meal,
+		ExpectedHeadcount: hc.meal(*meal),
+		Attendance:        hc.attendanceCounts(*meal),
+		DietaryWarnings:   hc.dietaryWarnings(*meal, items),
+		Items:             itemsWithSignups,
 	}, nil
 }
 
@@ -346,6 +781,11 @@ func (db *DB) GetMealsWithItemsByEvent(ctx context.Context, eventID string) ([]m
 		return nil, err
 	}
 
+	hc, err := newHeadcounter(ctx, db.pool, eventID)
+	if err != nil {
+		return nil, err
+	}
+
 	result := make([]models.MealWithItems, len(meals))
 	for i, meal := range meals {
 		items, err := db.GetMealItemsByMeal(ctx, meal.ID)
@@ -359,18 +799,15 @@ func (db *DB) GetMealsWithItemsByEvent(ctx context.Context, eventID string) ([]m
 			if err != nil {
 				return nil, err
 			}
-			if signups == nil {
-				signups = []models.MealSignup{}
-			}
-			itemsWithSignups[j] = models.MealItemWithSignups{
-				MealItem: item,
-				Signups:  signups,
-			}
+			itemsWithSignups[j] = withSignups(item, signups)
 		}
 
 		result[i] = models.MealWithItems{
-			Meal:  meal,
-			Items: itemsWithSignups,
+			Meal:              meal,
+			ExpectedHeadcount: hc.meal(meal),
+			Attendance:        hc.attendanceCounts(meal),
+			DietaryWarnings:   hc.dietaryWarnings(meal, items),
+			Items:             itemsWithSignups,
 		}
 	}
 
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+	"farm-time/internal/units"
+)
+
+// Recipe operations
+
+const recipeColumns = `id, name, description, servings, steps, tags, source_url, created_by, version, created_at, updated_at`
+
+func scanRecipe(row pgx.Row, r *models.Recipe) error {
+	return row.Scan(&r.ID, &r.Name, &r.Description, &r.Servings, &r.Steps, &r.Tags, &r.SourceURL,
+		&r.CreatedBy, &r.Version, &r.CreatedAt, &r.UpdatedAt)
+}
+
+// cleanSteps drops blank steps and never returns nil
+func cleanSteps(steps []string) []string {
+	cleaned := []string{}
+	for _, step := range steps {
+		if step = strings.TrimSpace(step); step != "" {
+			cleaned = append(cleaned, step)
+		}
+	}
+	return cleaned
+}
+
+func getRecipeIngredients(ctx context.Context, q querier, recipeID string) ([]models.RecipeIngredient, error) {
+	rows, err := q.Query(ctx,
+		`SELECT quantity, unit, name, note, category FROM recipe_ingredients WHERE recipe_id = $1 ORDER BY position ASC`,
+		recipeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ingredients := []models.RecipeIngredient{}
+	for rows.Next() {
+		var i models.RecipeIngredient
+		if err := rows.Scan(&i.Quantity, &i.Unit, &i.Name, &i.Note, &i.Category); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, i)
+	}
+	return ingredients, rows.Err()
+}
+
+// replaceRecipeIngredients swaps a recipe's ingredient list for a new one
+func replaceRecipeIngredients(ctx context.Context, q querier, recipeID string, ingredients []models.RecipeIngredient) error {
+	if _, err := q.Exec(ctx, `DELETE FROM recipe_ingredients WHERE recipe_id = $1`, recipeID); err != nil {
+		return err
+	}
+	for i, ing := range ingredients {
+		if _, err := q.Exec(ctx,
+			`INSERT INTO recipe_ingredients (id, recipe_id, position, quantity, unit, name, note, category)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			uuid.New().String(), recipeID, i, ing.Quantity, ing.Unit, ing.Name, ing.Note, ing.Category,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRecipe(ctx context.Context, q querier, id string) (*models.Recipe, error) {
+	var recipe models.Recipe
+	err := scanRecipe(q.QueryRow(ctx, `SELECT `+recipeColumns+` FROM recipes WHERE id = $1`, id), &recipe)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	recipe.Ingredients, err = getRecipeIngredients(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	return &recipe, nil
+}
+
+func (db *DB) GetRecipe(ctx context.Context, id string) (*models.Recipe, error) {
+	return getRecipe(ctx, db.pool, id)
+}
+
+// ListRecipes returns the library alphabetically, optionally only recipes
+// with the given tag
+func (db *DB) ListRecipes(ctx context.Context, tag string) ([]models.Recipe, error) {
+	query := `SELECT ` + recipeColumns + ` FROM recipes`
+	var args []any
+	if tag != "" {
+		query += ` WHERE $1 = ANY(tags)`
+		args = append(args, strings.ToLower(strings.TrimSpace(tag)))
+	}
+	rows, err := db.pool.Query(ctx, query+` ORDER BY LOWER(name) ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipes := []models.Recipe{}
+	for rows.Next() {
+		var r models.Recipe
+		if err := scanRecipe(rows, &r); err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range recipes {
+		recipes[i].Ingredients, err = getRecipeIngredients(ctx, db.pool, recipes[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return recipes, nil
+}
+
+func (db *DB) CreateRecipe(ctx context.Context, req models.CreateRecipeRequest) (*models.Recipe, error) {
+	recipe := &models.Recipe{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		Servings:    req.Servings,
+		Ingredients: req.Ingredients,
+		Steps:       cleanSteps(req.Steps),
+		Tags:        normalizeTags(req.Tags),
+		SourceURL:   req.SourceURL,
+		CreatedBy:   actorFromContext(ctx),
+		Version:     1,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if recipe.Ingredients == nil {
+		recipe.Ingredients = []models.RecipeIngredient{}
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO recipes (id, name, description, servings, steps, tags, source_url, created_by, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			recipe.ID, recipe.Name, recipe.Description, recipe.Servings, recipe.Steps, recipe.Tags,
+			recipe.SourceURL, recipe.CreatedBy, recipe.CreatedAt, recipe.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := replaceRecipeIngredients(ctx, tx, recipe.ID, recipe.Ingredients); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "recipe", EntityID: recipe.ID, After: recipe,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recipe, nil
+}
+
+func (db *DB) UpdateRecipe(ctx context.Context, id string, req models.UpdateRecipeRequest, expectedVersion *int) (*models.Recipe, error) {
+	var recipe *models.Recipe
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getRecipe(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		recipe = &updated
+		if req.Name != nil {
+			recipe.Name = *req.Name
+		}
+		if req.Description != nil {
+			recipe.Description = *req.Description
+		}
+		if req.Servings != nil {
+			recipe.Servings = *req.Servings
+		}
+		if req.Steps != nil {
+			recipe.Steps = cleanSteps(*req.Steps)
+		}
+		if req.Tags != nil {
+			recipe.Tags = normalizeTags(*req.Tags)
+		}
+		if req.SourceURL != nil {
+			recipe.SourceURL = *req.SourceURL
+		}
+		recipe.UpdatedAt = time.Now()
+		recipe.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE recipes SET name=$1, description=$2, servings=$3, steps=$4, tags=$5, source_url=$6,
+			 updated_at=$7, version=$8
+			 WHERE id=$9 AND version=$10`,
+			recipe.Name, recipe.Description, recipe.Servings, recipe.Steps, recipe.Tags, recipe.SourceURL,
+			recipe.UpdatedAt, recipe.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+		if req.Ingredients != nil {
+			recipe.Ingredients = *req.Ingredients
+			if recipe.Ingredients == nil {
+				recipe.Ingredients = []models.RecipeIngredient{}
+			}
+			if err := replaceRecipeIngredients(ctx, tx, id, recipe.Ingredients); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "recipe", EntityID: id, Before: before, After: recipe,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recipe, nil
+}
+
+// DeleteRecipe removes a recipe from the library; meal items made from it
+// keep their name but lose the link. It returns ErrNotFound if there was
+// nothing to delete.
+func (db *DB) DeleteRecipe(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getRecipe(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM recipes WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "recipe", EntityID: id, Before: before,
+		})
+	})
+}
+
+// scaleRecipe scales ingredient quantities to feed servings people. A
+// non-positive servings leaves the recipe as written.
+func scaleRecipe(recipe models.Recipe, servings int) models.ScaledRecipe {
+	if servings <= 0 {
+		servings = recipe.Servings
+	}
+	factor := float64(servings) / float64(recipe.Servings)
+
+	scaled := models.ScaledRecipe{Recipe: recipe, ScaledServings: servings, Factor: math.Round(factor*1000) / 1000}
+	scaled.Ingredients = make([]models.RecipeIngredient, len(recipe.Ingredients))
+	for i, ing := range recipe.Ingredients {
+		if ing.Quantity != nil {
+			q := units.Round(*ing.Quantity * factor)
+			ing.Quantity = &q
+		}
+		scaled.Ingredients[i] = ing
+	}
+	return scaled
+}
+
+// ScaleRecipe returns a recipe scaled to feed servings people
+func (db *DB) ScaleRecipe(ctx context.Context, id string, servings int) (*models.ScaledRecipe, error) {
+	recipe, err := db.GetRecipe(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	scaled := scaleRecipe(*recipe, servings)
+	return &scaled, nil
+}
+
+// GetMealItemRecipe returns the recipe of a meal item scaled to the meal's
+// expected headcount
+func (db *DB) GetMealItemRecipe(ctx context.Context, itemID string) (*models.ScaledRecipe, error) {
+	item, err := db.GetMealItem(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.RecipeID == nil {
+		return nil, ErrNotFound
+	}
+	meal, err := db.GetMealWithItems(ctx, item.MealID)
+	if err != nil {
+		return nil, err
+	}
+	return db.ScaleRecipe(ctx, *item.RecipeID, meal.ExpectedHeadcount)
+}
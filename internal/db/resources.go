@@ -0,0 +1,424 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Resource operations. Like rooms, resources belong to the property, so
+// their audit entries have no event.
+
+// Reservation statuses. Pending reservations hold their slot until an
+// admin decides; denied ones free it.
+const (
+	ReservationPending  = "pending"
+	ReservationApproved = "approved"
+	ReservationDenied   = "denied"
+)
+
+const resourceColumns = `id, name, description, quantity, requires_approval, version, created_at, updated_at`
+
+func scanResource(row pgx.Row, r *models.Resource) error {
+	return row.Scan(&r.ID, &r.Name, &r.Description, &r.Quantity, &r.RequiresApproval, &r.Version, &r.CreatedAt,
+		&r.UpdatedAt)
+}
+
+func getResource(ctx context.Context, q querier, id string) (*models.Resource, error) {
+	var resource models.Resource
+	if err := scanResource(q.QueryRow(ctx, `SELECT `+resourceColumns+` FROM resources WHERE id = $1`, id), &resource); err != nil {
+		return nil, mapError(err)
+	}
+	return &resource, nil
+}
+
+func (db *DB) GetResource(ctx context.Context, id string) (*models.Resource, error) {
+	return getResource(ctx, db.pool, id)
+}
+
+// ListResources returns the property's equipment alphabetically
+func (db *DB) ListResources(ctx context.Context) ([]models.Resource, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+resourceColumns+` FROM resources ORDER BY LOWER(name) ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []models.Resource{}
+	for rows.Next() {
+		var r models.Resource
+		if err := scanResource(rows, &r); err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+	return resources, rows.Err()
+}
+
+func (db *DB) CreateResource(ctx context.Context, req models.CreateResourceRequest) (*models.Resource, error) {
+	resource := &models.Resource{
+		ID:               uuid.New().String(),
+		Name:             req.Name,
+		Description:      req.Description,
+		Quantity:         1,
+		RequiresApproval: req.RequiresApproval,
+		Version:          1,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+	if req.Quantity != nil {
+		resource.Quantity = *req.Quantity
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO resources (id, name, description, quantity, requires_approval, created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			resource.ID, resource.Name, resource.Description, resource.Quantity, resource.RequiresApproval,
+			resource.CreatedAt, resource.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "resource", EntityID: resource.ID, After: resource,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// UpdateResource changes a resource. Lowering the quantity doesn't cancel
+// existing reservations; it only limits new ones.
+func (db *DB) UpdateResource(ctx context.Context, id string, req models.UpdateResourceRequest, expectedVersion *int) (*models.Resource, error) {
+	var resource *models.Resource
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getResource(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		resource = &updated
+		if req.Name != nil {
+			resource.Name = *req.Name
+		}
+		if req.Description != nil {
+			resource.Description = *req.Description
+		}
+		if req.Quantity != nil {
+			resource.Quantity = *req.Quantity
+		}
+		if req.RequiresApproval != nil {
+			resource.RequiresApproval = *req.RequiresApproval
+		}
+		resource.UpdatedAt = time.Now()
+		resource.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE resources SET name=$1, description=$2, quantity=$3, requires_approval=$4, updated_at=$5, version=$6
+			 WHERE id=$7 AND version=$8`,
+			resource.Name, resource.Description, resource.Quantity, resource.RequiresApproval, resource.UpdatedAt,
+			resource.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "resource", EntityID: id, Before: before, After: resource,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// DeleteResource removes a resource and all of its reservations. It returns
+// ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteResource(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getResource(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM resources WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "resource", EntityID: id, Before: before,
+		})
+	})
+}
+
+// Reservation operations
+
+const reservationColumns = `rr.id, rr.resource_id, r.name, rr.event_id, e.title, rr.attendee_id, a.name,
+	rr.start_time, rr.end_time, rr.quantity, rr.status, rr.notes, rr.created_by, rr.reviewed_by, rr.reviewed_at,
+	rr.created_at`
+
+const reservationJoins = ` FROM resource_reservations rr
+	JOIN resources r ON rr.resource_id = r.id
+	JOIN events e ON rr.event_id = e.id
+	JOIN attendees a ON rr.attendee_id = a.id`
+
+func scanReservation(row pgx.Row, r *models.Reservation) error {
+	return row.Scan(&r.ID, &r.ResourceID, &r.ResourceName, &r.EventID, &r.EventTitle, &r.AttendeeID,
+		&r.AttendeeName, &r.StartTime, &r.EndTime, &r.Quantity, &r.Status, &r.Notes, &r.CreatedBy, &r.ReviewedBy,
+		&r.ReviewedAt, &r.CreatedAt)
+}
+
+func getReservation(ctx context.Context, q querier, id string) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := scanReservation(q.QueryRow(ctx, `SELECT `+reservationColumns+reservationJoins+` WHERE rr.id = $1`, id),
+		&reservation)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &reservation, nil
+}
+
+func (db *DB) GetReservation(ctx context.Context, id string) (*models.Reservation, error) {
+	return getReservation(ctx, db.pool, id)
+}
+
+func queryReservations(ctx context.Context, q querier, where string, args ...any) ([]models.Reservation, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+reservationColumns+reservationJoins+` WHERE `+where+` ORDER BY rr.start_time ASC, r.name ASC`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := []models.Reservation{}
+	for rows.Next() {
+		var r models.Reservation
+		if err := scanReservation(rows, &r); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, rows.Err()
+}
+
+// GetReservationsByEvent returns every reservation made for an event,
+// including pending and denied ones
+func (db *DB) GetReservationsByEvent(ctx context.Context, eventID string) ([]models.Reservation, error) {
+	return queryReservations(ctx, db.pool, `rr.event_id = $1`, eventID)
+}
+
+// GetResourceCalendar returns a resource's reservations across all live
+// events that overlap [from, to). A nil from or to leaves that end open.
+func (db *DB) GetResourceCalendar(ctx context.Context, resourceID string, from, to *time.Time) (*models.ResourceCalendar, error) {
+	resource, err := db.GetResource(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := queryReservations(ctx, db.pool,
+		`rr.resource_id = $1 AND e.deleted_at IS NULL
+		 AND ($2::timestamptz IS NULL OR rr.end_time > $2) AND ($3::timestamptz IS NULL OR rr.start_time < $3)`,
+		resourceID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ResourceCalendar{Resource: *resource, Reservations: reservations}, nil
+}
+
+// checkResourceFree locks the resource and returns ErrOverCapacity unless
+// quantity more of it are free for all of [start, end). Pending
+// reservations hold their slot; skipID leaves one reservation out.
+func checkResourceFree(ctx context.Context, tx pgx.Tx, resource *models.Resource, start, end time.Time, quantity int, skipID string) error {
+	if _, err := tx.Exec(ctx, `SELECT id FROM resources WHERE id = $1 FOR UPDATE`, resource.ID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT rr.start_time, rr.end_time, rr.quantity
+		 FROM resource_reservations rr JOIN events e ON rr.event_id = e.id
+		 WHERE rr.resource_id = $1 AND rr.status <> 'denied' AND rr.id <> $2 AND e.deleted_at IS NULL
+		   AND rr.start_time < $4 AND rr.end_time > $3`,
+		resource.ID, skipID, start, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type booking struct {
+		start, end time.Time
+		quantity   int
+	}
+	var bookings []booking
+	for rows.Next() {
+		var b booking
+		if err := rows.Scan(&b.start, &b.end, &b.quantity); err != nil {
+			return err
+		}
+		bookings = append(bookings, b)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Usage only rises when a booking starts, so checking at the new
+	// booking's start and at each overlapping start finds the peak
+	checkpoints := []time.Time{start}
+	for _, b := range bookings {
+		if b.start.After(start) {
+			checkpoints = append(checkpoints, b.start)
+		}
+	}
+	for _, at := range checkpoints {
+		used := quantity
+		for _, b := range bookings {
+			if !b.start.After(at) && b.end.After(at) {
+				used += b.quantity
+			}
+		}
+		if used > resource.Quantity {
+			return ErrOverCapacity
+		}
+	}
+	return nil
+}
+
+// CreateReservation books a resource for an attendee of the event. It is
+// pending when the resource requires approval and approved otherwise, and
+// fails with ErrOverCapacity when the resource is already booked for part
+// of that time.
+func (db *DB) CreateReservation(ctx context.Context, eventID string, req models.CreateReservationRequest) (*models.Reservation, error) {
+	id := uuid.New().String()
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if err := checkAttendeeInEvent(ctx, tx, req.AttendeeID, eventID); err != nil {
+			return err
+		}
+		resource, err := getResource(ctx, tx, req.ResourceID)
+		if errors.Is(err, ErrNotFound) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+
+		quantity := 1
+		if req.Quantity != nil {
+			quantity = *req.Quantity
+		}
+		if err := checkResourceFree(ctx, tx, resource, req.StartTime, req.EndTime, quantity, ""); err != nil {
+			return err
+		}
+
+		status := ReservationApproved
+		if resource.RequiresApproval {
+			status = ReservationPending
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO resource_reservations (id, resource_id, event_id, attendee_id, start_time, end_time, quantity,
+			 status, notes, created_by, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			id, resource.ID, eventID, req.AttendeeID, req.StartTime, req.EndTime, quantity, status, req.Notes,
+			actorFromContext(ctx), time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		reservation, err := getReservation(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "reservation", EntityID: id, EventID: &eventID, After: reservation,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetReservation(ctx, id)
+}
+
+// ReviewReservation records an admin approving or denying a reservation.
+// Approving a previously denied reservation checks the resource is still
+// free.
+func (db *DB) ReviewReservation(ctx context.Context, id, status string) (*models.Reservation, error) {
+	var reservation *models.Reservation
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getReservation(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if status == ReservationApproved && before.Status == ReservationDenied {
+			resource, err := getResource(ctx, tx, before.ResourceID)
+			if err != nil {
+				return err
+			}
+			if err := checkResourceFree(ctx, tx, resource, before.StartTime, before.EndTime, before.Quantity, id); err != nil {
+				return err
+			}
+		}
+
+		updated := *before
+		reservation = &updated
+		now := time.Now()
+		reservation.Status = status
+		reservation.ReviewedBy = actorFromContext(ctx)
+		reservation.ReviewedAt = &now
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE resource_reservations SET status = $1, reviewed_by = $2, reviewed_at = $3 WHERE id = $4`,
+			reservation.Status, reservation.ReviewedBy, reservation.ReviewedAt, id,
+		); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "reservation", EntityID: id, EventID: &reservation.EventID,
+			Before: before, After: reservation,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// DeleteReservation cancels a reservation. It returns ErrNotFound if there
+// was nothing to delete.
+func (db *DB) DeleteReservation(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getReservation(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM resource_reservations WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "reservation", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
@@ -0,0 +1,511 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Ride operations
+
+// Ride directions and passenger statuses
+const (
+	RideToFarm = "to_farm"
+	RideHome   = "home"
+
+	PassengerRequested = "requested"
+	PassengerConfirmed = "confirmed"
+)
+
+const rideColumns = `r.id, r.event_id, r.driver_attendee_id, a.name, r.direction, r.origin, r.departure_time, r.seats,
+	r.notes, r.version, r.created_at, r.updated_at`
+
+func scanRide(row pgx.Row, r *models.Ride) error {
+	return row.Scan(&r.ID, &r.EventID, &r.DriverAttendeeID, &r.DriverName, &r.Direction, &r.Origin, &r.DepartureTime,
+		&r.Seats, &r.Notes, &r.Version, &r.CreatedAt, &r.UpdatedAt)
+}
+
+const ridePassengerColumns = `p.id, p.ride_id, p.attendee_id, a.name, p.seats, p.status, p.created_at`
+
+func scanRidePassenger(row pgx.Row, p *models.RidePassenger) error {
+	return row.Scan(&p.ID, &p.RideID, &p.AttendeeID, &p.AttendeeName, &p.Seats, &p.Status, &p.CreatedAt)
+}
+
+func getRide(ctx context.Context, q querier, id string) (*models.Ride, error) {
+	var ride models.Ride
+	err := scanRide(q.QueryRow(ctx,
+		`SELECT `+rideColumns+` FROM rides r JOIN attendees a ON r.driver_attendee_id = a.id WHERE r.id = $1`, id,
+	), &ride)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &ride, nil
+}
+
+// lockRide locks a ride against concurrent seat claims and returns it
+func lockRide(ctx context.Context, tx pgx.Tx, id string) (*models.Ride, error) {
+	if _, err := tx.Exec(ctx, `SELECT id FROM rides WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return nil, err
+	}
+	return getRide(ctx, tx, id)
+}
+
+func (db *DB) GetRide(ctx context.Context, id string) (*models.Ride, error) {
+	return getRide(ctx, db.pool, id)
+}
+
+func getRidePassengers(ctx context.Context, q querier, rideID string) ([]models.RidePassenger, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+ridePassengerColumns+` FROM ride_passengers p JOIN attendees a ON p.attendee_id = a.id
+		 WHERE p.ride_id = $1 ORDER BY p.created_at ASC`, rideID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passengers := []models.RidePassenger{}
+	for rows.Next() {
+		var p models.RidePassenger
+		if err := scanRidePassenger(rows, &p); err != nil {
+			return nil, err
+		}
+		passengers = append(passengers, p)
+	}
+	return passengers, rows.Err()
+}
+
+func getRidePassenger(ctx context.Context, q querier, id string) (*models.RidePassenger, error) {
+	var passenger models.RidePassenger
+	err := scanRidePassenger(q.QueryRow(ctx,
+		`SELECT `+ridePassengerColumns+` FROM ride_passengers p JOIN attendees a ON p.attendee_id = a.id
+		 WHERE p.id = $1`, id,
+	), &passenger)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &passenger, nil
+}
+
+// seatsTaken counts the seats confirmed passengers take, leaving out skipID
+// (so a passenger can be resized)
+func seatsTaken(passengers []models.RidePassenger, skipID string) int {
+	taken := 0
+	for _, p := range passengers {
+		if p.Status == PassengerConfirmed && p.ID != skipID {
+			taken += p.Seats
+		}
+	}
+	return taken
+}
+
+func withPassengers(ride models.Ride, passengers []models.RidePassenger) models.RideWithPassengers {
+	taken := seatsTaken(passengers, "")
+	return models.RideWithPassengers{
+		Ride:       ride,
+		Passengers: passengers,
+		SeatsTaken: taken,
+		SeatsLeft:  max(ride.Seats-taken, 0),
+	}
+}
+
+func (db *DB) GetRideWithPassengers(ctx context.Context, id string) (*models.RideWithPassengers, error) {
+	ride, err := db.GetRide(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	passengers, err := getRidePassengers(ctx, db.pool, id)
+	if err != nil {
+		return nil, err
+	}
+	result := withPassengers(*ride, passengers)
+	return &result, nil
+}
+
+// GetRidesByEvent returns an event's rides in order of departure
+func (db *DB) GetRidesByEvent(ctx context.Context, eventID string) ([]models.RideWithPassengers, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+rideColumns+` FROM rides r JOIN attendees a ON r.driver_attendee_id = a.id
+		 WHERE r.event_id = $1 ORDER BY r.departure_time ASC, a.name ASC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rides []models.Ride
+	for rows.Next() {
+		var r models.Ride
+		if err := scanRide(rows, &r); err != nil {
+			return nil, err
+		}
+		rides = append(rides, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]models.RideWithPassengers, len(rides))
+	for i, ride := range rides {
+		passengers, err := getRidePassengers(ctx, db.pool, ride.ID)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = withPassengers(ride, passengers)
+	}
+	return result, nil
+}
+
+func (db *DB) CreateRide(ctx context.Context, eventID string, req models.CreateRideRequest) (*models.RideWithPassengers, error) {
+	ride := &models.Ride{
+		ID:               uuid.New().String(),
+		EventID:          eventID,
+		DriverAttendeeID: req.DriverAttendeeID,
+		Direction:        req.Direction,
+		Origin:           req.Origin,
+		DepartureTime:    req.DepartureTime,
+		Seats:            req.Seats,
+		Notes:            req.Notes,
+		Version:          1,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if err := checkAttendeeInEvent(ctx, tx, ride.DriverAttendeeID, eventID); err != nil {
+			return err
+		}
+		if err := checkRideFree(ctx, tx, ride.DriverAttendeeID, ride); err != nil {
+			return err
+		}
+		if name := attendeeName(ctx, tx, &ride.DriverAttendeeID); name != nil {
+			ride.DriverName = *name
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO rides (id, event_id, driver_attendee_id, direction, origin, departure_time, seats, notes,
+			 created_at, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			ride.ID, ride.EventID, ride.DriverAttendeeID, ride.Direction, ride.Origin, ride.DepartureTime, ride.Seats,
+			ride.Notes, ride.CreatedAt, ride.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "ride", EntityID: ride.ID, EventID: &eventID, After: ride,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := withPassengers(*ride, []models.RidePassenger{})
+	return &result, nil
+}
+
+// UpdateRide changes a ride. It returns ErrOverCapacity if fewer seats
+// would be left than confirmed passengers already take.
+func (db *DB) UpdateRide(ctx context.Context, id string, req models.UpdateRideRequest, expectedVersion *int) (*models.RideWithPassengers, error) {
+	var result models.RideWithPassengers
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockRide(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+		passengers, err := getRidePassengers(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		updated := *before
+		ride := &updated
+		if req.Origin != nil {
+			ride.Origin = *req.Origin
+		}
+		if req.DepartureTime != nil {
+			ride.DepartureTime = *req.DepartureTime
+		}
+		if req.Seats != nil {
+			if *req.Seats < seatsTaken(passengers, "") {
+				return ErrOverCapacity
+			}
+			ride.Seats = *req.Seats
+		}
+		if req.Notes != nil {
+			ride.Notes = *req.Notes
+		}
+		ride.UpdatedAt = time.Now()
+		ride.Version = before.Version + 1
+
+		err = casResult(tx.Exec(ctx,
+			`UPDATE rides SET origin=$1, departure_time=$2, seats=$3, notes=$4, updated_at=$5, version=$6
+			 WHERE id=$7 AND version=$8`,
+			ride.Origin, ride.DepartureTime, ride.Seats, ride.Notes, ride.UpdatedAt, ride.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+
+		result = withPassengers(*ride, passengers)
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "ride", EntityID: id, EventID: &ride.EventID, Before: before, After: ride,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DeleteRide cancels a ride; its passengers go back to needing one. It
+// returns ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteRide(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getRide(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM rides WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "ride", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
+
+// checkRideFree returns ErrConflict if the attendee is already confirmed on,
+// or driving, another ride the same way. It holds a lock on the attendee's
+// rides until tx ends, so two rides can't both claim them at once.
+func checkRideFree(ctx context.Context, tx pgx.Tx, attendeeID string, ride *models.Ride) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('rides:' || $1))`, attendeeID); err != nil {
+		return err
+	}
+
+	var busy bool
+	err := tx.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM ride_passengers p JOIN rides r ON p.ride_id = r.id
+			WHERE p.attendee_id = $1 AND p.status = 'confirmed' AND r.direction = $2 AND r.id <> $3
+		 ) OR EXISTS (
+			SELECT 1 FROM rides WHERE driver_attendee_id = $1 AND direction = $2 AND id <> $3
+		 )`,
+		attendeeID, ride.Direction, ride.ID,
+	).Scan(&busy)
+	if err != nil {
+		return err
+	}
+	if busy {
+		return ErrConflict
+	}
+	return nil
+}
+
+// AddRidePassenger claims seats on a ride for an attendee, or asks for them.
+// Claims fail with ErrOverCapacity when the ride is full and ErrConflict
+// when the attendee already has a ride that way; requests are checked when
+// they are confirmed.
+func (db *DB) AddRidePassenger(ctx context.Context, rideID string, req models.RideSeatRequest) (*models.RidePassenger, error) {
+	var passenger *models.RidePassenger
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		ride, err := lockRide(ctx, tx, rideID)
+		if err != nil {
+			return err
+		}
+		attendee, err := getAttendee(ctx, tx, req.AttendeeID)
+		if errors.Is(err, ErrNotFound) || (err == nil && attendee.EventID != ride.EventID) {
+			return ErrForeignKey
+		}
+		if err != nil {
+			return err
+		}
+		if attendee.ID == ride.DriverAttendeeID {
+			return ErrCheckViolation
+		}
+
+		passenger = &models.RidePassenger{
+			ID:           uuid.New().String(),
+			RideID:       rideID,
+			AttendeeID:   attendee.ID,
+			AttendeeName: attendee.Name,
+			Seats:        partySize(*attendee),
+			Status:       PassengerConfirmed,
+			CreatedAt:    time.Now(),
+		}
+		if req.Seats != nil {
+			passenger.Seats = *req.Seats
+		}
+		if req.Request {
+			passenger.Status = PassengerRequested
+		} else {
+			if err := checkRideFree(ctx, tx, attendee.ID, ride); err != nil {
+				return err
+			}
+			passengers, err := getRidePassengers(ctx, tx, rideID)
+			if err != nil {
+				return err
+			}
+			if seatsTaken(passengers, "")+passenger.Seats > ride.Seats {
+				return ErrOverCapacity
+			}
+		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO ride_passengers (id, ride_id, attendee_id, seats, status, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			passenger.ID, passenger.RideID, passenger.AttendeeID, passenger.Seats, passenger.Status, passenger.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "ride_passenger", EntityID: passenger.ID, EventID: &ride.EventID, After: passenger,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return passenger, nil
+}
+
+// UpdateRidePassenger confirms a seat request or resizes a passenger's
+// party, with the same checks as claiming seats
+func (db *DB) UpdateRidePassenger(ctx context.Context, id string, req models.UpdateRidePassengerRequest) (*models.RidePassenger, error) {
+	var passenger *models.RidePassenger
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getRidePassenger(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		ride, err := lockRide(ctx, tx, before.RideID)
+		if err != nil {
+			return err
+		}
+
+		updated := *before
+		passenger = &updated
+		if req.Status != nil {
+			passenger.Status = *req.Status
+		}
+		if req.Seats != nil {
+			passenger.Seats = *req.Seats
+		}
+
+		if passenger.Status == PassengerConfirmed {
+			if before.Status != PassengerConfirmed {
+				if err := checkRideFree(ctx, tx, passenger.AttendeeID, ride); err != nil {
+					return err
+				}
+			}
+			passengers, err := getRidePassengers(ctx, tx, ride.ID)
+			if err != nil {
+				return err
+			}
+			if seatsTaken(passengers, id)+passenger.Seats > ride.Seats {
+				return ErrOverCapacity
+			}
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE ride_passengers SET seats = $1, status = $2 WHERE id = $3`, passenger.Seats, passenger.Status, id,
+		); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "ride_passenger", EntityID: id, EventID: &ride.EventID,
+			Before: before, After: passenger,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return passenger, nil
+}
+
+func (db *DB) GetRidePassenger(ctx context.Context, id string) (*models.RidePassenger, error) {
+	return getRidePassenger(ctx, db.pool, id)
+}
+
+// DeleteRidePassenger gives up a seat or withdraws a request. It returns
+// ErrNotFound if there was nothing to delete.
+func (db *DB) DeleteRidePassenger(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getRidePassenger(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		ride, err := getRide(ctx, tx, before.RideID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM ride_passengers WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "ride_passenger", EntityID: id, EventID: &ride.EventID, Before: before,
+		})
+	})
+}
+
+// GetRideNeeds lists attending attendees who aren't driving or confirmed on
+// a ride, for each direction
+func (db *DB) GetRideNeeds(ctx context.Context, eventID string) ([]models.RideNeed, error) {
+	if _, err := db.GetEvent(ctx, eventID); err != nil {
+		return nil, err
+	}
+	attendees, err := db.GetAttendeesByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	rides, err := db.GetRidesByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	covered := map[string]map[string]bool{RideToFarm: {}, RideHome: {}}
+	requested := map[string]map[string]bool{RideToFarm: {}, RideHome: {}}
+	for _, ride := range rides {
+		covered[ride.Direction][ride.DriverAttendeeID] = true
+		for _, p := range ride.Passengers {
+			if p.Status == PassengerConfirmed {
+				covered[ride.Direction][p.AttendeeID] = true
+			} else {
+				requested[ride.Direction][p.AttendeeID] = true
+			}
+		}
+	}
+
+	needs := []models.RideNeed{}
+	for _, direction := range []string{RideToFarm, RideHome} {
+		for _, a := range attendees {
+			if a.Status != "attending" || covered[direction][a.ID] {
+				continue
+			}
+			needs = append(needs, models.RideNeed{
+				AttendeeID:   a.ID,
+				AttendeeName: a.Name,
+				PartySize:    partySize(a),
+				Direction:    direction,
+				Requested:    requested[direction][a.ID],
+			})
+		}
+	}
+	return needs, nil
+}
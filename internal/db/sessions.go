@@ -23,7 +23,7 @@ func (db *DB) GetSession(ctx context.Context, sessionID string) (*models.Session
 		 FROM sessions WHERE id = $1`, sessionID,
 	).Scan(&session.ID, &session.UserID, &session.ExpiresAt, &session.CreatedAt)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &session, nil
 }
@@ -0,0 +1,351 @@
+package db
+
+import (
+	"context"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Settlement operations
+
+const settlementColumns = `s.id, s.event_id, s.from_attendee_id, f.name, s.to_attendee_id, t.name, s.amount_cents,
+	s.currency, s.note, s.created_by, s.paid_at`
+
+const settlementJoins = ` FROM settlements s
+	JOIN attendees f ON s.from_attendee_id = f.id
+	JOIN attendees t ON s.to_attendee_id = t.id`
+
+func scanSettlement(row pgx.Row, s *models.Settlement) error {
+	var cents int64
+	err := row.Scan(&s.ID, &s.EventID, &s.FromAttendeeID, &s.FromName, &s.ToAttendeeID, &s.ToName, &cents,
+		&s.Currency, &s.Note, &s.CreatedBy, &s.PaidAt)
+	s.Amount = fromCents(cents)
+	return err
+}
+
+func getSettlement(ctx context.Context, q querier, id string) (*models.Settlement, error) {
+	var settlement models.Settlement
+	err := scanSettlement(q.QueryRow(ctx, `SELECT `+settlementColumns+settlementJoins+` WHERE s.id = $1`, id), &settlement)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &settlement, nil
+}
+
+func (db *DB) GetSettlement(ctx context.Context, id string) (*models.Settlement, error) {
+	return getSettlement(ctx, db.pool, id)
+}
+
+func (db *DB) GetSettlementsByEvent(ctx context.Context, eventID string) ([]models.Settlement, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+settlementColumns+settlementJoins+` WHERE s.event_id = $1 ORDER BY s.paid_at ASC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settlements := []models.Settlement{}
+	for rows.Next() {
+		var s models.Settlement
+		if err := scanSettlement(rows, &s); err != nil {
+			return nil, err
+		}
+		settlements = append(settlements, s)
+	}
+	return settlements, rows.Err()
+}
+
+// CreateSettlement records a payment between two attendees of an event as made
+func (db *DB) CreateSettlement(ctx context.Context, eventID string, req models.CreateSettlementRequest) (*models.Settlement, error) {
+	id := uuid.New().String()
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if err := checkAttendeeInEvent(ctx, tx, req.FromAttendeeID, eventID); err != nil {
+			return err
+		}
+		if err := checkAttendeeInEvent(ctx, tx, req.ToAttendeeID, eventID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx,
+			`INSERT INTO settlements (id, event_id, from_attendee_id, to_attendee_id, amount_cents, currency, note,
+			 created_by, paid_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			id, eventID, req.FromAttendeeID, req.ToAttendeeID, toCents(req.Amount), normalizeCurrency(req.Currency),
+			req.Note, actorFromContext(ctx), time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+
+		settlement, err := getSettlement(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "settlement", EntityID: id, EventID: &eventID, After: settlement,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetSettlement(ctx, id)
+}
+
+// DeleteSettlement undoes marking a payment as made. It returns ErrNotFound
+// if there was nothing to delete.
+func (db *DB) DeleteSettlement(ctx context.Context, id string) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getSettlement(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM settlements WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "settlement", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
+}
+
+// ledgerEntry accumulates one attendee's money in one currency, in cents
+type ledgerEntry struct {
+	name                       string
+	paid, owed, sent, received int64
+}
+
+func (e *ledgerEntry) net() int64 {
+	return e.paid - e.owed + e.sent - e.received
+}
+
+// GetEventBalances works out where each attendee stands after the event's
+// expenses and recorded settlements, per currency, with transfers that
+// would settle everyone up
+func (db *DB) GetEventBalances(ctx context.Context, eventID string) (*models.EventBalances, error) {
+	expenses, err := db.GetExpensesByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	settlements, err := db.GetSettlementsByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgers := map[string]map[string]*ledgerEntry{}
+	totals := map[string]int64{}
+	entry := func(currency, attendeeID, name string) *ledgerEntry {
+		if ledgers[currency] == nil {
+			ledgers[currency] = map[string]*ledgerEntry{}
+		}
+		e, ok := ledgers[currency][attendeeID]
+		if !ok {
+			e = &ledgerEntry{name: name}
+			ledgers[currency][attendeeID] = e
+		}
+		return e
+	}
+
+	for _, x := range expenses {
+		totals[x.Currency] += toCents(x.Amount)
+		entry(x.Currency, x.PayerAttendeeID, x.PayerName).paid += toCents(x.Amount)
+		for _, part := range x.Split {
+			entry(x.Currency, part.AttendeeID, part.AttendeeName).owed += toCents(part.Amount)
+		}
+	}
+	for _, s := range settlements {
+		entry(s.Currency, s.FromAttendeeID, s.FromName).sent += toCents(s.Amount)
+		entry(s.Currency, s.ToAttendeeID, s.ToName).received += toCents(s.Amount)
+	}
+
+	currencies := make([]string, 0, len(ledgers))
+	for currency := range ledgers {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	result := &models.EventBalances{
+		EventID:     eventID,
+		Currencies:  []models.CurrencyBalances{},
+		Settlements: settlements,
+	}
+	for _, currency := range currencies {
+		ledger := ledgers[currency]
+		cb := models.CurrencyBalances{
+			Currency:  currency,
+			Total:     fromCents(totals[currency]),
+			Balances:  []models.AttendeeBalance{},
+			Transfers: settleUp(currency, ledger),
+		}
+		for id, e := range ledger {
+			cb.Balances = append(cb.Balances, models.AttendeeBalance{
+				AttendeeID:   id,
+				AttendeeName: e.name,
+				Paid:         fromCents(e.paid),
+				Owed:         fromCents(e.owed),
+				Sent:         fromCents(e.sent),
+				Received:     fromCents(e.received),
+				Net:          fromCents(e.net()),
+			})
+		}
+		sort.Slice(cb.Balances, func(i, j int) bool {
+			if cb.Balances[i].AttendeeName != cb.Balances[j].AttendeeName {
+				return cb.Balances[i].AttendeeName < cb.Balances[j].AttendeeName
+			}
+			return cb.Balances[i].AttendeeID < cb.Balances[j].AttendeeID
+		})
+		result.Currencies = append(result.Currencies, cb)
+	}
+
+	return result, nil
+}
+
+// maxExactSettle is the most people with a balance settleUp searches for
+// the fewest transfers; past that it settles everyone as one group
+const maxExactSettle = 16
+
+// settleParty is someone with a balance: positive if they are owed money,
+// negative if they owe it
+type settleParty struct {
+	id, name string
+	amount   int64
+}
+
+// settleUp suggests the fewest transfers that bring every balance to zero.
+// A group whose balances add up to zero settles in one transfer fewer than
+// its size, so the fewest transfers come from splitting people into as many
+// such groups as possible, each then settled on its own.
+func settleUp(currency string, ledger map[string]*ledgerEntry) []models.SettleUpTransfer {
+	var parties []settleParty
+	for id, e := range ledger {
+		if net := e.net(); net != 0 {
+			parties = append(parties, settleParty{id, e.name, net})
+		}
+	}
+	sort.Slice(parties, func(i, j int) bool { return parties[i].id < parties[j].id })
+
+	transfers := []models.SettleUpTransfer{}
+	for _, group := range zeroSumGroups(parties) {
+		transfers = append(transfers, settleGroup(currency, group)...)
+	}
+	return transfers
+}
+
+// zeroSumGroups splits parties into as many groups with balances adding up
+// to zero as possible. It tries every subset, so more than maxExactSettle
+// parties are left as a single group.
+func zeroSumGroups(parties []settleParty) [][]settleParty {
+	n := len(parties)
+	if n == 0 {
+		return nil
+	}
+	if n > maxExactSettle {
+		return [][]settleParty{parties}
+	}
+
+	// best[mask] is the most zero-sum groups the parties in mask can be cut
+	// into, found by adding them one at a time and counting each point where
+	// the running total is zero
+	size := 1 << n
+	sums := make([]int64, size)
+	best := make([]int8, size)
+	for mask := 1; mask < size; mask++ {
+		sums[mask] = sums[mask&(mask-1)] + parties[bits.TrailingZeros(uint(mask))].amount
+		for i := 0; i < n; i++ {
+			if bit := 1 << i; mask&bit != 0 && best[mask^bit] > best[mask] {
+				best[mask] = best[mask^bit]
+			}
+		}
+		if sums[mask] == 0 {
+			best[mask]++
+		}
+	}
+
+	members := func(mask int) []settleParty {
+		var group []settleParty
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 {
+				group = append(group, parties[i])
+			}
+		}
+		return group
+	}
+
+	// Walk back from everyone to no one along a best ordering; the parties
+	// between two zero totals form a group
+	var groups [][]settleParty
+	mask, cut := size-1, size-1
+	for mask != 0 {
+		var zero int8
+		if sums[mask] == 0 {
+			zero = 1
+			if mask != cut {
+				groups = append(groups, members(cut&^mask))
+				cut = mask
+			}
+		}
+		for i := 0; i < n; i++ {
+			if bit := 1 << i; mask&bit != 0 && best[mask^bit] == best[mask]-zero {
+				mask ^= bit
+				break
+			}
+		}
+	}
+	return append(groups, members(cut))
+}
+
+// settleGroup has the biggest debtor pay the biggest creditor until the
+// group is square, which takes at most one transfer fewer than its size
+func settleGroup(currency string, group []settleParty) []models.SettleUpTransfer {
+	var debtors, creditors []*settleParty
+	for _, p := range group {
+		switch {
+		case p.amount < 0:
+			debtors = append(debtors, &settleParty{p.id, p.name, -p.amount})
+		case p.amount > 0:
+			creditors = append(creditors, &settleParty{p.id, p.name, p.amount})
+		}
+	}
+
+	largestFirst := func(parties []*settleParty) {
+		sort.Slice(parties, func(i, j int) bool {
+			if parties[i].amount != parties[j].amount {
+				return parties[i].amount > parties[j].amount
+			}
+			return parties[i].id < parties[j].id
+		})
+	}
+
+	var transfers []models.SettleUpTransfer
+	for len(debtors) > 0 && len(creditors) > 0 {
+		largestFirst(debtors)
+		largestFirst(creditors)
+		from, to := debtors[0], creditors[0]
+		amount := min(from.amount, to.amount)
+		transfers = append(transfers, models.SettleUpTransfer{
+			FromAttendeeID: from.id,
+			FromName:       from.name,
+			ToAttendeeID:   to.id,
+			ToName:         to.name,
+			Amount:         fromCents(amount),
+			Currency:       currency,
+		})
+		from.amount -= amount
+		to.amount -= amount
+		if from.amount == 0 {
+			debtors = debtors[1:]
+		}
+		if to.amount == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
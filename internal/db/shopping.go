@@ -0,0 +1,314 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+	"farm-time/internal/units"
+)
+
+// storeCategories lists store sections in the order a shopping trip walks
+// them; the shopping list is grouped in this order
+var storeCategories = []string{
+	"produce", "bakery", "meat", "dairy", "frozen", "pantry", "snacks", "beverages", "household", "other",
+}
+
+// categoryKeywords guesses the store section of items that don't have one
+var categoryKeywords = map[string][]string{
+	"produce":   {"apple", "banana", "berr", "lettuce", "salad", "tomato", "onion", "potato", "pepper", "corn", "carrot", "lemon", "lime", "fruit", "vegetable", "garlic", "avocado"},
+	"bakery":    {"bread", "bun", "roll", "bagel", "tortilla", "muffin", "cake", "pie"},
+	"meat":      {"burger", "beef", "chicken", "pork", "sausage", "hot dog", "bacon", "steak", "ham", "turkey", "fish"},
+	"dairy":     {"milk", "cheese", "butter", "yogurt", "egg", "cream"},
+	"frozen":    {"ice cream", "frozen", "popsicle"},
+	"beverages": {"drink", "soda", "juice", "beer", "wine", "coffee", "tea", "water", "seltzer"},
+	"snacks":    {"chip", "cracker", "cookie", "pretzel", "popcorn", "nut", "candy", "marshmallow", "s'more"},
+	"household": {"ice", "plate", "napkin", "cup", "foil", "charcoal", "propane", "trash bag", "paper towel", "soap"},
+	"pantry":    {"flour", "sugar", "salt", "oil", "pasta", "rice", "sauce", "ketchup", "mustard", "syrup", "spice", "bean", "can"},
+}
+
+func guessCategory(name string) string {
+	n := strings.ToLower(name)
+	// Walk sections in a fixed order so overlapping keywords ("ice cream"
+	// vs "ice") resolve the same way every time
+	for _, category := range []string{"frozen", "meat", "dairy", "bakery", "produce", "beverages", "snacks", "pantry", "household"} {
+		for _, keyword := range categoryKeywords[category] {
+			if strings.Contains(n, keyword) {
+				return category
+			}
+		}
+	}
+	return "other"
+}
+
+// shoppingListBuilder merges amounts of the same thing from many sources
+// into shopping list lines
+type shoppingListBuilder struct {
+	lines map[string]*models.ShoppingListItem
+	units map[string]units.Unit
+}
+
+func newShoppingListBuilder() *shoppingListBuilder {
+	return &shoppingListBuilder{
+		lines: map[string]*models.ShoppingListItem{},
+		units: map[string]units.Unit{},
+	}
+}
+
+// add merges an amount of name into the list. Amounts in units of the same
+// dimension are converted to the unit the line was started with; other
+// units start a separate line.
+func (b *shoppingListBuilder) add(name, category string, quantity *float64, unit string, source models.ShoppingListSource) {
+	name = strings.TrimSpace(name)
+	category = strings.ToLower(strings.TrimSpace(category))
+	u := units.Normalize(unit)
+	key := units.Singular(strings.ToLower(name)) + "|" + u.Dimension
+
+	line, ok := b.lines[key]
+	if !ok {
+		if category == "" {
+			category = guessCategory(name)
+		}
+		line = &models.ShoppingListItem{
+			Key:      key,
+			Name:     name,
+			Unit:     u.Name,
+			Category: category,
+			Sources:  []models.ShoppingListSource{},
+		}
+		b.lines[key] = line
+		b.units[key] = u
+	}
+
+	if quantity != nil {
+		amount := units.Convert(*quantity, u, b.units[key])
+		if line.Quantity == nil {
+			line.Quantity = &amount
+		} else {
+			*line.Quantity += amount
+		}
+	}
+	line.Sources = append(line.Sources, source)
+}
+
+// build groups the lines by store section
+func (b *shoppingListBuilder) build() []models.ShoppingListCategory {
+	byCategory := map[string][]models.ShoppingListItem{}
+	for _, line := range b.lines {
+		if line.Quantity != nil {
+			*line.Quantity = units.Round(*line.Quantity)
+		}
+		byCategory[line.Category] = append(byCategory[line.Category], *line)
+	}
+
+	// Sections people made up go after the standard ones, alphabetically
+	known := map[string]bool{}
+	for _, c := range storeCategories {
+		known[c] = true
+	}
+	var extra []string
+	for category := range byCategory {
+		if !known[category] {
+			extra = append(extra, category)
+		}
+	}
+	sort.Strings(extra)
+	order := append(append([]string{}, storeCategories...), extra...)
+
+	categories := []models.ShoppingListCategory{}
+	for _, category := range order {
+		items := byCategory[category]
+		if len(items) == 0 {
+			continue
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+		})
+		categories = append(categories, models.ShoppingListCategory{Category: category, Items: items})
+	}
+	return categories
+}
+
+// shoppingQuantity decides whether an item goes on the shopping list and
+// how much of it. Host-bought items are bought in full; other items only
+// for whatever nobody has claimed.
+func shoppingQuantity(item models.MealItemWithSignups) (*float64, bool) {
+	if item.HostBuys {
+		return item.Quantity, true
+	}
+	if item.FullyCovered {
+		return nil, false
+	}
+	return item.Remaining, true
+}
+
+type shoppingPurchase struct {
+	userID   *string
+	userName *string
+	at       time.Time
+}
+
+func (db *DB) getShoppingPurchases(ctx context.Context, eventID string) (map[string]shoppingPurchase, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT p.item_key, p.purchased_by, u.name, p.purchased_at
+		 FROM shopping_list_purchases p
+		 LEFT JOIN users u ON p.purchased_by = u.id
+		 WHERE p.event_id = $1`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purchases := map[string]shoppingPurchase{}
+	for rows.Next() {
+		var key string
+		var p shoppingPurchase
+		if err := rows.Scan(&key, &p.userID, &p.userName, &p.at); err != nil {
+			return nil, err
+		}
+		purchases[key] = p
+	}
+	return purchases, rows.Err()
+}
+
+// GetShoppingList merges the unclaimed and host-bought items of every meal
+// of an event into one list. Items made from a recipe contribute its
+// ingredients, scaled to the meal's expected headcount, instead of
+// themselves, in proportion to how much of the item is still uncovered.
+func (db *DB) GetShoppingList(ctx context.Context, eventID string) (*models.ShoppingList, error) {
+	event, err := db.GetEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	meals, err := db.GetMealsWithItemsByEvent(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	recipes := map[string]*models.Recipe{}
+	b := newShoppingListBuilder()
+	for _, meal := range meals {
+		for _, item := range meal.Items {
+			quantity, ok := shoppingQuantity(item)
+			if !ok {
+				continue
+			}
+
+			if item.RecipeID != nil {
+				recipe, ok := recipes[*item.RecipeID]
+				if !ok {
+					if recipe, err = db.GetRecipe(ctx, *item.RecipeID); err != nil {
+						return nil, err
+					}
+					recipes[*item.RecipeID] = recipe
+				}
+				scaled := scaleRecipe(*recipe, meal.ExpectedHeadcount)
+				// A partly covered item only needs the uncovered share of
+				// the recipe bought
+				share := 1.0
+				if !item.HostBuys && item.Quantity != nil && *item.Quantity > 0 && quantity != nil {
+					share = *quantity / *item.Quantity
+				}
+				for _, ing := range scaled.Ingredients {
+					if ing.Quantity != nil && share != 1 {
+						q := units.Round(*ing.Quantity * share)
+						ing.Quantity = &q
+					}
+					b.add(ing.Name, ing.Category, ing.Quantity, ing.Unit, models.ShoppingListSource{
+						MealID:     meal.ID,
+						MealName:   meal.Name,
+						MealDate:   meal.MealDate,
+						MealItemID: item.ID,
+						RecipeID:   item.RecipeID,
+						Quantity:   ing.Quantity,
+						Unit:       ing.Unit,
+					})
+				}
+				continue
+			}
+
+			b.add(item.Name, item.Category, quantity, item.Unit, models.ShoppingListSource{
+				MealID:     meal.ID,
+				MealName:   meal.Name,
+				MealDate:   meal.MealDate,
+				MealItemID: item.ID,
+				Quantity:   quantity,
+				Unit:       item.Unit,
+			})
+		}
+	}
+
+	purchases, err := db.getShoppingPurchases(ctx, eventID)
+	if err != nil {
+		return nil, err
+	}
+	for key, line := range b.lines {
+		if p, ok := purchases[key]; ok {
+			at := p.at
+			line.Purchased = true
+			line.PurchasedBy = p.userID
+			line.PurchasedByName = p.userName
+			line.PurchasedAt = &at
+		}
+	}
+
+	return &models.ShoppingList{
+		EventID:    event.ID,
+		EventTitle: event.Title,
+		Categories: b.build(),
+	}, nil
+}
+
+// SetShoppingItemPurchased checks a shopping list line off as bought by the
+// current user, or clears the check
+func (db *DB) SetShoppingItemPurchased(ctx context.Context, eventID, key string, purchased bool) error {
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := getEvent(ctx, tx, eventID); err != nil {
+			return err
+		}
+
+		var id string
+		err := tx.QueryRow(ctx,
+			`SELECT id FROM shopping_list_purchases WHERE event_id = $1 AND item_key = $2`, eventID, key,
+		).Scan(&id)
+		exists := err == nil
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		type purchaseState struct {
+			Key       string `json:"key"`
+			Purchased bool   `json:"purchased"`
+		}
+		before := purchaseState{Key: key, Purchased: exists}
+		after := purchaseState{Key: key, Purchased: purchased}
+		if exists == purchased {
+			return nil
+		}
+
+		if purchased {
+			id = uuid.New().String()
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO shopping_list_purchases (id, event_id, item_key, purchased_by, purchased_at)
+				 VALUES ($1, $2, $3, $4, $5)`,
+				id, eventID, key, actorFromContext(ctx), time.Now(),
+			); err != nil {
+				return err
+			}
+		} else {
+			if _, err := tx.Exec(ctx, `DELETE FROM shopping_list_purchases WHERE id = $1`, id); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "shopping_item", EntityID: id, EventID: &eventID, Before: before, After: after,
+		})
+	})
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+
+	"farm-time/internal/models"
+)
+
+// Stats. Everything is aggregated in SQL from the existing tables; nothing
+// is stored. Attendee entries are tied to users by email, and nights are
+// counted in calendar days between arrival and departure in the event's
+// time zone.
+
+// mealItemCovered is true for item mi when the host is buying it or the
+// assignee and signups bring all of it, matching withSignups
+const mealItemCovered = `(mi.host_buys OR CASE
+	WHEN mi.quantity IS NULL THEN
+		mi.assigned_attendee_id IS NOT NULL OR EXISTS (SELECT 1 FROM meal_signups s WHERE s.meal_item_id = mi.id)
+	ELSE
+		CASE WHEN mi.assigned_attendee_id IS NOT NULL THEN COALESCE(mi.assigned_quantity, mi.quantity) ELSE 0 END
+		+ COALESCE((SELECT SUM(s.quantity) FROM meal_signups s WHERE s.meal_item_id = mi.id), 0) >= mi.quantity
+END)`
+
+// attendeeNights counts the nights attendee a stays at event e
+const attendeeNights = `GREATEST(
+	(a.departure_time AT TIME ZONE e.time_zone)::date - (a.arrival_time AT TIME ZONE e.time_zone)::date, 0)`
+
+// eventYear is the year event e starts in, in its own time zone
+const eventYear = `EXTRACT(YEAR FROM e.start_time AT TIME ZONE e.time_zone)`
+
+// statsEvents limits e to live events starting in year $2, or in any year
+// if $2 is NULL
+const statsEvents = `e.deleted_at IS NULL AND ($2::int IS NULL OR ` + eventYear + ` = $2::int)`
+
+// userStatsQuery computes UserStats for user $1, or every user if $1 is
+// empty, over the events in statsEvents
+const userStatsQuery = `SELECT u.id, u.name,
+	(SELECT COUNT(DISTINCT a.event_id) FROM attendees a JOIN events e ON a.event_id = e.id
+	 WHERE LOWER(a.email) = LOWER(u.email) AND a.status = 'attending' AND ` + statsEvents + `),
+	(SELECT COUNT(DISTINCT m.id) FROM meal_signups s
+	 JOIN meal_items mi ON s.meal_item_id = mi.id JOIN meals m ON mi.meal_id = m.id JOIN events e ON m.event_id = e.id
+	 WHERE s.user_id = u.id AND mi.deleted_at IS NULL AND m.deleted_at IS NULL AND ` + statsEvents + `),
+	(SELECT COUNT(*) FROM meal_items mi JOIN meals m ON mi.meal_id = m.id JOIN events e ON m.event_id = e.id
+	 WHERE mi.deleted_at IS NULL AND m.deleted_at IS NULL AND ` + statsEvents + `
+	   AND (EXISTS (SELECT 1 FROM attendees a WHERE a.id = mi.assigned_attendee_id AND LOWER(a.email) = LOWER(u.email))
+	        OR EXISTS (SELECT 1 FROM meal_signups s WHERE s.meal_item_id = mi.id AND s.user_id = u.id))),
+	(SELECT COUNT(*) FROM todos t JOIN events e ON t.event_id = e.id
+	 WHERE t.completed AND t.deleted_at IS NULL AND ` + statsEvents + `
+	   AND (t.completed_by = u.id OR (t.completed_by IS NULL AND EXISTS (
+		SELECT 1 FROM attendees a WHERE a.id = t.assigned_attendee_id AND LOWER(a.email) = LOWER(u.email))))),
+	(SELECT COALESCE(SUM(` + attendeeNights + `), 0)::int FROM attendees a JOIN events e ON a.event_id = e.id
+	 WHERE LOWER(a.email) = LOWER(u.email) AND a.status = 'attending' AND ` + statsEvents + `)
+ FROM users u
+ WHERE $1 = '' OR u.id = $1`
+
+func scanUserStats(row interface{ Scan(...any) error }, s *models.UserStats) error {
+	return row.Scan(&s.UserID, &s.Name, &s.EventsAttended, &s.MealsSignedUp, &s.ItemsBrought, &s.TodosCompleted,
+		&s.NightsStayed)
+}
+
+// GetUserStats returns a user's contributions across all events
+func (db *DB) GetUserStats(ctx context.Context, userID string) (*models.UserStats, error) {
+	var stats models.UserStats
+	err := scanUserStats(db.pool.QueryRow(ctx, userStatsQuery, userID, nil), &stats)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &stats, nil
+}
+
+// listUserStats returns the stats of every user who took part in an event
+// starting in year, or in any year if year is nil, biggest contributors
+// first. limit 0 means no limit.
+func (db *DB) listUserStats(ctx context.Context, year *int, limit int) ([]models.UserStats, error) {
+	var limitArg *int
+	if limit > 0 {
+		limitArg = &limit
+	}
+	rows, err := db.pool.Query(ctx,
+		`SELECT * FROM (`+userStatsQuery+`) s (user_id, name, events, meals, items, todos, nights)
+		 WHERE s.events > 0 OR s.meals > 0 OR s.items > 0 OR s.todos > 0
+		 ORDER BY s.items + s.todos DESC, s.events DESC, LOWER(s.name) ASC
+		 LIMIT $3`, "", year, limitArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.UserStats{}
+	for rows.Next() {
+		var s models.UserStats
+		if err := scanUserStats(rows, &s); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// ListUserStats returns every user's contributions across all events,
+// biggest contributors first
+func (db *DB) ListUserStats(ctx context.Context) ([]models.UserStats, error) {
+	return db.listUserStats(ctx, nil, 0)
+}
+
+// queryEventStats computes EventStats for the events matching where, which
+// may refer to e and to $1 onwards
+func (db *DB) queryEventStats(ctx context.Context, where string, args ...any) ([]models.EventStats, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT e.id, e.title, e.start_time, e.end_time,
+			a.attendees, a.headcount, a.person_nights, i.items, i.covered, t.todos, t.completed
+		 FROM events e
+		 CROSS JOIN LATERAL (
+			SELECT COUNT(*)::int AS attendees,
+				COALESCE(SUM(a.adults + a.children), 0)::int AS headcount,
+				COALESCE(SUM((a.adults + a.children) * `+attendeeNights+`), 0)::int AS person_nights
+			FROM attendees a WHERE a.event_id = e.id AND a.status = 'attending'
+		 ) a
+		 CROSS JOIN LATERAL (
+			SELECT COUNT(*)::int AS items, (COUNT(*) FILTER (WHERE `+mealItemCovered+`))::int AS covered
+			FROM meal_items mi JOIN meals m ON mi.meal_id = m.id
+			WHERE m.event_id = e.id AND m.deleted_at IS NULL AND mi.deleted_at IS NULL
+		 ) i
+		 CROSS JOIN LATERAL (
+			SELECT COUNT(*)::int AS todos, (COUNT(*) FILTER (WHERE t.completed))::int AS completed
+			FROM todos t WHERE t.event_id = e.id AND t.deleted_at IS NULL
+		 ) t
+		 WHERE `+where+`
+		 ORDER BY e.start_time ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.EventStats{}
+	for rows.Next() {
+		var s models.EventStats
+		if err := rows.Scan(&s.EventID, &s.Title, &s.StartTime, &s.EndTime, &s.Attendees, &s.Headcount,
+			&s.PersonNights, &s.MealItems, &s.CoveredItems, &s.Todos, &s.CompletedTodos); err != nil {
+			return nil, err
+		}
+		s.Coverage = percentage(s.CoveredItems, s.MealItems)
+		s.TodoCompletion = percentage(s.CompletedTodos, s.Todos)
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// percentage returns part as a percentage of whole, or 0 if whole is 0
+func percentage(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(whole)
+}
+
+// GetEventStats summarizes an event's turnout and coverage
+func (db *DB) GetEventStats(ctx context.Context, eventID string) (*models.EventStats, error) {
+	stats, err := db.queryEventStats(ctx, `e.id = $1 AND e.deleted_at IS NULL`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return nil, ErrNotFound
+	}
+	return &stats[0], nil
+}
+
+// GetYearlyReport rolls up the events that started in year, each in its
+// own time zone
+func (db *DB) GetYearlyReport(ctx context.Context, year int) (*models.YearlyReport, error) {
+	const inYear = `e.deleted_at IS NULL AND ` + eventYear + ` = $1::int`
+	events, err := db.queryEventStats(ctx, inYear, year)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.YearlyReport{Year: year, Events: len(events), EventStats: events}
+	for _, e := range events {
+		report.Headcount += e.Headcount
+		report.PersonNights += e.PersonNights
+		report.MealItems += e.MealItems
+		report.CoveredItems += e.CoveredItems
+		report.Todos += e.Todos
+		report.CompletedTodos += e.CompletedTodos
+	}
+	report.Coverage = percentage(report.CoveredItems, report.MealItems)
+	report.TodoCompletion = percentage(report.CompletedTodos, report.Todos)
+
+	if err := db.pool.QueryRow(ctx,
+		`SELECT COUNT(DISTINCT COALESCE(NULLIF(LOWER(a.email), ''), a.id))
+		 FROM attendees a JOIN events e ON a.event_id = e.id
+		 WHERE a.status = 'attending' AND `+inYear, year,
+	).Scan(&report.People); err != nil {
+		return nil, err
+	}
+
+	report.TopContributors, err = db.listUserStats(ctx, &year, 10)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
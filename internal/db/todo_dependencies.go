@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Todo dependencies. A todo may list other todos in its event as
+// prerequisites; it is blocked until they are all complete. Prerequisites
+// in the trash are ignored until restored.
+
+// withTodoDependencies fills in DependsOn and Blocked for todos in one query
+func withTodoDependencies(ctx context.Context, q querier, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(todos))
+	ids := make([]string, len(todos))
+	for i, t := range todos {
+		index[t.ID] = i
+		ids[i] = t.ID
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT d.todo_id, d.depends_on_id, p.completed
+		 FROM todo_dependencies d
+		 JOIN todos p ON d.depends_on_id = p.id
+		 WHERE d.todo_id = ANY($1) AND p.deleted_at IS NULL
+		 ORDER BY d.todo_id, p.created_at ASC`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID, dependsOnID string
+		var completed bool
+		if err := rows.Scan(&todoID, &dependsOnID, &completed); err != nil {
+			return err
+		}
+		i := index[todoID]
+		todos[i].DependsOn = append(todos[i].DependsOn, dependsOnID)
+		if !completed {
+			todos[i].Blocked = true
+		}
+	}
+	return rows.Err()
+}
+
+// todoBlocked reports whether any live prerequisite of a todo is incomplete
+func todoBlocked(ctx context.Context, q querier, todoID string) (bool, error) {
+	var blocked bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM todo_dependencies d JOIN todos p ON d.depends_on_id = p.id
+			WHERE d.todo_id = $1 AND NOT p.completed AND p.deleted_at IS NULL
+		 )`, todoID,
+	).Scan(&blocked)
+	return blocked, err
+}
+
+// setTodoDependencies replaces a todo's prerequisites. Every prerequisite
+// must be a live todo in the same event (ErrForeignKey), and none may
+// already depend on the todo, directly or indirectly (ErrDependencyCycle).
+func setTodoDependencies(ctx context.Context, tx pgx.Tx, todo *models.Todo, dependsOn []string) error {
+	// Serialize dependency edits within the event so two concurrent
+	// changes can't close a cycle between them
+	if _, err := tx.Exec(ctx,
+		`SELECT pg_advisory_xact_lock(hashtext('todo_dependencies:' || $1))`, todo.EventID,
+	); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(dependsOn))
+	deps := []string{}
+	for _, id := range dependsOn {
+		if id == todo.ID {
+			return ErrDependencyCycle
+		}
+		if !seen[id] {
+			seen[id] = true
+			deps = append(deps, id)
+		}
+	}
+
+	if len(deps) > 0 {
+		var found int
+		if err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM todos WHERE id = ANY($1) AND event_id = $2 AND deleted_at IS NULL`,
+			deps, todo.EventID,
+		).Scan(&found); err != nil {
+			return err
+		}
+		if found != len(deps) {
+			return ErrForeignKey
+		}
+
+		rows, err := tx.Query(ctx,
+			`SELECT d.todo_id, d.depends_on_id
+			 FROM todo_dependencies d JOIN todos t ON d.todo_id = t.id
+			 WHERE t.event_id = $1 AND d.todo_id <> $2`, todo.EventID, todo.ID)
+		if err != nil {
+			return err
+		}
+		edges := map[string][]string{}
+		for rows.Next() {
+			var from, to string
+			if err := rows.Scan(&from, &to); err != nil {
+				rows.Close()
+				return err
+			}
+			edges[from] = append(edges[from], to)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Walk the prerequisites' own prerequisites looking for the todo
+		visited := map[string]bool{}
+		stack := append([]string{}, deps...)
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if id == todo.ID {
+				return ErrDependencyCycle
+			}
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			stack = append(stack, edges[id]...)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM todo_dependencies WHERE todo_id = $1`, todo.ID); err != nil {
+		return err
+	}
+	for _, id := range deps {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO todo_dependencies (todo_id, depends_on_id) VALUES ($1, $2)`, todo.ID, id,
+		); err != nil {
+			return err
+		}
+	}
+	todo.DependsOn = deps
+
+	blocked, err := todoBlocked(ctx, tx, todo.ID)
+	if err != nil {
+		return err
+	}
+	todo.Blocked = blocked
+	return nil
+}
+
+// GetTodoPlan returns an event's open todos in dependency order, split into
+// those that can be done now and those still waiting on others. Within
+// that order, more urgent and older todos come first.
+func (db *DB) GetTodoPlan(ctx context.Context, eventID string) (*models.TodoPlan, error) {
+	open := false
+	todos, err := db.ListTodos(ctx, eventID, models.TodoFilter{Completed: &open, Sort: "priority"})
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(todos))
+	for i, t := range todos {
+		index[t.ID] = i
+	}
+	waiting := make([]int, len(todos))
+	dependents := make([][]int, len(todos))
+	for i, t := range todos {
+		for _, id := range t.DependsOn {
+			// Completed prerequisites aren't in the list and don't hold anything up
+			if j, ok := index[id]; ok {
+				waiting[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	plan := &models.TodoPlan{Ready: []models.Todo{}, Blocked: []models.Todo{}}
+	placed := make([]bool, len(todos))
+	for range todos {
+		next := -1
+		for i := range todos {
+			if !placed[i] && waiting[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		placed[next] = true
+		for _, j := range dependents[next] {
+			waiting[j]--
+		}
+		if todos[next].Blocked {
+			plan.Blocked = append(plan.Blocked, todos[next])
+		} else {
+			plan.Ready = append(plan.Ready, todos[next])
+		}
+	}
+	for i := range todos {
+		if !placed[i] {
+			plan.Blocked = append(plan.Blocked, todos[i])
+		}
+	}
+	return plan, nil
+}
@@ -2,15 +2,102 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
 	"farm-time/internal/models"
 )
 
 // Todo operations
 
+// TodoPriorityNormal is the priority of todos created without one
+const TodoPriorityNormal = "normal"
+
+const todoColumns = `t.id, t.event_id, t.title, COALESCE(t.description, ''), t.completed, t.assigned_attendee_id, a.name,
+	t.due_at, t.due_offset_minutes, t.priority, t.category, t.completed_at, t.completed_by, cu.name,
+	t.checklist_item_id, t.checklist, t.version, t.created_at, t.updated_at, t.deleted_at`
+
+const todoJoins = ` FROM todos t
+	LEFT JOIN attendees a ON t.assigned_attendee_id = a.id
+	LEFT JOIN users cu ON t.completed_by = cu.id`
+
+// todoPriorityRank orders priorities most urgent first
+const todoPriorityRank = `CASE t.priority WHEN 'urgent' THEN 0 WHEN 'high' THEN 1 WHEN 'normal' THEN 2 ELSE 3 END`
+
+func scanTodo(row pgx.Row, t *models.Todo) error {
+	t.Subtasks = []models.TodoSubtask{}
+	t.DependsOn = []string{}
+	return row.Scan(&t.ID, &t.EventID, &t.Title, &t.Description, &t.Completed, &t.AssignedAttendeeID, &t.AssignedAttendeeName,
+		&t.DueAt, &t.DueOffsetMinutes, &t.Priority, &t.Category, &t.CompletedAt, &t.CompletedBy, &t.CompletedByName,
+		&t.ChecklistItemID, &t.Checklist, &t.Version, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt)
+}
+
+// withTodoSubtasks loads the checklists of todos in one query
+func withTodoSubtasks(ctx context.Context, q querier, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(todos))
+	ids := make([]string, len(todos))
+	for i, t := range todos {
+		index[t.ID] = i
+		ids[i] = t.ID
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT todo_id, title, done FROM todo_subtasks WHERE todo_id = ANY($1) ORDER BY todo_id, position ASC`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID string
+		var st models.TodoSubtask
+		if err := rows.Scan(&todoID, &st.Title, &st.Done); err != nil {
+			return err
+		}
+		i := index[todoID]
+		todos[i].Subtasks = append(todos[i].Subtasks, st)
+	}
+	return rows.Err()
+}
+
+// withTodoDetails loads the checklists and prerequisites of todos
+func withTodoDetails(ctx context.Context, q querier, todos []models.Todo) error {
+	if err := withTodoSubtasks(ctx, q, todos); err != nil {
+		return err
+	}
+	return withTodoDependencies(ctx, q, todos)
+}
+
+// replaceTodoSubtasks swaps a todo's checklist for a new one
+func replaceTodoSubtasks(ctx context.Context, q querier, todoID string, subtasks []models.TodoSubtask) error {
+	if _, err := q.Exec(ctx, `DELETE FROM todo_subtasks WHERE todo_id = $1`, todoID); err != nil {
+		return err
+	}
+	for i, st := range subtasks {
+		if _, err := q.Exec(ctx,
+			`INSERT INTO todo_subtasks (todo_id, position, title, done) VALUES ($1, $2, $3, $4)`,
+			todoID, i, st.Title, st.Done,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relativeDue returns when a todo due offset minutes after the event
+// starts is due
+func relativeDue(event *models.Event, offset int) *time.Time {
+	due := event.StartTime.Add(time.Duration(offset) * time.Minute)
+	return &due
+}
+
 func (db *DB) CreateTodo(ctx context.Context, eventID string, req models.CreateTodoRequest) (*models.Todo, error) {
 	todo := &models.Todo{
 		ID:                 uuid.New().String(),
@@ -19,104 +106,342 @@ func (db *DB) CreateTodo(ctx context.Context, eventID string, req models.CreateT
 		Description:        req.Description,
 		Completed:          false,
 		AssignedAttendeeID: req.AssignedAttendeeID,
+		DueAt:              req.DueAt,
+		DueOffsetMinutes:   req.DueOffsetMinutes,
+		Priority:           req.Priority,
+		Category:           req.Category,
+		Subtasks:           req.Subtasks,
+		Version:            1,
 		CreatedAt:          time.Now(),
 		UpdatedAt:          time.Now(),
 	}
+	if todo.Priority == "" {
+		todo.Priority = TodoPriorityNormal
+	}
+	if todo.Subtasks == nil {
+		todo.Subtasks = []models.TodoSubtask{}
+	}
+	todo.DependsOn = []string{}
 
-	_, err := db.pool.Exec(ctx,
-		`INSERT INTO todos (id, event_id, title, description, completed, assigned_attendee_id, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		todo.ID, todo.EventID, todo.Title, todo.Description, todo.Completed, todo.AssignedAttendeeID, todo.CreatedAt, todo.UpdatedAt,
-	)
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		if err := checkLiveEvent(ctx, tx, eventID); err != nil {
+			return err
+		}
+
+		if todo.DueOffsetMinutes != nil {
+			event, err := getEvent(ctx, tx, eventID)
+			if err != nil {
+				return err
+			}
+			todo.DueAt = relativeDue(event, *todo.DueOffsetMinutes)
+		}
+
+		if err := insertTodo(ctx, tx, todo); err != nil {
+			return err
+		}
+		if len(req.DependsOn) > 0 {
+			if err := setTodoDependencies(ctx, tx, todo, req.DependsOn); err != nil {
+				return err
+			}
+		}
+
+		// Get attendee name if assigned
+		todo.AssignedAttendeeName = attendeeName(ctx, tx, todo.AssignedAttendeeID)
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditCreate, EntityType: "todo", EntityID: todo.ID, EventID: &eventID, After: todo,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Get attendee name if assigned
-	if todo.AssignedAttendeeID != nil {
-		var name string
-		err := db.pool.QueryRow(ctx, `SELECT name FROM attendees WHERE id = $1`, *todo.AssignedAttendeeID).Scan(&name)
-		if err == nil {
-			todo.AssignedAttendeeName = &name
+	return todo, nil
+}
+
+// insertTodo stores a new todo and its checklist
+func insertTodo(ctx context.Context, tx pgx.Tx, todo *models.Todo) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO todos (id, event_id, title, description, completed, assigned_attendee_id, due_at,
+		 due_offset_minutes, priority, category, checklist_item_id, checklist, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		todo.ID, todo.EventID, todo.Title, todo.Description, todo.Completed, todo.AssignedAttendeeID, todo.DueAt,
+		todo.DueOffsetMinutes, todo.Priority, todo.Category, todo.ChecklistItemID, todo.Checklist, todo.CreatedAt,
+		todo.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	return replaceTodoSubtasks(ctx, tx, todo.ID, todo.Subtasks)
+}
+
+// followEventDueDates moves the event's todos due relative to its start,
+// and closing chores still due at its old end, to match its new times,
+// auditing each one it changes. Todos in the trash move too, so they come
+// back on time if restored.
+func (db *DB) followEventDueDates(ctx context.Context, tx pgx.Tx, before, event *models.Event) error {
+	rows, err := tx.Query(ctx,
+		`SELECT `+todoColumns+todoJoins+`
+		 WHERE t.event_id = $1 AND (t.due_offset_minutes IS NOT NULL OR (t.checklist = $2 AND t.due_at = $3))
+		 FOR UPDATE OF t`, event.ID, ChecklistDeparture, before.EndTime)
+	if err != nil {
+		return err
+	}
+	var todos []models.Todo
+	for rows.Next() {
+		var t models.Todo
+		if err := scanTodo(rows, &t); err != nil {
+			rows.Close()
+			return err
 		}
+		todos = append(todos, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := withTodoDetails(ctx, tx, todos); err != nil {
+		return err
 	}
 
-	return todo, nil
+	for _, prev := range todos {
+		var due time.Time
+		if prev.DueOffsetMinutes != nil {
+			due = event.StartTime.Add(time.Duration(*prev.DueOffsetMinutes) * time.Minute)
+		} else {
+			due = event.EndTime
+		}
+		if prev.DueAt != nil && prev.DueAt.Equal(due) {
+			continue
+		}
+
+		todo := prev
+		todo.DueAt = &due
+		if err := tx.QueryRow(ctx,
+			`UPDATE todos SET due_at = $1, updated_at = $2, version = version + 1
+			 WHERE id = $3
+			 RETURNING version`,
+			todo.DueAt, event.UpdatedAt, todo.ID,
+		).Scan(&todo.Version); err != nil {
+			return err
+		}
+		todo.UpdatedAt = event.UpdatedAt
+
+		if err := db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "todo", EntityID: todo.ID, EventID: &todo.EventID,
+			Before: &prev, After: &todo,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (db *DB) GetTodo(ctx context.Context, id string) (*models.Todo, error) {
+func getTodo(ctx context.Context, q querier, id string) (*models.Todo, error) {
 	var todo models.Todo
-	err := db.pool.QueryRow(ctx,
-		`SELECT t.id, t.event_id, t.title, COALESCE(t.description, ''), t.completed, t.assigned_attendee_id, a.name, t.created_at, t.updated_at
-		 FROM todos t
-		 LEFT JOIN attendees a ON t.assigned_attendee_id = a.id
-		 WHERE t.id = $1`, id,
-	).Scan(&todo.ID, &todo.EventID, &todo.Title, &todo.Description, &todo.Completed, &todo.AssignedAttendeeID, &todo.AssignedAttendeeName, &todo.CreatedAt, &todo.UpdatedAt)
-
+	err := scanTodo(q.QueryRow(ctx,
+		`SELECT `+todoColumns+todoJoins+` WHERE t.id = $1 AND t.deleted_at IS NULL`, id,
+	), &todo)
 	if err != nil {
+		return nil, mapError(err)
+	}
+	todos := []models.Todo{todo}
+	if err := withTodoDetails(ctx, q, todos); err != nil {
 		return nil, err
 	}
-	return &todo, nil
+	return &todos[0], nil
 }
 
+func (db *DB) GetTodo(ctx context.Context, id string) (*models.Todo, error) {
+	return getTodo(ctx, db.pool, id)
+}
+
+// GetTodosByEvent returns an event's todos, open ones first
 func (db *DB) GetTodosByEvent(ctx context.Context, eventID string) ([]models.Todo, error) {
-	rows, err := db.pool.Query(ctx,
-		`SELECT t.id, t.event_id, t.title, COALESCE(t.description, ''), t.completed, t.assigned_attendee_id, a.name, t.created_at, t.updated_at
-		 FROM todos t
-		 LEFT JOIN attendees a ON t.assigned_attendee_id = a.id
-		 WHERE t.event_id = $1 ORDER BY t.completed ASC, t.created_at ASC`, eventID)
+	return db.ListTodos(ctx, eventID, models.TodoFilter{})
+}
+
+// todoSorts maps TodoFilter.Sort to an ORDER BY clause taking the direction
+var todoSorts = map[string]string{
+	"due":      "t.due_at %s NULLS LAST",
+	"priority": todoPriorityRank + " %s",
+	"title":    "LOWER(t.title) %s",
+	"created":  "t.created_at %s",
+}
+
+// listTodos returns an event's todos matching filter. Todos sort with open
+// ones first, oldest first, unless filter.Sort says otherwise; priority
+// sorts most urgent first.
+func listTodos(ctx context.Context, q querier, eventID string, filter models.TodoFilter) ([]models.Todo, error) {
+	conds := []string{"t.event_id = $1", "t.deleted_at IS NULL"}
+	args := []any{eventID}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.Completed != nil {
+		add("t.completed = $%d", *filter.Completed)
+	}
+	if filter.Priority != "" {
+		add("t.priority = $%d", filter.Priority)
+	}
+	if filter.Category != "" {
+		add("t.category = $%d", filter.Category)
+	}
+	if filter.Checklist != "" {
+		add("t.checklist = $%d", filter.Checklist)
+	}
+	if filter.AssigneeID == "none" {
+		conds = append(conds, "t.assigned_attendee_id IS NULL")
+	} else if filter.AssigneeID != "" {
+		add("t.assigned_attendee_id = $%d", filter.AssigneeID)
+	}
+	if filter.DueBefore != nil {
+		add("t.due_at < $%d", *filter.DueBefore)
+	}
+
+	order := "t.completed ASC, t.created_at ASC"
+	if clause, ok := todoSorts[filter.Sort]; ok {
+		direction := "ASC"
+		if filter.Descending {
+			direction = "DESC"
+		}
+		order = fmt.Sprintf(clause, direction) + ", t.created_at ASC"
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT `+todoColumns+todoJoins+` WHERE `+strings.Join(conds, " AND ")+` ORDER BY `+order+`, t.id ASC`,
+		args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var todos []models.Todo
+	todos := []models.Todo{}
 	for rows.Next() {
 		var t models.Todo
-		if err := rows.Scan(&t.ID, &t.EventID, &t.Title, &t.Description, &t.Completed, &t.AssignedAttendeeID, &t.AssignedAttendeeName, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		if err := scanTodo(rows, &t); err != nil {
 			return nil, err
 		}
 		todos = append(todos, t)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	if err := withTodoDetails(ctx, q, todos); err != nil {
+		return nil, err
+	}
 	return todos, nil
 }
 
-func (db *DB) UpdateTodo(ctx context.Context, id string, req models.UpdateTodoRequest) (*models.Todo, error) {
-	todo, err := db.GetTodo(ctx, id)
-	if err != nil {
-		return nil, err
-	}
+func (db *DB) ListTodos(ctx context.Context, eventID string, filter models.TodoFilter) ([]models.Todo, error) {
+	return listTodos(ctx, db.pool, eventID, filter)
+}
 
-	if req.Title != nil {
-		todo.Title = *req.Title
-	}
-	if req.Description != nil {
-		todo.Description = *req.Description
-	}
-	if req.Completed != nil {
-		todo.Completed = *req.Completed
-	}
-	if req.AssignedAttendeeID != nil {
-		if *req.AssignedAttendeeID == "" {
-			todo.AssignedAttendeeID = nil
-			todo.AssignedAttendeeName = nil
-		} else {
-			todo.AssignedAttendeeID = req.AssignedAttendeeID
-			// Get attendee name
-			var name string
-			err := db.pool.QueryRow(ctx, `SELECT name FROM attendees WHERE id = $1`, *req.AssignedAttendeeID).Scan(&name)
-			if err == nil {
-				todo.AssignedAttendeeName = &name
+func (db *DB) UpdateTodo(ctx context.Context, id string, req models.UpdateTodoRequest, expectedVersion *int) (*models.Todo, error) {
+	var todo *models.Todo
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getTodo(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(expectedVersion, before.Version); err != nil {
+			return err
+		}
+
+		updated := *before
+		todo = &updated
+		if req.Title != nil {
+			todo.Title = *req.Title
+		}
+		if req.Description != nil {
+			todo.Description = *req.Description
+		}
+		if req.Completed != nil && *req.Completed != before.Completed {
+			todo.Completed = *req.Completed
+			if todo.Completed {
+				now := time.Now()
+				todo.CompletedAt = &now
+				todo.CompletedBy = actorFromContext(ctx)
+				todo.CompletedByName = userName(ctx, tx, todo.CompletedBy)
+			} else {
+				todo.CompletedAt = nil
+				todo.CompletedBy = nil
+				todo.CompletedByName = nil
 			}
 		}
-	}
-	todo.UpdatedAt = time.Now()
+		if req.AssignedAttendeeID != nil {
+			if *req.AssignedAttendeeID == "" {
+				todo.AssignedAttendeeID = nil
+				todo.AssignedAttendeeName = nil
+			} else {
+				todo.AssignedAttendeeID = req.AssignedAttendeeID
+				todo.AssignedAttendeeName = attendeeName(ctx, tx, req.AssignedAttendeeID)
+			}
+		}
+		if req.ClearDue {
+			todo.DueAt = nil
+			todo.DueOffsetMinutes = nil
+		}
+		if req.DueAt != nil {
+			todo.DueOffsetMinutes = nil
+			todo.DueAt = req.DueAt
+		}
+		if req.DueOffsetMinutes != nil {
+			event, err := getEvent(ctx, tx, todo.EventID)
+			if err != nil {
+				return err
+			}
+			todo.DueOffsetMinutes = req.DueOffsetMinutes
+			todo.DueAt = relativeDue(event, *req.DueOffsetMinutes)
+		}
+		if req.Priority != nil {
+			todo.Priority = *req.Priority
+		}
+		if req.Category != nil {
+			todo.Category = *req.Category
+		}
+		if req.Subtasks != nil {
+			todo.Subtasks = *req.Subtasks
+			if todo.Subtasks == nil {
+				todo.Subtasks = []models.TodoSubtask{}
+			}
+		}
+		if req.DependsOn != nil {
+			if err := setTodoDependencies(ctx, tx, todo, *req.DependsOn); err != nil {
+				return err
+			}
+		}
+		if todo.Completed && !before.Completed && todo.Blocked && !req.Override {
+			return ErrBlocked
+		}
+		todo.UpdatedAt = time.Now()
+		todo.Version = before.Version + 1
 
-	_, err = db.pool.Exec(ctx,
-		`UPDATE todos SET title=$1, description=$2, completed=$3, assigned_attendee_id=$4, updated_at=$5 WHERE id=$6`,
-		todo.Title, todo.Description, todo.Completed, todo.AssignedAttendeeID, todo.UpdatedAt, id,
-	)
+		err = casResult(tx.Exec(ctx,
+			`UPDATE todos SET title=$1, description=$2, completed=$3, assigned_attendee_id=$4, due_at=$5,
+			 due_offset_minutes=$6, priority=$7, category=$8, completed_at=$9, completed_by=$10, updated_at=$11,
+			 version=$12
+			 WHERE id=$13 AND version=$14 AND deleted_at IS NULL`,
+			todo.Title, todo.Description, todo.Completed, todo.AssignedAttendeeID, todo.DueAt,
+			todo.DueOffsetMinutes, todo.Priority, todo.Category, todo.CompletedAt, todo.CompletedBy, todo.UpdatedAt,
+			todo.Version, id, before.Version,
+		))
+		if err != nil {
+			return err
+		}
+		if req.Subtasks != nil {
+			if err := replaceTodoSubtasks(ctx, tx, id, todo.Subtasks); err != nil {
+				return err
+			}
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "todo", EntityID: id, EventID: &todo.EventID, Before: before, After: todo,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -124,9 +449,23 @@ func (db *DB) UpdateTodo(ctx context.Context, id string, req models.UpdateTodoRe
 	return todo, nil
 }
 
+// DeleteTodo moves the todo to the trash. It returns ErrNotFound if there
+// was nothing to delete.
 func (db *DB) DeleteTodo(ctx context.Context, id string) error {
-	_, err := db.pool.Exec(ctx, `DELETE FROM todos WHERE id = $1`, id)
-	return err
+	return db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := getTodo(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE todos SET deleted_at = $1 WHERE id = $2`, time.Now(), id); err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditDelete, EntityType: "todo", EntityID: id, EventID: &before.EventID, Before: before,
+		})
+	})
 }
 
 // GetEventWithAll returns event with attendees, meals, and todos
@@ -136,6 +475,21 @@ func (db *DB) GetEventWithAll(ctx context.Context, id string) (*models.EventWith
 		return nil, err
 	}
 
+	households, err := db.GetHouseholdsByEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rides, err := db.GetRidesByEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := db.GetReservationsByEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
 	todos, err := db.GetTodosByEvent(ctx, id)
 	if err != nil {
 		return nil, err
@@ -146,6 +500,9 @@ func (db *DB) GetEventWithAll(ctx context.Context, id string) (*models.EventWith
 
 	return &models.EventWithAll{
 		EventWithMeals: *eventWithMeals,
+		Households:     households,
+		Rides:          rides,
+		Reservations:   reservations,
 		Todos:          todos,
 	}, nil
 }
@@ -0,0 +1,396 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"farm-time/internal/models"
+)
+
+// Audit actions for the trash lifecycle
+const (
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// Children deleted along with their parent share its deleted_at timestamp,
+// which is how a restore tells them apart from rows that were deleted on
+// their own beforehand.
+
+// checkLiveEvent returns ErrParentDeleted if the event is in the trash. It
+// locks the event so it can't be deleted until tx ends.
+func checkLiveEvent(ctx context.Context, tx pgx.Tx, eventID string) error {
+	var deleted bool
+	err := tx.QueryRow(ctx,
+		`SELECT deleted_at IS NOT NULL FROM events WHERE id = $1 FOR SHARE`, eventID,
+	).Scan(&deleted)
+	if err != nil {
+		return mapError(err)
+	}
+	if deleted {
+		return ErrParentDeleted
+	}
+	return nil
+}
+
+// checkLiveMeal returns ErrParentDeleted if the meal or its event is in the
+// trash. It locks both so neither can be deleted until tx ends.
+func checkLiveMeal(ctx context.Context, tx pgx.Tx, mealID string) error {
+	var deleted bool
+	err := tx.QueryRow(ctx,
+		`SELECT m.deleted_at IS NOT NULL OR e.deleted_at IS NOT NULL
+		 FROM meals m JOIN events e ON m.event_id = e.id
+		 WHERE m.id = $1 FOR SHARE`, mealID,
+	).Scan(&deleted)
+	if err != nil {
+		return mapError(err)
+	}
+	if deleted {
+		return ErrParentDeleted
+	}
+	return nil
+}
+
+func softDeleteEventChildren(ctx context.Context, q querier, eventID string, at time.Time) error {
+	if _, err := q.Exec(ctx,
+		`UPDATE meal_items SET deleted_at = $1
+		 WHERE deleted_at IS NULL AND meal_id IN (SELECT id FROM meals WHERE event_id = $2)`, at, eventID,
+	); err != nil {
+		return err
+	}
+	if _, err := q.Exec(ctx,
+		`UPDATE meals SET deleted_at = $1 WHERE event_id = $2 AND deleted_at IS NULL`, at, eventID,
+	); err != nil {
+		return err
+	}
+	_, err := q.Exec(ctx,
+		`UPDATE todos SET deleted_at = $1 WHERE event_id = $2 AND deleted_at IS NULL`, at, eventID,
+	)
+	return err
+}
+
+func softDeleteMealChildren(ctx context.Context, q querier, mealID string, at time.Time) error {
+	_, err := q.Exec(ctx,
+		`UPDATE meal_items SET deleted_at = $1 WHERE meal_id = $2 AND deleted_at IS NULL`, at, mealID,
+	)
+	return err
+}
+
+// Restore operations
+
+// RestoreEvent brings an event back from the trash along with the children
+// that were deleted with it
+func (db *DB) RestoreEvent(ctx context.Context, id string) (*models.Event, error) {
+	var event *models.Event
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		var before models.Event
+		err := scanEvent(tx.QueryRow(ctx,
+			`SELECT `+eventColumns+` FROM events WHERE id = $1 AND deleted_at IS NOT NULL`, id,
+		), &before)
+		if err != nil {
+			return err
+		}
+		if err := checkEventDates(ctx, tx, &before); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE meal_items SET deleted_at = NULL
+			 WHERE deleted_at = $1 AND meal_id IN (SELECT id FROM meals WHERE event_id = $2)`, *before.DeletedAt, id,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE meals SET deleted_at = NULL WHERE event_id = $1 AND deleted_at = $2`, id, *before.DeletedAt,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE todos SET deleted_at = NULL WHERE event_id = $1 AND deleted_at = $2`, id, *before.DeletedAt,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE events SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		event, err = getEvent(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditRestore, EntityType: "event", EntityID: id, EventID: &id, Before: &before, After: event,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// RestoreMeal brings a meal back from the trash along with the items that
+// were deleted with it
+func (db *DB) RestoreMeal(ctx context.Context, id string) (*models.Meal, error) {
+	var meal *models.Meal
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		var before models.Meal
+		err := scanMeal(tx.QueryRow(ctx,
+			`SELECT `+mealColumns+` FROM meals WHERE id = $1 AND deleted_at IS NOT NULL`, id,
+		), &before)
+		if err != nil {
+			return err
+		}
+
+		if _, err := getEvent(ctx, tx, before.EventID); errors.Is(err, ErrNotFound) {
+			return ErrParentDeleted
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx,
+			`UPDATE meal_items SET deleted_at = NULL WHERE meal_id = $1 AND deleted_at = $2`, id, *before.DeletedAt,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE meals SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		meal, err = getMeal(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditRestore, EntityType: "meal", EntityID: id, EventID: &meal.EventID, Before: &before, After: meal,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return meal, nil
+}
+
+// RestoreMealItem brings a meal item back from the trash
+func (db *DB) RestoreMealItem(ctx context.Context, id string) (*models.MealItem, error) {
+	var item *models.MealItem
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		var before models.MealItem
+		err := scanMealItem(tx.QueryRow(ctx,
+			`SELECT `+mealItemColumns+`
+			 FROM meal_items mi
+			 LEFT JOIN attendees a ON mi.assigned_attendee_id = a.id
+			 WHERE mi.id = $1 AND mi.deleted_at IS NOT NULL`, id,
+		), &before)
+		if err != nil {
+			return err
+		}
+
+		meal, err := getMeal(ctx, tx, before.MealID)
+		if errors.Is(err, ErrNotFound) {
+			return ErrParentDeleted
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE meal_items SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		item, err = getMealItem(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditRestore, EntityType: "meal_item", EntityID: id, EventID: &meal.EventID, Before: &before, After: item,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// RestoreTodo brings a todo back from the trash
+func (db *DB) RestoreTodo(ctx context.Context, id string) (*models.Todo, error) {
+	var todo *models.Todo
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		var before models.Todo
+		err := scanTodo(tx.QueryRow(ctx,
+			`SELECT `+todoColumns+todoJoins+` WHERE t.id = $1 AND t.deleted_at IS NOT NULL`, id,
+		), &before)
+		if err != nil {
+			return err
+		}
+
+		if _, err := getEvent(ctx, tx, before.EventID); errors.Is(err, ErrNotFound) {
+			return ErrParentDeleted
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE todos SET deleted_at = NULL WHERE id = $1`, id); err != nil {
+			return err
+		}
+
+		todo, err = getTodo(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditRestore, EntityType: "todo", EntityID: id, EventID: &todo.EventID, Before: &before, After: todo,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// Trash queries
+
+// ListDeletedEvents returns events currently in the trash, most recently deleted first
+func (db *DB) ListDeletedEvents(ctx context.Context) ([]models.Event, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var e models.Event
+		if err := scanEvent(rows, &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// GetEventTrash returns the deleted meals, meal items and todos of an event
+func (db *DB) GetEventTrash(ctx context.Context, eventID string) (*models.EventTrash, error) {
+	trash := &models.EventTrash{
+		Meals:     []models.Meal{},
+		MealItems: []models.MealItem{},
+		Todos:     []models.Todo{},
+	}
+
+	mealRows, err := db.pool.Query(ctx,
+		`SELECT `+mealColumns+` FROM meals WHERE event_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer mealRows.Close()
+	for mealRows.Next() {
+		var m models.Meal
+		if err := scanMeal(mealRows, &m); err != nil {
+			return nil, err
+		}
+		trash.Meals = append(trash.Meals, m)
+	}
+
+	itemRows, err := db.pool.Query(ctx,
+		`SELECT `+mealItemColumns+`
+		 FROM meal_items mi
+		 JOIN meals m ON mi.meal_id = m.id
+		 LEFT JOIN attendees a ON mi.assigned_attendee_id = a.id
+		 WHERE m.event_id = $1 AND mi.deleted_at IS NOT NULL ORDER BY mi.deleted_at DESC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		var i models.MealItem
+		if err := scanMealItem(itemRows, &i); err != nil {
+			return nil, err
+		}
+		trash.MealItems = append(trash.MealItems, i)
+	}
+
+	todoRows, err := db.pool.Query(ctx,
+		`SELECT `+todoColumns+todoJoins+`
+		 WHERE t.event_id = $1 AND t.deleted_at IS NOT NULL ORDER BY t.deleted_at DESC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer todoRows.Close()
+	for todoRows.Next() {
+		var t models.Todo
+		if err := scanTodo(todoRows, &t); err != nil {
+			return nil, err
+		}
+		trash.Todos = append(trash.Todos, t)
+	}
+	if err := withTodoDetails(ctx, db.pool, trash.Todos); err != nil {
+		return nil, err
+	}
+
+	return trash, nil
+}
+
+// Retention
+
+// PurgeDeleted permanently removes rows that have been in the trash since
+// before the cutoff and returns how many were removed
+func (db *DB) PurgeDeleted(ctx context.Context, cutoff time.Time) (int, error) {
+	purged := 0
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		// Children go first so each purge is logged against its event
+		// before a cascading delete removes it.
+		statements := []struct {
+			entityType string
+			sql        string
+		}{
+			{"meal_item", `DELETE FROM meal_items mi USING meals m
+				WHERE mi.meal_id = m.id AND mi.deleted_at < $1 RETURNING mi.id, m.event_id`},
+			{"todo", `DELETE FROM todos WHERE deleted_at < $1 RETURNING id, event_id`},
+			{"meal", `DELETE FROM meals WHERE deleted_at < $1 RETURNING id, event_id`},
+			{"event", `DELETE FROM events WHERE deleted_at < $1 RETURNING id, id`},
+		}
+
+		for _, stmt := range statements {
+			rows, err := tx.Query(ctx, stmt.sql, cutoff)
+			if err != nil {
+				return err
+			}
+			var removed []auditRecord
+			for rows.Next() {
+				var id, eventID string
+				if err := rows.Scan(&id, &eventID); err != nil {
+					rows.Close()
+					return err
+				}
+				removed = append(removed, auditRecord{
+					Action: AuditPurge, EntityType: stmt.entityType, EntityID: id, EventID: &eventID,
+				})
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, rec := range removed {
+				if err := db.recordAudit(ctx, tx, rec); err != nil {
+					return err
+				}
+			}
+			purged += len(removed)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -5,36 +5,53 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
 	"farm-time/internal/models"
 )
 
+const userColumns = `id, google_id, email, name, picture, is_admin, can_create_events,
+	dietary_restrictions, allergies, COALESCE(dietary_notes, ''), created_at, updated_at`
+
+func scanUser(row pgx.Row, u *models.User) error {
+	return row.Scan(&u.ID, &u.GoogleID, &u.Email, &u.Name, &u.Picture, &u.IsAdmin, &u.CanCreateEvents,
+		&u.DietaryRestrictions, &u.Allergies, &u.DietaryNotes, &u.CreatedAt, &u.UpdatedAt)
+}
+
 func (db *DB) GetUserByGoogleID(ctx context.Context, googleID string) (*models.User, error) {
 	var user models.User
-	err := db.pool.QueryRow(ctx,
-		`SELECT id, google_id, email, name, picture, is_admin, can_create_events, created_at, updated_at
-		 FROM users WHERE google_id = $1`, googleID,
-	).Scan(&user.ID, &user.GoogleID, &user.Email, &user.Name,
-		&user.Picture, &user.IsAdmin, &user.CanCreateEvents, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(db.pool.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users WHERE google_id = $1`, googleID,
+	), &user)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &user, nil
 }
 
 func (db *DB) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	var user models.User
-	err := db.pool.QueryRow(ctx,
-		`SELECT id, google_id, email, name, picture, is_admin, can_create_events, created_at, updated_at
-		 FROM users WHERE id = $1`, id,
-	).Scan(&user.ID, &user.GoogleID, &user.Email, &user.Name,
-		&user.Picture, &user.IsAdmin, &user.CanCreateEvents, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(db.pool.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = $1`, id,
+	), &user)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err)
 	}
 	return &user, nil
 }
 
+// userName looks up a user's display name, or nil if there is none
+func userName(ctx context.Context, q querier, userID *string) *string {
+	if userID == nil {
+		return nil
+	}
+	var name string
+	if err := q.QueryRow(ctx, `SELECT name FROM users WHERE id = $1`, *userID).Scan(&name); err != nil {
+		return nil
+	}
+	return &name
+}
+
 func (db *DB) CreateOrUpdateUser(ctx context.Context, googleID, email, name, picture string) (*models.User, error) {
 	now := time.Now()
 	id := uuid.New().String()
@@ -65,8 +82,7 @@ func (db *DB) CreateOrUpdateUser(ctx context.Context, googleID, email, name, pic
 
 func (db *DB) ListAllUsers(ctx context.Context) ([]models.User, error) {
 	rows, err := db.pool.Query(ctx,
-		`SELECT id, google_id, email, name, picture, is_admin, can_create_events, created_at, updated_at
-		 FROM users ORDER BY created_at ASC`)
+		`SELECT `+userColumns+` FROM users ORDER BY created_at ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +91,7 @@ func (db *DB) ListAllUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var u models.User
-		if err := rows.Scan(&u.ID, &u.GoogleID, &u.Email, &u.Name,
-			&u.Picture, &u.IsAdmin, &u.CanCreateEvents, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err := scanUser(rows, &u); err != nil {
 			return nil, err
 		}
 		users = append(users, u)
@@ -85,21 +100,82 @@ func (db *DB) ListAllUsers(ctx context.Context) ([]models.User, error) {
 	return users, nil
 }
 
+// lockUser loads a user and locks the row until tx ends, so the snapshot
+// audited as the update's before is the one it replaced
+func lockUser(ctx context.Context, tx pgx.Tx, id string) (*models.User, error) {
+	var user models.User
+	err := scanUser(tx.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users WHERE id = $1 FOR UPDATE`, id,
+	), &user)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &user, nil
+}
+
 func (db *DB) UpdateUserPermissions(ctx context.Context, userID string, req models.UpdateUserPermissionsRequest) (*models.User, error) {
-	user, err := db.GetUserByID(ctx, userID)
+	var user *models.User
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		updated := *before
+		user = &updated
+		if req.CanCreateEvents != nil {
+			user.CanCreateEvents = *req.CanCreateEvents
+		}
+		user.UpdatedAt = time.Now()
+
+		_, err = tx.Exec(ctx,
+			`UPDATE users SET can_create_events=$1, updated_at=$2 WHERE id=$3`,
+			user.CanCreateEvents, user.UpdatedAt, userID,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "user", EntityID: userID, Before: before, After: user,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if req.CanCreateEvents != nil {
-		user.CanCreateEvents = *req.CanCreateEvents
-	}
-	user.UpdatedAt = time.Now()
+	return user, nil
+}
 
-	_, err = db.pool.Exec(ctx,
-		`UPDATE users SET can_create_events=$1, updated_at=$2 WHERE id=$3`,
-		user.CanCreateEvents, user.UpdatedAt, userID,
-	)
+// UpdateDietaryProfile replaces the user's own dietary restrictions,
+// allergies and notes
+func (db *DB) UpdateDietaryProfile(ctx context.Context, userID string, req models.DietaryProfile) (*models.User, error) {
+	var user *models.User
+	err := db.withTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		updated := *before
+		user = &updated
+		user.DietaryRestrictions = normalizeTags(req.Restrictions)
+		user.Allergies = normalizeTags(req.Allergies)
+		user.DietaryNotes = req.Notes
+		user.UpdatedAt = time.Now()
+
+		_, err = tx.Exec(ctx,
+			`UPDATE users SET dietary_restrictions=$1, allergies=$2, dietary_notes=$3, updated_at=$4 WHERE id=$5`,
+			user.DietaryRestrictions, user.Allergies, user.DietaryNotes, user.UpdatedAt, userID,
+		)
+		if err != nil {
+			return err
+		}
+
+		return db.recordAudit(ctx, tx, auditRecord{
+			Action: AuditUpdate, EntityType: "user", EntityID: userID, Before: before, After: user,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
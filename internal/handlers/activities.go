@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Activity handlers
+
+func (h *Handler) ListActivities(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	activities, err := h.db.GetActivitiesByEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Activity", "list activities")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, activities)
+}
+
+func (h *Handler) CreateActivity(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.CreateActivityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateActivity(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	activity, err := h.db.CreateActivity(r.Context(), eventID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Activity", "create activity")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, activity)
+}
+
+func (h *Handler) GetActivity(w http.ResponseWriter, r *http.Request) {
+	activityID := chi.URLParam(r, "activityId")
+
+	activity, err := h.db.GetActivityWithSignups(r.Context(), activityID)
+	if err != nil {
+		h.respondDBError(w, err, "Activity", "load activity")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, activity.Version, activity)
+}
+
+func (h *Handler) UpdateActivity(w http.ResponseWriter, r *http.Request) {
+	activityID := chi.URLParam(r, "activityId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.UpdateActivityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	current, err := h.db.GetActivity(r.Context(), activityID)
+	if err != nil {
+		h.respondDBError(w, err, "Activity", "load activity")
+		return
+	}
+	if err := validation.UpdateActivity(req, *current); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	activity, err := h.db.UpdateActivity(r.Context(), activityID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetActivityWithSignups(r.Context(), activityID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if errors.Is(err, db.ErrOverCapacity) {
+		h.respondError(w, http.StatusConflict, "More people have already signed up than that")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Activity", "update activity")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, activity.Version, activity)
+}
+
+func (h *Handler) DeleteActivity(w http.ResponseWriter, r *http.Request) {
+	activityID := chi.URLParam(r, "activityId")
+
+	if err := h.db.DeleteActivity(r.Context(), activityID); err != nil {
+		h.respondDBError(w, err, "Activity", "delete activity")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SignUpForActivity adds an attendee and their party to an activity
+func (h *Handler) SignUpForActivity(w http.ResponseWriter, r *http.Request) {
+	activityID := chi.URLParam(r, "activityId")
+
+	var req models.ActivitySignupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.ActivitySignup(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	signup, err := h.db.SignUpForActivity(r.Context(), activityID, req)
+	if errors.Is(err, db.ErrConflict) {
+		h.respondError(w, http.StatusConflict, "Attendee is already signed up for this activity")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Activity", "sign up for activity")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, signup)
+}
+
+func (h *Handler) DeleteActivitySignup(w http.ResponseWriter, r *http.Request) {
+	signupID := chi.URLParam(r, "signupId")
+
+	if err := h.db.DeleteActivitySignup(r.Context(), signupID); err != nil {
+		h.respondDBError(w, err, "Activity signup", "remove activity signup")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetItinerary shows an event's meals, activities and due todos day by day
+func (h *Handler) GetItinerary(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	itinerary, err := h.db.GetItinerary(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load itinerary")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, itinerary)
+}
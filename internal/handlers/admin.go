@@ -8,6 +8,7 @@ import (
 
 	"farm-time/internal/auth"
 	"farm-time/internal/models"
+	"farm-time/internal/validation"
 )
 
 // Admin handlers - require admin privileges
@@ -22,7 +23,7 @@ func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
 
 	users, err := h.db.ListAllUsers(r.Context())
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to list users")
+		h.respondDBError(w, err, "User", "list users")
 		return
 	}
 	if users == nil {
@@ -46,10 +47,14 @@ func (h *Handler) UpdateUserPermissions(w http.ResponseWriter, r *http.Request)
 		h.respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if err := validation.UpdateUserPermissions(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
 
 	user, err := h.db.UpdateUserPermissions(r.Context(), userID, req)
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "User not found")
+		h.respondDBError(w, err, "User", "update user")
 		return
 	}
 
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Chore assignment handlers. Attendees state their preferences; the event
+// owner asks for a proposal, reviews it and applies the parts they like.
+
+func (h *Handler) GetChorePreferences(w http.ResponseWriter, r *http.Request) {
+	attendeeID := chi.URLParam(r, "attendeeId")
+
+	prefs, err := h.db.GetChorePreferences(r.Context(), attendeeID)
+	if err != nil {
+		h.respondDBError(w, err, "Attendee", "load chore preferences")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, prefs)
+}
+
+func (h *Handler) UpdateChorePreferences(w http.ResponseWriter, r *http.Request) {
+	attendeeID := chi.URLParam(r, "attendeeId")
+
+	var req models.UpdateChorePreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateChorePreferences(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	prefs, err := h.db.SetChorePreferences(r.Context(), attendeeID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Attendee", "update chore preferences")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, prefs)
+}
+
+// loadManagedEvent fetches the event in the URL if the current user owns
+// it or is an admin, writing the error response and returning nil otherwise
+func (h *Handler) loadManagedEvent(w http.ResponseWriter, r *http.Request, forbidden string) *models.Event {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil
+	}
+
+	event, err := h.db.GetEvent(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return nil
+	}
+	if !canManageEvent(user, event) {
+		h.respondError(w, http.StatusForbidden, forbidden)
+		return nil
+	}
+	return event
+}
+
+// ProposeAssignments suggests who should take the event's unassigned todos
+// and uncovered meal items. Nothing is saved.
+func (h *Handler) ProposeAssignments(w http.ResponseWriter, r *http.Request) {
+	event := h.loadManagedEvent(w, r, "Only the event owner can assign chores")
+	if event == nil {
+		return
+	}
+
+	proposal, err := h.db.ProposeAssignments(r.Context(), event.ID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "propose assignments")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, proposal)
+}
+
+// ApplyAssignments saves the chosen entries of a proposal in one go
+func (h *Handler) ApplyAssignments(w http.ResponseWriter, r *http.Request) {
+	event := h.loadManagedEvent(w, r, "Only the event owner can assign chores")
+	if event == nil {
+		return
+	}
+
+	var req models.ApplyAssignmentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.ApplyAssignments(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	result, err := h.db.ApplyAssignments(r.Context(), event.ID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Assignment", "apply assignments")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, result)
+}
+
+// GetAssignmentLog lists the assignments applied for an event and why
+func (h *Handler) GetAssignmentLog(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	entries, err := h.db.GetAssignmentLog(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Assignment", "load assignment log")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Meal attendance handlers
+
+func (h *Handler) GetMealAttendance(w http.ResponseWriter, r *http.Request) {
+	mealID := chi.URLParam(r, "mealId")
+
+	summary, err := h.db.GetMealAttendance(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "load attendance")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, summary)
+}
+
+// SetMyMealAttendance records the current user's own answer for a meal
+func (h *Handler) SetMyMealAttendance(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+	mealID := chi.URLParam(r, "mealId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.SetMealAttendanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.AttendeeIDs = nil
+	if err := validation.SetMealAttendance(req, false); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	attendee, err := h.db.GetAttendeeByEmail(r.Context(), eventID, user.Email)
+	if errors.Is(err, db.ErrNotFound) {
+		h.respondError(w, http.StatusNotFound, "You are not an attendee of this event")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Attendee", "load attendee")
+		return
+	}
+
+	answers, err := h.db.SetMealAttendance(r.Context(), eventID, mealID, []string{attendee.ID}, req.Status)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "set attendance")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, answers[0])
+}
+
+// SetMealAttendance records one answer for several attendees at once, such
+// as a whole family. Only the event owner may answer for others.
+func (h *Handler) SetMealAttendance(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+	mealID := chi.URLParam(r, "mealId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	event, err := h.db.GetEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+	if !canManageEvent(user, event) {
+		h.respondError(w, http.StatusForbidden, "Only the event owner can set attendance for others")
+		return
+	}
+
+	var req models.SetMealAttendanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.SetMealAttendance(req, true); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	answers, err := h.db.SetMealAttendance(r.Context(), eventID, mealID, req.AttendeeIDs, req.Status)
+	if err != nil {
+		h.respondDBError(w, err, "Meal or attendee", "set attendance")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, answers)
+}
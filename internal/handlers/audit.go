@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+
+	defaultChangeBatch = 100
+	maxChangeBatch     = 500
+)
+
+// parseAuditFilter reads filtering and pagination options from the query string
+func parseAuditFilter(r *http.Request) (models.AuditLogFilter, string) {
+	q := r.URL.Query()
+	filter := models.AuditLogFilter{
+		ActorUserID: q.Get("actor_id"),
+		EntityType:  q.Get("entity_type"),
+		EntityID:    q.Get("entity_id"),
+		Action:      q.Get("action"),
+		Limit:       defaultAuditPageSize,
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return filter, "Invalid limit"
+		}
+		if limit > maxAuditPageSize {
+			limit = maxAuditPageSize
+		}
+		filter.Limit = limit
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filter, "Invalid offset"
+		}
+		filter.Offset = offset
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, "Invalid since, expected RFC 3339 timestamp"
+		}
+		filter.Since = &since
+	}
+	if v := q.Get("until"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, "Invalid until, expected RFC 3339 timestamp"
+		}
+		filter.Until = &until
+	}
+
+	return filter, ""
+}
+
+// GetEventHistory returns the audit trail for a single event. Only the
+// event's owner and admins may view it.
+func (h *Handler) GetEventHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	event, err := h.db.GetEvent(r.Context(), id)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+	if !canManageEvent(user, event) {
+		h.respondError(w, http.StatusForbidden, "Only the event owner can view its history")
+		return
+	}
+
+	filter, msg := parseAuditFilter(r)
+	if msg != "" {
+		h.respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+	filter.EventID = id
+
+	page, err := h.db.ListAuditLog(r.Context(), filter)
+	if err != nil {
+		h.respondDBError(w, err, "Audit log", "load audit log")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, page)
+}
+
+// ListAuditLog returns the site-wide audit log (admin only)
+func (h *Handler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	filter, msg := parseAuditFilter(r)
+	if msg != "" {
+		h.respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+	filter.EventID = r.URL.Query().Get("event_id")
+
+	page, err := h.db.ListAuditLog(r.Context(), filter)
+	if err != nil {
+		h.respondDBError(w, err, "Audit log", "load audit log")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, page)
+}
+
+// GetEventChanges is the change feed the UI polls to stay current: what
+// happened in the event after ?cursor=, or from the start without one.
+// Anyone can follow an event's feed; it names what changed but not how.
+func (h *Handler) GetEventChanges(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	cursor, err := db.ParseChangeCursor(q.Get("cursor"))
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	limit := defaultChangeBatch
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			h.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(n, maxChangeBatch)
+	}
+
+	feed, err := h.db.ListChanges(r.Context(), chi.URLParam(r, "id"), cursor, limit)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load changes")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, feed)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// GetAvailability shows the events and pending booking requests at the
+// farm, optionally limited to those overlapping from/until (RFC 3339)
+func (h *Handler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	var from, until *time.Time
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "Invalid from, expected RFC 3339 timestamp")
+			return
+		}
+		from = &t
+	}
+	if v := r.URL.Query().Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "Invalid until, expected RFC 3339 timestamp")
+			return
+		}
+		until = &t
+	}
+
+	availability, err := h.db.GetAvailability(r.Context(), from, until)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load availability")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, availability)
+}
+
+// Booking request handlers. Anyone can ask for dates; admins see every
+// request and decide on them, everyone else sees their own.
+
+func (h *Handler) ListBookingRequests(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID := user.ID
+	if user.IsAdmin {
+		userID = ""
+	}
+	requests, err := h.db.ListBookingRequests(r.Context(), userID, r.URL.Query().Get("status"))
+	if err != nil {
+		h.respondDBError(w, err, "Booking request", "list booking requests")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, requests)
+}
+
+func (h *Handler) CreateBookingRequest(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.CreateBookingRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateBookingRequest(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	request, err := h.db.CreateBookingRequest(r.Context(), req)
+	if errors.Is(err, db.ErrDatesTaken) {
+		h.respondDatesTaken(w, r, req.StartTime, req.EndTime, req.Exclusive, "")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Booking request", "create booking request")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, request)
+}
+
+// loadOwnBookingRequest fetches a booking request the current user may see,
+// writing the error response and returning nil otherwise
+func (h *Handler) loadOwnBookingRequest(w http.ResponseWriter, r *http.Request) (*models.User, *models.BookingRequest) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, nil
+	}
+
+	request, err := h.db.GetBookingRequest(r.Context(), chi.URLParam(r, "requestId"))
+	if err != nil {
+		h.respondDBError(w, err, "Booking request", "load booking request")
+		return nil, nil
+	}
+	if !user.IsAdmin && request.RequestedBy != user.ID {
+		h.respondError(w, http.StatusNotFound, "Booking request not found")
+		return nil, nil
+	}
+	return user, request
+}
+
+func (h *Handler) GetBookingRequest(w http.ResponseWriter, r *http.Request) {
+	_, request := h.loadOwnBookingRequest(w, r)
+	if request == nil {
+		return
+	}
+	h.respondJSON(w, http.StatusOK, request)
+}
+
+// ReviewBookingRequest approves or denies a pending request. Approval
+// creates the event, with the usual meals, for the requester.
+func (h *Handler) ReviewBookingRequest(w http.ResponseWriter, r *http.Request) {
+	requestID := chi.URLParam(r, "requestId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.ReviewBookingRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.ReviewBookingRequest(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	request, event, err := h.db.ReviewBookingRequest(r.Context(), requestID, req)
+	if errors.Is(err, db.ErrConflict) {
+		h.respondError(w, http.StatusConflict, "Booking request has already been reviewed")
+		return
+	}
+	if errors.Is(err, db.ErrDatesTaken) {
+		if current, err := h.db.GetBookingRequest(r.Context(), requestID); err == nil {
+			h.respondDatesTaken(w, r, current.StartTime, current.EndTime, current.Exclusive, "")
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Booking request", "review booking request")
+		return
+	}
+
+	if event != nil {
+		h.autoCreateMeals(r.Context(), event)
+	}
+
+	h.respondJSON(w, http.StatusOK, request)
+}
+
+// DeleteBookingRequest withdraws a request. Requesters can withdraw their
+// own while it is pending; admins can remove any.
+func (h *Handler) DeleteBookingRequest(w http.ResponseWriter, r *http.Request) {
+	user, request := h.loadOwnBookingRequest(w, r)
+	if request == nil {
+		return
+	}
+	if !user.IsAdmin && request.Status != db.BookingPending {
+		h.respondError(w, http.StatusConflict, "Booking request has already been reviewed")
+		return
+	}
+
+	if err := h.db.DeleteBookingRequest(r.Context(), request.ID); err != nil {
+		h.respondDBError(w, err, "Booking request", "delete booking request")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
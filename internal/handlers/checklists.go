@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+const (
+	defaultChecklistHistory = 10
+	maxChecklistHistory     = 50
+)
+
+// Checklist handlers. Everyone can see the standing opening and closing
+// checklists and how past events did with them; only admins change them.
+
+func (h *Handler) ListChecklistItems(w http.ResponseWriter, r *http.Request) {
+	items, err := h.db.ListChecklistItems(r.Context())
+	if err != nil {
+		h.respondDBError(w, err, "Checklist item", "list checklist items")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, items)
+}
+
+func (h *Handler) CreateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.CreateChecklistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateChecklistItem(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	item, err := h.db.CreateChecklistItem(r.Context(), req)
+	if err != nil {
+		h.respondDBError(w, err, "Checklist item", "create checklist item")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, item)
+}
+
+func (h *Handler) GetChecklistItem(w http.ResponseWriter, r *http.Request) {
+	itemID := chi.URLParam(r, "itemId")
+
+	item, err := h.db.GetChecklistItem(r.Context(), itemID)
+	if err != nil {
+		h.respondDBError(w, err, "Checklist item", "load checklist item")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, item.Version, item)
+}
+
+func (h *Handler) UpdateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	itemID := chi.URLParam(r, "itemId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.UpdateChecklistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateChecklistItem(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	item, err := h.db.UpdateChecklistItem(r.Context(), itemID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetChecklistItem(r.Context(), itemID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Checklist item", "update checklist item")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, item.Version, item)
+}
+
+func (h *Handler) DeleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+	itemID := chi.URLParam(r, "itemId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	if err := h.db.DeleteChecklistItem(r.Context(), itemID); err != nil {
+		h.respondDBError(w, err, "Checklist item", "delete checklist item")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PropagateChecklists pushes the current standing checklists to every
+// event that hasn't started yet
+func (h *Handler) PropagateChecklists(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	result, err := h.db.PropagateChecklists(r.Context())
+	if err != nil {
+		h.respondDBError(w, err, "Checklist", "propagate checklists")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, result)
+}
+
+// GetChecklistHistory shows how recent events did with their checklists,
+// newest first. ?phase limits it to arrival or departure chores and ?limit
+// sets how many events to include.
+func (h *Handler) GetChecklistHistory(w http.ResponseWriter, r *http.Request) {
+	phase := r.URL.Query().Get("phase")
+	if phase != "" && phase != db.ChecklistArrival && phase != db.ChecklistDeparture {
+		h.respondError(w, http.StatusBadRequest, "Invalid phase, expected arrival or departure")
+		return
+	}
+
+	limit := defaultChecklistHistory
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			h.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(n, maxChecklistHistory)
+	}
+
+	runs, err := h.db.GetChecklistHistory(r.Context(), phase, limit)
+	if err != nil {
+		h.respondDBError(w, err, "Checklist", "load checklist history")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, runs)
+}
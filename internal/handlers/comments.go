@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Comment handlers. Anyone can read and join a thread; a comment can be
+// changed by whoever wrote it or the event's owner.
+
+func canManageComment(user *models.User, comment *models.Comment, event *models.Event) bool {
+	if user == nil {
+		return false
+	}
+	if comment.AuthorID != nil && *comment.AuthorID == user.ID {
+		return true
+	}
+	return canManageEvent(user, event)
+}
+
+// loadManagedComment fetches the comment in the URL if it belongs to the
+// URL's event and the current user may change it, writing the error
+// response and returning nil otherwise
+func (h *Handler) loadManagedComment(w http.ResponseWriter, r *http.Request, forbidden string) *models.Comment {
+	comment, err := h.db.GetComment(r.Context(), chi.URLParam(r, "commentId"))
+	if err == nil && comment.EventID != chi.URLParam(r, "id") {
+		err = db.ErrNotFound
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Comment", "load comment")
+		return nil
+	}
+
+	event, err := h.db.GetEvent(r.Context(), comment.EventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return nil
+	}
+	if !canManageComment(auth.GetUserFromContext(r.Context()), comment, event) {
+		h.respondError(w, http.StatusForbidden, forbidden)
+		return nil
+	}
+	return comment
+}
+
+// ListComments returns a thread in the event, the event's own unless
+// entity_type and entity_id say otherwise, with replies nested
+func (h *Handler) ListComments(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	q := r.URL.Query()
+	thread, err := h.db.GetCommentThread(r.Context(), chi.URLParam(r, "id"), q.Get("entity_type"), q.Get("entity_id"),
+		user.ID)
+	if err != nil {
+		h.respondDBError(w, err, "Comment thread", "load comments")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, thread)
+}
+
+func (h *Handler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.CreateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateComment(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	comment, err := h.db.CreateComment(r.Context(), eventID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Comment", "create comment")
+		return
+	}
+	h.respondJSON(w, http.StatusCreated, comment)
+}
+
+func (h *Handler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	current := h.loadManagedComment(w, r, "Only the comment's author or the event owner can change it")
+	if current == nil {
+		return
+	}
+
+	var req models.UpdateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateComment(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	comment, err := h.db.UpdateComment(r.Context(), current.ID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetComment(r.Context(), current.ID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Comment", "update comment")
+		return
+	}
+	h.respondVersioned(w, http.StatusOK, comment.Version, comment)
+}
+
+func (h *Handler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	current := h.loadManagedComment(w, r, "Only the comment's author or the event owner can delete it")
+	if current == nil {
+		return
+	}
+
+	if err := h.db.DeleteComment(r.Context(), current.ID); err != nil {
+		h.respondDBError(w, err, "Comment", "delete comment")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkCommentsRead marks a thread read up to now for the current user
+func (h *Handler) MarkCommentsRead(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.MarkCommentsReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.MarkCommentsRead(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	err := h.db.MarkCommentsRead(r.Context(), chi.URLParam(r, "id"), req.EntityType, req.EntityID, user.ID)
+	if err != nil {
+		h.respondDBError(w, err, "Comment thread", "mark comments read")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUnreadComments lists the event's threads with comments the current
+// user hasn't read
+func (h *Handler) GetUnreadComments(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	unread, err := h.db.GetUnreadComments(r.Context(), chi.URLParam(r, "id"), user.ID)
+	if err != nil {
+		h.respondDBError(w, err, "Comment", "load unread comments")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, unread)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Dietary profile handlers
+
+// GetMyDietaryProfile returns the current user's dietary profile
+func (h *Handler) GetMyDietaryProfile(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, models.DietaryProfile{
+		Restrictions: user.DietaryRestrictions,
+		Allergies:    user.Allergies,
+		Notes:        user.DietaryNotes,
+	})
+}
+
+// UpdateMyDietaryProfile replaces the current user's dietary profile. It
+// applies to every event they attend under the same email.
+func (h *Handler) UpdateMyDietaryProfile(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.DietaryProfile
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateDietaryProfile(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	updated, err := h.db.UpdateDietaryProfile(r.Context(), user.ID, req)
+	if err != nil {
+		h.respondDBError(w, err, "User", "update dietary profile")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, updated)
+}
+
+// GetEventDietary summarizes the diets and allergies of an event's attendees
+func (h *Handler) GetEventDietary(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	summary, err := h.db.GetEventDietarySummary(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load dietary summary")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, summary)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Expense handlers
+
+func (h *Handler) ListExpenses(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	expenses, err := h.db.GetExpensesByEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Expense", "list expenses")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, expenses)
+}
+
+func (h *Handler) CreateExpense(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.CreateExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateExpense(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	expense, err := h.db.CreateExpense(r.Context(), eventID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Expense", "create expense")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, expense)
+}
+
+func (h *Handler) GetExpense(w http.ResponseWriter, r *http.Request) {
+	expenseID := chi.URLParam(r, "expenseId")
+
+	expense, err := h.db.GetExpense(r.Context(), expenseID)
+	if err != nil {
+		h.respondDBError(w, err, "Expense", "load expense")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, expense.Version, expense)
+}
+
+func (h *Handler) UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	expenseID := chi.URLParam(r, "expenseId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.UpdateExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	current, err := h.db.GetExpense(r.Context(), expenseID)
+	if err != nil {
+		h.respondDBError(w, err, "Expense", "load expense")
+		return
+	}
+	if err := validation.UpdateExpense(req, *current); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	expense, err := h.db.UpdateExpense(r.Context(), expenseID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetExpense(r.Context(), expenseID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Expense", "update expense")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, expense.Version, expense)
+}
+
+func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	expenseID := chi.URLParam(r, "expenseId")
+
+	if err := h.db.DeleteExpense(r.Context(), expenseID); err != nil {
+		h.respondDBError(w, err, "Expense", "delete expense")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEventBalances shows who owes whom after an event's expenses, with the
+// transfers that would settle everyone up
+func (h *Handler) GetEventBalances(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	balances, err := h.db.GetEventBalances(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load balances")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, balances)
+}
+
+// Settlement handlers
+
+func (h *Handler) ListSettlements(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	settlements, err := h.db.GetSettlementsByEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Settlement", "list settlements")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, settlements)
+}
+
+// CreateSettlement marks a payment between two attendees as paid
+func (h *Handler) CreateSettlement(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.CreateSettlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateSettlement(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	settlement, err := h.db.CreateSettlement(r.Context(), eventID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Settlement", "record settlement")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, settlement)
+}
+
+func (h *Handler) DeleteSettlement(w http.ResponseWriter, r *http.Request) {
+	settlementID := chi.URLParam(r, "settlementId")
+
+	if err := h.db.DeleteSettlement(r.Context(), settlementID); err != nil {
+		h.respondDBError(w, err, "Settlement", "delete settlement")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
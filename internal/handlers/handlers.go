@@ -3,7 +3,11 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -11,6 +15,7 @@ import (
 	"farm-time/internal/auth"
 	"farm-time/internal/db"
 	"farm-time/internal/models"
+	"farm-time/internal/validation"
 )
 
 type Handler struct {
@@ -27,8 +32,189 @@ func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{
 	json.NewEncoder(w).Encode(data)
 }
 
+// errorResponse is the body of every error reply. Code is a stable,
+// machine-readable identifier; Fields is set for validation failures.
+type errorResponse struct {
+	Error  string            `json:"error"`
+	Code   string            `json:"code"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Machine-readable error codes
+const (
+	codeBadRequest         = "bad_request"
+	codeValidationFailed   = "validation_failed"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "not_found"
+	codeConflict           = "conflict"
+	codePreconditionFailed = "precondition_failed"
+	codeUnprocessable      = "unprocessable"
+	codeForeignKey         = "foreign_key_violation"
+	codeCheckViolation     = "check_violation"
+	codeInternal           = "internal_error"
+)
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusPreconditionFailed:
+		return codePreconditionFailed
+	case http.StatusUnprocessableEntity:
+		return codeUnprocessable
+	default:
+		return codeInternal
+	}
+}
+
 func (h *Handler) respondError(w http.ResponseWriter, status int, message string) {
-	h.respondJSON(w, status, map[string]string{"error": message})
+	h.respondJSON(w, status, errorResponse{Error: message, Code: errorCode(status)})
+}
+
+// respondDBError maps a typed error from the db package to an HTTP status.
+// entity names the resource in client-facing messages and action completes
+// "Failed to ..." for unexpected errors, which are logged.
+func (h *Handler) respondDBError(w http.ResponseWriter, err error, entity, action string) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		h.respondError(w, http.StatusNotFound, entity+" not found")
+	case errors.Is(err, db.ErrConflict):
+		h.respondError(w, http.StatusConflict, entity+" already exists")
+	case errors.Is(err, db.ErrParentDeleted):
+		h.respondError(w, http.StatusConflict, entity+" belongs to something that is still in the trash; restore that first")
+	case errors.Is(err, db.ErrOverCommitted):
+		h.respondError(w, http.StatusConflict, entity+" is more than the item still needs")
+	case errors.Is(err, db.ErrOverCapacity):
+		h.respondError(w, http.StatusConflict, entity+" is full")
+	case errors.Is(err, db.ErrDatesTaken):
+		h.respondError(w, http.StatusConflict, entity+" dates overlap an event that has the whole farm")
+	case errors.Is(err, db.ErrDependencyCycle):
+		h.respondError(w, http.StatusConflict, entity+" dependencies would form a cycle")
+	case errors.Is(err, db.ErrBlocked):
+		h.respondError(w, http.StatusConflict, entity+" is blocked by incomplete prerequisites")
+	case errors.Is(err, db.ErrVersionConflict):
+		h.respondError(w, http.StatusPreconditionFailed, entity+" was changed by someone else")
+	case errors.Is(err, db.ErrForeignKey):
+		h.respondJSON(w, http.StatusUnprocessableEntity, errorResponse{
+			Error: "Referenced record does not exist", Code: codeForeignKey,
+		})
+	case errors.Is(err, db.ErrCheckViolation):
+		h.respondJSON(w, http.StatusUnprocessableEntity, errorResponse{
+			Error: "Invalid value for " + strings.ToLower(entity), Code: codeCheckViolation,
+		})
+	default:
+		log.Printf("Failed to %s: %v", action, err)
+		h.respondError(w, http.StatusInternalServerError, "Failed to "+action)
+	}
+}
+
+// respondValidationError reports the invalid fields found by the validation package
+func (h *Handler) respondValidationError(w http.ResponseWriter, err error) {
+	var verr *validation.Error
+	if !errors.As(err, &verr) {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.respondJSON(w, http.StatusBadRequest, errorResponse{
+		Error:  "Validation failed",
+		Code:   codeValidationFailed,
+		Fields: verr.Fields,
+	})
+}
+
+// respondVersioned writes data with an ETag carrying the entity's version
+func (h *Handler) respondVersioned(w http.ResponseWriter, status int, version int, data interface{}) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(version)))
+	h.respondJSON(w, status, data)
+}
+
+var errInvalidIfMatch = errors.New("invalid If-Match header")
+
+// ifMatchVersion parses the If-Match header into the version the client
+// last saw. It returns nil when the header is absent or "*". A weak tag
+// (W/"3"), as some proxies turn ETags into, names the same version. A list
+// of several tags can't name a single version, so it yields version 0,
+// which no row ever has, and the update fails with 412.
+func ifMatchVersion(r *http.Request) (*int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	tags := strings.Split(header, ",")
+	var version int
+	for _, tag := range tags {
+		unquoted, err := strconv.Unquote(strings.TrimPrefix(strings.TrimSpace(tag), "W/"))
+		if err != nil {
+			return nil, errInvalidIfMatch
+		}
+		if version, err = strconv.Atoi(unquoted); err != nil {
+			return nil, errInvalidIfMatch
+		}
+	}
+	if len(tags) > 1 {
+		version = 0
+	}
+	return &version, nil
+}
+
+// respondPreconditionFailed answers a lost update with 412 and the entity's
+// current state so the client can merge and retry
+func (h *Handler) respondPreconditionFailed(w http.ResponseWriter, version int, current interface{}) {
+	h.respondVersioned(w, http.StatusPreconditionFailed, version, current)
+}
+
+// respondDatesTaken answers ErrDatesTaken with 409, naming the events that
+// stand in the way
+func (h *Handler) respondDatesTaken(w http.ResponseWriter, r *http.Request, start, end time.Time, exclusive bool, skipID string) {
+	message := "Those dates overlap an event that has the whole farm"
+	if exclusive {
+		message = "The whole farm can't be claimed while other events overlap those dates"
+	}
+	conflicts, err := h.db.EventConflicts(r.Context(), start, end, exclusive, skipID)
+	if err == nil && len(conflicts) > 0 {
+		titles := make([]string, len(conflicts))
+		for i, e := range conflicts {
+			titles[i] = e.Title
+		}
+		message += ": " + strings.Join(titles, ", ")
+	}
+	h.respondError(w, http.StatusConflict, message)
+}
+
+// respondMealsOutsideDates answers ErrMealsOutsideDates with 409, naming the
+// meals that would be left outside the event's new dates
+func (h *Handler) respondMealsOutsideDates(w http.ResponseWriter, r *http.Request, event *models.Event) {
+	message := "Those dates would leave meals on days the event no longer covers; move them first"
+	meals, err := h.db.MealsOutsideDates(r.Context(), event)
+	if err == nil && len(meals) > 0 {
+		names := make([]string, len(meals))
+		for i, m := range meals {
+			names[i] = m.Name + " (" + *m.MealDate + ")"
+		}
+		message += ": " + strings.Join(names, ", ")
+	}
+	h.respondError(w, http.StatusConflict, message)
+}
+
+// canManageEvent reports whether the user owns the event or is an admin
+func canManageEvent(user *models.User, event *models.Event) bool {
+	if user == nil {
+		return false
+	}
+	if user.IsAdmin {
+		return true
+	}
+	return event.CreatedBy != nil && *event.CreatedBy == user.ID
 }
 
 // Event handlers
@@ -36,7 +222,7 @@ func (h *Handler) respondError(w http.ResponseWriter, status int, message string
 func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) {
 	events, err := h.db.ListEvents(r.Context())
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to list events")
+		h.respondDBError(w, err, "Event", "list events")
 		return
 	}
 	if events == nil {
@@ -63,23 +249,23 @@ func (h *Handler) CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Title == "" {
-		h.respondError(w, http.StatusBadRequest, "Title is required")
-		return
-	}
-	if req.StartTime.IsZero() || req.EndTime.IsZero() {
-		h.respondError(w, http.StatusBadRequest, "Start time and end time are required")
+	if err := validation.CreateEvent(req); err != nil {
+		h.respondValidationError(w, err)
 		return
 	}
 
 	event, err := h.db.CreateEvent(r.Context(), req)
+	if errors.Is(err, db.ErrDatesTaken) {
+		h.respondDatesTaken(w, r, req.StartTime, req.EndTime, req.Exclusive, "")
+		return
+	}
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to create event")
+		h.respondDBError(w, err, "Event", "create event")
 		return
 	}
 
 	// Auto-create meals based on event times
-	h.autoCreateMeals(r.Context(), event.ID, req.StartTime, req.EndTime)
+	h.autoCreateMeals(r.Context(), event)
 
 	h.respondJSON(w, http.StatusCreated, event)
 }
@@ -89,7 +275,7 @@ func (h *Handler) GetEvent(w http.ResponseWriter, r *http.Request) {
 
 	event, err := h.db.GetEventWithAttendees(r.Context(), id)
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "Event not found")
+		h.respondDBError(w, err, "Event", "load event")
 		return
 	}
 
@@ -99,26 +285,69 @@ func (h *Handler) GetEvent(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
 	var req models.UpdateEventRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	event, err := h.db.UpdateEvent(r.Context(), id, req)
+	current, err := h.db.GetEvent(r.Context(), id)
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "Event not found")
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+	if err := validation.UpdateEvent(req, *current); err != nil {
+		h.respondValidationError(w, err)
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, event)
+	event, err := h.db.UpdateEvent(r.Context(), id, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetEvent(r.Context(), id); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if errors.Is(err, db.ErrDatesTaken) || errors.Is(err, db.ErrMealsOutsideDates) {
+		proposed := *current
+		if req.StartTime != nil {
+			proposed.StartTime = *req.StartTime
+		}
+		if req.EndTime != nil {
+			proposed.EndTime = *req.EndTime
+		}
+		if req.TimeZone != nil {
+			proposed.TimeZone = *req.TimeZone
+		}
+		if req.Exclusive != nil {
+			proposed.Exclusive = *req.Exclusive
+		}
+		if errors.Is(err, db.ErrDatesTaken) {
+			h.respondDatesTaken(w, r, proposed.StartTime, proposed.EndTime, proposed.Exclusive, id)
+		} else {
+			h.respondMealsOutsideDates(w, r, &proposed)
+		}
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Event", "update event")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, event.Version, event)
 }
 
 func (h *Handler) DeleteEvent(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	if err := h.db.DeleteEvent(r.Context(), id); err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to delete event")
+		h.respondDBError(w, err, "Event", "delete event")
 		return
 	}
 
@@ -132,7 +361,7 @@ func (h *Handler) ListAttendees(w http.ResponseWriter, r *http.Request) {
 
 	attendees, err := h.db.GetAttendeesByEvent(r.Context(), eventID)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to list attendees")
+		h.respondDBError(w, err, "Attendee", "list attendees")
 		return
 	}
 	if attendees == nil {
@@ -150,58 +379,120 @@ func (h *Handler) AddAttendee(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Name == "" {
-		h.respondError(w, http.StatusBadRequest, "Name is required")
+	event, err := h.db.GetEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
 		return
 	}
-	if req.Email == "" {
-		h.respondError(w, http.StatusBadRequest, "Email is required")
+	if err := validation.CreateAttendee(req, *event); err != nil {
+		h.respondValidationError(w, err)
 		return
 	}
 
 	attendee, err := h.db.CreateAttendee(r.Context(), eventID, req)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to add attendee")
+		h.respondDBError(w, err, "Attendee", "add attendee")
 		return
 	}
 
 	h.respondJSON(w, http.StatusCreated, attendee)
 }
 
+func (h *Handler) GetAttendee(w http.ResponseWriter, r *http.Request) {
+	attendeeID := chi.URLParam(r, "attendeeId")
+
+	attendee, err := h.db.GetAttendee(r.Context(), attendeeID)
+	if err != nil {
+		h.respondDBError(w, err, "Attendee", "load attendee")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, attendee.Version, attendee)
+}
+
 func (h *Handler) UpdateAttendee(w http.ResponseWriter, r *http.Request) {
 	attendeeID := chi.URLParam(r, "attendeeId")
 
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
 	var req models.UpdateAttendeeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	attendee, err := h.db.UpdateAttendee(r.Context(), attendeeID, req)
+	current, err := h.db.GetAttendee(r.Context(), attendeeID)
+	if err != nil {
+		h.respondDBError(w, err, "Attendee", "load attendee")
+		return
+	}
+	primary := false
+	if current.HouseholdID != nil {
+		household, err := h.db.GetHousehold(r.Context(), *current.HouseholdID)
+		if err != nil {
+			h.respondDBError(w, err, "Household", "load household")
+			return
+		}
+		primary = household.PrimaryAttendeeID != nil && *household.PrimaryAttendeeID == current.ID
+	}
+	if err := validation.UpdateAttendee(req, *current, primary); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	attendee, err := h.db.UpdateAttendee(r.Context(), attendeeID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetAttendee(r.Context(), attendeeID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "Attendee not found")
+		h.respondDBError(w, err, "Attendee", "update attendee")
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, attendee)
+	h.respondVersioned(w, http.StatusOK, attendee.Version, attendee)
 }
 
 func (h *Handler) RemoveAttendee(w http.ResponseWriter, r *http.Request) {
 	attendeeID := chi.URLParam(r, "attendeeId")
 
 	if err := h.db.DeleteAttendee(r.Context(), attendeeID); err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to remove attendee")
+		h.respondDBError(w, err, "Attendee", "remove attendee")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetEventOccupancy returns the per-day on-site summary for an event
+func (h *Handler) GetEventOccupancy(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	days, err := h.db.GetEventOccupancy(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load occupancy")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, days)
+}
+
 // autoCreateMeals creates lunch and dinner meals based on event times
 // - Lunch: created if start time is at or before 11:00 AM
 // - Dinner: created if end time is at or after 8:00 PM
 // For multi-day events, creates meals for each day
-func (h *Handler) autoCreateMeals(ctx context.Context, eventID string, startTime, endTime time.Time) {
+// Times and dates are in the event's time zone
+func (h *Handler) autoCreateMeals(ctx context.Context, event *models.Event) {
+	eventID := event.ID
+	loc := db.EventLocation(event)
+	startTime, endTime := event.StartTime.In(loc), event.EndTime.In(loc)
+
 	// Normalize to local dates
 	startDate := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, startTime.Location())
 	endDate := time.Date(endTime.Year(), endTime.Month(), endTime.Day(), 0, 0, 0, 0, endTime.Location())
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Household handlers
+
+func (h *Handler) ListHouseholds(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	households, err := h.db.GetHouseholdsByEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Household", "list households")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, households)
+}
+
+// primaryContact loads the attendee named as a household's contact so its
+// email can be validated. A missing attendee is left for the db layer to
+// report.
+func (h *Handler) primaryContact(r *http.Request, attendeeID *string) *models.Attendee {
+	if attendeeID == nil || *attendeeID == "" {
+		return nil
+	}
+	attendee, err := h.db.GetAttendee(r.Context(), *attendeeID)
+	if err != nil {
+		return nil
+	}
+	return attendee
+}
+
+func (h *Handler) CreateHousehold(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.CreateHouseholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateHousehold(req, h.primaryContact(r, req.PrimaryAttendeeID)); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	household, err := h.db.CreateHousehold(r.Context(), eventID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Household", "create household")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, household)
+}
+
+func (h *Handler) GetHousehold(w http.ResponseWriter, r *http.Request) {
+	householdID := chi.URLParam(r, "householdId")
+
+	household, err := h.db.GetHouseholdWithMembers(r.Context(), householdID)
+	if err != nil {
+		h.respondDBError(w, err, "Household", "load household")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, household.Version, household)
+}
+
+func (h *Handler) UpdateHousehold(w http.ResponseWriter, r *http.Request) {
+	householdID := chi.URLParam(r, "householdId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.UpdateHouseholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateHousehold(req, h.primaryContact(r, req.PrimaryAttendeeID)); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	household, err := h.db.UpdateHousehold(r.Context(), householdID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetHousehold(r.Context(), householdID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Household", "update household")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, household.Version, household)
+}
+
+func (h *Handler) DeleteHousehold(w http.ResponseWriter, r *http.Request) {
+	householdID := chi.URLParam(r, "householdId")
+
+	if err := h.db.DeleteHousehold(r.Context(), householdID); err != nil {
+		h.respondDBError(w, err, "Household", "delete household")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetHouseholdRSVP answers for every member of a household at once
+func (h *Handler) SetHouseholdRSVP(w http.ResponseWriter, r *http.Request) {
+	householdID := chi.URLParam(r, "householdId")
+
+	var req models.HouseholdRSVPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.HouseholdRSVP(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	household, err := h.db.SetHouseholdStatus(r.Context(), householdID, req.Status)
+	if err != nil {
+		h.respondDBError(w, err, "Household", "update household RSVP")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, household)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Room handlers. Everyone can see the property's rooms; only admins change
+// them.
+
+func (h *Handler) ListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := h.db.ListRooms(r.Context())
+	if err != nil {
+		h.respondDBError(w, err, "Room", "list rooms")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, rooms)
+}
+
+func (h *Handler) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.CreateRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateRoom(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	room, err := h.db.CreateRoom(r.Context(), req)
+	if err != nil {
+		h.respondDBError(w, err, "Room", "create room")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, room)
+}
+
+func (h *Handler) GetRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomId")
+
+	room, err := h.db.GetRoom(r.Context(), roomID)
+	if err != nil {
+		h.respondDBError(w, err, "Room", "load room")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, room.Version, room)
+}
+
+func (h *Handler) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.UpdateRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateRoom(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	room, err := h.db.UpdateRoom(r.Context(), roomID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetRoom(r.Context(), roomID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Room", "update room")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, room.Version, room)
+}
+
+func (h *Handler) DeleteRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	if err := h.db.DeleteRoom(r.Context(), roomID); err != nil {
+		h.respondDBError(w, err, "Room", "delete room")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Sleeping assignment handlers
+
+// GetEventLodging shows who sleeps where on each night of an event
+func (h *Handler) GetEventLodging(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	nights, err := h.db.GetEventLodging(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load lodging")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, nights)
+}
+
+// AssignSleeping puts an attendee in a room for some or all of their nights
+func (h *Handler) AssignSleeping(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.AssignSleepingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	event, err := h.db.GetEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+	// A missing attendee is left for the db layer to report
+	var stayNights []string
+	if attendee, err := h.db.GetAttendee(r.Context(), req.AttendeeID); err == nil {
+		stayNights = db.StayNights(*attendee, db.EventLocation(event))
+	}
+	if err := validation.AssignSleeping(req, stayNights); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	assignments, err := h.db.AssignSleeping(r.Context(), eventID, req)
+	if errors.Is(err, db.ErrConflict) {
+		h.respondError(w, http.StatusConflict, "Attendee already sleeps in another room on one of those nights; set replace to move them")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Room", "assign room")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, assignments)
+}
+
+func (h *Handler) DeleteSleepingAssignment(w http.ResponseWriter, r *http.Request) {
+	assignmentID := chi.URLParam(r, "assignmentId")
+
+	if err := h.db.DeleteSleepingAssignment(r.Context(), assignmentID); err != nil {
+		h.respondDBError(w, err, "Sleeping assignment", "delete sleeping assignment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Meal planning handlers
+
+// MoveMeal moves a meal to another day and/or event
+func (h *Handler) MoveMeal(w http.ResponseWriter, r *http.Request) {
+	mealID := chi.URLParam(r, "mealId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.MoveMealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	current, err := h.db.GetMeal(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "load meal")
+		return
+	}
+	targetID := current.EventID
+	if req.EventID != nil && *req.EventID != "" {
+		targetID = *req.EventID
+	}
+	target, err := h.db.GetEvent(r.Context(), targetID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+	if err := validation.MoveMeal(req, *current, *target); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	meal, err := h.db.MoveMeal(r.Context(), mealID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetMeal(r.Context(), mealID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "move meal")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, meal.Version, meal)
+}
+
+// CopyMeal copies a meal and its items to another day and/or event
+func (h *Handler) CopyMeal(w http.ResponseWriter, r *http.Request) {
+	mealID := chi.URLParam(r, "mealId")
+
+	var req models.CopyMealRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	source, err := h.db.GetMeal(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "load meal")
+		return
+	}
+	targetID := source.EventID
+	if req.EventID != nil && *req.EventID != "" {
+		targetID = *req.EventID
+	}
+	target, err := h.db.GetEvent(r.Context(), targetID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+	if err := validation.CopyMeal(req, *source, *target); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	meal, err := h.db.CopyMeal(r.Context(), mealID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "copy meal")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, meal)
+}
+
+// SwapMeals trades the day and meal type of two meals of an event
+func (h *Handler) SwapMeals(w http.ResponseWriter, r *http.Request) {
+	mealID := chi.URLParam(r, "mealId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.SwapMealsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	first, err := h.db.GetMeal(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "load meal")
+		return
+	}
+	second := &models.Meal{}
+	if req.OtherMealID != "" {
+		if second, err = h.db.GetMeal(r.Context(), req.OtherMealID); err != nil {
+			h.respondDBError(w, err, "Meal", "load meal")
+			return
+		}
+	}
+	if err := validation.SwapMeals(req, *first, *second); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	meals, err := h.db.SwapMeals(r.Context(), mealID, req.OtherMealID, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetMeal(r.Context(), mealID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "swap meals")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, meals)
+}
+
+// ReorderMealItems sets the order of a meal's items
+func (h *Handler) ReorderMealItems(w http.ResponseWriter, r *http.Request) {
+	mealID := chi.URLParam(r, "mealId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.ReorderMealItemsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	items, err := h.db.GetMealItemsByMeal(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "load meal items")
+		return
+	}
+	if err := validation.ReorderMealItems(req, items); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	meal, err := h.db.ReorderMealItems(r.Context(), mealID, req.ItemIDs, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetMealWithItems(r.Context(), mealID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Meal item order", "reorder meal items")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, meal.Version, meal)
+}
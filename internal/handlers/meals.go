@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 
 	"farm-time/internal/auth"
+	"farm-time/internal/db"
 	"farm-time/internal/models"
+	"farm-time/internal/validation"
 )
 
 // Meal handlers
@@ -18,7 +21,7 @@ func (h *Handler) ListMeals(w http.ResponseWriter, r *http.Request) {
 
 	meals, err := h.db.GetMealsWithItemsByEvent(r.Context(), eventID)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to list meals")
+		h.respondDBError(w, err, "Meal", "list meals")
 		return
 	}
 	if meals == nil {
@@ -36,47 +39,87 @@ func (h *Handler) CreateMeal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Name == "" {
-		h.respondError(w, http.StatusBadRequest, "Name is required")
+	event, err := h.db.GetEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
 		return
 	}
-	if req.MealType == "" {
-		h.respondError(w, http.StatusBadRequest, "Meal type is required")
+	if err := validation.CreateMeal(req, *event); err != nil {
+		h.respondValidationError(w, err)
 		return
 	}
 
 	meal, err := h.db.CreateMeal(r.Context(), eventID, req)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to create meal")
+		h.respondDBError(w, err, "Meal", "create meal")
 		return
 	}
 
 	h.respondJSON(w, http.StatusCreated, meal)
 }
 
+func (h *Handler) GetMeal(w http.ResponseWriter, r *http.Request) {
+	mealID := chi.URLParam(r, "mealId")
+
+	meal, err := h.db.GetMealWithItems(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "load meal")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, meal.Version, meal)
+}
+
 func (h *Handler) UpdateMeal(w http.ResponseWriter, r *http.Request) {
 	mealID := chi.URLParam(r, "mealId")
 
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
 	var req models.UpdateMealRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	meal, err := h.db.UpdateMeal(r.Context(), mealID, req)
+	current, err := h.db.GetMeal(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "load meal")
+		return
+	}
+	event, err := h.db.GetEvent(r.Context(), current.EventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+	if err := validation.UpdateMeal(req, *event); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	meal, err := h.db.UpdateMeal(r.Context(), mealID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetMeal(r.Context(), mealID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "Meal not found")
+		h.respondDBError(w, err, "Meal", "update meal")
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, meal)
+	h.respondVersioned(w, http.StatusOK, meal.Version, meal)
 }
 
 func (h *Handler) DeleteMeal(w http.ResponseWriter, r *http.Request) {
 	mealID := chi.URLParam(r, "mealId")
 
 	if err := h.db.DeleteMeal(r.Context(), mealID); err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to delete meal")
+		h.respondDBError(w, err, "Meal", "delete meal")
 		return
 	}
 
@@ -94,43 +137,75 @@ func (h *Handler) AddMealItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Name == "" {
-		h.respondError(w, http.StatusBadRequest, "Name is required")
+	if err := validation.CreateMealItem(req); err != nil {
+		h.respondValidationError(w, err)
 		return
 	}
 
 	item, err := h.db.CreateMealItem(r.Context(), mealID, req)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to add meal item")
+		h.respondDBError(w, err, "Meal item", "add meal item")
 		return
 	}
 
 	h.respondJSON(w, http.StatusCreated, item)
 }
 
+func (h *Handler) GetMealItem(w http.ResponseWriter, r *http.Request) {
+	itemID := chi.URLParam(r, "itemId")
+
+	item, err := h.db.GetMealItemWithSignups(r.Context(), itemID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal item", "load meal item")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, item.Version, item)
+}
+
 func (h *Handler) UpdateMealItem(w http.ResponseWriter, r *http.Request) {
 	itemID := chi.URLParam(r, "itemId")
 
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
 	var req models.UpdateMealItemRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if err := validation.UpdateMealItem(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
 
-	item, err := h.db.UpdateMealItem(r.Context(), itemID, req)
+	item, err := h.db.UpdateMealItem(r.Context(), itemID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetMealItem(r.Context(), itemID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if errors.Is(err, db.ErrOverCommitted) {
+		h.respondError(w, http.StatusConflict, "Quantity is less than what people have already signed up to bring")
+		return
+	}
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "Meal item not found")
+		h.respondDBError(w, err, "Meal item", "update meal item")
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, item)
+	h.respondVersioned(w, http.StatusOK, item.Version, item)
 }
 
 func (h *Handler) DeleteMealItem(w http.ResponseWriter, r *http.Request) {
 	itemID := chi.URLParam(r, "itemId")
 
 	if err := h.db.DeleteMealItem(r.Context(), itemID); err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to delete meal item")
+		h.respondDBError(w, err, "Meal item", "delete meal item")
 		return
 	}
 
@@ -155,24 +230,20 @@ func (h *Handler) SignupForItem(w http.ResponseWriter, r *http.Request) {
 		// Allow empty body for signups without notes
 		req = models.CreateMealSignupRequest{}
 	}
+	if err := validation.CreateMealSignup(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
 
 	// Create the signup
 	signup, err := h.db.CreateMealSignup(r.Context(), itemID, user.ID, req)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to sign up for item")
+		h.respondDBError(w, err, "Signup", "sign up for item")
 		return
 	}
 
 	// Auto-add user as attendee if not already
-	attendees, _ := h.db.GetAttendeesByEvent(r.Context(), eventID)
-	isAttendee := false
-	for _, a := range attendees {
-		if a.Email == user.Email {
-			isAttendee = true
-			break
-		}
-	}
-	if !isAttendee {
+	if _, err := h.db.GetAttendeeByEmail(r.Context(), eventID, user.Email); errors.Is(err, db.ErrNotFound) {
 		h.db.CreateAttendee(r.Context(), eventID, models.CreateAttendeeRequest{
 			Name:   user.Name,
 			Email:  user.Email,
@@ -183,6 +254,35 @@ func (h *Handler) SignupForItem(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusCreated, signup)
 }
 
+// UpdateSignup changes how much of an item the current user is bringing
+func (h *Handler) UpdateSignup(w http.ResponseWriter, r *http.Request) {
+	itemID := chi.URLParam(r, "itemId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req models.UpdateMealSignupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateMealSignup(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	signup, err := h.db.UpdateMealSignup(r.Context(), itemID, user.ID, req)
+	if err != nil {
+		h.respondDBError(w, err, "Signup", "update signup")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, signup)
+}
+
 func (h *Handler) RemoveSignup(w http.ResponseWriter, r *http.Request) {
 	itemID := chi.URLParam(r, "itemId")
 
@@ -194,7 +294,7 @@ func (h *Handler) RemoveSignup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.db.DeleteMealSignup(r.Context(), itemID, user.ID); err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to remove signup")
+		h.respondDBError(w, err, "Signup", "remove signup")
 		return
 	}
 
@@ -208,7 +308,7 @@ func (h *Handler) GetEventWithMeals(w http.ResponseWriter, r *http.Request) {
 	event, err := h.db.GetEventWithMeals(r.Context(), id)
 	if err != nil {
 		log.Printf("GetEventWithMeals error for id %s: %v", id, err)
-		h.respondError(w, http.StatusNotFound, "Event not found")
+		h.respondDBError(w, err, "Event", "load event")
 		return
 	}
 
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/recipeimport"
+	"farm-time/internal/validation"
+)
+
+// Recipe handlers. The library is shared by everyone; a recipe can be
+// changed by whoever added it or an admin.
+
+func canManageRecipe(user *models.User, recipe *models.Recipe) bool {
+	if user == nil {
+		return false
+	}
+	if user.IsAdmin {
+		return true
+	}
+	return recipe.CreatedBy != nil && *recipe.CreatedBy == user.ID
+}
+
+func (h *Handler) ListRecipes(w http.ResponseWriter, r *http.Request) {
+	recipes, err := h.db.ListRecipes(r.Context(), r.URL.Query().Get("tag"))
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "list recipes")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, recipes)
+}
+
+func (h *Handler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateRecipe(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	recipe, err := h.db.CreateRecipe(r.Context(), req)
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "create recipe")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, recipe)
+}
+
+// ImportRecipe adds a recipe from pasted schema.org Recipe JSON-LD
+func (h *Handler) ImportRecipe(w http.ResponseWriter, r *http.Request) {
+	var req models.ImportRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	parsed, err := recipeimport.ParseJSONLD(req.Text)
+	if err != nil {
+		h.respondError(w, http.StatusUnprocessableEntity, "No schema.org Recipe found in the text")
+		return
+	}
+	if err := validation.CreateRecipe(*parsed); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	recipe, err := h.db.CreateRecipe(r.Context(), *parsed)
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "import recipe")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, recipe)
+}
+
+func (h *Handler) GetRecipe(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "recipeId")
+
+	recipe, err := h.db.GetRecipe(r.Context(), recipeID)
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "load recipe")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, recipe.Version, recipe)
+}
+
+// ScaleRecipe returns a recipe scaled with ?servings=N
+func (h *Handler) ScaleRecipe(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "recipeId")
+
+	servings, err := strconv.Atoi(r.URL.Query().Get("servings"))
+	if err != nil || servings < 1 {
+		h.respondError(w, http.StatusBadRequest, "servings must be a positive number")
+		return
+	}
+
+	scaled, err := h.db.ScaleRecipe(r.Context(), recipeID, servings)
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "scale recipe")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, scaled)
+}
+
+func (h *Handler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "recipeId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	current, err := h.db.GetRecipe(r.Context(), recipeID)
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "load recipe")
+		return
+	}
+	if !canManageRecipe(auth.GetUserFromContext(r.Context()), current) {
+		h.respondError(w, http.StatusForbidden, "Only the recipe's author or an admin can change it")
+		return
+	}
+
+	var req models.UpdateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateRecipe(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	recipe, err := h.db.UpdateRecipe(r.Context(), recipeID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetRecipe(r.Context(), recipeID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "update recipe")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, recipe.Version, recipe)
+}
+
+func (h *Handler) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "recipeId")
+
+	current, err := h.db.GetRecipe(r.Context(), recipeID)
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "load recipe")
+		return
+	}
+	if !canManageRecipe(auth.GetUserFromContext(r.Context()), current) {
+		h.respondError(w, http.StatusForbidden, "Only the recipe's author or an admin can delete it")
+		return
+	}
+
+	if err := h.db.DeleteRecipe(r.Context(), recipeID); err != nil {
+		h.respondDBError(w, err, "Recipe", "delete recipe")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMealItemRecipe returns the item's recipe scaled to the meal's expected headcount
+func (h *Handler) GetMealItemRecipe(w http.ResponseWriter, r *http.Request) {
+	itemID := chi.URLParam(r, "itemId")
+
+	scaled, err := h.db.GetMealItemRecipe(r.Context(), itemID)
+	if err != nil {
+		h.respondDBError(w, err, "Recipe", "load recipe")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, scaled)
+}
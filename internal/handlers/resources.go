@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Resource handlers. Everyone can see and reserve the property's
+// equipment; only admins change the catalog or review reservations.
+
+func (h *Handler) ListResources(w http.ResponseWriter, r *http.Request) {
+	resources, err := h.db.ListResources(r.Context())
+	if err != nil {
+		h.respondDBError(w, err, "Resource", "list resources")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, resources)
+}
+
+func (h *Handler) CreateResource(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.CreateResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateResource(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	resource, err := h.db.CreateResource(r.Context(), req)
+	if err != nil {
+		h.respondDBError(w, err, "Resource", "create resource")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, resource)
+}
+
+func (h *Handler) GetResource(w http.ResponseWriter, r *http.Request) {
+	resourceID := chi.URLParam(r, "resourceId")
+
+	resource, err := h.db.GetResource(r.Context(), resourceID)
+	if err != nil {
+		h.respondDBError(w, err, "Resource", "load resource")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, resource.Version, resource)
+}
+
+func (h *Handler) UpdateResource(w http.ResponseWriter, r *http.Request) {
+	resourceID := chi.URLParam(r, "resourceId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.UpdateResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateResource(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	resource, err := h.db.UpdateResource(r.Context(), resourceID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetResource(r.Context(), resourceID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Resource", "update resource")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, resource.Version, resource)
+}
+
+func (h *Handler) DeleteResource(w http.ResponseWriter, r *http.Request) {
+	resourceID := chi.URLParam(r, "resourceId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	if err := h.db.DeleteResource(r.Context(), resourceID); err != nil {
+		h.respondDBError(w, err, "Resource", "delete resource")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetResourceCalendar lists a resource's reservations across all events,
+// optionally limited to those overlapping from/until (RFC 3339)
+func (h *Handler) GetResourceCalendar(w http.ResponseWriter, r *http.Request) {
+	resourceID := chi.URLParam(r, "resourceId")
+
+	var from, until *time.Time
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "Invalid from, expected RFC 3339 timestamp")
+			return
+		}
+		from = &t
+	}
+	if v := r.URL.Query().Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "Invalid until, expected RFC 3339 timestamp")
+			return
+		}
+		until = &t
+	}
+
+	calendar, err := h.db.GetResourceCalendar(r.Context(), resourceID, from, until)
+	if err != nil {
+		h.respondDBError(w, err, "Resource", "load resource calendar")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, calendar)
+}
+
+// Reservation handlers
+
+func (h *Handler) ListReservations(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	reservations, err := h.db.GetReservationsByEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Reservation", "list reservations")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, reservations)
+}
+
+// CreateReservation books a resource for an attendee. It waits for an
+// admin when the resource requires approval.
+func (h *Handler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.CreateReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateReservation(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	reservation, err := h.db.CreateReservation(r.Context(), eventID, req)
+	if errors.Is(err, db.ErrOverCapacity) {
+		h.respondError(w, http.StatusConflict, "Resource is already booked for part of that time")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Reservation", "create reservation")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, reservation)
+}
+
+// ReviewReservation approves or denies a reservation
+func (h *Handler) ReviewReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID := chi.URLParam(r, "reservationId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req models.ReviewReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.ReviewReservation(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	reservation, err := h.db.ReviewReservation(r.Context(), reservationID, req.Status)
+	if errors.Is(err, db.ErrOverCapacity) {
+		h.respondError(w, http.StatusConflict, "Resource has since been booked for part of that time")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Reservation", "review reservation")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, reservation)
+}
+
+func (h *Handler) DeleteReservation(w http.ResponseWriter, r *http.Request) {
+	reservationID := chi.URLParam(r, "reservationId")
+
+	if err := h.db.DeleteReservation(r.Context(), reservationID); err != nil {
+		h.respondDBError(w, err, "Reservation", "cancel reservation")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
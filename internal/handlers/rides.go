@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/db"
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Ride handlers
+
+func (h *Handler) ListRides(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	rides, err := h.db.GetRidesByEvent(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Ride", "list rides")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, rides)
+}
+
+func (h *Handler) CreateRide(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.CreateRideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.CreateRide(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	ride, err := h.db.CreateRide(r.Context(), eventID, req)
+	if errors.Is(err, db.ErrConflict) {
+		h.respondError(w, http.StatusConflict, "The driver already has another ride that way")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Ride", "create ride")
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, ride)
+}
+
+func (h *Handler) GetRide(w http.ResponseWriter, r *http.Request) {
+	rideID := chi.URLParam(r, "rideId")
+
+	ride, err := h.db.GetRideWithPassengers(r.Context(), rideID)
+	if err != nil {
+		h.respondDBError(w, err, "Ride", "load ride")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, ride.Version, ride)
+}
+
+func (h *Handler) UpdateRide(w http.ResponseWriter, r *http.Request) {
+	rideID := chi.URLParam(r, "rideId")
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
+	var req models.UpdateRideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateRide(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	ride, err := h.db.UpdateRide(r.Context(), rideID, req, expectedVersion)
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetRideWithPassengers(r.Context(), rideID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
+	if errors.Is(err, db.ErrOverCapacity) {
+		h.respondError(w, http.StatusConflict, "Confirmed passengers already take more seats than that")
+		return
+	}
+	if err != nil {
+		h.respondDBError(w, err, "Ride", "update ride")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, ride.Version, ride)
+}
+
+func (h *Handler) DeleteRide(w http.ResponseWriter, r *http.Request) {
+	rideID := chi.URLParam(r, "rideId")
+
+	if err := h.db.DeleteRide(r.Context(), rideID); err != nil {
+		h.respondDBError(w, err, "Ride", "delete ride")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRideNeeds lists who is coming but has no ride yet, each way
+func (h *Handler) GetRideNeeds(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	needs, err := h.db.GetRideNeeds(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load ride needs")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, needs)
+}
+
+// Passenger handlers
+
+// AddRidePassenger claims seats on a ride, or asks the driver for them
+func (h *Handler) AddRidePassenger(w http.ResponseWriter, r *http.Request) {
+	rideID := chi.URLParam(r, "rideId")
+
+	var req models.RideSeatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.RideSeat(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	passenger, err := h.db.AddRidePassenger(r.Context(), rideID, req)
+	if !h.respondPassengerError(w, err, "add passenger") {
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, passenger)
+}
+
+// UpdateRidePassenger confirms a seat request or changes a passenger's seats
+func (h *Handler) UpdateRidePassenger(w http.ResponseWriter, r *http.Request) {
+	passengerID := chi.URLParam(r, "passengerId")
+
+	var req models.UpdateRidePassengerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.UpdateRidePassenger(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	passenger, err := h.db.UpdateRidePassenger(r.Context(), passengerID, req)
+	if !h.respondPassengerError(w, err, "update passenger") {
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, passenger)
+}
+
+func (h *Handler) DeleteRidePassenger(w http.ResponseWriter, r *http.Request) {
+	passengerID := chi.URLParam(r, "passengerId")
+
+	if err := h.db.DeleteRidePassenger(r.Context(), passengerID); err != nil {
+		h.respondDBError(w, err, "Passenger", "remove passenger")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondPassengerError writes the response for a failed seat change and
+// reports whether the caller should carry on
+func (h *Handler) respondPassengerError(w http.ResponseWriter, err error, action string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, db.ErrConflict):
+		h.respondError(w, http.StatusConflict, "Attendee is already on this ride or has another ride that way")
+	case errors.Is(err, db.ErrCheckViolation):
+		h.respondError(w, http.StatusUnprocessableEntity, "The driver can't be a passenger on their own ride")
+	default:
+		h.respondDBError(w, err, "Ride", action)
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/models"
+	"farm-time/internal/validation"
+)
+
+// Shopping list handlers
+
+// GetShoppingList returns the event's shopping list as JSON, or as a
+// download with ?format=text or ?format=csv
+func (h *Handler) GetShoppingList(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "text" && format != "csv" {
+		h.respondError(w, http.StatusBadRequest, "format must be one of: json, text, csv")
+		return
+	}
+
+	list, err := h.db.GetShoppingList(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load shopping list")
+		return
+	}
+
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="shopping-list.txt"`)
+		w.Write([]byte(shoppingListText(list)))
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="shopping-list.csv"`)
+		writeShoppingListCSV(w, list)
+	default:
+		h.respondJSON(w, http.StatusOK, list)
+	}
+}
+
+// MarkShoppingItemPurchased checks a line off the list as bought by the
+// current user, or puts it back
+func (h *Handler) MarkShoppingItemPurchased(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	var req models.MarkPurchasedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.MarkPurchased(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	if err := h.db.SetShoppingItemPurchased(r.Context(), eventID, req.Key, req.Purchased); err != nil {
+		h.respondDBError(w, err, "Event", "update shopping list")
+		return
+	}
+
+	list, err := h.db.GetShoppingList(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load shopping list")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, list)
+}
+
+// shoppingAmount formats a line's quantity and unit, e.g. "24 burgers" or "2.5 lb"
+func shoppingAmount(item models.ShoppingListItem) string {
+	if item.Quantity == nil {
+		return ""
+	}
+	amount := strconv.FormatFloat(*item.Quantity, 'f', -1, 64)
+	if item.Unit != "" {
+		amount += " " + item.Unit
+	}
+	return amount
+}
+
+func shoppingMeals(item models.ShoppingListItem) string {
+	var meals []string
+	seen := map[string]bool{}
+	for _, s := range item.Sources {
+		if !seen[s.MealID] {
+			seen[s.MealID] = true
+			meals = append(meals, s.MealName)
+		}
+	}
+	return strings.Join(meals, "; ")
+}
+
+func shoppingListText(list *models.ShoppingList) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Shopping list: %s\n", list.EventTitle)
+	for _, category := range list.Categories {
+		fmt.Fprintf(&b, "\n%s\n", strings.ToUpper(category.Category))
+		for _, item := range category.Items {
+			check := "[ ]"
+			if item.Purchased {
+				check = "[x]"
+			}
+			line := check + " " + item.Name
+			if amount := shoppingAmount(item); amount != "" {
+				line += " - " + amount
+			}
+			if meals := shoppingMeals(item); meals != "" {
+				line += " (" + meals + ")"
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func writeShoppingListCSV(w http.ResponseWriter, list *models.ShoppingList) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"category", "item", "quantity", "unit", "purchased", "purchased_by", "meals"})
+	for _, category := range list.Categories {
+		for _, item := range category.Items {
+			quantity := ""
+			if item.Quantity != nil {
+				quantity = strconv.FormatFloat(*item.Quantity, 'f', -1, 64)
+			}
+			purchasedBy := ""
+			if item.PurchasedByName != nil {
+				purchasedBy = *item.PurchasedByName
+			}
+			cw.Write([]string{
+				csvSafe(category.Category), csvSafe(item.Name), quantity, csvSafe(item.Unit),
+				strconv.FormatBool(item.Purchased), csvSafe(purchasedBy), csvSafe(shoppingMeals(item)),
+			})
+		}
+	}
+	cw.Flush()
+}
+
+// csvSafe stops a spreadsheet from running a user-entered cell as a formula
+// by prefixing it with a quote
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/auth"
+)
+
+// Stats handlers. Anyone can see their own numbers, an event's summary and
+// the yearly report; other people's numbers are for admins.
+
+// GetMyStats returns the current user's contributions across all events
+func (h *Handler) GetMyStats(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		h.respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	stats, err := h.db.GetUserStats(r.Context(), user.ID)
+	if err != nil {
+		h.respondDBError(w, err, "User", "load stats")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, stats)
+}
+
+// GetUserStats returns one user's contributions. Users may look up
+// themselves; anyone else needs an admin.
+func (h *Handler) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userId")
+
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || (!user.IsAdmin && user.ID != userID) {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	stats, err := h.db.GetUserStats(r.Context(), userID)
+	if err != nil {
+		h.respondDBError(w, err, "User", "load stats")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, stats)
+}
+
+// ListUserStats returns everyone's contributions, biggest first (admin only)
+func (h *Handler) ListUserStats(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil || !user.IsAdmin {
+		h.respondError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	stats, err := h.db.ListUserStats(r.Context())
+	if err != nil {
+		h.respondDBError(w, err, "User", "load stats")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, stats)
+}
+
+// GetEventStats summarizes an event's headcount, meal coverage and todos
+func (h *Handler) GetEventStats(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	stats, err := h.db.GetEventStats(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load stats")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, stats)
+}
+
+// GetYearlyReport rolls up a year's events, the current year by default
+func (h *Handler) GetYearlyReport(w http.ResponseWriter, r *http.Request) {
+	year := time.Now().Year()
+	if v := r.URL.Query().Get("year"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > 9999 {
+			h.respondError(w, http.StatusBadRequest, "Invalid year")
+			return
+		}
+		year = parsed
+	}
+
+	report, err := h.db.GetYearlyReport(r.Context(), year)
+	if err != nil {
+		h.respondDBError(w, err, "Report", "load yearly report")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, report)
+}
@@ -2,29 +2,93 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"farm-time/internal/db"
 	"farm-time/internal/models"
+	"farm-time/internal/validation"
 )
 
 // Todo handlers
 
+// parseTodoFilter reads filtering and sorting options from the query string
+func parseTodoFilter(r *http.Request) (models.TodoFilter, string) {
+	q := r.URL.Query()
+	filter := models.TodoFilter{
+		Priority:   q.Get("priority"),
+		Category:   q.Get("category"),
+		Checklist:  q.Get("checklist"),
+		AssigneeID: q.Get("assignee"),
+		Sort:       q.Get("sort"),
+	}
+
+	if v := q.Get("completed"); v != "" {
+		completed, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, "Invalid completed, expected true or false"
+		}
+		filter.Completed = &completed
+	}
+	if v := q.Get("due_before"); v != "" {
+		dueBefore, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, "Invalid due_before, expected RFC 3339 timestamp"
+		}
+		filter.DueBefore = &dueBefore
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, "Invalid order, expected asc or desc"
+	}
+
+	return filter, ""
+}
+
+// ListTodos returns an event's todos. They can be filtered by completed,
+// priority, category, checklist, assignee (an attendee ID or "none") and
+// due_before, and sorted by due, priority, title or created in either order.
 func (h *Handler) ListTodos(w http.ResponseWriter, r *http.Request) {
 	eventID := chi.URLParam(r, "id")
 
-	todos, err := h.db.GetTodosByEvent(r.Context(), eventID)
-	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to list todos")
+	filter, msg := parseTodoFilter(r)
+	if msg != "" {
+		h.respondError(w, http.StatusBadRequest, msg)
 		return
 	}
-	if todos == nil {
-		todos = []models.Todo{}
+	if err := validation.TodoFilter(filter); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
+
+	todos, err := h.db.ListTodos(r.Context(), eventID, filter)
+	if err != nil {
+		h.respondDBError(w, err, "Todo", "list todos")
+		return
 	}
 	h.respondJSON(w, http.StatusOK, todos)
 }
 
+// GetTodoPlan lists an event's open todos in dependency order, split into
+// what can be done now and what is still waiting on other todos
+func (h *Handler) GetTodoPlan(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	plan, err := h.db.GetTodoPlan(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Todo", "plan todos")
+		return
+	}
+	h.respondJSON(w, http.StatusOK, plan)
+}
+
 func (h *Handler) CreateTodo(w http.ResponseWriter, r *http.Request) {
 	eventID := chi.URLParam(r, "id")
 
@@ -34,43 +98,75 @@ func (h *Handler) CreateTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Title == "" {
-		h.respondError(w, http.StatusBadRequest, "Title is required")
+	if err := validation.CreateTodo(req); err != nil {
+		h.respondValidationError(w, err)
 		return
 	}
 
 	todo, err := h.db.CreateTodo(r.Context(), eventID, req)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to create todo")
+		h.respondDBError(w, err, "Todo", "create todo")
 		return
 	}
 
 	h.respondJSON(w, http.StatusCreated, todo)
 }
 
+func (h *Handler) GetTodo(w http.ResponseWriter, r *http.Request) {
+	todoID := chi.URLParam(r, "todoId")
+
+	todo, err := h.db.GetTodo(r.Context(), todoID)
+	if err != nil {
+		h.respondDBError(w, err, "Todo", "load todo")
+		return
+	}
+
+	h.respondVersioned(w, http.StatusOK, todo.Version, todo)
+}
+
 func (h *Handler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
 	todoID := chi.URLParam(r, "todoId")
 
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid If-Match header")
+		return
+	}
+
 	var req models.UpdateTodoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if err := validation.UpdateTodo(req); err != nil {
+		h.respondValidationError(w, err)
+		return
+	}
 
-	todo, err := h.db.UpdateTodo(r.Context(), todoID, req)
+	todo, err := h.db.UpdateTodo(r.Context(), todoID, req, expectedVersion)
+	if errors.Is(err, db.ErrBlocked) {
+		h.respondError(w, http.StatusConflict, "Todo is waiting on incomplete prerequisites; set override to complete it anyway")
+		return
+	}
+	if errors.Is(err, db.ErrVersionConflict) {
+		if current, err := h.db.GetTodo(r.Context(), todoID); err == nil {
+			h.respondPreconditionFailed(w, current.Version, current)
+			return
+		}
+	}
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "Todo not found")
+		h.respondDBError(w, err, "Todo", "update todo")
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, todo)
+	h.respondVersioned(w, http.StatusOK, todo.Version, todo)
 }
 
 func (h *Handler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
 	todoID := chi.URLParam(r, "todoId")
 
 	if err := h.db.DeleteTodo(r.Context(), todoID); err != nil {
-		h.respondError(w, http.StatusInternalServerError, "Failed to delete todo")
+		h.respondDBError(w, err, "Todo", "delete todo")
 		return
 	}
 
@@ -83,9 +179,10 @@ func (h *Handler) GetEventWithAll(w http.ResponseWriter, r *http.Request) {
 
 	event, err := h.db.GetEventWithAll(r.Context(), id)
 	if err != nil {
-		h.respondError(w, http.StatusNotFound, "Event not found")
+		h.respondDBError(w, err, "Event", "load event")
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, event)
+	// The ETag is the event's own version, for use with If-Match on PUT
+	h.respondVersioned(w, http.StatusOK, event.Version, event)
 }
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"farm-time/internal/models"
+)
+
+// Trash handlers
+
+func (h *Handler) ListDeletedEvents(w http.ResponseWriter, r *http.Request) {
+	events, err := h.db.ListDeletedEvents(r.Context())
+	if err != nil {
+		h.respondDBError(w, err, "Event", "list deleted events")
+		return
+	}
+	if events == nil {
+		events = []models.Event{}
+	}
+	h.respondJSON(w, http.StatusOK, events)
+}
+
+func (h *Handler) GetEventTrash(w http.ResponseWriter, r *http.Request) {
+	eventID := chi.URLParam(r, "id")
+
+	if _, err := h.db.GetEvent(r.Context(), eventID); err != nil {
+		h.respondDBError(w, err, "Event", "load event")
+		return
+	}
+
+	trash, err := h.db.GetEventTrash(r.Context(), eventID)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "load trash")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, trash)
+}
+
+func (h *Handler) RestoreEvent(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	event, err := h.db.RestoreEvent(r.Context(), id)
+	if err != nil {
+		h.respondDBError(w, err, "Event", "restore event")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, event)
+}
+
+func (h *Handler) RestoreMeal(w http.ResponseWriter, r *http.Request) {
+	mealID := chi.URLParam(r, "mealId")
+
+	meal, err := h.db.RestoreMeal(r.Context(), mealID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal", "restore meal")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, meal)
+}
+
+func (h *Handler) RestoreMealItem(w http.ResponseWriter, r *http.Request) {
+	itemID := chi.URLParam(r, "itemId")
+
+	item, err := h.db.RestoreMealItem(r.Context(), itemID)
+	if err != nil {
+		h.respondDBError(w, err, "Meal item", "restore meal item")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, item)
+}
+
+func (h *Handler) RestoreTodo(w http.ResponseWriter, r *http.Request) {
+	todoID := chi.URLParam(r, "todoId")
+
+	todo, err := h.db.RestoreTodo(r.Context(), todoID)
+	if err != nil {
+		h.respondDBError(w, err, "Todo", "restore todo")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, todo)
+}
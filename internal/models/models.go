@@ -1,24 +1,48 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Event struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Location    string    `json:"location"`
-	StartTime   time.Time `json:"start_time"`
-	EndTime     time.Time `json:"end_time"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Location    string     `json:"location"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
+	TimeZone    string     `json:"time_zone"`  // IANA name such as "America/Chicago"; decides which day a time falls on
+	Exclusive   bool       `json:"exclusive"`  // Claims the whole property; nothing else may overlap it
+	CreatedBy   *string    `json:"created_by"` // Owning user, nil for events created before ownership was tracked
+	Version     int        `json:"version"`    // Incremented on every update, exposed as the ETag
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // Set while the event is in the trash
+	Overlaps    []string   `json:"overlaps,omitempty"`   // IDs of other events at the same time; only set when listing
 }
 
 type Attendee struct {
-	ID        string    `json:"id"`
-	EventID   string    `json:"event_id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Status    string    `json:"status"` // "attending", "maybe", "declined"
+	ID            string    `json:"id"`
+	EventID       string    `json:"event_id"`
+	Name          string    `json:"name"`
+	Email         string    `json:"email"`          // Optional for household members other than the primary contact
+	Status        string    `json:"status"`         // "attending", "maybe", "declined"
+	ArrivalTime   time.Time `json:"arrival_time"`   // Defaults to the event's start time
+	DepartureTime time.Time `json:"departure_time"` // Defaults to the event's end time
+
+	// Party size: one row can stand for a person plus guests who don't need
+	// their own entry
+	HouseholdID *string `json:"household_id"`
+	Adults      int     `json:"adults"`   // Defaults to 1
+	Children    int     `json:"children"` // Defaults to 0
+
+	// Dietary profile for this attendee, merged with their user's profile
+	DietaryRestrictions []string `json:"dietary_restrictions"`
+	Allergies           []string `json:"allergies"`
+	DietaryNotes        string   `json:"dietary_notes"`
+
+	Version   int       `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -34,6 +58,8 @@ type CreateEventRequest struct {
 	Location    string    `json:"location"`
 	StartTime   time.Time `json:"start_time"`
 	EndTime     time.Time `json:"end_time"`
+	TimeZone    string    `json:"time_zone"` // Defaults to UTC
+	Exclusive   bool      `json:"exclusive"`
 }
 
 type UpdateEventRequest struct {
@@ -42,31 +68,141 @@ type UpdateEventRequest struct {
 	Location    *string    `json:"location,omitempty"`
 	StartTime   *time.Time `json:"start_time,omitempty"`
 	EndTime     *time.Time `json:"end_time,omitempty"`
+	TimeZone    *string    `json:"time_zone,omitempty"`
+	Exclusive   *bool      `json:"exclusive,omitempty"`
+}
+
+// BookingRequest asks for the farm on some dates. Users who can't create
+// events file one; approving it creates the event for them.
+type BookingRequest struct {
+	ID            string     `json:"id"`
+	RequestedBy   string     `json:"requested_by"`
+	RequesterName string     `json:"requester_name"`
+	Title         string     `json:"title"`
+	Description   string     `json:"description"`
+	StartTime     time.Time  `json:"start_time"`
+	EndTime       time.Time  `json:"end_time"`
+	Exclusive     bool       `json:"exclusive"`
+	Status        string     `json:"status"`   // "pending", "approved" or "denied"
+	EventID       *string    `json:"event_id"` // The event created on approval
+	ReviewNote    string     `json:"review_note"`
+	ReviewedBy    *string    `json:"reviewed_by"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type CreateBookingRequestRequest struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Exclusive   bool      `json:"exclusive"`
+}
+
+// ReviewBookingRequestRequest is an admin's decision on a booking request
+type ReviewBookingRequestRequest struct {
+	Status string `json:"status"` // "approved" or "denied"
+	Note   string `json:"note"`
+}
+
+// Availability shows what is happening at the farm over a stretch of time:
+// the events already planned and the booking requests still waiting
+type Availability struct {
+	Events          []Event          `json:"events"`
+	BookingRequests []BookingRequest `json:"booking_requests"`
 }
 
 type CreateAttendeeRequest struct {
-	Name   string `json:"name"`
-	Email  string `json:"email"`
-	Status string `json:"status"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Status        string     `json:"status"`
+	ArrivalTime   *time.Time `json:"arrival_time"`
+	DepartureTime *time.Time `json:"departure_time"`
+	HouseholdID   *string    `json:"household_id"`
+	Adults        *int       `json:"adults"`
+	Children      *int       `json:"children"`
+
+	DietaryRestrictions []string `json:"dietary_restrictions"`
+	Allergies           []string `json:"allergies"`
+	DietaryNotes        string   `json:"dietary_notes"`
 }
 
 type UpdateAttendeeRequest struct {
-	Name   *string `json:"name,omitempty"`
-	Email  *string `json:"email,omitempty"`
-	Status *string `json:"status,omitempty"`
+	Name          *string    `json:"name,omitempty"`
+	Email         *string    `json:"email,omitempty"`
+	Status        *string    `json:"status,omitempty"`
+	ArrivalTime   *time.Time `json:"arrival_time,omitempty"`
+	DepartureTime *time.Time `json:"departure_time,omitempty"`
+	HouseholdID   *string    `json:"household_id,omitempty"` // Empty string leaves the household
+	Adults        *int       `json:"adults,omitempty"`
+	Children      *int       `json:"children,omitempty"`
+
+	DietaryRestrictions *[]string `json:"dietary_restrictions,omitempty"`
+	Allergies           *[]string `json:"allergies,omitempty"`
+	DietaryNotes        *string   `json:"dietary_notes,omitempty"`
+}
+
+// Household groups the attendees of an event who travel and RSVP together,
+// such as a family
+type Household struct {
+	ID                string    `json:"id"`
+	EventID           string    `json:"event_id"`
+	Name              string    `json:"name"`
+	PrimaryAttendeeID *string   `json:"primary_attendee_id"` // Contact for the household, must have an email
+	Version           int       `json:"version"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// HouseholdWithMembers is a household with its attendees and their total
+// party size
+type HouseholdWithMembers struct {
+	Household
+	Members  []Attendee `json:"members"`
+	Adults   int        `json:"adults"`
+	Children int        `json:"children"`
+}
+
+type CreateHouseholdRequest struct {
+	Name              string  `json:"name"`
+	PrimaryAttendeeID *string `json:"primary_attendee_id"`
+}
+
+type UpdateHouseholdRequest struct {
+	Name              *string `json:"name,omitempty"`
+	PrimaryAttendeeID *string `json:"primary_attendee_id,omitempty"` // Empty string clears the contact
+}
+
+// HouseholdRSVPRequest sets the status of every member of a household at once
+type HouseholdRSVPRequest struct {
+	Status string `json:"status"`
 }
 
 // User represents a user authenticated via Google OAuth
 type User struct {
-	ID              string    `json:"id"`
-	GoogleID        string    `json:"-"` // Never expose to frontend
-	Email           string    `json:"email"`
-	Name            string    `json:"name"`
-	Picture         string    `json:"picture"`
-	IsAdmin         bool      `json:"is_admin"`
-	CanCreateEvents bool      `json:"can_create_events"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              string `json:"id"`
+	GoogleID        string `json:"-"` // Never expose to frontend
+	Email           string `json:"email"`
+	Name            string `json:"name"`
+	Picture         string `json:"picture"`
+	IsAdmin         bool   `json:"is_admin"`
+	CanCreateEvents bool   `json:"can_create_events"`
+
+	// Dietary profile, applied to attendees with the same email
+	DietaryRestrictions []string `json:"dietary_restrictions"` // e.g. "vegetarian", "gluten-free"
+	Allergies           []string `json:"allergies"`            // e.g. "peanuts", "tree nuts"
+	DietaryNotes        string   `json:"dietary_notes"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DietaryProfile is a set of diets and allergies for one person
+type DietaryProfile struct {
+	Restrictions []string `json:"restrictions"`
+	Allergies    []string `json:"allergies"`
+	Notes        string   `json:"notes"`
 }
 
 type UpdateUserPermissionsRequest struct {
@@ -83,26 +219,39 @@ type Session struct {
 
 // Meal represents a meal within an event (e.g., "Saturday Dinner")
 type Meal struct {
-	ID        string    `json:"id"`
-	EventID   string    `json:"event_id"`
-	Name      string    `json:"name"`
-	MealType  string    `json:"meal_type"` // "breakfast", "lunch", "dinner", "snacks", "other"
-	MealDate  *string   `json:"meal_date"` // Optional YYYY-MM-DD
-	Notes     string    `json:"notes"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `json:"id"`
+	EventID   string     `json:"event_id"`
+	Name      string     `json:"name"`
+	MealType  string     `json:"meal_type"` // "breakfast", "lunch", "dinner", "snacks", "other"
+	MealDate  *string    `json:"meal_date"` // Optional YYYY-MM-DD
+	Notes     string     `json:"notes"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // MealItem represents something needed for a meal (e.g., "Burgers")
 type MealItem struct {
-	ID                   string    `json:"id"`
-	MealID               string    `json:"meal_id"`
-	Name                 string    `json:"name"`
-	Description          string    `json:"description"`
-	AssignedAttendeeID   *string   `json:"assigned_attendee_id"`
-	AssignedAttendeeName *string   `json:"assigned_attendee_name"`
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+	ID                   string     `json:"id"`
+	MealID               string     `json:"meal_id"`
+	Name                 string     `json:"name"`
+	Description          string     `json:"description"`
+	AssignedAttendeeID   *string    `json:"assigned_attendee_id"`
+	AssignedAttendeeName *string    `json:"assigned_attendee_name"`
+	Quantity             *float64   `json:"quantity"`          // How much is needed, e.g. 24; nil for no set amount
+	Unit                 string     `json:"unit"`              // e.g. "burgers", "bags"
+	AssignedQuantity     *float64   `json:"assigned_quantity"` // How much the assignee brings; nil for all of it
+	HostBuys             bool       `json:"host_buys"`         // Bought on the group shopping run rather than brought by someone
+	Category             string     `json:"category"`          // Store section for the shopping list, e.g. "produce"
+	RecipeID             *string    `json:"recipe_id"`         // Recipe the item is made from; its ingredients go on the shopping list
+	Allergens            []string   `json:"allergens"`         // Allergens the item contains, e.g. "peanuts", "gluten"
+	DietTags             []string   `json:"diet_tags"`         // Diets the item suits, e.g. "vegetarian", "gluten-free"
+	SortOrder            int        `json:"sort_order"`        // Position within the meal; ties sort by name
+	Version              int        `json:"version"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	DeletedAt            *time.Time `json:"deleted_at,omitempty"`
 }
 
 // MealSignup represents a user signing up to bring a meal item
@@ -112,6 +261,7 @@ type MealSignup struct {
 	UserID     string    `json:"user_id"`
 	UserName   string    `json:"user_name"`
 	UserEmail  string    `json:"user_email"`
+	Quantity   *float64  `json:"quantity"` // How much of the item this person brings
 	Notes      string    `json:"notes"`
 	CreatedAt  time.Time `json:"created_at"`
 }
@@ -119,13 +269,96 @@ type MealSignup struct {
 // MealItemWithSignups includes item details with who's bringing it
 type MealItemWithSignups struct {
 	MealItem
-	Signups []MealSignup `json:"signups"`
+	Covered      float64      `json:"covered"`   // Amount the assignee and signups bring between them
+	Remaining    *float64     `json:"remaining"` // Amount still needed; nil for items without a quantity
+	FullyCovered bool         `json:"fully_covered"`
+	Signups      []MealSignup `json:"signups"`
 }
 
 // MealWithItems includes meal details with all items
 type MealWithItems struct {
 	Meal
-	Items []MealItemWithSignups `json:"items"`
+	ExpectedHeadcount int                   `json:"expected_headcount"` // On-site attendees who haven't opted out, plus explicit opt-ins
+	Attendance        MealAttendanceCounts  `json:"attendance"`
+	DietaryWarnings   []DietaryWarning      `json:"dietary_warnings"`
+	Items             []MealItemWithSignups `json:"items"`
+}
+
+// DietaryWarning flags a meal item containing something a diner is allergic to
+type DietaryWarning struct {
+	AttendeeID   string `json:"attendee_id"`
+	AttendeeName string `json:"attendee_name"`
+	MealItemID   string `json:"meal_item_id"`
+	MealItemName string `json:"meal_item_name"`
+	Allergen     string `json:"allergen"`
+}
+
+// DietarySummary totals diets and allergies among an event's attending
+// attendees, for whoever does the shopping
+type DietarySummary struct {
+	Restrictions map[string][]string `json:"restrictions"` // Restriction -> attendee names
+	Allergies    map[string][]string `json:"allergies"`    // Allergen -> attendee names
+	Notes        []DietaryNote       `json:"notes"`
+	Warnings     []DietaryWarning    `json:"warnings"` // Allergy conflicts across all meals
+}
+
+// DietaryNote is an attendee's free-text dietary note
+type DietaryNote struct {
+	AttendeeID   string `json:"attendee_id"`
+	AttendeeName string `json:"attendee_name"`
+	Notes        string `json:"notes"`
+}
+
+// MealAttendance is one attendee's answer to whether they'll eat a meal
+type MealAttendance struct {
+	ID           string    `json:"id,omitempty"`
+	MealID       string    `json:"meal_id"`
+	AttendeeID   string    `json:"attendee_id"`
+	AttendeeName string    `json:"attendee_name"`
+	Status       string    `json:"status"` // "in", "out", "unknown"
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MealAttendanceCounts tallies answers for a meal. Unknown counts attendees
+// expected on site who haven't answered.
+type MealAttendanceCounts struct {
+	In      int `json:"in"`
+	Out     int `json:"out"`
+	Unknown int `json:"unknown"`
+}
+
+// MealAttendanceSummary lists every answer for a meal and who still needs chasing
+type MealAttendanceSummary struct {
+	MealID            string               `json:"meal_id"`
+	ExpectedHeadcount int                  `json:"expected_headcount"`
+	Counts            MealAttendanceCounts `json:"counts"`
+	Attendees         []MealAttendance     `json:"attendees"`
+	Unanswered        []Attendee           `json:"unanswered"`
+}
+
+// SetMealAttendanceRequest sets one answer for the current user, or for a
+// list of attendees (e.g. a whole family) when sent by the event owner
+type SetMealAttendanceRequest struct {
+	Status      string   `json:"status"`
+	AttendeeIDs []string `json:"attendee_ids,omitempty"`
+}
+
+// MealHeadcount is the expected headcount of one meal
+type MealHeadcount struct {
+	MealID            string `json:"meal_id"`
+	Name              string `json:"name"`
+	MealType          string `json:"meal_type"`
+	ExpectedHeadcount int    `json:"expected_headcount"`
+}
+
+// DayOccupancy summarizes who is on site on one day of an event
+type DayOccupancy struct {
+	Date      string          `json:"date"`      // YYYY-MM-DD
+	OnSite    int             `json:"on_site"`   // People in attending parties present at any point that day
+	Overnight int             `json:"overnight"` // People in attending parties staying through the following midnight
+	Arriving  []string        `json:"arriving"`  // Names of attendees arriving that day
+	Departing []string        `json:"departing"` // Names of attendees leaving that day
+	Meals     []MealHeadcount `json:"meals"`
 }
 
 // EventWithMeals extends EventWithAttendees to include meals
@@ -149,50 +382,1021 @@ type UpdateMealRequest struct {
 	Notes    *string `json:"notes,omitempty"`
 }
 
+// MoveMealRequest moves a meal to another date and/or event. Omitted fields
+// keep the meal where it is.
+type MoveMealRequest struct {
+	EventID  *string `json:"event_id,omitempty"`
+	MealDate *string `json:"meal_date,omitempty"`
+}
+
+// CopyMealRequest copies a meal and its items to another date and/or event
+type CopyMealRequest struct {
+	EventID        *string `json:"event_id,omitempty"`
+	MealDate       *string `json:"meal_date,omitempty"`
+	IncludeSignups bool    `json:"include_signups"` // Also copy who signed up to bring what
+}
+
+// SwapMealsRequest exchanges the date and meal type of two meals
+type SwapMealsRequest struct {
+	OtherMealID string `json:"other_meal_id"`
+}
+
+// ReorderMealItemsRequest lists every item of a meal in its new order
+type ReorderMealItemsRequest struct {
+	ItemIDs []string `json:"item_ids"`
+}
+
 type CreateMealItemRequest struct {
-	Name               string  `json:"name"`
-	Description        string  `json:"description"`
-	AssignedAttendeeID *string `json:"assigned_attendee_id"`
+	Name               string   `json:"name"`
+	Description        string   `json:"description"`
+	AssignedAttendeeID *string  `json:"assigned_attendee_id"`
+	Quantity           *float64 `json:"quantity"`
+	Unit               string   `json:"unit"`
+	AssignedQuantity   *float64 `json:"assigned_quantity"`
+	HostBuys           bool     `json:"host_buys"`
+	Category           string   `json:"category"`
+	RecipeID           *string  `json:"recipe_id"`
+	Allergens          []string `json:"allergens"`
+	DietTags           []string `json:"diet_tags"`
 }
 
 type UpdateMealItemRequest struct {
-	Name               *string `json:"name,omitempty"`
-	Description        *string `json:"description,omitempty"`
-	AssignedAttendeeID *string `json:"assigned_attendee_id,omitempty"`
+	Name               *string   `json:"name,omitempty"`
+	Description        *string   `json:"description,omitempty"`
+	AssignedAttendeeID *string   `json:"assigned_attendee_id,omitempty"`
+	Quantity           *float64  `json:"quantity,omitempty"` // 0 clears the quantity
+	Unit               *string   `json:"unit,omitempty"`
+	AssignedQuantity   *float64  `json:"assigned_quantity,omitempty"` // 0 means the assignee brings all of it
+	HostBuys           *bool     `json:"host_buys,omitempty"`
+	Category           *string   `json:"category,omitempty"`
+	RecipeID           *string   `json:"recipe_id,omitempty"` // Empty string unlinks the recipe
+	Allergens          *[]string `json:"allergens,omitempty"`
+	DietTags           *[]string `json:"diet_tags,omitempty"`
 }
 
 type CreateMealSignupRequest struct {
-	Notes string `json:"notes"`
+	Quantity *float64 `json:"quantity"` // Defaults to whatever is still needed
+	Notes    string   `json:"notes"`
+}
+
+type UpdateMealSignupRequest struct {
+	Quantity *float64 `json:"quantity,omitempty"`
+	Notes    *string  `json:"notes,omitempty"`
+}
+
+// Recipe is a dish in the shared recipe library
+type Recipe struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Servings    int                `json:"servings"`
+	Ingredients []RecipeIngredient `json:"ingredients"`
+	Steps       []string           `json:"steps"`
+	Tags        []string           `json:"tags"`
+	SourceURL   string             `json:"source_url"`
+	CreatedBy   *string            `json:"created_by"`
+	Version     int                `json:"version"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// RecipeIngredient is one line of a recipe, e.g. 2 cup flour (sifted)
+type RecipeIngredient struct {
+	Quantity *float64 `json:"quantity"` // nil for "salt to taste"
+	Unit     string   `json:"unit"`
+	Name     string   `json:"name"`
+	Note     string   `json:"note"`
+	Category string   `json:"category"` // Store section, guessed from the name when empty
+}
+
+type CreateRecipeRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Servings    int                `json:"servings"`
+	Ingredients []RecipeIngredient `json:"ingredients"`
+	Steps       []string           `json:"steps"`
+	Tags        []string           `json:"tags"`
+	SourceURL   string             `json:"source_url"`
+}
+
+type UpdateRecipeRequest struct {
+	Name        *string             `json:"name,omitempty"`
+	Description *string             `json:"description,omitempty"`
+	Servings    *int                `json:"servings,omitempty"`
+	Ingredients *[]RecipeIngredient `json:"ingredients,omitempty"`
+	Steps       *[]string           `json:"steps,omitempty"`
+	Tags        *[]string           `json:"tags,omitempty"`
+	SourceURL   *string             `json:"source_url,omitempty"`
+}
+
+// ImportRecipeRequest carries schema.org Recipe JSON-LD, or a page of HTML
+// containing it, pasted in as text
+type ImportRecipeRequest struct {
+	Text string `json:"text"`
+}
+
+// ScaledRecipe is a recipe with ingredient quantities scaled to feed a
+// number of people
+type ScaledRecipe struct {
+	Recipe
+	ScaledServings int     `json:"scaled_servings"`
+	Factor         float64 `json:"factor"` // ScaledServings / Servings
+}
+
+// ShoppingList is everything still to be bought for an event, merged across
+// meals and grouped by store section
+type ShoppingList struct {
+	EventID    string                 `json:"event_id"`
+	EventTitle string                 `json:"event_title"`
+	Categories []ShoppingListCategory `json:"categories"`
+}
+
+type ShoppingListCategory struct {
+	Category string             `json:"category"`
+	Items    []ShoppingListItem `json:"items"`
+}
+
+// ShoppingListItem is one line of the shopping list. Key identifies the
+// line across regenerations so purchases can be checked off.
+type ShoppingListItem struct {
+	Key             string               `json:"key"`
+	Name            string               `json:"name"`
+	Quantity        *float64             `json:"quantity"` // nil when no source gave an amount
+	Unit            string               `json:"unit"`
+	Category        string               `json:"category"`
+	Sources         []ShoppingListSource `json:"sources"`
+	Purchased       bool                 `json:"purchased"`
+	PurchasedBy     *string              `json:"purchased_by"`
+	PurchasedByName *string              `json:"purchased_by_name"`
+	PurchasedAt     *time.Time           `json:"purchased_at"`
+}
+
+// ShoppingListSource is a meal item that contributed to a shopping list line
+type ShoppingListSource struct {
+	MealID     string   `json:"meal_id"`
+	MealName   string   `json:"meal_name"`
+	MealDate   *string  `json:"meal_date"`
+	MealItemID string   `json:"meal_item_id"`
+	RecipeID   *string  `json:"recipe_id,omitempty"` // Set when the line is an ingredient of the item's recipe
+	Quantity   *float64 `json:"quantity"`
+	Unit       string   `json:"unit"`
+}
+
+// MarkPurchasedRequest checks a shopping list line off, or back on
+type MarkPurchasedRequest struct {
+	Key       string `json:"key"`
+	Purchased bool   `json:"purchased"`
+}
+
+// Room is a place to sleep on the property: a bedroom, the bunkhouse or a
+// patch of tent space. It sleeps as many people as its beds hold.
+type Room struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Beds        []Bed     `json:"beds"`
+	Capacity    int       `json:"capacity"` // Total of the beds' capacities
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Bed is one bed in a room, e.g. a queen sleeping 2
+type Bed struct {
+	BedType  string `json:"bed_type"` // "king", "queen", "double", "twin", "bunk", "sofa_bed", "air_mattress", "crib", "tent", "other"
+	Capacity int    `json:"capacity"`
+	Label    string `json:"label"` // e.g. "top bunk"
+}
+
+type CreateRoomRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Beds        []Bed  `json:"beds"`
+}
+
+type UpdateRoomRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Beds        *[]Bed  `json:"beds,omitempty"`
+}
+
+// SleepingAssignment puts an attendee's party in a room for one night.
+// Night is the date the night starts on.
+type SleepingAssignment struct {
+	ID           string    `json:"id"`
+	EventID      string    `json:"event_id"`
+	AttendeeID   string    `json:"attendee_id"`
+	AttendeeName string    `json:"attendee_name"`
+	PartySize    int       `json:"party_size"`
+	RoomID       string    `json:"room_id"`
+	RoomName     string    `json:"room_name"`
+	Night        string    `json:"night"` // YYYY-MM-DD
+	CreatedBy    *string   `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AssignSleepingRequest puts an attendee in a room for some nights, or for
+// every night of their stay if none are listed. Replace moves them out of
+// rooms they're already in on those nights; otherwise that is a conflict.
+type AssignSleepingRequest struct {
+	AttendeeID string   `json:"attendee_id"`
+	RoomID     string   `json:"room_id"`
+	Nights     []string `json:"nights"`
+	Replace    bool     `json:"replace"`
+}
+
+// NightLodging is who sleeps where on one night of an event
+type NightLodging struct {
+	Night      string           `json:"night"`
+	Rooms      []RoomOccupancy  `json:"rooms"`
+	Unassigned []LodgingGuest   `json:"unassigned"` // Staying the night with no room yet
+	Warnings   []LodgingWarning `json:"warnings"`
+}
+
+// RoomOccupancy is one room on one night
+type RoomOccupancy struct {
+	RoomID       string               `json:"room_id"`
+	RoomName     string               `json:"room_name"`
+	Capacity     int                  `json:"capacity"`
+	Occupied     int                  `json:"occupied"`
+	OverCapacity bool                 `json:"over_capacity"`
+	Occupants    []SleepingAssignment `json:"occupants"`
+}
+
+type LodgingGuest struct {
+	AttendeeID   string `json:"attendee_id"`
+	AttendeeName string `json:"attendee_name"`
+	PartySize    int    `json:"party_size"`
+}
+
+// LodgingWarning flags an assignment that no longer fits, e.g. because the
+// attendee changed their travel dates or a room lost a bed
+type LodgingWarning struct {
+	AttendeeID   string `json:"attendee_id,omitempty"`
+	AttendeeName string `json:"attendee_name,omitempty"`
+	RoomID       string `json:"room_id,omitempty"`
+	Message      string `json:"message"`
+}
+
+// Ride is a car going to the farm or home, with seats to offer
+type Ride struct {
+	ID               string    `json:"id"`
+	EventID          string    `json:"event_id"`
+	DriverAttendeeID string    `json:"driver_attendee_id"`
+	DriverName       string    `json:"driver_name"`
+	Direction        string    `json:"direction"` // "to_farm" or "home"
+	Origin           string    `json:"origin"`    // Where the ride leaves from
+	DepartureTime    time.Time `json:"departure_time"`
+	Seats            int       `json:"seats"` // Seats for passengers, not counting the driver's own party
+	Notes            string    `json:"notes"`
+	Version          int       `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// RidePassenger is an attendee riding along, or asking to
+type RidePassenger struct {
+	ID           string    `json:"id"`
+	RideID       string    `json:"ride_id"`
+	AttendeeID   string    `json:"attendee_id"`
+	AttendeeName string    `json:"attendee_name"`
+	Seats        int       `json:"seats"`
+	Status       string    `json:"status"` // "requested" or "confirmed"
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RideWithPassengers is a ride with who's in it. Only confirmed passengers
+// take seats.
+type RideWithPassengers struct {
+	Ride
+	Passengers []RidePassenger `json:"passengers"`
+	SeatsTaken int             `json:"seats_taken"`
+	SeatsLeft  int             `json:"seats_left"`
+}
+
+type CreateRideRequest struct {
+	DriverAttendeeID string    `json:"driver_attendee_id"`
+	Direction        string    `json:"direction"`
+	Origin           string    `json:"origin"`
+	DepartureTime    time.Time `json:"departure_time"`
+	Seats            int       `json:"seats"`
+	Notes            string    `json:"notes"`
+}
+
+type UpdateRideRequest struct {
+	Origin        *string    `json:"origin,omitempty"`
+	DepartureTime *time.Time `json:"departure_time,omitempty"`
+	Seats         *int       `json:"seats,omitempty"`
+	Notes         *string    `json:"notes,omitempty"`
+}
+
+// RideSeatRequest claims seats on a ride, or asks the driver for them when
+// Request is set
+type RideSeatRequest struct {
+	AttendeeID string `json:"attendee_id"`
+	Seats      *int   `json:"seats"` // Defaults to the attendee's party size
+	Request    bool   `json:"request"`
+}
+
+// UpdateRidePassengerRequest confirms a request or changes how many seats
+// a passenger takes
+type UpdateRidePassengerRequest struct {
+	Status *string `json:"status,omitempty"`
+	Seats  *int    `json:"seats,omitempty"`
+}
+
+// RideNeed is an attending attendee with no way to the farm or home yet
+type RideNeed struct {
+	AttendeeID   string `json:"attendee_id"`
+	AttendeeName string `json:"attendee_name"`
+	PartySize    int    `json:"party_size"`
+	Direction    string `json:"direction"`
+	Requested    bool   `json:"requested"` // Has asked a driver and is waiting to hear back
+}
+
+// Activity is a timed part of an event's schedule, such as a hike or the
+// bonfire
+type Activity struct {
+	ID               string    `json:"id"`
+	EventID          string    `json:"event_id"`
+	Title            string    `json:"title"`
+	Description      string    `json:"description"`
+	Location         string    `json:"location"`
+	LeaderAttendeeID *string   `json:"leader_attendee_id"`
+	LeaderName       *string   `json:"leader_name"`
+	StartTime        time.Time `json:"start_time"`
+	EndTime          time.Time `json:"end_time"`
+	Capacity         *int      `json:"capacity"` // Most people who can join; nil for no limit
+	Version          int       `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// ActivitySignup is an attendee joining an activity with some of their party
+type ActivitySignup struct {
+	ID           string    `json:"id"`
+	ActivityID   string    `json:"activity_id"`
+	AttendeeID   string    `json:"attendee_id"`
+	AttendeeName string    `json:"attendee_name"`
+	People       int       `json:"people"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// MealOverlap is a meal served while an activity is going on
+type MealOverlap struct {
+	MealID   string    `json:"meal_id"`
+	MealName string    `json:"meal_name"`
+	MealType string    `json:"meal_type"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// ActivityWithSignups is an activity with who's joining and which meals it
+// runs into
+type ActivityWithSignups struct {
+	Activity
+	Signups      []ActivitySignup `json:"signups"`
+	SignedUp     int              `json:"signed_up"`  // People, not signups
+	SpotsLeft    *int             `json:"spots_left"` // nil when there is no capacity
+	MealOverlaps []MealOverlap    `json:"meal_overlaps"`
+}
+
+type CreateActivityRequest struct {
+	Title            string    `json:"title"`
+	Description      string    `json:"description"`
+	Location         string    `json:"location"`
+	LeaderAttendeeID *string   `json:"leader_attendee_id"`
+	StartTime        time.Time `json:"start_time"`
+	EndTime          time.Time `json:"end_time"`
+	Capacity         *int      `json:"capacity"`
+}
+
+type UpdateActivityRequest struct {
+	Title            *string    `json:"title,omitempty"`
+	Description      *string    `json:"description,omitempty"`
+	Location         *string    `json:"location,omitempty"`
+	LeaderAttendeeID *string    `json:"leader_attendee_id,omitempty"` // Empty string clears the leader
+	StartTime        *time.Time `json:"start_time,omitempty"`
+	EndTime          *time.Time `json:"end_time,omitempty"`
+	Capacity         *int       `json:"capacity,omitempty"` // 0 removes the limit
+}
+
+type ActivitySignupRequest struct {
+	AttendeeID string `json:"attendee_id"`
+	People     *int   `json:"people"` // Defaults to the attendee's party size
+}
+
+// ItineraryEntry is one meal, activity or due todo on an event's itinerary
+type ItineraryEntry struct {
+	Kind     string     `json:"kind"` // "meal", "activity" or "todo"
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"` // nil for todos, which are due at Start
+	AllDay   bool       `json:"all_day"`
+	Location string     `json:"location,omitempty"`
+	Detail   string     `json:"detail,omitempty"` // Meal type, activity leader or todo assignee
+}
+
+// ItineraryDay is everything happening on one day of an event, in order
+type ItineraryDay struct {
+	Date    string           `json:"date"` // YYYY-MM-DD in the event's time zone
+	Entries []ItineraryEntry `json:"entries"`
+}
+
+// Itinerary is an event's day-by-day schedule. Undated meals and todos
+// without a due time are listed as unscheduled.
+type Itinerary struct {
+	EventID     string           `json:"event_id"`
+	Days        []ItineraryDay   `json:"days"`
+	Unscheduled []ItineraryEntry `json:"unscheduled"`
+}
+
+// Resource is shared equipment on the property, such as the tractor or the
+// kayaks, that people reserve for a stretch of time
+type Resource struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	Quantity         int       `json:"quantity"`          // How many there are, e.g. 2 kayaks
+	RequiresApproval bool      `json:"requires_approval"` // Reservations wait for an admin, e.g. for the chainsaw
+	Version          int       `json:"version"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type CreateResourceRequest struct {
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	Quantity         *int   `json:"quantity"` // Defaults to 1
+	RequiresApproval bool   `json:"requires_approval"`
+}
+
+type UpdateResourceRequest struct {
+	Name             *string `json:"name,omitempty"`
+	Description      *string `json:"description,omitempty"`
+	Quantity         *int    `json:"quantity,omitempty"`
+	RequiresApproval *bool   `json:"requires_approval,omitempty"`
+}
+
+// Reservation books some of a resource for an attendee of an event
+type Reservation struct {
+	ID           string     `json:"id"`
+	ResourceID   string     `json:"resource_id"`
+	ResourceName string     `json:"resource_name"`
+	EventID      string     `json:"event_id"`
+	EventTitle   string     `json:"event_title"`
+	AttendeeID   string     `json:"attendee_id"`
+	AttendeeName string     `json:"attendee_name"`
+	StartTime    time.Time  `json:"start_time"`
+	EndTime      time.Time  `json:"end_time"`
+	Quantity     int        `json:"quantity"`
+	Status       string     `json:"status"` // "pending", "approved" or "denied"
+	Notes        string     `json:"notes"`
+	CreatedBy    *string    `json:"created_by"`
+	ReviewedBy   *string    `json:"reviewed_by"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type CreateReservationRequest struct {
+	ResourceID string    `json:"resource_id"`
+	AttendeeID string    `json:"attendee_id"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Quantity   *int      `json:"quantity"` // Defaults to 1
+	Notes      string    `json:"notes"`
+}
+
+// ReviewReservationRequest is an admin's decision on a reservation
+type ReviewReservationRequest struct {
+	Status string `json:"status"` // "approved" or "denied"
+}
+
+// ResourceCalendar is a resource with its reservations across all events
+type ResourceCalendar struct {
+	Resource     Resource      `json:"resource"`
+	Reservations []Reservation `json:"reservations"`
+}
+
+// Expense is money one attendee fronted for an event, split among
+// attendees by SplitRule
+type Expense struct {
+	ID              string         `json:"id"`
+	EventID         string         `json:"event_id"`
+	PayerAttendeeID string         `json:"payer_attendee_id"`
+	PayerName       string         `json:"payer_name"`
+	Amount          float64        `json:"amount"`
+	Currency        string         `json:"currency"` // ISO 4217 code, e.g. "USD"
+	Description     string         `json:"description"`
+	MealItemID      *string        `json:"meal_item_id"` // What the money was spent on, if it's on the plan
+	TodoID          *string        `json:"todo_id"`
+	SplitRule       string         `json:"split_rule"` // "equal", "household", "nights", "custom"
+	Shares          []ExpenseShare `json:"shares"`     // Weights for the custom split rule
+	Split           []ExpenseSplit `json:"split"`      // What each attendee owes, computed from the rule
+	CreatedBy       *string        `json:"created_by"`
+	Version         int            `json:"version"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// ExpenseShare weights an attendee's part of a custom split, e.g. 2 shares
+// pays twice as much as 1
+type ExpenseShare struct {
+	AttendeeID   string  `json:"attendee_id"`
+	AttendeeName string  `json:"attendee_name,omitempty"`
+	Shares       float64 `json:"shares"`
+}
+
+// ExpenseSplit is one attendee's part of an expense
+type ExpenseSplit struct {
+	AttendeeID   string  `json:"attendee_id"`
+	AttendeeName string  `json:"attendee_name"`
+	Amount       float64 `json:"amount"`
+}
+
+type CreateExpenseRequest struct {
+	PayerAttendeeID string         `json:"payer_attendee_id"`
+	Amount          float64        `json:"amount"`
+	Currency        string         `json:"currency"` // Defaults to USD
+	Description     string         `json:"description"`
+	MealItemID      *string        `json:"meal_item_id"`
+	TodoID          *string        `json:"todo_id"`
+	SplitRule       string         `json:"split_rule"` // Defaults to equal
+	Shares          []ExpenseShare `json:"shares"`
+}
+
+type UpdateExpenseRequest struct {
+	PayerAttendeeID *string         `json:"payer_attendee_id,omitempty"`
+	Amount          *float64        `json:"amount,omitempty"`
+	Currency        *string         `json:"currency,omitempty"`
+	Description     *string         `json:"description,omitempty"`
+	MealItemID      *string         `json:"meal_item_id,omitempty"` // Empty string unlinks the item
+	TodoID          *string         `json:"todo_id,omitempty"`      // Empty string unlinks the todo
+	SplitRule       *string         `json:"split_rule,omitempty"`
+	Shares          *[]ExpenseShare `json:"shares,omitempty"`
+}
+
+// Settlement is a payment from one attendee to another to settle up
+type Settlement struct {
+	ID             string    `json:"id"`
+	EventID        string    `json:"event_id"`
+	FromAttendeeID string    `json:"from_attendee_id"`
+	FromName       string    `json:"from_name"`
+	ToAttendeeID   string    `json:"to_attendee_id"`
+	ToName         string    `json:"to_name"`
+	Amount         float64   `json:"amount"`
+	Currency       string    `json:"currency"`
+	Note           string    `json:"note"`
+	CreatedBy      *string   `json:"created_by"`
+	PaidAt         time.Time `json:"paid_at"`
+}
+
+// CreateSettlementRequest marks a payment as made, typically one of the
+// suggested transfers from the balances view
+type CreateSettlementRequest struct {
+	FromAttendeeID string  `json:"from_attendee_id"`
+	ToAttendeeID   string  `json:"to_attendee_id"`
+	Amount         float64 `json:"amount"`
+	Currency       string  `json:"currency"` // Defaults to USD
+	Note           string  `json:"note"`
+}
+
+// AttendeeBalance is where an attendee stands in one currency. Net is
+// positive when they are owed money and negative when they owe it.
+type AttendeeBalance struct {
+	AttendeeID   string  `json:"attendee_id"`
+	AttendeeName string  `json:"attendee_name"`
+	Paid         float64 `json:"paid"`     // Expenses they fronted
+	Owed         float64 `json:"owed"`     // Their part of all expenses
+	Sent         float64 `json:"sent"`     // Settlements they paid
+	Received     float64 `json:"received"` // Settlements paid to them
+	Net          float64 `json:"net"`
+}
+
+// SettleUpTransfer is a suggested payment that helps settle balances
+type SettleUpTransfer struct {
+	FromAttendeeID string  `json:"from_attendee_id"`
+	FromName       string  `json:"from_name"`
+	ToAttendeeID   string  `json:"to_attendee_id"`
+	ToName         string  `json:"to_name"`
+	Amount         float64 `json:"amount"`
+	Currency       string  `json:"currency"`
+}
+
+// CurrencyBalances holds the balances of an event in one currency and the
+// transfers that would settle them
+type CurrencyBalances struct {
+	Currency  string             `json:"currency"`
+	Total     float64            `json:"total"` // Sum of expenses
+	Balances  []AttendeeBalance  `json:"balances"`
+	Transfers []SettleUpTransfer `json:"transfers"`
+}
+
+// EventBalances is the balances view of an event. Currencies are settled
+// separately; nothing is converted.
+type EventBalances struct {
+	EventID     string             `json:"event_id"`
+	Currencies  []CurrencyBalances `json:"currencies"`
+	Settlements []Settlement       `json:"settlements"`
 }
 
 // Todo represents a task item for an event
 type Todo struct {
-	ID                   string    `json:"id"`
-	EventID              string    `json:"event_id"`
-	Title                string    `json:"title"`
-	Description          string    `json:"description"`
-	Completed            bool      `json:"completed"`
-	AssignedAttendeeID   *string   `json:"assigned_attendee_id"`
-	AssignedAttendeeName *string   `json:"assigned_attendee_name"`
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+	ID                   string        `json:"id"`
+	EventID              string        `json:"event_id"`
+	Title                string        `json:"title"`
+	Description          string        `json:"description"`
+	Completed            bool          `json:"completed"`
+	AssignedAttendeeID   *string       `json:"assigned_attendee_id"`
+	AssignedAttendeeName *string       `json:"assigned_attendee_name"`
+	DueAt                *time.Time    `json:"due_at"`
+	DueOffsetMinutes     *int          `json:"due_offset_minutes"` // Set when DueAt follows the event's start, e.g. -2880 for two days before
+	Priority             string        `json:"priority"`           // "low", "normal", "high" or "urgent"
+	Category             string        `json:"category"`           // "before_arrival", "on_site", "closing_up" or "" for none
+	Subtasks             []TodoSubtask `json:"subtasks"`
+	DependsOn            []string      `json:"depends_on"`        // IDs of todos in the same event that must be done first
+	Blocked              bool          `json:"blocked"`           // Some prerequisite is still incomplete
+	ChecklistItemID      *string       `json:"checklist_item_id"` // The standing checklist item it came from
+	Checklist            string        `json:"checklist"`         // "arrival", "departure" or "" for one-off todos
+	CompletedAt          *time.Time    `json:"completed_at"`
+	CompletedBy          *string       `json:"completed_by"` // User who checked it off
+	CompletedByName      *string       `json:"completed_by_name"`
+	Version              int           `json:"version"`
+	CreatedAt            time.Time     `json:"created_at"`
+	UpdatedAt            time.Time     `json:"updated_at"`
+	DeletedAt            *time.Time    `json:"deleted_at,omitempty"`
 }
 
+// TodoSubtask is one checklist step within a todo
+type TodoSubtask struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+// CreateTodoRequest creates a todo. At most one of DueAt and
+// DueOffsetMinutes may be set.
 type CreateTodoRequest struct {
-	Title              string  `json:"title"`
-	Description        string  `json:"description"`
-	AssignedAttendeeID *string `json:"assigned_attendee_id"`
+	Title              string        `json:"title"`
+	Description        string        `json:"description"`
+	AssignedAttendeeID *string       `json:"assigned_attendee_id"`
+	DueAt              *time.Time    `json:"due_at"`
+	DueOffsetMinutes   *int          `json:"due_offset_minutes"` // Due this many minutes after the event starts; negative for before
+	Priority           string        `json:"priority"`           // Defaults to "normal"
+	Category           string        `json:"category"`
+	Subtasks           []TodoSubtask `json:"subtasks"`
+	DependsOn          []string      `json:"depends_on"`
 }
 
 type UpdateTodoRequest struct {
-	Title              *string `json:"title,omitempty"`
-	Description        *string `json:"description,omitempty"`
-	Completed          *bool   `json:"completed,omitempty"`
-	AssignedAttendeeID *string `json:"assigned_attendee_id,omitempty"`
+	Title              *string        `json:"title,omitempty"`
+	Description        *string        `json:"description,omitempty"`
+	Completed          *bool          `json:"completed,omitempty"`
+	AssignedAttendeeID *string        `json:"assigned_attendee_id,omitempty"`
+	DueAt              *time.Time     `json:"due_at,omitempty"`
+	DueOffsetMinutes   *int           `json:"due_offset_minutes,omitempty"` // Replaces any fixed due time
+	ClearDue           bool           `json:"clear_due,omitempty"`          // Removes the due time and offset
+	Priority           *string        `json:"priority,omitempty"`
+	Category           *string        `json:"category,omitempty"`
+	Subtasks           *[]TodoSubtask `json:"subtasks,omitempty"`   // Replaces the whole checklist
+	DependsOn          *[]string      `json:"depends_on,omitempty"` // Replaces all prerequisites
+	Override           bool           `json:"override,omitempty"`   // Allows completing a blocked todo
+}
+
+// TodoPlan orders an event's open todos so prerequisites come first
+type TodoPlan struct {
+	Ready   []Todo `json:"ready"`   // Can be done right now
+	Blocked []Todo `json:"blocked"` // Waiting on other todos
+}
+
+// ChorePreferences are an attendee's wishes for automatic chore
+// assignment. Keywords match todo titles and categories, meal item names
+// and meal types, e.g. "dishes" or "breakfast".
+type ChorePreferences struct {
+	AttendeeID string   `json:"attendee_id"`
+	Prefers    []string `json:"prefers"` // Favored when the load is otherwise close
+	Avoids     []string `json:"avoids"`  // Never assigned anything matching
+	Exempt     bool     `json:"exempt"`  // Left out of automatic assignment, e.g. small children
+}
+
+type UpdateChorePreferencesRequest struct {
+	Prefers []string `json:"prefers"`
+	Avoids  []string `json:"avoids"`
+	Exempt  bool     `json:"exempt"`
+}
+
+// ProposedAssignment is one chore the assignment engine would hand out,
+// with why it picked that attendee
+type ProposedAssignment struct {
+	Kind         string `json:"kind"` // "todo" or "meal_item"
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	AttendeeID   string `json:"attendee_id"`
+	AttendeeName string `json:"attendee_name"`
+	Reason       string `json:"reason"`
+}
+
+// UnassignedChore is a chore the assignment engine found nobody for
+type UnassignedChore struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+}
+
+// AttendeeWorkload is how many chores an attendee has done and would do
+type AttendeeWorkload struct {
+	AttendeeID   string  `json:"attendee_id"`
+	AttendeeName string  `json:"attendee_name"`
+	PastEvents   int     `json:"past_events"`  // Earlier events they attended, matched by email
+	PastAverage  float64 `json:"past_average"` // Chores per earlier event
+	Current      int     `json:"current"`      // Chores already theirs at this event
+	Proposed     int     `json:"proposed"`     // Chores the proposal adds
+}
+
+// AssignmentProposal is the assignment engine's suggestion for the
+// unassigned todos and uncovered meal items of an event. Nothing changes
+// until the owner applies it.
+type AssignmentProposal struct {
+	EventID     string               `json:"event_id"`
+	Assignments []ProposedAssignment `json:"assignments"`
+	Unassigned  []UnassignedChore    `json:"unassigned"`
+	Workload    []AttendeeWorkload   `json:"workload"`
+}
+
+// ApplyAssignmentsRequest applies the chosen entries of a proposal. Only
+// kind, id and attendee_id are read; reasons come from the engine.
+type ApplyAssignmentsRequest struct {
+	Assignments []ProposedAssignment `json:"assignments"`
+}
+
+// AssignmentLogEntry records an applied assignment and why it was made
+type AssignmentLogEntry struct {
+	ID            string    `json:"id"`
+	EventID       string    `json:"event_id"`
+	Kind          string    `json:"kind"`
+	EntityID      string    `json:"entity_id"`
+	Title         string    `json:"title"`
+	AttendeeID    *string   `json:"attendee_id"` // Nil once the attendee is removed
+	AttendeeName  string    `json:"attendee_name"`
+	Reason        string    `json:"reason"`
+	AppliedBy     *string   `json:"applied_by"`
+	AppliedByName *string   `json:"applied_by_name"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// AssignmentResult reports which proposed assignments were applied. Ones
+// the engine no longer proposes, such as chores taken, finished or removed
+// in the meantime, are skipped.
+type AssignmentResult struct {
+	Applied []AssignmentLogEntry `json:"applied"`
+	Skipped []ProposedAssignment `json:"skipped"`
+}
+
+// ChecklistItem is a standing chore, such as shutting off the water, that
+// every event gets as a todo on arrival or departure
+type ChecklistItem struct {
+	ID          string    `json:"id"`
+	Phase       string    `json:"phase"` // "arrival" or "departure"
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Priority    string    `json:"priority"`
+	Position    int       `json:"position"` // Order within the phase
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CreateChecklistItemRequest struct {
+	Phase       string `json:"phase"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Priority    string `json:"priority"` // Defaults to "normal"
+	Position    *int   `json:"position"` // Defaults to the end of the phase
+}
+
+type UpdateChecklistItemRequest struct {
+	Phase       *string `json:"phase,omitempty"`
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Priority    *string `json:"priority,omitempty"`
+	Position    *int    `json:"position,omitempty"`
+}
+
+// ChecklistPropagation counts what bringing upcoming events in line with
+// the standing checklists changed
+type ChecklistPropagation struct {
+	Events  int `json:"events"`  // Upcoming events checked
+	Added   int `json:"added"`   // Todos created for new checklist items
+	Updated int `json:"updated"` // Open todos changed to match their item
+	Removed int `json:"removed"` // Open todos trashed because their item was deleted
+	Skipped int `json:"skipped"` // Open todos left alone because someone changed them meanwhile
+}
+
+// ChecklistRun is how far one event got through its standing checklists
+type ChecklistRun struct {
+	EventID    string    `json:"event_id"`
+	EventTitle string    `json:"event_title"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Total      int       `json:"total"`
+	Completed  int       `json:"completed"`
+	Todos      []Todo    `json:"todos"` // In checklist order, with who completed each and when
+}
+
+// TodoFilter narrows and orders an event's todo list; empty fields are ignored
+type TodoFilter struct {
+	Completed  *bool
+	Priority   string
+	Category   string
+	AssigneeID string // An attendee ID, or "none" for unassigned todos
+	Checklist  string // "arrival" or "departure"
+	DueBefore  *time.Time
+	Sort       string // "due", "priority", "title" or "created"; completed todos sink to the bottom by default
+	Descending bool
 }
 
 // EventWithAll extends EventWithMeals to include todos
 type EventWithAll struct {
 	EventWithMeals
-	Todos []Todo `json:"todos"`
+	Households   []HouseholdWithMembers `json:"households"`
+	Rides        []RideWithPassengers   `json:"rides"`
+	Reservations []Reservation          `json:"reservations"`
+	Todos        []Todo                 `json:"todos"`
+}
+
+// EventTrash lists the deleted meals, meal items and todos of an event
+type EventTrash struct {
+	Meals     []Meal     `json:"meals"`
+	MealItems []MealItem `json:"meal_items"`
+	Todos     []Todo     `json:"todos"`
+}
+
+// AuditEntry is one append-only record of a create, update or delete
+type AuditEntry struct {
+	ID          string          `json:"id"`
+	ActorUserID *string         `json:"actor_user_id"`
+	ActorName   *string         `json:"actor_name"`
+	Action      string          `json:"action"`      // "create", "update", "delete", "restore", "purge"
+	EntityType  string          `json:"entity_type"` // "event", "attendee", "meal", "meal_item", "meal_signup", "todo", "user"
+	EntityID    string          `json:"entity_id"`
+	EventID     *string         `json:"event_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	Changes     json.RawMessage `json:"changes"` // Changed fields as {"field": {"before": ..., "after": ...}}
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// AuditFieldChange holds the before and after value of a single field
+type AuditFieldChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditLogFilter narrows an audit log query; empty fields are ignored
+type AuditLogFilter struct {
+	EventID     string
+	ActorUserID string
+	EntityType  string
+	EntityID    string
+	Action      string
+	Since       *time.Time
+	Until       *time.Time
+	Limit       int
+	Offset      int
+}
+
+// AuditLogPage is a page of audit entries, newest first
+type AuditLogPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+// UserStats sums up what one person has done across events. Attendee
+// entries count as theirs when the email matches.
+type UserStats struct {
+	UserID         string `json:"user_id"`
+	Name           string `json:"name"`
+	EventsAttended int    `json:"events_attended"`
+	MealsSignedUp  int    `json:"meals_signed_up"` // Meals they signed up to bring something for
+	ItemsBrought   int    `json:"items_brought"`   // Meal items assigned to them or signed up for
+	TodosCompleted int    `json:"todos_completed"`
+	NightsStayed   int    `json:"nights_stayed"`
+}
+
+// EventStats summarizes turnout and how well one event was covered
+type EventStats struct {
+	EventID        string    `json:"event_id"`
+	Title          string    `json:"title"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	Attendees      int       `json:"attendees"`       // Attending entries
+	Headcount      int       `json:"headcount"`       // People, counting each entry's whole party
+	PersonNights   int       `json:"person_nights"`   // Nights stayed times party size
+	MealItems      int       `json:"meal_items"`      // Items on the meal plan
+	CoveredItems   int       `json:"covered_items"`   // Items fully brought, or bought by the host
+	Coverage       float64   `json:"coverage"`        // Percentage of items covered
+	Todos          int       `json:"todos"`           // Todos, done or not
+	CompletedTodos int       `json:"completed_todos"` // Todos checked off
+	TodoCompletion float64   `json:"todo_completion"` // Percentage of todos completed
+}
+
+// YearlyReport rolls up every event that started in a calendar year
+type YearlyReport struct {
+	Year            int          `json:"year"`
+	Events          int          `json:"events"`
+	People          int          `json:"people"` // Different people who attended, by email
+	Headcount       int          `json:"headcount"`
+	PersonNights    int          `json:"person_nights"`
+	MealItems       int          `json:"meal_items"`
+	CoveredItems    int          `json:"covered_items"`
+	Coverage        float64      `json:"coverage"`
+	Todos           int          `json:"todos"`
+	CompletedTodos  int          `json:"completed_todos"`
+	TodoCompletion  float64      `json:"todo_completion"`
+	EventStats      []EventStats `json:"event_stats"`      // By start time
+	TopContributors []UserStats  `json:"top_contributors"` // Most items brought plus todos completed
+}
+
+// Comment is one message in the discussion thread of an event, meal, meal
+// item or todo. Replies point at their parent; a deleted comment that still
+// has replies stays in the thread with its body removed.
+type Comment struct {
+	ID         string           `json:"id"`
+	EventID    string           `json:"event_id"`
+	EntityType string           `json:"entity_type"` // "event", "meal", "meal_item" or "todo"
+	EntityID   string           `json:"entity_id"`
+	ParentID   *string          `json:"parent_id"`
+	AuthorID   *string          `json:"author_id"`
+	AuthorName *string          `json:"author_name"`
+	Body       string           `json:"body"`
+	Mentions   []CommentMention `json:"mentions"` // Attendees named with @ in the body
+	Unread     bool             `json:"unread"`   // Newer than the viewer last read the thread
+	Version    int              `json:"version"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+	EditedAt   *time.Time       `json:"edited_at,omitempty"`
+	DeletedAt  *time.Time       `json:"deleted_at,omitempty"`
+	Replies    []Comment        `json:"replies,omitempty"` // Oldest first
+}
+
+// CommentMention is an attendee named in a comment
+type CommentMention struct {
+	AttendeeID string `json:"attendee_id"`
+	Name       string `json:"name"`
+}
+
+// CommentThread is the discussion attached to one thing, top-level
+// comments oldest first
+type CommentThread struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   string    `json:"entity_id"`
+	Comments   []Comment `json:"comments"`
+	Unread     int       `json:"unread"`
+}
+
+type CreateCommentRequest struct {
+	EntityType string  `json:"entity_type"` // Defaults to the event itself
+	EntityID   string  `json:"entity_id"`
+	ParentID   *string `json:"parent_id"` // Comment being replied to, in the same thread
+	Body       string  `json:"body"`
+}
+
+type UpdateCommentRequest struct {
+	Body string `json:"body"`
+}
+
+type MarkCommentsReadRequest struct {
+	EntityType string `json:"entity_type"` // Defaults to the event itself
+	EntityID   string `json:"entity_id"`
+}
+
+// UnreadComments counts the comments in one thread the viewer hasn't read
+type UnreadComments struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   string    `json:"entity_id"`
+	Unread     int       `json:"unread"`
+	Mentions   int       `json:"mentions"` // Unread comments naming the viewer
+	LatestAt   time.Time `json:"latest_at"`
+}
+
+// Change is one entry in an event's change feed: something was created,
+// updated or deleted. It only says what changed, so clients refetch it;
+// who changed it and how stays in the owner-only history.
+type Change struct {
+	ID         string    `json:"id"`
+	Action     string    `json:"action"`
+	EntityType string    `json:"entity_type"`
+	EntityID   string    `json:"entity_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ChangeFeed is a batch of changes in the order they were written. Poll
+// again with Cursor to get what happened next.
+type ChangeFeed struct {
+	Changes []Change `json:"changes"`
+	Cursor  string   `json:"cursor"` // Opaque position after the last change
+	More    bool     `json:"more"`   // The batch was cut off at the limit
 }
@@ -0,0 +1,305 @@
+// Package recipeimport reads recipes pasted from recipe sites, which
+// publish them as schema.org Recipe JSON-LD.
+package recipeimport
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"farm-time/internal/models"
+	"farm-time/internal/units"
+)
+
+// ErrNoRecipe is returned when pasted text has no schema.org Recipe in it
+var ErrNoRecipe = errors.New("no schema.org Recipe found")
+
+// defaultImportServings is used when a recipe doesn't say how many it serves
+const defaultImportServings = 4
+
+var ldScriptPattern = regexp.MustCompile(`(?is)<script[^>]*application/ld\+json[^>]*>(.*?)</script>`)
+
+// countUnits are ingredient units that aren't measures but still shouldn't be
+// read as part of the ingredient's name
+var countUnits = map[string]bool{
+	"can": true, "clove": true, "bag": true, "package": true, "pkg": true, "pinch": true, "dash": true,
+	"slice": true, "bunch": true, "head": true, "stick": true, "dozen": true, "jar": true, "bottle": true,
+	"box": true, "sprig": true, "handful": true, "piece": true, "packet": true, "container": true,
+}
+
+var unicodeFractions = strings.NewReplacer(
+	"½", " 1/2", "⅓", " 1/3", "⅔", " 2/3", "¼", " 1/4", "¾", " 3/4",
+	"⅛", " 1/8", "⅜", " 3/8", "⅝", " 5/8", "⅞", " 7/8", "⅕", " 1/5",
+)
+
+// ParseJSONLD reads a schema.org Recipe from JSON-LD, or from HTML with
+// JSON-LD script blocks in it, into a request to create the recipe. The only
+// error is ErrNoRecipe.
+func ParseJSONLD(text string) (*models.CreateRecipeRequest, error) {
+	text = strings.TrimSpace(text)
+	blocks := []string{text}
+	if !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "[") {
+		blocks = nil
+		for _, m := range ldScriptPattern.FindAllStringSubmatch(text, -1) {
+			blocks = append(blocks, m[1])
+		}
+	}
+
+	for _, block := range blocks {
+		var doc any
+		if err := json.Unmarshal([]byte(block), &doc); err != nil {
+			continue
+		}
+		if node := findRecipeNode(doc); node != nil {
+			return recipeFromNode(node), nil
+		}
+	}
+	return nil, ErrNoRecipe
+}
+
+// findRecipeNode searches a JSON-LD document, including @graph lists, for
+// the first node typed Recipe
+func findRecipeNode(v any) map[string]any {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			if node := findRecipeNode(item); node != nil {
+				return node
+			}
+		}
+	case map[string]any:
+		for _, t := range ldStrings(v["@type"]) {
+			if t == "Recipe" {
+				return v
+			}
+		}
+		for _, child := range v {
+			if node := findRecipeNode(child); node != nil {
+				return node
+			}
+		}
+	}
+	return nil
+}
+
+func recipeFromNode(node map[string]any) *models.CreateRecipeRequest {
+	req := &models.CreateRecipeRequest{
+		Name:        ldText(node["name"]),
+		Description: ldText(node["description"]),
+		Servings:    defaultImportServings,
+		Ingredients: []models.RecipeIngredient{},
+	}
+
+	for _, y := range ldStrings(node["recipeYield"]) {
+		if n := leadingInt(y); n > 0 {
+			req.Servings = n
+			break
+		}
+	}
+
+	ingredients := node["recipeIngredient"]
+	if ingredients == nil {
+		ingredients = node["ingredients"]
+	}
+	for _, line := range ldStrings(ingredients) {
+		if ing, ok := parseIngredientLine(html.UnescapeString(line)); ok {
+			req.Ingredients = append(req.Ingredients, ing)
+		}
+	}
+
+	req.Steps = ldSteps(node["recipeInstructions"])
+
+	var tags []string
+	for _, kw := range ldStrings(node["keywords"]) {
+		tags = append(tags, strings.Split(kw, ",")...)
+	}
+	tags = append(tags, ldStrings(node["recipeCategory"])...)
+	tags = append(tags, ldStrings(node["recipeCuisine"])...)
+	req.Tags = cleanTags(tags)
+
+	req.SourceURL = ldText(node["url"])
+	if req.SourceURL == "" {
+		if page, ok := node["mainEntityOfPage"].(map[string]any); ok {
+			req.SourceURL = ldText(page["@id"])
+		} else {
+			req.SourceURL = ldText(node["mainEntityOfPage"])
+		}
+	}
+
+	return req
+}
+
+// ldStrings flattens a JSON-LD value that may be a string, a number or a
+// list of them
+func ldStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []any:
+		var out []string
+		for _, item := range v {
+			out = append(out, ldStrings(item)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func ldText(v any) string {
+	if values := ldStrings(v); len(values) > 0 {
+		return strings.TrimSpace(html.UnescapeString(values[0]))
+	}
+	return ""
+}
+
+// ldSteps reads recipeInstructions, which sites give as one string, a list
+// of strings, HowToStep objects or HowToSections of steps
+func ldSteps(v any) []string {
+	var steps []string
+	switch v := v.(type) {
+	case string:
+		steps = strings.Split(html.UnescapeString(v), "\n")
+	case []any:
+		for _, item := range v {
+			steps = append(steps, ldSteps(item)...)
+		}
+	case map[string]any:
+		if list, ok := v["itemListElement"]; ok {
+			steps = append(steps, ldSteps(list)...)
+		} else if text := ldText(v["text"]); text != "" {
+			steps = append(steps, text)
+		} else {
+			steps = append(steps, ldText(v["name"]))
+		}
+	}
+
+	cleaned := []string{}
+	for _, step := range steps {
+		if step = strings.TrimSpace(step); step != "" {
+			cleaned = append(cleaned, step)
+		}
+	}
+	return cleaned
+}
+
+func leadingInt(s string) int {
+	for _, field := range strings.Fields(s) {
+		if n, err := strconv.Atoi(strings.Trim(field, "()-")); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// parseAmount reads "2", "1.5", "1/2" or a range like "2-3" (taking the
+// larger end, so the shopping list doesn't come up short)
+func parseAmount(token string) (float64, bool) {
+	if lo, hi, ok := strings.Cut(token, "-"); ok && lo != "" {
+		if _, ok := parseAmount(lo); ok {
+			return parseAmount(hi)
+		}
+		return 0, false
+	}
+	if num, den, ok := strings.Cut(token, "/"); ok {
+		n, err1 := strconv.ParseFloat(num, 64)
+		d, err2 := strconv.ParseFloat(den, 64)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0, false
+		}
+		return n / d, true
+	}
+	f, err := strconv.ParseFloat(token, 64)
+	return f, err == nil && f > 0
+}
+
+// parseIngredientLine splits a line like "1 1/2 cups flour, sifted" into
+// quantity, unit, name and note
+func parseIngredientLine(line string) (models.RecipeIngredient, bool) {
+	line = strings.Join(strings.Fields(unicodeFractions.Replace(line)), " ")
+	if line == "" {
+		return models.RecipeIngredient{}, false
+	}
+
+	var ing models.RecipeIngredient
+	var notes []string
+	fields := strings.Fields(line)
+
+	// Quantity: one or more amounts added together, as in "1 1/2"
+	var total float64
+	i := 0
+	for ; i < len(fields); i++ {
+		amount, ok := parseAmount(fields[i])
+		if !ok {
+			break
+		}
+		total += amount
+	}
+	if i > 0 {
+		q := units.Round(total)
+		ing.Quantity = &q
+	}
+
+	// A parenthetical package size such as "(15 oz)" belongs in the note
+	if i < len(fields) && strings.HasPrefix(fields[i], "(") {
+		j := i
+		for j < len(fields) && !strings.HasSuffix(fields[j], ")") {
+			j++
+		}
+		if j < len(fields) {
+			notes = append(notes, strings.Trim(strings.Join(fields[i:j+1], " "), "()"))
+			i = j + 1
+		}
+	}
+
+	// Unit: a known measure ("tbsp", "fl oz") or count word ("cans")
+	if ing.Quantity != nil && i < len(fields) {
+		if i+1 < len(fields) {
+			two := strings.ToLower(fields[i] + " " + fields[i+1])
+			if u := units.Normalize(two); !u.IsCount() {
+				ing.Unit = u.Name
+				i += 2
+			}
+		}
+		if ing.Unit == "" {
+			word := strings.ToLower(strings.TrimSuffix(fields[i], "."))
+			u := units.Normalize(word)
+			if !u.IsCount() || countUnits[u.Name] {
+				ing.Unit = u.Name
+				i++
+			}
+		}
+	}
+
+	rest := strings.Join(fields[i:], " ")
+	rest = strings.TrimPrefix(rest, "of ")
+	if name, note, ok := strings.Cut(rest, ","); ok {
+		rest = name
+		notes = append(notes, strings.TrimSpace(note))
+	}
+	ing.Name = strings.TrimSpace(rest)
+	ing.Note = strings.Join(notes, "; ")
+	if ing.Name == "" {
+		return models.RecipeIngredient{}, false
+	}
+	return ing, true
+}
+
+// cleanTags lowercases and trims tags, dropping empty and repeated ones
+func cleanTags(tags []string) []string {
+	cleaned := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		cleaned = append(cleaned, tag)
+	}
+	return cleaned
+}
@@ -0,0 +1,96 @@
+// Package units normalizes, converts and rounds the units of measure used
+// in recipes and shopping lists.
+package units
+
+import (
+	"math"
+	"strings"
+)
+
+// Unit describes a unit of measure. Units of the same Dimension can be
+// added together after converting by Factor, which is relative to the
+// dimension's base unit (grams for mass, millilitres for volume).
+type Unit struct {
+	Name      string
+	Dimension string
+	Factor    float64
+}
+
+var measureUnits = map[string]Unit{
+	"g":     {"g", "mass", 1},
+	"kg":    {"kg", "mass", 1000},
+	"oz":    {"oz", "mass", 28.3495},
+	"lb":    {"lb", "mass", 453.592},
+	"ml":    {"ml", "volume", 1},
+	"l":     {"l", "volume", 1000},
+	"tsp":   {"tsp", "volume", 4.92892},
+	"tbsp":  {"tbsp", "volume", 14.7868},
+	"cup":   {"cup", "volume", 236.588},
+	"pt":    {"pt", "volume", 473.176},
+	"qt":    {"qt", "volume", 946.353},
+	"gal":   {"gal", "volume", 3785.41},
+	"fl oz": {"fl oz", "volume", 29.5735},
+}
+
+// unitAliases maps spellings people type to the names in measureUnits
+var unitAliases = map[string]string{
+	"gram": "g", "grams": "g", "gr": "g",
+	"kilogram": "kg", "kilograms": "kg", "kilo": "kg", "kilos": "kg", "kgs": "kg",
+	"ounce": "oz", "ounces": "oz",
+	"pound": "lb", "pounds": "lb", "lbs": "lb",
+	"milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml",
+	"liter": "l", "liters": "l", "litre": "l", "litres": "l",
+	"teaspoon": "tsp", "teaspoons": "tsp", "tsps": "tsp",
+	"tablespoon": "tbsp", "tablespoons": "tbsp", "tbsps": "tbsp", "tbs": "tbsp",
+	"cups": "cup", "c": "cup",
+	"pint": "pt", "pints": "pt",
+	"quart": "qt", "quarts": "qt",
+	"gallon": "gal", "gallons": "gal",
+	"fluid ounce": "fl oz", "fluid ounces": "fl oz", "floz": "fl oz",
+}
+
+// Normalize returns the canonical form of a unit. Units that aren't
+// measures ("bags", "dozen", "") are counts of their own, singularized so
+// "bag" and "bags" merge.
+func Normalize(unit string) Unit {
+	u := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(unit), ".")))
+	if alias, ok := unitAliases[u]; ok {
+		u = alias
+	}
+	if info, ok := measureUnits[u]; ok {
+		return info
+	}
+	u = Singular(u)
+	return Unit{Name: u, Dimension: "count:" + u, Factor: 1}
+}
+
+// IsCount reports whether u counts things rather than measuring them
+func (u Unit) IsCount() bool {
+	return strings.HasPrefix(u.Dimension, "count:")
+}
+
+// Convert converts an amount between two units of the same dimension
+func Convert(amount float64, from, to Unit) float64 {
+	return amount * from.Factor / to.Factor
+}
+
+// Round rounds a converted or scaled amount to two decimal places
+func Round(q float64) float64 {
+	return math.Round(q*100) / 100
+}
+
+// Singular strips a plain English plural, which is enough for units and
+// grocery names ("bags", "tomatoes", "berries")
+func Singular(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		return strings.TrimSuffix(word, "ies") + "y"
+	case strings.HasSuffix(word, "oes"):
+		return strings.TrimSuffix(word, "es")
+	case strings.HasSuffix(word, "ss"):
+		return word
+	case strings.HasSuffix(word, "s") && len(word) > 3:
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
@@ -0,0 +1,974 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"farm-time/internal/models"
+)
+
+// Allowed values for enum fields
+var (
+	AttendeeStatuses  = []string{"attending", "maybe", "declined"}
+	MealTypes         = []string{"breakfast", "lunch", "dinner", "snacks", "other"}
+	MealAttendances   = []string{"in", "out", "unknown"}
+	SplitRules        = []string{"equal", "household", "nights", "custom"}
+	BedTypes          = []string{"king", "queen", "double", "twin", "bunk", "sofa_bed", "air_mattress", "crib", "tent", "other"}
+	RideDirections    = []string{"to_farm", "home"}
+	PassengerStatuses = []string{"requested", "confirmed"}
+	ReviewStatuses    = []string{"approved", "denied"}
+	TodoPriorities    = []string{"low", "normal", "high", "urgent"}
+	TodoCategories    = []string{"before_arrival", "on_site", "closing_up"}
+	TodoSorts         = []string{"due", "priority", "title", "created"}
+	ChecklistPhases   = []string{"arrival", "departure"}
+	ChoreKinds        = []string{"todo", "meal_item"}
+	CommentTargets    = []string{"event", "meal", "meal_item", "todo"}
+)
+
+// Events
+
+func CreateEvent(req models.CreateEventRequest) error {
+	v := newValidator()
+	v.required("title", req.Title)
+	v.maxLength("title", req.Title, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	v.maxLength("location", req.Location, maxNameLength)
+	v.requiredTime("start_time", req.StartTime)
+	v.requiredTime("end_time", req.EndTime)
+	v.timeRange("start_time", req.StartTime, "end_time", req.EndTime)
+	if req.TimeZone != "" {
+		v.timeZone("time_zone", req.TimeZone)
+	}
+	return v.err()
+}
+
+// UpdateEvent validates req as it would apply on top of the current event
+func UpdateEvent(req models.UpdateEventRequest, current models.Event) error {
+	v := newValidator()
+	if req.Title != nil {
+		v.required("title", *req.Title)
+		v.maxLength("title", *req.Title, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	if req.Location != nil {
+		v.maxLength("location", *req.Location, maxNameLength)
+	}
+	if req.TimeZone != nil {
+		v.required("time_zone", *req.TimeZone)
+		if *req.TimeZone != "" {
+			v.timeZone("time_zone", *req.TimeZone)
+		}
+	}
+
+	start, end := current.StartTime, current.EndTime
+	if req.StartTime != nil {
+		v.requiredTime("start_time", *req.StartTime)
+		start = *req.StartTime
+	}
+	if req.EndTime != nil {
+		v.requiredTime("end_time", *req.EndTime)
+		end = *req.EndTime
+	}
+	v.timeRange("start_time", start, "end_time", end)
+	return v.err()
+}
+
+// CreateBookingRequest checks a request for the farm's dates
+func CreateBookingRequest(req models.CreateBookingRequestRequest) error {
+	v := newValidator()
+	v.required("title", req.Title)
+	v.maxLength("title", req.Title, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	v.requiredTime("start_time", req.StartTime)
+	v.requiredTime("end_time", req.EndTime)
+	v.timeRange("start_time", req.StartTime, "end_time", req.EndTime)
+	return v.err()
+}
+
+func ReviewBookingRequest(req models.ReviewBookingRequestRequest) error {
+	v := newValidator()
+	v.oneOf("status", req.Status, ReviewStatuses)
+	v.maxLength("note", req.Note, maxTextLength)
+	return v.err()
+}
+
+// Attendees
+
+// CreateAttendee validates req against the event the attendee is joining.
+// Email is optional for attendees joining a household.
+func CreateAttendee(req models.CreateAttendeeRequest, event models.Event) error {
+	v := newValidator()
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	if req.HouseholdID == nil {
+		v.required("email", req.Email)
+	}
+	if req.Email != "" {
+		v.email("email", req.Email)
+	}
+	adults, children := 1, 0
+	if req.Adults != nil {
+		adults = *req.Adults
+	}
+	if req.Children != nil {
+		children = *req.Children
+	}
+	v.partySize(adults, children)
+	if req.Status != "" {
+		v.oneOf("status", req.Status, AttendeeStatuses)
+	}
+	v.tags("dietary_restrictions", req.DietaryRestrictions)
+	v.tags("allergies", req.Allergies)
+	v.maxLength("dietary_notes", req.DietaryNotes, maxTextLength)
+
+	arrival, departure := event.StartTime, event.EndTime
+	if req.ArrivalTime != nil {
+		v.requiredTime("arrival_time", *req.ArrivalTime)
+		arrival = *req.ArrivalTime
+	}
+	if req.DepartureTime != nil {
+		v.requiredTime("departure_time", *req.DepartureTime)
+		departure = *req.DepartureTime
+	}
+	v.timeRange("arrival_time", arrival, "departure_time", departure)
+	return v.err()
+}
+
+// UpdateAttendee validates req as it would apply on top of the current
+// attendee. primary is set when they are their household's primary contact.
+func UpdateAttendee(req models.UpdateAttendeeRequest, current models.Attendee, primary bool) error {
+	v := newValidator()
+	if req.Name != nil {
+		v.required("name", *req.Name)
+		v.maxLength("name", *req.Name, maxNameLength)
+	}
+
+	email, inHousehold := current.Email, current.HouseholdID != nil
+	if req.Email != nil {
+		email = *req.Email
+	}
+	if req.HouseholdID != nil {
+		inHousehold = *req.HouseholdID != ""
+		primary = primary && *req.HouseholdID == *current.HouseholdID
+	}
+	if email == "" {
+		if !inHousehold {
+			v.fail("email", "is required for attendees outside a household")
+		} else if primary {
+			v.fail("email", "is required for a household's primary contact")
+		}
+	} else if req.Email != nil {
+		v.email("email", email)
+	}
+
+	adults, children := current.Adults, current.Children
+	if req.Adults != nil {
+		adults = *req.Adults
+	}
+	if req.Children != nil {
+		children = *req.Children
+	}
+	v.partySize(adults, children)
+	if req.Status != nil {
+		v.oneOf("status", *req.Status, AttendeeStatuses)
+	}
+	if req.DietaryRestrictions != nil {
+		v.tags("dietary_restrictions", *req.DietaryRestrictions)
+	}
+	if req.Allergies != nil {
+		v.tags("allergies", *req.Allergies)
+	}
+	if req.DietaryNotes != nil {
+		v.maxLength("dietary_notes", *req.DietaryNotes, maxTextLength)
+	}
+
+	arrival, departure := current.ArrivalTime, current.DepartureTime
+	if req.ArrivalTime != nil {
+		v.requiredTime("arrival_time", *req.ArrivalTime)
+		arrival = *req.ArrivalTime
+	}
+	if req.DepartureTime != nil {
+		v.requiredTime("departure_time", *req.DepartureTime)
+		departure = *req.DepartureTime
+	}
+	v.timeRange("arrival_time", arrival, "departure_time", departure)
+	return v.err()
+}
+
+// Households
+
+// CreateHousehold validates req. primary is the attendee named as the
+// household's contact, if any.
+func CreateHousehold(req models.CreateHouseholdRequest, primary *models.Attendee) error {
+	v := newValidator()
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	if primary != nil && primary.Email == "" {
+		v.fail("primary_attendee_id", "primary contact must have an email")
+	}
+	return v.err()
+}
+
+// UpdateHousehold validates req. primary is the attendee named as the new
+// contact, if any.
+func UpdateHousehold(req models.UpdateHouseholdRequest, primary *models.Attendee) error {
+	v := newValidator()
+	if req.Name != nil {
+		v.required("name", *req.Name)
+		v.maxLength("name", *req.Name, maxNameLength)
+	}
+	if primary != nil && primary.Email == "" {
+		v.fail("primary_attendee_id", "primary contact must have an email")
+	}
+	return v.err()
+}
+
+func HouseholdRSVP(req models.HouseholdRSVPRequest) error {
+	v := newValidator()
+	v.required("status", req.Status)
+	if req.Status != "" {
+		v.oneOf("status", req.Status, AttendeeStatuses)
+	}
+	return v.err()
+}
+
+// Meals
+
+// eventInZone returns the event's start and end in its own time zone, which
+// decides the calendar days its meals can fall on
+func eventInZone(event models.Event) (time.Time, time.Time) {
+	loc, err := time.LoadLocation(event.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return event.StartTime.In(loc), event.EndTime.In(loc)
+}
+
+// CreateMeal validates req against the event the meal belongs to
+func CreateMeal(req models.CreateMealRequest, event models.Event) error {
+	v := newValidator()
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	v.required("meal_type", req.MealType)
+	if req.MealType != "" {
+		v.oneOf("meal_type", req.MealType, MealTypes)
+	}
+	if req.MealDate != nil {
+		start, end := eventInZone(event)
+		v.dateWithin("meal_date", *req.MealDate, start, end)
+	}
+	v.maxLength("notes", req.Notes, maxTextLength)
+	return v.err()
+}
+
+// UpdateMeal validates req against the event the meal belongs to
+func UpdateMeal(req models.UpdateMealRequest, event models.Event) error {
+	v := newValidator()
+	if req.Name != nil {
+		v.required("name", *req.Name)
+		v.maxLength("name", *req.Name, maxNameLength)
+	}
+	if req.MealType != nil {
+		v.oneOf("meal_type", *req.MealType, MealTypes)
+	}
+	if req.MealDate != nil {
+		start, end := eventInZone(event)
+		v.dateWithin("meal_date", *req.MealDate, start, end)
+	}
+	if req.Notes != nil {
+		v.maxLength("notes", *req.Notes, maxTextLength)
+	}
+	return v.err()
+}
+
+// MoveMeal validates where the meal would end up: its date, new or kept,
+// has to fall within the target event
+func MoveMeal(req models.MoveMealRequest, current models.Meal, target models.Event) error {
+	v := newValidator()
+	v.mealDestination(req.EventID, req.MealDate, current, target)
+	return v.err()
+}
+
+// CopyMeal validates where the copy would end up, as MoveMeal does
+func CopyMeal(req models.CopyMealRequest, source models.Meal, target models.Event) error {
+	v := newValidator()
+	v.mealDestination(req.EventID, req.MealDate, source, target)
+	return v.err()
+}
+
+// SwapMeals checks the two meals can trade places
+func SwapMeals(req models.SwapMealsRequest, first, second models.Meal) error {
+	v := newValidator()
+	v.required("other_meal_id", req.OtherMealID)
+	if first.ID == second.ID {
+		v.fail("other_meal_id", "must be a different meal")
+	} else if first.EventID != second.EventID {
+		v.fail("other_meal_id", "must be a meal of the same event")
+	}
+	return v.err()
+}
+
+// ReorderMealItems checks req lists each of the meal's items exactly once
+func ReorderMealItems(req models.ReorderMealItemsRequest, items []models.MealItem) error {
+	v := newValidator()
+	current := make(map[string]bool, len(items))
+	for _, item := range items {
+		current[item.ID] = true
+	}
+	seen := make(map[string]bool, len(req.ItemIDs))
+	for _, id := range req.ItemIDs {
+		switch {
+		case !current[id]:
+			v.fail("item_ids", fmt.Sprintf("%q is not an item of this meal", id))
+		case seen[id]:
+			v.fail("item_ids", fmt.Sprintf("%q is listed more than once", id))
+		}
+		seen[id] = true
+	}
+	if len(seen) < len(current) {
+		v.fail("item_ids", "must list every item of the meal")
+	}
+	return v.err()
+}
+
+// mealDestination checks that a meal moved or copied to target keeps a date
+// within it. The meal keeps its current date when none is given.
+func (v *validator) mealDestination(eventID, mealDate *string, meal models.Meal, target models.Event) {
+	if eventID != nil {
+		v.required("event_id", *eventID)
+	}
+	date := meal.MealDate
+	if mealDate != nil {
+		date = mealDate
+	}
+	if date != nil {
+		start, end := eventInZone(target)
+		v.dateWithin("meal_date", *date, start, end)
+	}
+}
+
+func CreateMealItem(req models.CreateMealItemRequest) error {
+	v := newValidator()
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	v.positive("quantity", req.Quantity, false)
+	v.maxLength("unit", req.Unit, maxNameLength)
+	v.positive("assigned_quantity", req.AssignedQuantity, false)
+	v.maxLength("category", req.Category, maxTagLength)
+	if req.AssignedQuantity != nil && req.Quantity != nil && *req.AssignedQuantity > *req.Quantity {
+		v.fail("assigned_quantity", "must not be more than quantity")
+	}
+	v.tags("allergens", req.Allergens)
+	v.tags("diet_tags", req.DietTags)
+	return v.err()
+}
+
+func UpdateMealItem(req models.UpdateMealItemRequest) error {
+	v := newValidator()
+	if req.Name != nil {
+		v.required("name", *req.Name)
+		v.maxLength("name", *req.Name, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	v.positive("quantity", req.Quantity, true)
+	if req.Unit != nil {
+		v.maxLength("unit", *req.Unit, maxNameLength)
+	}
+	v.positive("assigned_quantity", req.AssignedQuantity, true)
+	if req.Category != nil {
+		v.maxLength("category", *req.Category, maxTagLength)
+	}
+	if req.Allergens != nil {
+		v.tags("allergens", *req.Allergens)
+	}
+	if req.DietTags != nil {
+		v.tags("diet_tags", *req.DietTags)
+	}
+	return v.err()
+}
+
+func CreateMealSignup(req models.CreateMealSignupRequest) error {
+	v := newValidator()
+	v.positive("quantity", req.Quantity, false)
+	v.maxLength("notes", req.Notes, maxTextLength)
+	return v.err()
+}
+
+func UpdateMealSignup(req models.UpdateMealSignupRequest) error {
+	v := newValidator()
+	v.positive("quantity", req.Quantity, false)
+	if req.Notes != nil {
+		v.maxLength("notes", *req.Notes, maxTextLength)
+	}
+	return v.err()
+}
+
+// SetMealAttendance validates an attendance answer. requireAttendees is set
+// when the answer is for named attendees rather than the current user.
+func SetMealAttendance(req models.SetMealAttendanceRequest, requireAttendees bool) error {
+	v := newValidator()
+	v.required("status", req.Status)
+	if req.Status != "" {
+		v.oneOf("status", req.Status, MealAttendances)
+	}
+	if requireAttendees && len(req.AttendeeIDs) == 0 {
+		v.fail("attendee_ids", "is required")
+	}
+	for _, id := range req.AttendeeIDs {
+		if id == "" {
+			v.fail("attendee_ids", "must not contain empty IDs")
+		}
+	}
+	return v.err()
+}
+
+func MarkPurchased(req models.MarkPurchasedRequest) error {
+	v := newValidator()
+	v.required("key", req.Key)
+	v.maxLength("key", req.Key, maxNameLength+maxTagLength)
+	return v.err()
+}
+
+// Recipes
+
+const maxRecipeServings = 1000
+
+func recipeIngredients(v *validator, ingredients []models.RecipeIngredient) {
+	for _, ing := range ingredients {
+		if strings.TrimSpace(ing.Name) == "" {
+			v.fail("ingredients", "every ingredient needs a name")
+		}
+		if ing.Quantity != nil && *ing.Quantity <= 0 {
+			v.fail("ingredients", "quantities must be greater than 0")
+		}
+		if len(ing.Name) > maxNameLength || len(ing.Unit) > maxTagLength || len(ing.Note) > maxNameLength ||
+			len(ing.Category) > maxTagLength {
+			v.fail("ingredients", "ingredient text is too long")
+		}
+	}
+}
+
+func recipeSteps(v *validator, steps []string) {
+	for _, step := range steps {
+		v.maxLength("steps", step, maxTextLength)
+	}
+}
+
+func CreateRecipe(req models.CreateRecipeRequest) error {
+	v := newValidator()
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	if req.Servings < 1 || req.Servings > maxRecipeServings {
+		v.fail("servings", fmt.Sprintf("must be between 1 and %d", maxRecipeServings))
+	}
+	recipeIngredients(v, req.Ingredients)
+	recipeSteps(v, req.Steps)
+	v.tags("tags", req.Tags)
+	v.maxLength("source_url", req.SourceURL, maxNameLength*5)
+	return v.err()
+}
+
+func UpdateRecipe(req models.UpdateRecipeRequest) error {
+	v := newValidator()
+	if req.Name != nil {
+		v.required("name", *req.Name)
+		v.maxLength("name", *req.Name, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	if req.Servings != nil && (*req.Servings < 1 || *req.Servings > maxRecipeServings) {
+		v.fail("servings", fmt.Sprintf("must be between 1 and %d", maxRecipeServings))
+	}
+	if req.Ingredients != nil {
+		recipeIngredients(v, *req.Ingredients)
+	}
+	if req.Steps != nil {
+		recipeSteps(v, *req.Steps)
+	}
+	if req.Tags != nil {
+		v.tags("tags", *req.Tags)
+	}
+	if req.SourceURL != nil {
+		v.maxLength("source_url", *req.SourceURL, maxNameLength*5)
+	}
+	return v.err()
+}
+
+// Lodging
+
+func CreateRoom(req models.CreateRoomRequest) error {
+	v := newValidator()
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	v.beds(req.Beds)
+	return v.err()
+}
+
+func UpdateRoom(req models.UpdateRoomRequest) error {
+	v := newValidator()
+	if req.Name != nil {
+		v.required("name", *req.Name)
+		v.maxLength("name", *req.Name, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	if req.Beds != nil {
+		v.beds(*req.Beds)
+	}
+	return v.err()
+}
+
+func (v *validator) beds(beds []models.Bed) {
+	for _, b := range beds {
+		v.oneOf("beds", b.BedType, BedTypes)
+		if b.Capacity < 1 {
+			v.fail("beds", "capacity must be at least 1")
+		}
+		v.maxLength("beds", b.Label, maxNameLength)
+	}
+}
+
+// AssignSleeping validates req against the nights the attendee is staying.
+// Nights aren't checked when stayNights is nil because the attendee is unknown.
+func AssignSleeping(req models.AssignSleepingRequest, stayNights []string) error {
+	v := newValidator()
+	v.required("attendee_id", req.AttendeeID)
+	v.required("room_id", req.RoomID)
+	if stayNights == nil {
+		return v.err()
+	}
+	staying := make(map[string]bool, len(stayNights))
+	for _, night := range stayNights {
+		staying[night] = true
+	}
+	if len(req.Nights) == 0 && len(stayNights) == 0 {
+		v.fail("nights", "attendee isn't staying overnight")
+	}
+	for _, night := range req.Nights {
+		if !staying[night] {
+			v.fail("nights", fmt.Sprintf("attendee isn't staying the night of %s", night))
+		}
+	}
+	return v.err()
+}
+
+// Carpools
+
+func CreateRide(req models.CreateRideRequest) error {
+	v := newValidator()
+	v.required("driver_attendee_id", req.DriverAttendeeID)
+	v.oneOf("direction", req.Direction, RideDirections)
+	v.maxLength("origin", req.Origin, maxNameLength)
+	v.requiredTime("departure_time", req.DepartureTime)
+	v.seats("seats", &req.Seats, true)
+	v.maxLength("notes", req.Notes, maxTextLength)
+	return v.err()
+}
+
+func UpdateRide(req models.UpdateRideRequest) error {
+	v := newValidator()
+	if req.Origin != nil {
+		v.maxLength("origin", *req.Origin, maxNameLength)
+	}
+	if req.DepartureTime != nil {
+		v.requiredTime("departure_time", *req.DepartureTime)
+	}
+	v.seats("seats", req.Seats, true)
+	if req.Notes != nil {
+		v.maxLength("notes", *req.Notes, maxTextLength)
+	}
+	return v.err()
+}
+
+func RideSeat(req models.RideSeatRequest) error {
+	v := newValidator()
+	v.required("attendee_id", req.AttendeeID)
+	v.seats("seats", req.Seats, false)
+	return v.err()
+}
+
+func UpdateRidePassenger(req models.UpdateRidePassengerRequest) error {
+	v := newValidator()
+	if req.Status != nil {
+		v.oneOf("status", *req.Status, PassengerStatuses)
+	}
+	v.seats("seats", req.Seats, false)
+	return v.err()
+}
+
+// Activities
+
+func CreateActivity(req models.CreateActivityRequest) error {
+	v := newValidator()
+	v.required("title", req.Title)
+	v.maxLength("title", req.Title, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	v.maxLength("location", req.Location, maxNameLength)
+	v.requiredTime("start_time", req.StartTime)
+	v.requiredTime("end_time", req.EndTime)
+	v.timeRange("start_time", req.StartTime, "end_time", req.EndTime)
+	v.seats("capacity", req.Capacity, false)
+	return v.err()
+}
+
+// UpdateActivity validates req as it would apply on top of the current activity
+func UpdateActivity(req models.UpdateActivityRequest, current models.Activity) error {
+	v := newValidator()
+	if req.Title != nil {
+		v.required("title", *req.Title)
+		v.maxLength("title", *req.Title, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	if req.Location != nil {
+		v.maxLength("location", *req.Location, maxNameLength)
+	}
+
+	start, end := current.StartTime, current.EndTime
+	if req.StartTime != nil {
+		v.requiredTime("start_time", *req.StartTime)
+		start = *req.StartTime
+	}
+	if req.EndTime != nil {
+		v.requiredTime("end_time", *req.EndTime)
+		end = *req.EndTime
+	}
+	v.timeRange("start_time", start, "end_time", end)
+	v.seats("capacity", req.Capacity, true)
+	return v.err()
+}
+
+func ActivitySignup(req models.ActivitySignupRequest) error {
+	v := newValidator()
+	v.required("attendee_id", req.AttendeeID)
+	v.seats("people", req.People, false)
+	return v.err()
+}
+
+// Resources
+
+func CreateResource(req models.CreateResourceRequest) error {
+	v := newValidator()
+	v.required("name", req.Name)
+	v.maxLength("name", req.Name, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	v.seats("quantity", req.Quantity, false)
+	return v.err()
+}
+
+func UpdateResource(req models.UpdateResourceRequest) error {
+	v := newValidator()
+	if req.Name != nil {
+		v.required("name", *req.Name)
+		v.maxLength("name", *req.Name, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	v.seats("quantity", req.Quantity, false)
+	return v.err()
+}
+
+func CreateReservation(req models.CreateReservationRequest) error {
+	v := newValidator()
+	v.required("resource_id", req.ResourceID)
+	v.required("attendee_id", req.AttendeeID)
+	v.requiredTime("start_time", req.StartTime)
+	v.requiredTime("end_time", req.EndTime)
+	v.timeRange("start_time", req.StartTime, "end_time", req.EndTime)
+	v.seats("quantity", req.Quantity, false)
+	v.maxLength("notes", req.Notes, maxTextLength)
+	return v.err()
+}
+
+func ReviewReservation(req models.ReviewReservationRequest) error {
+	v := newValidator()
+	v.oneOf("status", req.Status, ReviewStatuses)
+	return v.err()
+}
+
+// Expenses
+
+func CreateExpense(req models.CreateExpenseRequest) error {
+	v := newValidator()
+	v.required("payer_attendee_id", req.PayerAttendeeID)
+	v.positive("amount", &req.Amount, false)
+	v.currency("currency", req.Currency)
+	v.maxLength("description", req.Description, maxTextLength)
+	if req.SplitRule != "" {
+		v.oneOf("split_rule", req.SplitRule, SplitRules)
+	}
+	if req.SplitRule == "custom" {
+		v.expenseShares(req.Shares)
+	}
+	return v.err()
+}
+
+// UpdateExpense validates req as it would apply on top of the current expense
+func UpdateExpense(req models.UpdateExpenseRequest, current models.Expense) error {
+	v := newValidator()
+	if req.PayerAttendeeID != nil {
+		v.required("payer_attendee_id", *req.PayerAttendeeID)
+	}
+	v.positive("amount", req.Amount, false)
+	if req.Currency != nil {
+		v.currency("currency", *req.Currency)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	rule := current.SplitRule
+	if req.SplitRule != nil {
+		v.oneOf("split_rule", *req.SplitRule, SplitRules)
+		rule = *req.SplitRule
+	}
+	if rule == "custom" {
+		shares := current.Shares
+		if req.Shares != nil {
+			shares = *req.Shares
+		}
+		v.expenseShares(shares)
+	}
+	return v.err()
+}
+
+// expenseShares checks the weights of a custom split
+func (v *validator) expenseShares(shares []models.ExpenseShare) {
+	if len(shares) == 0 {
+		v.fail("shares", "are required for a custom split")
+		return
+	}
+	seen := map[string]bool{}
+	for _, s := range shares {
+		switch {
+		case s.AttendeeID == "":
+			v.fail("shares", "each share needs an attendee_id")
+		case seen[s.AttendeeID]:
+			v.fail("shares", fmt.Sprintf("%q is listed more than once", s.AttendeeID))
+		case s.Shares <= 0:
+			v.fail("shares", "must be greater than 0")
+		}
+		seen[s.AttendeeID] = true
+	}
+}
+
+func CreateSettlement(req models.CreateSettlementRequest) error {
+	v := newValidator()
+	v.required("from_attendee_id", req.FromAttendeeID)
+	v.required("to_attendee_id", req.ToAttendeeID)
+	if req.FromAttendeeID != "" && req.FromAttendeeID == req.ToAttendeeID {
+		v.fail("to_attendee_id", "must be someone other than from_attendee_id")
+	}
+	v.positive("amount", &req.Amount, false)
+	v.currency("currency", req.Currency)
+	v.maxLength("note", req.Note, maxTextLength)
+	return v.err()
+}
+
+// Todos
+
+func CreateTodo(req models.CreateTodoRequest) error {
+	v := newValidator()
+	v.required("title", req.Title)
+	v.maxLength("title", req.Title, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	if req.Priority != "" {
+		v.oneOf("priority", req.Priority, TodoPriorities)
+	}
+	if req.Category != "" {
+		v.oneOf("category", req.Category, TodoCategories)
+	}
+	if req.DueAt != nil && req.DueOffsetMinutes != nil {
+		v.fail("due_offset_minutes", "cannot be combined with due_at")
+	}
+	todoSubtasks(v, req.Subtasks)
+	todoDependencies(v, req.DependsOn)
+	return v.err()
+}
+
+func UpdateTodo(req models.UpdateTodoRequest) error {
+	v := newValidator()
+	if req.Title != nil {
+		v.required("title", *req.Title)
+		v.maxLength("title", *req.Title, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	if req.Priority != nil {
+		v.oneOf("priority", *req.Priority, TodoPriorities)
+	}
+	if req.Category != nil && *req.Category != "" {
+		v.oneOf("category", *req.Category, TodoCategories)
+	}
+	if req.DueAt != nil && req.DueOffsetMinutes != nil {
+		v.fail("due_offset_minutes", "cannot be combined with due_at")
+	}
+	if req.ClearDue && (req.DueAt != nil || req.DueOffsetMinutes != nil) {
+		v.fail("clear_due", "cannot be combined with due_at or due_offset_minutes")
+	}
+	if req.Subtasks != nil {
+		todoSubtasks(v, *req.Subtasks)
+	}
+	if req.DependsOn != nil {
+		todoDependencies(v, *req.DependsOn)
+	}
+	return v.err()
+}
+
+// todoSubtasks checks each checklist entry has a title
+func todoSubtasks(v *validator, subtasks []models.TodoSubtask) {
+	for i, st := range subtasks {
+		field := fmt.Sprintf("subtasks[%d].title", i)
+		v.required(field, st.Title)
+		v.maxLength(field, st.Title, maxNameLength)
+	}
+}
+
+// todoDependencies checks each prerequisite is a todo ID
+func todoDependencies(v *validator, ids []string) {
+	for i, id := range ids {
+		v.required(fmt.Sprintf("depends_on[%d]", i), id)
+	}
+}
+
+// TodoFilter validates the filter and sort options for listing todos
+func TodoFilter(filter models.TodoFilter) error {
+	v := newValidator()
+	if filter.Priority != "" {
+		v.oneOf("priority", filter.Priority, TodoPriorities)
+	}
+	if filter.Category != "" {
+		v.oneOf("category", filter.Category, TodoCategories)
+	}
+	if filter.Checklist != "" {
+		v.oneOf("checklist", filter.Checklist, ChecklistPhases)
+	}
+	if filter.Sort != "" {
+		v.oneOf("sort", filter.Sort, TodoSorts)
+	}
+	return v.err()
+}
+
+// Chore assignment
+
+func UpdateChorePreferences(req models.UpdateChorePreferencesRequest) error {
+	v := newValidator()
+	v.tags("prefers", req.Prefers)
+	v.tags("avoids", req.Avoids)
+	return v.err()
+}
+
+func ApplyAssignments(req models.ApplyAssignmentsRequest) error {
+	v := newValidator()
+	if len(req.Assignments) == 0 {
+		v.fail("assignments", "is required")
+	}
+	for i, a := range req.Assignments {
+		field := fmt.Sprintf("assignments[%d]", i)
+		v.oneOf(field+".kind", a.Kind, ChoreKinds)
+		v.required(field+".id", a.ID)
+		v.required(field+".attendee_id", a.AttendeeID)
+	}
+	return v.err()
+}
+
+// Checklists
+
+func CreateChecklistItem(req models.CreateChecklistItemRequest) error {
+	v := newValidator()
+	v.oneOf("phase", req.Phase, ChecklistPhases)
+	v.required("title", req.Title)
+	v.maxLength("title", req.Title, maxNameLength)
+	v.maxLength("description", req.Description, maxTextLength)
+	if req.Priority != "" {
+		v.oneOf("priority", req.Priority, TodoPriorities)
+	}
+	v.seats("position", req.Position, true)
+	return v.err()
+}
+
+func UpdateChecklistItem(req models.UpdateChecklistItemRequest) error {
+	v := newValidator()
+	if req.Phase != nil {
+		v.oneOf("phase", *req.Phase, ChecklistPhases)
+	}
+	if req.Title != nil {
+		v.required("title", *req.Title)
+		v.maxLength("title", *req.Title, maxNameLength)
+	}
+	if req.Description != nil {
+		v.maxLength("description", *req.Description, maxTextLength)
+	}
+	if req.Priority != nil {
+		v.oneOf("priority", *req.Priority, TodoPriorities)
+	}
+	v.seats("position", req.Position, true)
+	return v.err()
+}
+
+// Comments
+
+// commentThread checks the thread a request points at; leaving both fields
+// empty means the event's own thread
+func commentThread(v *validator, entityType, entityID string) {
+	if entityType == "" && entityID == "" {
+		return
+	}
+	v.oneOf("entity_type", entityType, CommentTargets)
+	v.required("entity_id", entityID)
+}
+
+func CreateComment(req models.CreateCommentRequest) error {
+	v := newValidator()
+	commentThread(v, req.EntityType, req.EntityID)
+	if req.ParentID != nil {
+		v.required("parent_id", *req.ParentID)
+	}
+	v.required("body", req.Body)
+	v.maxLength("body", req.Body, maxTextLength)
+	return v.err()
+}
+
+func UpdateComment(req models.UpdateCommentRequest) error {
+	v := newValidator()
+	v.required("body", req.Body)
+	v.maxLength("body", req.Body, maxTextLength)
+	return v.err()
+}
+
+func MarkCommentsRead(req models.MarkCommentsReadRequest) error {
+	v := newValidator()
+	commentThread(v, req.EntityType, req.EntityID)
+	return v.err()
+}
+
+// Users
+
+func UpdateUserPermissions(req models.UpdateUserPermissionsRequest) error {
+	v := newValidator()
+	if req.CanCreateEvents == nil {
+		v.fail("can_create_events", "is required")
+	}
+	return v.err()
+}
+
+// UpdateDietaryProfile validates a user's own dietary profile
+func UpdateDietaryProfile(req models.DietaryProfile) error {
+	v := newValidator()
+	v.tags("restrictions", req.Restrictions)
+	v.tags("allergies", req.Allergies)
+	v.maxLength("notes", req.Notes, maxTextLength)
+	return v.err()
+}
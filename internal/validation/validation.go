@@ -0,0 +1,193 @@
+// Package validation checks API request models before they reach the
+// database and reports every invalid field at once.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DateLayout is the format used for calendar dates such as Meal.MealDate
+const DateLayout = "2006-01-02"
+
+// Field length limits
+const (
+	maxNameLength = 200
+	maxTextLength = 5000
+	maxTagLength  = 50
+	maxTags       = 30
+)
+
+// Error reports the invalid fields of a request, keyed by JSON field name
+type Error struct {
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " " + e.Fields[name]
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// validator collects field errors, keeping the first message for each field
+type validator struct {
+	fields map[string]string
+}
+
+func newValidator() *validator {
+	return &validator{fields: map[string]string{}}
+}
+
+func (v *validator) fail(field, message string) {
+	if _, ok := v.fields[field]; !ok {
+		v.fields[field] = message
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &Error{Fields: v.fields}
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.fail(field, "is required")
+	}
+}
+
+func (v *validator) maxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		v.fail(field, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(field, "must be one of: "+strings.Join(allowed, ", "))
+}
+
+func (v *validator) email(field, value string) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		v.fail(field, "must be a valid email address")
+	}
+}
+
+func (v *validator) requiredTime(field string, value time.Time) {
+	if value.IsZero() {
+		v.fail(field, "is required")
+	}
+}
+
+// timeRange checks that end is after start
+func (v *validator) timeRange(startField string, start time.Time, endField string, end time.Time) {
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		v.fail(endField, "must be after "+startField)
+	}
+}
+
+// tags checks a list of free-form labels such as allergens or diets
+func (v *validator) tags(field string, values []string) {
+	if len(values) > maxTags {
+		v.fail(field, fmt.Sprintf("must have at most %d entries", maxTags))
+		return
+	}
+	for _, value := range values {
+		if utf8.RuneCountInString(strings.TrimSpace(value)) > maxTagLength {
+			v.fail(field, fmt.Sprintf("entries must be at most %d characters", maxTagLength))
+			return
+		}
+	}
+}
+
+// positive checks an optional amount. allowZero permits 0 where it means
+// "clear this value".
+func (v *validator) positive(field string, value *float64, allowZero bool) {
+	if value == nil {
+		return
+	}
+	if *value < 0 || (*value == 0 && !allowZero) {
+		v.fail(field, "must be greater than 0")
+	}
+}
+
+// seats checks an optional count of seats or people. allowZero permits 0,
+// e.g. a car with no spare seats or an activity with no limit.
+func (v *validator) seats(field string, value *int, allowZero bool) {
+	switch {
+	case value == nil:
+	case allowZero && *value < 0:
+		v.fail(field, "cannot be negative")
+	case !allowZero && *value < 1:
+		v.fail(field, "must be at least 1")
+	}
+}
+
+// currency checks an optional ISO 4217 currency code such as "USD"
+func (v *validator) currency(field, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if len(value) != 3 || strings.Trim(strings.ToUpper(value), "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		v.fail(field, "must be a 3-letter currency code")
+	}
+}
+
+// partySize checks the adults and children an attendee row stands for
+func (v *validator) partySize(adults, children int) {
+	if adults < 0 {
+		v.fail("adults", "must not be negative")
+	}
+	if children < 0 {
+		v.fail("children", "must not be negative")
+	}
+	if adults+children < 1 {
+		v.fail("adults", "party must have at least one person")
+	}
+}
+
+// timeZone checks an IANA time zone name such as "America/Chicago". The
+// server's own zone ("Local") isn't accepted, since it can change under the
+// event.
+func (v *validator) timeZone(field, value string) {
+	if value == "Local" {
+		v.fail(field, "must be an IANA time zone name")
+		return
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		v.fail(field, "must be an IANA time zone name")
+	}
+}
+
+// dateWithin checks that value is a YYYY-MM-DD date between the calendar
+// days of start and end, inclusive
+func (v *validator) dateWithin(field, value string, start, end time.Time) {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		v.fail(field, "must be a date in YYYY-MM-DD format")
+		return
+	}
+	day := date.Format(DateLayout)
+	if day < start.Format(DateLayout) || day > end.Format(DateLayout) {
+		v.fail(field, fmt.Sprintf("must be between %s and %s", start.Format(DateLayout), end.Format(DateLayout)))
+	}
+}
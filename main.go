@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -38,6 +39,9 @@ func main() {
 	}
 	log.Println("Database migrations completed")
 
+	// Purge trashed rows past the retention period
+	go purgeTrash(ctx, database, trashRetention())
+
 	// Setup handlers
 	h := handlers.New(database)
 	authHandler := auth.NewHandler(database)
@@ -67,45 +71,206 @@ func main() {
 		r.Route("/admin", func(r chi.Router) {
 			r.Get("/users", h.ListUsers)
 			r.Put("/users/{userId}", h.UpdateUserPermissions)
+			r.Get("/audit", h.ListAuditLog)
+		})
+
+		// Current user's profile
+		r.Get("/profile/dietary", h.GetMyDietaryProfile)
+		r.Put("/profile/dietary", h.UpdateMyDietaryProfile)
+		r.Get("/profile/stats", h.GetMyStats)
+
+		// Contribution stats and the yearly report
+		r.Route("/stats", func(r chi.Router) {
+			r.Get("/users", h.ListUserStats)
+			r.Get("/users/{userId}", h.GetUserStats)
+			r.Get("/yearly", h.GetYearlyReport)
+		})
+
+		// Shared recipe library
+		r.Route("/recipes", func(r chi.Router) {
+			r.Get("/", h.ListRecipes)
+			r.Post("/", h.CreateRecipe)
+			r.Post("/import", h.ImportRecipe)
+			r.Get("/{recipeId}", h.GetRecipe)
+			r.Put("/{recipeId}", h.UpdateRecipe)
+			r.Delete("/{recipeId}", h.DeleteRecipe)
+			r.Get("/{recipeId}/scaled", h.ScaleRecipe)
+		})
+
+		// The property's rooms and beds
+		r.Route("/rooms", func(r chi.Router) {
+			r.Get("/", h.ListRooms)
+			r.Post("/", h.CreateRoom)
+			r.Get("/{roomId}", h.GetRoom)
+			r.Put("/{roomId}", h.UpdateRoom)
+			r.Delete("/{roomId}", h.DeleteRoom)
+		})
+
+		// Shared equipment and its reservations across events
+		r.Route("/resources", func(r chi.Router) {
+			r.Get("/", h.ListResources)
+			r.Post("/", h.CreateResource)
+			r.Get("/{resourceId}", h.GetResource)
+			r.Put("/{resourceId}", h.UpdateResource)
+			r.Delete("/{resourceId}", h.DeleteResource)
+			r.Get("/{resourceId}/calendar", h.GetResourceCalendar)
+		})
+		r.Put("/reservations/{reservationId}/review", h.ReviewReservation)
+
+		// Standing opening and closing checklists
+		r.Route("/checklists", func(r chi.Router) {
+			r.Get("/", h.ListChecklistItems)
+			r.Post("/", h.CreateChecklistItem)
+			r.Get("/history", h.GetChecklistHistory)
+			r.Post("/propagate", h.PropagateChecklists)
+			r.Get("/{itemId}", h.GetChecklistItem)
+			r.Put("/{itemId}", h.UpdateChecklistItem)
+			r.Delete("/{itemId}", h.DeleteChecklistItem)
+		})
+
+		// Farm availability and requests for dates
+		r.Get("/availability", h.GetAvailability)
+		r.Route("/booking-requests", func(r chi.Router) {
+			r.Get("/", h.ListBookingRequests)
+			r.Post("/", h.CreateBookingRequest)
+			r.Get("/{requestId}", h.GetBookingRequest)
+			r.Delete("/{requestId}", h.DeleteBookingRequest)
+			r.Put("/{requestId}/review", h.ReviewBookingRequest)
 		})
 
 		// Events
 		r.Route("/events", func(r chi.Router) {
 			r.Get("/", h.ListEvents)
 			r.Post("/", h.CreateEvent)
+			r.Get("/trash", h.ListDeletedEvents)
 			r.Route("/{id}", func(r chi.Router) {
 				r.Get("/", h.GetEventWithAll)
 				r.Put("/", h.UpdateEvent)
 				r.Delete("/", h.DeleteEvent)
+				r.Get("/history", h.GetEventHistory)
+				r.Get("/stats", h.GetEventStats)
+				r.Get("/changes", h.GetEventChanges)
+
+				// Comment threads on the event and its meals, items and todos
+				r.Get("/comments", h.ListComments)
+				r.Post("/comments", h.CreateComment)
+				r.Get("/comments/unread", h.GetUnreadComments)
+				r.Post("/comments/read", h.MarkCommentsRead)
+				r.Put("/comments/{commentId}", h.UpdateComment)
+				r.Delete("/comments/{commentId}", h.DeleteComment)
+				r.Get("/trash", h.GetEventTrash)
+				r.Post("/restore", h.RestoreEvent)
 
 				// Attendees for an event
 				r.Get("/attendees", h.ListAttendees)
 				r.Post("/attendees", h.AddAttendee)
+				r.Get("/attendees/{attendeeId}", h.GetAttendee)
 				r.Put("/attendees/{attendeeId}", h.UpdateAttendee)
 				r.Delete("/attendees/{attendeeId}", h.RemoveAttendee)
+				r.Get("/attendees/{attendeeId}/chore-preferences", h.GetChorePreferences)
+				r.Put("/attendees/{attendeeId}/chore-preferences", h.UpdateChorePreferences)
+				r.Get("/occupancy", h.GetEventOccupancy)
+				r.Get("/dietary", h.GetEventDietary)
+				r.Get("/shopping-list", h.GetShoppingList)
+				r.Put("/shopping-list/purchased", h.MarkShoppingItemPurchased)
+
+				// Households grouping attendees
+				r.Get("/households", h.ListHouseholds)
+				r.Post("/households", h.CreateHousehold)
+				r.Get("/households/{householdId}", h.GetHousehold)
+				r.Put("/households/{householdId}", h.UpdateHousehold)
+				r.Delete("/households/{householdId}", h.DeleteHousehold)
+				r.Put("/households/{householdId}/rsvp", h.SetHouseholdRSVP)
 
 				// Meals for an event
 				r.Get("/meals", h.ListMeals)
 				r.Post("/meals", h.CreateMeal)
 				r.Route("/meals/{mealId}", func(r chi.Router) {
+					r.Get("/", h.GetMeal)
 					r.Put("/", h.UpdateMeal)
 					r.Delete("/", h.DeleteMeal)
+					r.Post("/restore", h.RestoreMeal)
+
+					// Moving meals around the plan
+					r.Post("/move", h.MoveMeal)
+					r.Post("/copy", h.CopyMeal)
+					r.Post("/swap", h.SwapMeals)
+					r.Put("/items/order", h.ReorderMealItems)
+
+					// Who is eating this meal
+					r.Get("/attendance", h.GetMealAttendance)
+					r.Put("/attendance", h.SetMealAttendance)
+					r.Put("/attendance/me", h.SetMyMealAttendance)
 
 					// Items for a meal
 					r.Post("/items", h.AddMealItem)
+					r.Get("/items/{itemId}", h.GetMealItem)
+					r.Get("/items/{itemId}/recipe", h.GetMealItemRecipe)
 					r.Put("/items/{itemId}", h.UpdateMealItem)
 					r.Delete("/items/{itemId}", h.DeleteMealItem)
+					r.Post("/items/{itemId}/restore", h.RestoreMealItem)
 
 					// Signups for an item
 					r.Post("/items/{itemId}/signup", h.SignupForItem)
+					r.Put("/items/{itemId}/signup", h.UpdateSignup)
 					r.Delete("/items/{itemId}/signup", h.RemoveSignup)
 				})
 
+				// Who sleeps where
+				r.Get("/lodging", h.GetEventLodging)
+				r.Post("/lodging/assignments", h.AssignSleeping)
+				r.Delete("/lodging/assignments/{assignmentId}", h.DeleteSleepingAssignment)
+
+				// Carpools
+				r.Get("/rides", h.ListRides)
+				r.Post("/rides", h.CreateRide)
+				r.Get("/rides/needs", h.GetRideNeeds)
+				r.Get("/rides/{rideId}", h.GetRide)
+				r.Put("/rides/{rideId}", h.UpdateRide)
+				r.Delete("/rides/{rideId}", h.DeleteRide)
+				r.Post("/rides/{rideId}/passengers", h.AddRidePassenger)
+				r.Put("/rides/{rideId}/passengers/{passengerId}", h.UpdateRidePassenger)
+				r.Delete("/rides/{rideId}/passengers/{passengerId}", h.DeleteRidePassenger)
+
+				// Activities and the day-by-day itinerary
+				r.Get("/activities", h.ListActivities)
+				r.Post("/activities", h.CreateActivity)
+				r.Get("/activities/{activityId}", h.GetActivity)
+				r.Put("/activities/{activityId}", h.UpdateActivity)
+				r.Delete("/activities/{activityId}", h.DeleteActivity)
+				r.Post("/activities/{activityId}/signups", h.SignUpForActivity)
+				r.Delete("/activities/{activityId}/signups/{signupId}", h.DeleteActivitySignup)
+				r.Get("/itinerary", h.GetItinerary)
+
+				// Equipment reservations
+				r.Get("/reservations", h.ListReservations)
+				r.Post("/reservations", h.CreateReservation)
+				r.Delete("/reservations/{reservationId}", h.DeleteReservation)
+
+				// Expenses and settling up
+				r.Get("/expenses", h.ListExpenses)
+				r.Post("/expenses", h.CreateExpense)
+				r.Get("/expenses/{expenseId}", h.GetExpense)
+				r.Put("/expenses/{expenseId}", h.UpdateExpense)
+				r.Delete("/expenses/{expenseId}", h.DeleteExpense)
+				r.Get("/balances", h.GetEventBalances)
+				r.Get("/settlements", h.ListSettlements)
+				r.Post("/settlements", h.CreateSettlement)
+				r.Delete("/settlements/{settlementId}", h.DeleteSettlement)
+
 				// Todos for an event
 				r.Get("/todos", h.ListTodos)
 				r.Post("/todos", h.CreateTodo)
+				r.Get("/todos/plan", h.GetTodoPlan)
+				r.Get("/todos/{todoId}", h.GetTodo)
 				r.Put("/todos/{todoId}", h.UpdateTodo)
 				r.Delete("/todos/{todoId}", h.DeleteTodo)
+				r.Post("/todos/{todoId}/restore", h.RestoreTodo)
+
+				// Sharing out chores
+				r.Get("/assignments/proposal", h.ProposeAssignments)
+				r.Post("/assignments/apply", h.ApplyAssignments)
+				r.Get("/assignments/log", h.GetAssignmentLog)
 			})
 		})
 	})
@@ -164,3 +329,40 @@ func main() {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// trashRetention reads how long deleted rows stay restorable from
+// TRASH_RETENTION_DAYS, defaulting to 30 days
+func trashRetention() time.Duration {
+	days := 30
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Printf("Invalid TRASH_RETENTION_DAYS %q, using %d", v, days)
+		} else {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// purgeTrash permanently deletes rows that have been in the trash longer
+// than the retention period, checking once an hour
+func purgeTrash(ctx context.Context, database *db.DB, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		purged, err := database.PurgeDeleted(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted rows from trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
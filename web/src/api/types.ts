@@ -5,8 +5,13 @@ export interface Event {
   location: string
   start_time: string
   end_time: string
+  time_zone: string
+  exclusive: boolean
+  created_by: string | null
+  version: number
   created_at: string
   updated_at: string
+  overlaps?: string[]
 }
 
 export interface Attendee {
@@ -15,6 +20,15 @@ export interface Attendee {
   name: string
   email: string
   status: 'attending' | 'maybe' | 'declined'
+  arrival_time: string
+  departure_time: string
+  household_id: string | null
+  adults: number
+  children: number
+  dietary_restrictions: string[]
+  allergies: string[]
+  dietary_notes: string
+  version: number
   created_at: string
   updated_at: string
 }
@@ -29,12 +43,54 @@ export interface CreateEventRequest {
   location: string
   start_time: string
   end_time: string
+  time_zone?: string
+  exclusive?: boolean
+}
+
+// Farm availability types
+export interface BookingRequest {
+  id: string
+  requested_by: string
+  requester_name: string
+  title: string
+  description: string
+  start_time: string
+  end_time: string
+  exclusive: boolean
+  status: 'pending' | 'approved' | 'denied'
+  event_id: string | null
+  review_note: string
+  reviewed_by: string | null
+  reviewed_at: string | null
+  created_at: string
+  updated_at: string
+}
+
+export interface CreateBookingRequestRequest {
+  title: string
+  description?: string
+  start_time: string
+  end_time: string
+  exclusive?: boolean
+}
+
+export interface Availability {
+  events: Event[]
+  booking_requests: BookingRequest[]
 }
 
 export interface CreateAttendeeRequest {
   name: string
   email: string
   status: 'attending' | 'maybe' | 'declined'
+  arrival_time?: string
+  departure_time?: string
+  household_id?: string
+  adults?: number
+  children?: number
+  dietary_restrictions?: string[]
+  allergies?: string[]
+  dietary_notes?: string
 }
 
 // Meal types
@@ -47,6 +103,7 @@ export interface Meal {
   meal_type: MealType
   meal_date: string | null
   notes: string
+  version: number
   created_at: string
   updated_at: string
 }
@@ -58,6 +115,16 @@ export interface MealItem {
   description: string
   assigned_attendee_id: string | null
   assigned_attendee_name: string | null
+  quantity: number | null
+  unit: string
+  assigned_quantity: number | null
+  host_buys: boolean
+  category: string
+  recipe_id: string | null
+  allergens: string[]
+  diet_tags: string[]
+  sort_order: number
+  version: number
   created_at: string
   updated_at: string
 }
@@ -68,15 +135,36 @@ export interface MealSignup {
   user_id: string
   user_name: string
   user_email: string
+  quantity: number | null
   notes: string
   created_at: string
 }
 
 export interface MealItemWithSignups extends MealItem {
+  covered: number
+  remaining: number | null
+  fully_covered: boolean
   signups: MealSignup[]
 }
 
+export interface MealAttendanceCounts {
+  in: number
+  out: number
+  unknown: number
+}
+
+export interface DietaryWarning {
+  attendee_id: string
+  attendee_name: string
+  meal_item_id: string
+  meal_item_name: string
+  allergen: string
+}
+
 export interface MealWithItems extends Meal {
+  expected_headcount: number
+  attendance: MealAttendanceCounts
+  dietary_warnings: DietaryWarning[]
   items: MealItemWithSignups[]
 }
 
@@ -91,17 +179,456 @@ export interface CreateMealRequest {
   notes?: string
 }
 
+export interface MoveMealRequest {
+  event_id?: string
+  meal_date?: string
+}
+
+export interface CopyMealRequest extends MoveMealRequest {
+  include_signups?: boolean
+}
+
+export interface SwapMealsRequest {
+  other_meal_id: string
+}
+
+export interface ReorderMealItemsRequest {
+  item_ids: string[]
+}
+
 export interface CreateMealItemRequest {
   name: string
   description?: string
   assigned_attendee_id?: string
+  quantity?: number
+  unit?: string
+  assigned_quantity?: number
+  host_buys?: boolean
+  category?: string
+  recipe_id?: string
+  allergens?: string[]
+  diet_tags?: string[]
 }
 
 export interface CreateMealSignupRequest {
+  quantity?: number
+  notes?: string
+}
+
+// Recipe types
+export interface RecipeIngredient {
+  quantity: number | null
+  unit: string
+  name: string
+  note: string
+  category: string
+}
+
+export interface Recipe {
+  id: string
+  name: string
+  description: string
+  servings: number
+  ingredients: RecipeIngredient[]
+  steps: string[]
+  tags: string[]
+  source_url: string
+  created_by: string | null
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface ScaledRecipe extends Recipe {
+  scaled_servings: number
+  factor: number
+}
+
+// Shopping list types
+export interface ShoppingListSource {
+  meal_id: string
+  meal_name: string
+  meal_date: string | null
+  meal_item_id: string
+  recipe_id?: string
+  quantity: number | null
+  unit: string
+}
+
+export interface ShoppingListItem {
+  key: string
+  name: string
+  quantity: number | null
+  unit: string
+  category: string
+  sources: ShoppingListSource[]
+  purchased: boolean
+  purchased_by: string | null
+  purchased_by_name: string | null
+  purchased_at: string | null
+}
+
+export interface ShoppingList {
+  event_id: string
+  event_title: string
+  categories: { category: string; items: ShoppingListItem[] }[]
+}
+
+// Lodging types
+export type BedType =
+  | 'king'
+  | 'queen'
+  | 'double'
+  | 'twin'
+  | 'bunk'
+  | 'sofa_bed'
+  | 'air_mattress'
+  | 'crib'
+  | 'tent'
+  | 'other'
+
+export interface Bed {
+  bed_type: BedType
+  capacity: number
+  label: string
+}
+
+export interface Room {
+  id: string
+  name: string
+  description: string
+  beds: Bed[]
+  capacity: number
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface CreateRoomRequest {
+  name: string
+  description?: string
+  beds?: Bed[]
+}
+
+export interface SleepingAssignment {
+  id: string
+  event_id: string
+  attendee_id: string
+  attendee_name: string
+  party_size: number
+  room_id: string
+  room_name: string
+  night: string
+  created_by: string | null
+  created_at: string
+}
+
+export interface AssignSleepingRequest {
+  attendee_id: string
+  room_id: string
+  nights?: string[]
+  replace?: boolean
+}
+
+export interface NightLodging {
+  night: string
+  rooms: {
+    room_id: string
+    room_name: string
+    capacity: number
+    occupied: number
+    over_capacity: boolean
+    occupants: SleepingAssignment[]
+  }[]
+  unassigned: { attendee_id: string; attendee_name: string; party_size: number }[]
+  warnings: { attendee_id?: string; attendee_name?: string; room_id?: string; message: string }[]
+}
+
+// Carpool types
+export type RideDirection = 'to_farm' | 'home'
+
+export interface Ride {
+  id: string
+  event_id: string
+  driver_attendee_id: string
+  driver_name: string
+  direction: RideDirection
+  origin: string
+  departure_time: string
+  seats: number
+  notes: string
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface RidePassenger {
+  id: string
+  ride_id: string
+  attendee_id: string
+  attendee_name: string
+  seats: number
+  status: 'requested' | 'confirmed'
+  created_at: string
+}
+
+export interface RideWithPassengers extends Ride {
+  passengers: RidePassenger[]
+  seats_taken: number
+  seats_left: number
+}
+
+export interface CreateRideRequest {
+  driver_attendee_id: string
+  direction: RideDirection
+  origin?: string
+  departure_time: string
+  seats: number
+  notes?: string
+}
+
+export interface RideSeatRequest {
+  attendee_id: string
+  seats?: number
+  request?: boolean
+}
+
+export interface RideNeed {
+  attendee_id: string
+  attendee_name: string
+  party_size: number
+  direction: RideDirection
+  requested: boolean
+}
+
+// Activity and itinerary types
+export interface Activity {
+  id: string
+  event_id: string
+  title: string
+  description: string
+  location: string
+  leader_attendee_id: string | null
+  leader_name: string | null
+  start_time: string
+  end_time: string
+  capacity: number | null
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface ActivitySignup {
+  id: string
+  activity_id: string
+  attendee_id: string
+  attendee_name: string
+  people: number
+  created_at: string
+}
+
+export interface MealOverlap {
+  meal_id: string
+  meal_name: string
+  meal_type: MealType
+  start: string
+  end: string
+}
+
+export interface ActivityWithSignups extends Activity {
+  signups: ActivitySignup[]
+  signed_up: number
+  spots_left: number | null
+  meal_overlaps: MealOverlap[]
+}
+
+export interface CreateActivityRequest {
+  title: string
+  description?: string
+  location?: string
+  leader_attendee_id?: string | null
+  start_time: string
+  end_time: string
+  capacity?: number | null
+}
+
+export interface ItineraryEntry {
+  kind: 'meal' | 'activity' | 'todo'
+  id: string
+  title: string
+  start: string
+  end?: string
+  all_day: boolean
+  location?: string
+  detail?: string
+}
+
+export interface Itinerary {
+  event_id: string
+  days: { date: string; entries: ItineraryEntry[] }[]
+  unscheduled: ItineraryEntry[]
+}
+
+// Equipment and reservation types
+export interface Resource {
+  id: string
+  name: string
+  description: string
+  quantity: number
+  requires_approval: boolean
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface CreateResourceRequest {
+  name: string
+  description?: string
+  quantity?: number
+  requires_approval?: boolean
+}
+
+export type ReservationStatus = 'pending' | 'approved' | 'denied'
+
+export interface Reservation {
+  id: string
+  resource_id: string
+  resource_name: string
+  event_id: string
+  event_title: string
+  attendee_id: string
+  attendee_name: string
+  start_time: string
+  end_time: string
+  quantity: number
+  status: ReservationStatus
+  notes: string
+  created_by: string | null
+  reviewed_by: string | null
+  reviewed_at: string | null
+  created_at: string
+}
+
+export interface CreateReservationRequest {
+  resource_id: string
+  attendee_id: string
+  start_time: string
+  end_time: string
+  quantity?: number
   notes?: string
 }
 
+export interface ResourceCalendar {
+  resource: Resource
+  reservations: Reservation[]
+}
+
+// Expense types
+export type SplitRule = 'equal' | 'household' | 'nights' | 'custom'
+
+export interface ExpenseShare {
+  attendee_id: string
+  attendee_name?: string
+  shares: number
+}
+
+export interface ExpenseSplit {
+  attendee_id: string
+  attendee_name: string
+  amount: number
+}
+
+export interface Expense {
+  id: string
+  event_id: string
+  payer_attendee_id: string
+  payer_name: string
+  amount: number
+  currency: string
+  description: string
+  meal_item_id: string | null
+  todo_id: string | null
+  split_rule: SplitRule
+  shares: ExpenseShare[]
+  split: ExpenseSplit[]
+  created_by: string | null
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface CreateExpenseRequest {
+  payer_attendee_id: string
+  amount: number
+  currency?: string
+  description?: string
+  meal_item_id?: string
+  todo_id?: string
+  split_rule?: SplitRule
+  shares?: ExpenseShare[]
+}
+
+export interface Settlement {
+  id: string
+  event_id: string
+  from_attendee_id: string
+  from_name: string
+  to_attendee_id: string
+  to_name: string
+  amount: number
+  currency: string
+  note: string
+  created_by: string | null
+  paid_at: string
+}
+
+export interface CreateSettlementRequest {
+  from_attendee_id: string
+  to_attendee_id: string
+  amount: number
+  currency?: string
+  note?: string
+}
+
+export interface AttendeeBalance {
+  attendee_id: string
+  attendee_name: string
+  paid: number
+  owed: number
+  sent: number
+  received: number
+  net: number
+}
+
+export interface SettleUpTransfer {
+  from_attendee_id: string
+  from_name: string
+  to_attendee_id: string
+  to_name: string
+  amount: number
+  currency: string
+}
+
+export interface EventBalances {
+  event_id: string
+  currencies: {
+    currency: string
+    total: number
+    balances: AttendeeBalance[]
+    transfers: SettleUpTransfer[]
+  }[]
+  settlements: Settlement[]
+}
+
 // Todo types
+export type TodoPriority = 'low' | 'normal' | 'high' | 'urgent'
+export type TodoCategory = 'before_arrival' | 'on_site' | 'closing_up' | ''
+
+export interface TodoSubtask {
+  title: string
+  done: boolean
+}
+
 export interface Todo {
   id: string
   event_id: string
@@ -110,6 +637,19 @@ export interface Todo {
   completed: boolean
   assigned_attendee_id: string | null
   assigned_attendee_name: string | null
+  due_at: string | null
+  due_offset_minutes: number | null
+  priority: TodoPriority
+  category: TodoCategory
+  subtasks: TodoSubtask[]
+  depends_on: string[]
+  blocked: boolean
+  checklist_item_id: string | null
+  checklist: ChecklistPhase | ''
+  completed_at: string | null
+  completed_by: string | null
+  completed_by_name: string | null
+  version: number
   created_at: string
   updated_at: string
 }
@@ -118,6 +658,12 @@ export interface CreateTodoRequest {
   title: string
   description?: string
   assigned_attendee_id?: string
+  due_at?: string
+  due_offset_minutes?: number
+  priority?: TodoPriority
+  category?: TodoCategory
+  subtasks?: TodoSubtask[]
+  depends_on?: string[]
 }
 
 export interface UpdateTodoRequest {
@@ -125,12 +671,280 @@ export interface UpdateTodoRequest {
   description?: string
   completed?: boolean
   assigned_attendee_id?: string
+  due_at?: string
+  due_offset_minutes?: number
+  clear_due?: boolean
+  priority?: TodoPriority
+  category?: TodoCategory
+  subtasks?: TodoSubtask[]
+  depends_on?: string[]
+  override?: boolean
+}
+
+export interface TodoPlan {
+  ready: Todo[]
+  blocked: Todo[]
+}
+
+// Chore assignment types
+export type ChoreKind = 'todo' | 'meal_item'
+
+export interface ChorePreferences {
+  attendee_id: string
+  prefers: string[]
+  avoids: string[]
+  exempt: boolean
+}
+
+export interface UpdateChorePreferencesRequest {
+  prefers: string[]
+  avoids: string[]
+  exempt: boolean
+}
+
+export interface ProposedAssignment {
+  kind: ChoreKind
+  id: string
+  title: string
+  attendee_id: string
+  attendee_name: string
+  reason: string
+}
+
+export interface UnassignedChore {
+  kind: ChoreKind
+  id: string
+  title: string
+  reason: string
+}
+
+export interface AttendeeWorkload {
+  attendee_id: string
+  attendee_name: string
+  past_events: number
+  past_average: number
+  current: number
+  proposed: number
+}
+
+export interface AssignmentProposal {
+  event_id: string
+  assignments: ProposedAssignment[]
+  unassigned: UnassignedChore[]
+  workload: AttendeeWorkload[]
+}
+
+export interface ApplyAssignmentsRequest {
+  assignments: ProposedAssignment[]
+}
+
+export interface AssignmentLogEntry {
+  id: string
+  event_id: string
+  kind: ChoreKind
+  entity_id: string
+  title: string
+  attendee_id: string | null
+  attendee_name: string
+  reason: string
+  applied_by: string | null
+  applied_by_name: string | null
+  created_at: string
+}
+
+export interface AssignmentResult {
+  applied: AssignmentLogEntry[]
+  skipped: ProposedAssignment[]
+}
+
+// Checklist types
+export type ChecklistPhase = 'arrival' | 'departure'
+
+export interface ChecklistItem {
+  id: string
+  phase: ChecklistPhase
+  title: string
+  description: string
+  priority: TodoPriority
+  position: number
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface CreateChecklistItemRequest {
+  phase: ChecklistPhase
+  title: string
+  description?: string
+  priority?: TodoPriority
+  position?: number
+}
+
+export interface UpdateChecklistItemRequest {
+  phase?: ChecklistPhase
+  title?: string
+  description?: string
+  priority?: TodoPriority
+  position?: number
+}
+
+export interface ChecklistPropagation {
+  events: number
+  added: number
+  updated: number
+  removed: number
+  skipped: number
+}
+
+export interface ChecklistRun {
+  event_id: string
+  event_title: string
+  start_time: string
+  end_time: string
+  total: number
+  completed: number
+  todos: Todo[]
+}
+
+export interface Household {
+  id: string
+  event_id: string
+  name: string
+  primary_attendee_id: string | null
+  version: number
+  created_at: string
+  updated_at: string
+}
+
+export interface HouseholdWithMembers extends Household {
+  members: Attendee[]
+  adults: number
+  children: number
 }
 
 export interface EventWithAll extends EventWithMeals {
+  households: HouseholdWithMembers[]
+  rides: RideWithPassengers[]
+  reservations: Reservation[]
   todos: Todo[]
 }
 
+// Stats types
+export interface UserStats {
+  user_id: string
+  name: string
+  events_attended: number
+  meals_signed_up: number
+  items_brought: number
+  todos_completed: number
+  nights_stayed: number
+}
+
+export interface EventStats {
+  event_id: string
+  title: string
+  start_time: string
+  end_time: string
+  attendees: number
+  headcount: number
+  person_nights: number
+  meal_items: number
+  covered_items: number
+  coverage: number
+  todos: number
+  completed_todos: number
+  todo_completion: number
+}
+
+export interface YearlyReport {
+  year: number
+  events: number
+  people: number
+  headcount: number
+  person_nights: number
+  meal_items: number
+  covered_items: number
+  coverage: number
+  todos: number
+  completed_todos: number
+  todo_completion: number
+  event_stats: EventStats[]
+  top_contributors: UserStats[]
+}
+
+// Comment types
+export type CommentTarget = 'event' | 'meal' | 'meal_item' | 'todo'
+
+export interface CommentMention {
+  attendee_id: string
+  name: string
+}
+
+export interface Comment {
+  id: string
+  event_id: string
+  entity_type: CommentTarget
+  entity_id: string
+  parent_id: string | null
+  author_id: string | null
+  author_name: string | null
+  body: string
+  mentions: CommentMention[]
+  unread: boolean
+  version: number
+  created_at: string
+  updated_at: string
+  edited_at?: string
+  deleted_at?: string
+  replies?: Comment[]
+}
+
+export interface CommentThread {
+  entity_type: CommentTarget
+  entity_id: string
+  comments: Comment[]
+  unread: number
+}
+
+export interface CreateCommentRequest {
+  entity_type?: CommentTarget
+  entity_id?: string
+  parent_id?: string
+  body: string
+}
+
+export interface UpdateCommentRequest {
+  body: string
+}
+
+export interface MarkCommentsReadRequest {
+  entity_type?: CommentTarget
+  entity_id?: string
+}
+
+export interface UnreadComments {
+  entity_type: CommentTarget
+  entity_id: string
+  unread: number
+  mentions: number
+  latest_at: string
+}
+
+// Change feed types
+export interface Change {
+  id: string
+  action: string
+  entity_type: string
+  entity_id: string
+  created_at: string
+}
+
+export interface ChangeFeed {
+  changes: Change[]
+  cursor: string
+  more: boolean
+}
+
 // User types (for admin)
 export interface User {
   id: string
@@ -139,6 +953,9 @@ export interface User {
   picture: string
   is_admin: boolean
   can_create_events: boolean
+  dietary_restrictions: string[]
+  allergies: string[]
+  dietary_notes: string
   created_at: string
   updated_at: string
 }